@@ -3,12 +3,16 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,57 +21,194 @@ import (
 	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/config"
 	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/repository"
 	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/service"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
+const defaultConfigPath = "./config/metrics.toml"
+
 func main() {
+	configFlag := flag.String("config", "", "path to the metrics configuration file (overrides CONFIG_PATH)")
+	validateFlag := flag.Bool("validate", false, "validate the configuration and exit without opening the database")
+	flag.Parse()
+	configPath := resolveConfigPath(*configFlag)
+
+	if *validateFlag {
+		os.Exit(validateConfig(configPath))
+	}
+
 	// Setup logging first so all startup messages are logged
 	logger := setupLogging()
-	logger.Info("Starting metrics API server")
+	build := version.Get()
+	logger.Info("Starting metrics API server", "version", build.Version, "commit", build.Commit, "built", build.Built)
+
+	shutdownTracing, err := setupTracing(context.Background(), logger)
+	if err != nil {
+		logger.Error("Failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
 
 	// Load environment and configuration
-	port, dbPath := loadEnvironment(logger)
-	metrics, err := config.LoadConfig("./config/metrics.toml")
+	env := loadEnvironment(logger)
+	logger.Info("Loading configuration", "path", configPath)
+	cfg, err := config.Load(configPath)
 	if err != nil {
 		logger.Error("Failed to load configuration", "error", err)
 		os.Exit(1)
 	}
 
 	// Initialize repository (database)
-	repo, err := repository.NewSQLiteRepository(dbPath)
+	if len(cfg.Attach) > 0 && env.dbDriver != "sqlite" {
+		logger.Error("Failed to initialize database", "error", "attach requires DB_DRIVER=sqlite", "driver", env.dbDriver)
+		os.Exit(1)
+	}
+	repo, err := openRepository(env.dbDriver, env.dbPath, cfg.Attach, env)
 	if err != nil {
 		logger.Error("Failed to initialize database", "error", err)
 		os.Exit(1)
 	}
 	defer repo.Close()
 
+	// Additional data sources share the primary database's pool settings
+	dataSources := make(map[string]repository.Repository, len(cfg.DataSources))
+	for _, source := range cfg.DataSources {
+		sourceRepo, err := openRepository(source.Driver, source.DSN, source.Attach, env)
+		if err != nil {
+			logger.Error("Failed to initialize data source", "data_source", source.Name, "error", err)
+			os.Exit(1)
+		}
+		defer sourceRepo.Close()
+		dataSources[source.Name] = sourceRepo
+		logger.Info("Data source connected", "data_source", source.Name, "driver", source.Driver)
+	}
+
+	auditLogger, closeAudit, err := openAuditLog(env.auditLog)
+	if err != nil {
+		logger.Error("Failed to open audit log", "error", err)
+		os.Exit(1)
+	}
+	defer closeAudit()
+	if auditLogger != nil {
+		logger.Info("Audit log enabled", "path", env.auditLog)
+	}
+
 	// Wire up dependencies: repository -> service -> handlers -> router
-	svc := service.NewMetricService(repo, metrics, logger)
-	h := handlers.NewMetricsHandler(svc, logger)
-	router := api.NewRouter(h, logger)
+	svc := service.NewMetricService(repo, cfg.Metrics, logger, service.Options{
+		MaxRows:        env.maxResultRows,
+		MaxConcurrency: env.maxConcurrency,
+		Retries:        env.queryRetries,
+		RetryDelay:     env.queryRetryDelay,
+		MetricTimeout:  env.metricTimeout,
+		StrictParams:   env.strictParams,
+		DataSources:    dataSources,
+		AuditLogger:    auditLogger,
+		DefaultParams:  cfg.Defaults.Params,
+	})
+	if env.validateOnStart {
+		validateQueries(svc, logger)
+	}
+
+	// Precompute metrics that set refresh_interval; shutdown waits for an
+	// in-flight refresh so it never queries a closed database
+	refreshCtx, stopRefresh := context.WithCancel(context.Background())
+	refreshDone := make(chan struct{})
+	go func() {
+		svc.RunRefresh(refreshCtx)
+		close(refreshDone)
+	}()
+
+	// Ping every database in the background so /healthz notices connections
+	// that die while the server is idle
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	handlerOpts := handlers.Options{MaxMetrics: env.maxMetrics}
+	if env.health.Interval > 0 {
+		targets := map[string]repository.Pinger{"primary": repo}
+		for name, sourceRepo := range dataSources {
+			targets["data_sources."+name] = sourceRepo
+		}
+		checker := repository.NewHealthChecker(targets, logger, env.health)
+		go checker.Run(healthCtx)
+		handlerOpts.Unhealthy = checker.Unhealthy
+	}
+
+	// Scoped keys come from the config file and, like data sources, are only
+	// read at startup
+	scopedKeys := make(map[string][]string, len(cfg.APIKeys))
+	for _, key := range cfg.APIKeys {
+		scopedKeys[key.Key] = key.Scopes
+	}
+	if len(env.apiKeys) > 0 || len(scopedKeys) > 0 {
+		logger.Info("API key authentication enabled", "keys", len(env.apiKeys), "scoped_keys", len(scopedKeys))
+	} else {
+		logger.Info("No API keys configured, authentication disabled")
+	}
+
+	// Requests are cancelled shortly before the write timeout, so raising
+	// SERVER_WRITE_TIMEOUT gives slow metrics longer too
+	requestTimeout := api.RequestTimeout(env.writeTimeout)
+
+	h := handlers.NewMetricsHandler(svc, logger, handlerOpts)
+	router := api.NewRouter(h, logger, api.Options{
+		APIKeys:         env.apiKeys,
+		ScopedAPIKeys:   scopedKeys,
+		CORSOrigins:     env.corsOrigins,
+		MaxBodyBytes:    env.maxBodyBytes,
+		RateLimit:       env.rateLimit,
+		RateBurst:       env.rateBurst,
+		SecurityHeaders: env.securityHeaders,
+		RequestTimeout:  requestTimeout,
+		SensitiveParam:  svc.IsSensitiveParam,
+	})
 
 	// Setup HTTP server
 	srv := &http.Server{
-		Addr:           fmt.Sprintf(":%d", port),
+		Addr:           fmt.Sprintf(":%d", env.port),
 		Handler:        router,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   30 * time.Second,
-		IdleTimeout:    60 * time.Second,
+		ReadTimeout:    env.readTimeout,
+		WriteTimeout:   env.writeTimeout,
+		IdleTimeout:    env.idleTimeout,
 		MaxHeaderBytes: 1 << 20, // 1 MB
 	}
+	logger.Info("HTTP server timeouts", "read", env.readTimeout, "write", env.writeTimeout, "idle", env.idleTimeout, "request", requestTimeout)
+
+	// Bind before starting the server goroutine so an unusable port or
+	// socket path fails startup instead of a background error
+	listener, err := listen(env, srv.Addr)
+	if err != nil {
+		logger.Error("Failed to listen", "error", err)
+		os.Exit(1)
+	}
 
 	// Start server in a goroutine
 	go func() {
-		logger.Info("HTTP server listening", "address", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if env.tlsCertFile != "" {
+			logger.Info("HTTPS server listening", "address", listener.Addr().String())
+			err = srv.ServeTLS(listener, env.tlsCertFile, env.tlsKeyFile)
+		} else {
+			logger.Info("HTTP server listening", "address", listener.Addr().String())
+			err = srv.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error("Server error", "error", err)
 			os.Exit(1)
 		}
 	}()
 
-	// Wait for shutdown signal
+	// Reload configuration on SIGHUP until a shutdown signal arrives
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	sig := <-sigChan
+	for sig == syscall.SIGHUP {
+		reloadConfig(svc, configPath, logger)
+		sig = <-sigChan
+	}
 	logger.Info("Received signal, shutting down", "signal", sig.String())
 
 	// Graceful shutdown with timeout
@@ -78,41 +219,451 @@ func main() {
 		logger.Error("Error during server shutdown", "error", err)
 		os.Exit(1)
 	}
+	stopRefresh()
+	<-refreshDone
+	// Flush spans still buffered for export
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("Error flushing traces", "error", err)
+	}
 
 	logger.Info("Server stopped gracefully")
 }
 
-// setupLogging configures slog with JSON output format.
+// validateConfig loads the configuration as startup would and reports the
+// result as plain text for CI, returning the process exit code. It reads no
+// other environment settings, so it never touches the database or network.
+func validateConfig(configPath string) int {
+	metrics, err := config.LoadConfig(configPath)
+	if err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", configPath, line)
+		}
+		return 1
+	}
+
+	fmt.Printf("%s: OK, %d metrics\n", configPath, len(metrics))
+	return 0
+}
+
+// validateQueries probes every metric's query against the database and
+// exits if any fail, listing each failing metric.
+func validateQueries(svc *service.MetricService, logger *slog.Logger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	logger.Info("Validating metric queries against the database")
+	if err := svc.ValidateQueries(ctx); err != nil {
+		for _, line := range strings.Split(err.Error(), "\n") {
+			logger.Error("Metric query failed validation", "error", line)
+		}
+		os.Exit(1)
+	}
+	logger.Info("All metric queries validated")
+}
+
+// reloadConfig re-reads the metrics configuration and swaps its metrics and
+// default params into the service. An invalid file is logged and the
+// running configuration kept.
+func reloadConfig(svc *service.MetricService, configPath string, logger *slog.Logger) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		logger.Error("Failed to reload configuration, keeping current metrics", "path", configPath, "error", err)
+		return
+	}
+
+	svc.Reload(cfg.Metrics, cfg.Defaults.Params)
+	logger.Info("Configuration reloaded", "metrics", len(cfg.Metrics), "default_params", len(cfg.Defaults.Params))
+}
+
+// resolveConfigPath picks the configuration file: the -config flag, then
+// CONFIG_PATH, then the default.
+func resolveConfigPath(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if path := os.Getenv("CONFIG_PATH"); path != "" {
+		return path
+	}
+	return defaultConfigPath
+}
+
+// openAuditLog returns a JSON logger for audit records written to path, or
+// to stdout when path is "stdout", and a function to close it. An empty path
+// disables auditing and returns a nil logger.
+func openAuditLog(path string) (*slog.Logger, func(), error) {
+	switch path {
+	case "":
+		return nil, func() {}, nil
+	case "stdout":
+		return slog.New(slog.NewJSONHandler(os.Stdout, nil)), func() {}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return slog.New(slog.NewJSONHandler(f, nil)), func() { f.Close() }, nil
+}
+
+// setupTracing installs the W3C trace context propagator, so incoming
+// traceparent headers are honoured, and an OTLP/HTTP span exporter when
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set.
+// Without an endpoint spans are never recorded. The exporter and SDK read
+// the rest of their settings, such as OTEL_SERVICE_NAME and
+// OTEL_TRACES_SAMPLER, from the standard OTEL_* variables. The returned
+// function flushes and stops the exporter.
+func setupTracing(ctx context.Context, logger *slog.Logger) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		logger.Debug("OTEL_EXPORTER_OTLP_ENDPOINT not set, tracing disabled")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Attributes from the environment override the default service name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "personal-dashboard-backend")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	logger.Info("Tracing enabled, exporting spans over OTLP/HTTP")
+	return provider.Shutdown, nil
+}
+
+// setupLogging configures slog from LOG_LEVEL and LOG_FORMAT. Logging is
+// needed to report anything else, so invalid values fall back to info and
+// JSON with a warning instead of exiting.
 func setupLogging() *slog.Logger {
+	levelValue := os.Getenv("LOG_LEVEL")
+	level := slog.LevelInfo
+	var levelErr error
+	if levelValue != "" {
+		if levelErr = level.UnmarshalText([]byte(levelValue)); levelErr != nil {
+			level = slog.LevelInfo
+		}
+	}
+
 	opts := &slog.HandlerOptions{
-		Level: slog.LevelInfo,
+		Level: level,
 	}
-	handler := slog.NewJSONHandler(os.Stdout, opts)
+
+	formatValue := os.Getenv("LOG_FORMAT")
+	var handler slog.Handler
+	if formatValue == "text" {
+		handler = slog.NewTextHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	}
+
 	logger := slog.New(handler)
 	slog.SetDefault(logger)
+
+	if levelErr != nil {
+		logger.Warn("Invalid LOG_LEVEL value, using info", "value", levelValue, "error", levelErr)
+	}
+	if formatValue != "" && formatValue != "json" && formatValue != "text" {
+		logger.Warn("Invalid LOG_FORMAT value, using json", "value", formatValue)
+	}
 	return logger
 }
 
-// loadEnvironment reads PORT and DB_PATH from environment or .env file with defaults.
-func loadEnvironment(logger *slog.Logger) (port int, dbPath string) {
+// environment holds the settings read from environment variables.
+type environment struct {
+	port        int
+	dbDriver    string
+	dbPath      string
+	apiKeys     []string
+	corsOrigins []string
+
+	securityHeaders bool
+
+	maxBodyBytes  int64
+	maxMetrics    int
+	maxResultRows int
+	readOnly      bool
+	pool          repository.PoolOptions
+	health        repository.HealthOptions
+
+	sqliteJournalMode string
+	sqliteBusyTimeout time.Duration
+
+	maxConcurrency int
+
+	queryRetries    int
+	queryRetryDelay time.Duration
+	metricTimeout   time.Duration
+
+	strictParams bool
+
+	auditLog string
+
+	rateLimit float64
+	rateBurst int
+
+	tlsCertFile string
+	tlsKeyFile  string
+
+	listenSocket string
+
+	validateOnStart bool
+
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+	idleTimeout  time.Duration
+}
+
+// loadEnvironment reads server settings from environment variables, applying defaults.
+func loadEnvironment(logger *slog.Logger) environment {
+	var env environment
+
 	// PORT
-	portStr := os.Getenv("PORT")
-	if portStr == "" {
-		portStr = "8080"
-		logger.Debug("PORT not set, using default", "port", portStr)
+	env.port = intEnv(logger, "PORT", 8080)
+
+	// DB_DRIVER
+	env.dbDriver = os.Getenv("DB_DRIVER")
+	if env.dbDriver == "" {
+		env.dbDriver = "sqlite"
+		logger.Debug("DB_DRIVER not set, using default", "driver", env.dbDriver)
+	}
+
+	// DB_PATH
+	env.dbPath = os.Getenv("DB_PATH")
+	if env.dbPath == "" {
+		env.dbPath = "./data.db"
+		logger.Debug("DB_PATH not set, using default", "path", env.dbPath)
+	}
+
+	// API_KEYS (comma-separated); with no scoped api_keys in the config
+	// either, authentication is disabled
+	env.apiKeys = splitList(os.Getenv("API_KEYS"))
+
+	// CORS_ORIGINS (comma-separated)
+	env.corsOrigins = splitList(os.Getenv("CORS_ORIGINS"))
+	if len(env.corsOrigins) == 0 {
+		env.corsOrigins = []string{"*"}
+		logger.Debug("CORS_ORIGINS not set, allowing all origins")
+	}
+
+	// SECURITY_HEADERS; on unless a proxy in front sets its own
+	env.securityHeaders = boolEnv(logger, "SECURITY_HEADERS", true)
+
+	// MAX_BODY_BYTES, MAX_METRICS_PER_REQUEST and MAX_RESULT_ROWS; 0 disables the limit
+	env.maxBodyBytes = int64(intEnv(logger, "MAX_BODY_BYTES", 1<<20))
+	env.maxMetrics = intEnv(logger, "MAX_METRICS_PER_REQUEST", 50)
+	env.maxResultRows = intEnv(logger, "MAX_RESULT_ROWS", 100000)
+
+	// DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME and
+	// DB_CONN_MAX_IDLE_TIME; 0 uses the repository defaults, or a single
+	// connection for in-memory SQLite
+	env.pool = repository.PoolOptions{
+		MaxOpenConns:    intEnv(logger, "DB_MAX_OPEN_CONNS", 0),
+		MaxIdleConns:    intEnv(logger, "DB_MAX_IDLE_CONNS", 0),
+		ConnMaxLifetime: durationEnv(logger, "DB_CONN_MAX_LIFETIME", 0),
+		ConnMaxIdleTime: durationEnv(logger, "DB_CONN_MAX_IDLE_TIME", 0),
 	}
-	port, err := strconv.Atoi(portStr)
+
+	// HEALTH_CHECK_INTERVAL and HEALTH_CHECK_THRESHOLD; an interval of 0
+	// disables background pings, leaving /healthz always healthy
+	env.health = repository.HealthOptions{
+		Interval:  durationEnv(logger, "HEALTH_CHECK_INTERVAL", repository.DefaultHealthInterval),
+		Threshold: intEnv(logger, "HEALTH_CHECK_THRESHOLD", repository.DefaultHealthThreshold),
+	}
+
+	// MAX_CONCURRENT_QUERIES; defaults to the pool size so one batch request
+	// cannot queue on connections other requests need
+	defaultConcurrency := env.pool.MaxOpenConns
+	if defaultConcurrency == 0 {
+		defaultConcurrency = repository.DefaultMaxOpenConns
+	}
+	env.maxConcurrency = intEnv(logger, "MAX_CONCURRENT_QUERIES", defaultConcurrency)
+
+	// QUERY_RETRIES and QUERY_RETRY_DELAY; only lock and connection errors are retried
+	env.queryRetries = intEnv(logger, "QUERY_RETRIES", 2)
+	env.queryRetryDelay = durationEnv(logger, "QUERY_RETRY_DELAY", 100*time.Millisecond)
+
+	// VALIDATE_ON_START; probe every query against the database before serving
+	env.validateOnStart = boolEnv(logger, "VALIDATE_ON_START", false)
+
+	// METRIC_TIMEOUT; below the request timeout (SERVER_WRITE_TIMEOUT less
+	// 5s) so a partial batch can still respond with the metrics that finished
+	env.metricTimeout = durationEnv(logger, "METRIC_TIMEOUT", 20*time.Second)
+
+	// STRICT_PARAMS; reject params no requested metric declares
+	env.strictParams = boolEnv(logger, "STRICT_PARAMS", false)
+
+	// AUDIT_LOG; a file to append audit records to, or "stdout"
+	env.auditLog = os.Getenv("AUDIT_LOG")
+
+	// RATE_LIMIT_RPS and RATE_LIMIT_BURST; rate limiting is disabled when unset
+	env.rateLimit = floatEnv(logger, "RATE_LIMIT_RPS", 0)
+	if env.rateLimit > 0 {
+		env.rateBurst = intEnv(logger, "RATE_LIMIT_BURST", max(1, int(math.Ceil(env.rateLimit))))
+		logger.Info("Rate limiting enabled", "rps", env.rateLimit, "burst", env.rateBurst)
+	}
+
+	// READ_ONLY; only SQLite can enforce this on the connection
+	env.readOnly = boolEnv(logger, "READ_ONLY", false)
+	if env.readOnly && env.dbDriver != "sqlite" {
+		logger.Warn("READ_ONLY is only enforced for sqlite; use a read-only database user instead", "driver", env.dbDriver)
+	}
+
+	// DB_JOURNAL_MODE and DB_BUSY_TIMEOUT; SQLite only, empty or 0 uses the
+	// repository defaults (WAL, 5s)
+	env.sqliteJournalMode = os.Getenv("DB_JOURNAL_MODE")
+	env.sqliteBusyTimeout = durationEnv(logger, "DB_BUSY_TIMEOUT", 0)
+
+	// SERVER_READ_TIMEOUT, SERVER_WRITE_TIMEOUT and SERVER_IDLE_TIMEOUT; with
+	// http.Server's meaning of 0 (no limit, or the read timeout for idle)
+	env.readTimeout = durationEnv(logger, "SERVER_READ_TIMEOUT", 10*time.Second)
+	env.writeTimeout = durationEnv(logger, "SERVER_WRITE_TIMEOUT", 30*time.Second)
+	env.idleTimeout = durationEnv(logger, "SERVER_IDLE_TIMEOUT", 60*time.Second)
+
+	// LISTEN_SOCKET; a UNIX socket path used instead of PORT when set
+	env.listenSocket = os.Getenv("LISTEN_SOCKET")
+
+	// TLS_CERT_FILE and TLS_KEY_FILE; the server speaks plain HTTP unless both are set
+	env.tlsCertFile = os.Getenv("TLS_CERT_FILE")
+	env.tlsKeyFile = os.Getenv("TLS_KEY_FILE")
+	if (env.tlsCertFile == "") != (env.tlsKeyFile == "") {
+		logger.Error("TLS_CERT_FILE and TLS_KEY_FILE must be set together", "cert_file", env.tlsCertFile, "key_file", env.tlsKeyFile)
+		os.Exit(1)
+	}
+
+	return env
+}
+
+// intEnv reads a non-negative integer environment variable, returning def
+// when it is unset. An invalid value is fatal.
+func intEnv(logger *slog.Logger, name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		logger.Debug(name+" not set, using default", "value", def)
+		return def
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		logger.Error("Invalid "+name+" value", "value", value, "error", err)
+		os.Exit(1)
+	}
+	return n
+}
+
+// floatEnv reads a non-negative number environment variable, returning def
+// when it is unset. An invalid value is fatal.
+func floatEnv(logger *slog.Logger, name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		logger.Debug(name+" not set, using default", "value", def)
+		return def
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		logger.Error("Invalid "+name+" value", "value", value, "error", err)
+		os.Exit(1)
+	}
+	return f
+}
+
+// durationEnv reads a non-negative duration environment variable such as
+// "5m", returning def when it is unset. An invalid value is fatal.
+func durationEnv(logger *slog.Logger, name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		logger.Debug(name+" not set, using default", "value", def)
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		logger.Error("Invalid "+name+" value", "value", value, "error", err)
+		os.Exit(1)
+	}
+	return d
+}
+
+// boolEnv reads a boolean environment variable, returning def when it is
+// unset. An invalid value is fatal.
+func boolEnv(logger *slog.Logger, name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		logger.Debug(name+" not set, using default", "value", def)
+		return def
+	}
+
+	b, err := strconv.ParseBool(value)
 	if err != nil {
-		logger.Error("Invalid PORT value", "value", portStr, "error", err)
+		logger.Error("Invalid "+name+" value", "value", value, "error", err)
 		os.Exit(1)
 	}
+	return b
+}
 
-	// DB_PATH
-	dbPath = os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./data.db"
-		logger.Debug("DB_PATH not set, using default", "path", dbPath)
+// splitList splits a comma-separated value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// listen opens the server's listener: a UNIX socket when LISTEN_SOCKET is
+// set, otherwise TCP on addr. A socket file left behind by a crashed run is
+// removed first; the listener removes its own file when the server shuts down.
+func listen(env environment, addr string) (net.Listener, error) {
+	if env.listenSocket == "" {
+		return net.Listen("tcp", addr)
+	}
+
+	if info, err := os.Lstat(env.listenSocket); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("LISTEN_SOCKET %q exists and is not a socket", env.listenSocket)
+		}
+		// A socket that accepts connections belongs to a running server
+		if conn, err := net.Dial("unix", env.listenSocket); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("LISTEN_SOCKET %q is in use by another process", env.listenSocket)
+		}
+		if err := os.Remove(env.listenSocket); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
 	}
 
-	return port, dbPath
+	return net.Listen("unix", env.listenSocket)
+}
+
+// openRepository creates the repository for a database driver. For sqlite
+// the dsn is a file path; for postgres and mysql it is a connection string.
+// Attachments apply only to sqlite, which config validation enforces.
+func openRepository(driver, dsn string, attach map[string]string, env environment) (repository.Repository, error) {
+	switch driver {
+	case "sqlite":
+		return repository.NewSQLiteRepository(dsn, repository.SQLiteOptions{
+			ReadOnly:    env.readOnly,
+			JournalMode: env.sqliteJournalMode,
+			BusyTimeout: env.sqliteBusyTimeout,
+			Pool:        env.pool,
+			Attach:      attach,
+		})
+	case "postgres":
+		return repository.NewPostgresRepository(dsn, env.pool)
+	case "mysql":
+		return repository.NewMySQLRepository(dsn, env.pool)
+	default:
+		return nil, fmt.Errorf("unsupported driver %q (expected sqlite, postgres or mysql)", driver)
+	}
 }
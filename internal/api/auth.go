@@ -0,0 +1,74 @@
+// API key authentication middleware.
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/api/handlers"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/service"
+)
+
+// apiKeyMiddleware rejects requests that don't present one of keys or of
+// scoped's keys, either as "Authorization: Bearer <key>" or in the X-API-Key
+// header. A scoped key's requests are limited to the scopes it maps to.
+func apiKeyMiddleware(keys []string, scoped map[string][]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			presented := requestAPIKey(r)
+			if presented == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				handlers.WriteError(w, handlers.CodeUnauthorized, "missing API key")
+				return
+			}
+
+			if validAPIKey(keys, presented) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			scopes, ok := scopedAPIKey(scoped, presented)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				handlers.WriteError(w, handlers.CodeUnauthorized, "invalid API key")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(service.WithScopes(r.Context(), scopes)))
+		})
+	}
+}
+
+// requestAPIKey extracts the key from the Authorization or X-API-Key header.
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// validAPIKey compares against every configured key in constant time so
+// response timing doesn't reveal how much of a key matched.
+func validAPIKey(keys []string, presented string) bool {
+	valid := 0
+	for _, key := range keys {
+		valid |= subtle.ConstantTimeCompare([]byte(key), []byte(presented))
+	}
+	return valid == 1
+}
+
+// scopedAPIKey returns the scopes of the scoped key matching presented,
+// comparing against every key in constant time as validAPIKey does.
+func scopedAPIKey(scoped map[string][]string, presented string) ([]string, bool) {
+	var scopes []string
+	found := false
+	for key, granted := range scoped {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(presented)) == 1 {
+			scopes, found = granted, true
+		}
+	}
+	return scopes, found
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/api/handlers"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/service"
+)
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	keys := []string{"key-one", "key-two"}
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "valid bearer token",
+			headers:        map[string]string{"Authorization": "Bearer key-one"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "bearer scheme is case-insensitive",
+			headers:        map[string]string{"Authorization": "bearer key-two"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "valid X-API-Key header",
+			headers:        map[string]string{"X-API-Key": "key-two"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid key",
+			headers:        map[string]string{"Authorization": "Bearer wrong"},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid API key",
+		},
+		{
+			name:           "prefix of a valid key",
+			headers:        map[string]string{"X-API-Key": "key-on"},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid API key",
+		},
+		{
+			name:           "missing key",
+			headers:        nil,
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "missing API key",
+		},
+		{
+			name:           "non-bearer authorization scheme",
+			headers:        map[string]string{"Authorization": "Basic a2V5LW9uZQ=="},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "missing API key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := apiKeyMiddleware(keys, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.expectedStatus)
+			}
+
+			if tt.expectedStatus != http.StatusUnauthorized {
+				return
+			}
+
+			if w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", w.Header().Get("Content-Type"))
+			}
+			if w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+
+			var body struct {
+				Error handlers.APIError `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to unmarshal error response: %v", err)
+			}
+			if body.Error.Code != handlers.CodeUnauthorized {
+				t.Errorf("code = %q, want %q", body.Error.Code, handlers.CodeUnauthorized)
+			}
+			if body.Error.Message != tt.expectedError {
+				t.Errorf("message = %q, want %q", body.Error.Message, tt.expectedError)
+			}
+		})
+	}
+}
+
+func TestAPIKeyMiddleware_Scoped(t *testing.T) {
+	// Schemas of single-value metrics need no query, so the service can
+	// check scopes without a database.
+	svc := service.NewMetricService(nil, []models.Metric{
+		{Name: "revenue", Query: "SELECT 1", Scopes: []string{"sales"}},
+		{Name: "user_emails", Query: "SELECT 1", Scopes: []string{"pii"}},
+		{Name: "uptime", Query: "SELECT 1"},
+	}, nil, service.Options{})
+
+	handler := apiKeyMiddleware([]string{"admin"}, map[string][]string{"sales-key": {"sales"}, "public-key": nil})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := svc.GetMetricSchema(r.Context(), r.URL.Query().Get("metric"))
+			switch {
+			case errors.Is(err, service.ErrForbidden):
+				w.WriteHeader(http.StatusForbidden)
+			case err != nil:
+				t.Errorf("GetMetricSchema() error = %v", err)
+			}
+		}))
+
+	tests := []struct {
+		key    string
+		metric string
+		want   int
+	}{
+		{key: "sales-key", metric: "revenue", want: http.StatusOK},
+		{key: "sales-key", metric: "user_emails", want: http.StatusForbidden},
+		{key: "sales-key", metric: "uptime", want: http.StatusOK},
+		{key: "public-key", metric: "revenue", want: http.StatusForbidden},
+		{key: "public-key", metric: "uptime", want: http.StatusOK},
+		{key: "admin", metric: "user_emails", want: http.StatusOK},
+		{key: "sales", metric: "revenue", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key+" "+tt.metric, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/?metric="+tt.metric, nil)
+			req.Header.Set("X-API-Key", tt.key)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRouter_ScopedCatalog(t *testing.T) {
+	svc := service.NewMetricService(nil, []models.Metric{
+		{Name: "revenue", Query: "SELECT 1", Scopes: []string{"sales"}},
+		{Name: "user_emails", Query: "SELECT 1", Scopes: []string{"pii"}},
+	}, nil, service.Options{})
+	logger := slog.New(slog.DiscardHandler)
+	router := NewRouter(handlers.NewMetricsHandler(svc, logger, handlers.Options{}), logger,
+		Options{ScopedAPIKeys: map[string][]string{"sales-key": {"sales"}}})
+
+	for _, path := range []string{"/metrics", "/openapi.json"} {
+		t.Run(path, func(t *testing.T) {
+			req := httptest.NewRequest("GET", path, nil)
+			req.Header.Set("X-API-Key", "sales-key")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			if body := w.Body.String(); !strings.Contains(body, "revenue") || strings.Contains(body, "user_emails") {
+				t.Errorf("body = %s, want revenue listed without user_emails", body)
+			}
+		})
+	}
+}
+
+func TestNewRouter_AuthDisabledWithoutKeys(t *testing.T) {
+	router := newTestRouter(t, Options{})
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 with auth disabled", w.Code)
+	}
+}
+
+func TestNewRouter_HealthBypassesAuth(t *testing.T) {
+	router := newTestRouter(t, Options{APIKeys: []string{"secret"}})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("/healthz status = %d, want 200 without a key", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/version", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("/version status = %d, want 401 without a key", w.Code)
+	}
+}
@@ -0,0 +1,76 @@
+// CORS middleware with a configurable list of allowed origins.
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/api/handlers"
+)
+
+const (
+	corsAllowedMethods = "GET, HEAD, POST, OPTIONS"
+	corsAllowedHeaders = "Authorization, Content-Type, X-API-Key"
+	corsMaxAge         = 10 * time.Minute
+)
+
+// corsMiddleware adds CORS headers for requests from allowed origins and
+// answers preflight requests directly.
+//
+// With the wildcard origin "*" any site may read responses but credentials
+// are never allowed. With an explicit list, only matching origins are echoed
+// back (never the wildcard) and credentials are permitted, since the
+// operator has named exactly who to trust.
+func corsMiddleware(origins []string) func(http.Handler) http.Handler {
+	allowAll := false
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		if origin == "*" {
+			allowAll = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+
+			originAllowed := allowAll || allowed[origin]
+			if originAllowed {
+				if allowAll {
+					h.Set("Access-Control-Allow-Origin", "*")
+				} else {
+					h.Set("Access-Control-Allow-Origin", origin)
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+			}
+
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// Preflight request
+			if !originAllowed {
+				handlers.WriteError(w, handlers.CodeOriginNotAllowed, "origin not allowed")
+				return
+			}
+
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			h.Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(corsMaxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	tests := []struct {
+		name            string
+		origins         []string
+		method          string
+		origin          string
+		preflight       bool
+		expectedStatus  int
+		wantAllowOrigin string
+		wantCredentials bool
+	}{
+		{
+			name:            "wildcard allows any origin without credentials",
+			origins:         []string{"*"},
+			method:          "GET",
+			origin:          "https://evil.example",
+			expectedStatus:  http.StatusOK,
+			wantAllowOrigin: "*",
+		},
+		{
+			name:            "listed origin is echoed with credentials",
+			origins:         []string{"https://dash.example", "https://admin.example"},
+			method:          "GET",
+			origin:          "https://admin.example",
+			expectedStatus:  http.StatusOK,
+			wantAllowOrigin: "https://admin.example",
+			wantCredentials: true,
+		},
+		{
+			name:            "unlisted origin is not reflected",
+			origins:         []string{"https://dash.example"},
+			method:          "GET",
+			origin:          "https://evil.example",
+			expectedStatus:  http.StatusOK,
+			wantAllowOrigin: "",
+		},
+		{
+			name:            "no origin header is untouched",
+			origins:         []string{"*"},
+			method:          "GET",
+			expectedStatus:  http.StatusOK,
+			wantAllowOrigin: "",
+		},
+		{
+			name:            "preflight from allowed origin",
+			origins:         []string{"https://dash.example"},
+			method:          "OPTIONS",
+			origin:          "https://dash.example",
+			preflight:       true,
+			expectedStatus:  http.StatusNoContent,
+			wantAllowOrigin: "https://dash.example",
+			wantCredentials: true,
+		},
+		{
+			name:           "preflight from disallowed origin",
+			origins:        []string{"https://dash.example"},
+			method:         "OPTIONS",
+			origin:         "https://evil.example",
+			preflight:      true,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:            "plain OPTIONS is passed through",
+			origins:         []string{"*"},
+			method:          "OPTIONS",
+			origin:          "https://dash.example",
+			expectedStatus:  http.StatusOK,
+			wantAllowOrigin: "*",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := corsMiddleware(tt.origins)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(tt.method, "/metrics", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", "GET")
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.expectedStatus)
+			}
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllowOrigin)
+			}
+
+			gotCredentials := w.Header().Get("Access-Control-Allow-Credentials") == "true"
+			if gotCredentials != tt.wantCredentials {
+				t.Errorf("credentials allowed = %v, want %v", gotCredentials, tt.wantCredentials)
+			}
+
+			if tt.preflight && tt.expectedStatus == http.StatusNoContent {
+				if w.Header().Get("Access-Control-Allow-Methods") == "" {
+					t.Error("preflight response missing Access-Control-Allow-Methods")
+				}
+				if w.Header().Get("Access-Control-Allow-Headers") == "" {
+					t.Error("preflight response missing Access-Control-Allow-Headers")
+				}
+			}
+		})
+	}
+}
+
+func TestNewRouter_PreflightBypassesAuth(t *testing.T) {
+	router := newTestRouter(t, Options{
+		APIKeys:     []string{"secret"},
+		CORSOrigins: []string{"https://dash.example"},
+	})
+
+	req := httptest.NewRequest("OPTIONS", "/metrics", nil)
+	req.Header.Set("Origin", "https://dash.example")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	req.Header.Set("Access-Control-Request-Headers", "Authorization")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("preflight status = %d, want 204 without credentials", w.Code)
+	}
+}
@@ -0,0 +1,112 @@
+// ETag middleware that answers matching conditional GETs with 304 Not Modified.
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// etagMiddleware buffers successful GET responses, tags them with a hash of
+// the body and returns 304 when the client's If-None-Match already holds it.
+// The tag is weak because gzipMiddleware may change the encoding of an
+// otherwise identical representation.
+func etagMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ew := &etagResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(ew, r)
+		ew.finish(r)
+	})
+}
+
+// etagResponseWriter holds the status and body until the handler returns,
+// since the tag can only be computed over the complete body.
+type etagResponseWriter struct {
+	http.ResponseWriter
+	statusCode    int
+	headerWritten bool
+	buf           []byte
+	streaming     bool
+}
+
+func (e *etagResponseWriter) WriteHeader(code int) {
+	if e.headerWritten {
+		return
+	}
+	e.statusCode = code
+	e.headerWritten = true
+}
+
+func (e *etagResponseWriter) Write(p []byte) (int, error) {
+	if e.streaming {
+		return e.ResponseWriter.Write(p)
+	}
+	e.headerWritten = true
+	e.buf = append(e.buf, p...)
+	return len(p), nil
+}
+
+// Flush gives up on tagging the response: a handler that flushes is
+// streaming, so what is buffered so far is sent and later writes pass
+// straight through.
+func (e *etagResponseWriter) Flush() {
+	if !e.streaming {
+		e.streaming = true
+		e.headerWritten = true
+		e.ResponseWriter.WriteHeader(e.statusCode)
+		if len(e.buf) > 0 {
+			e.ResponseWriter.Write(e.buf)
+			e.buf = nil
+		}
+	}
+	http.NewResponseController(e.ResponseWriter).Flush()
+}
+
+// finish writes the buffered response, or 304 with no body when it matches.
+func (e *etagResponseWriter) finish(r *http.Request) {
+	if e.streaming {
+		return
+	}
+	h := e.ResponseWriter.Header()
+
+	if e.statusCode == http.StatusOK {
+		if h.Get("ETag") == "" {
+			sum := sha256.Sum256(e.buf)
+			h.Set("ETag", `W/"`+hex.EncodeToString(sum[:16])+`"`)
+		}
+
+		if etagMatches(r.Header.Get("If-None-Match"), h.Get("ETag")) {
+			h.Del("Content-Type")
+			h.Del("Content-Length")
+			e.ResponseWriter.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	e.ResponseWriter.WriteHeader(e.statusCode)
+	if len(e.buf) > 0 {
+		e.ResponseWriter.Write(e.buf)
+	}
+}
+
+// etagMatches applies the weak comparison If-None-Match calls for: any
+// listed tag equal to etag, ignoring W/ prefixes, or "*".
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEtagMiddleware(t *testing.T) {
+	body := `[{"name":"active_users","value":1}]`
+	handlerFor := func(status int, body string) http.Handler {
+		return etagMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			io.WriteString(w, body)
+		}))
+	}
+	serve := func(h http.Handler, method, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/metrics", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	first := serve(handlerFor(http.StatusOK, body), "GET", "")
+	etag := first.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag on 200 response")
+	}
+	if first.Body.String() != body {
+		t.Errorf("body = %q, want %q", first.Body.String(), body)
+	}
+
+	t.Run("stable for identical body", func(t *testing.T) {
+		if got := serve(handlerFor(http.StatusOK, body), "GET", "").Header().Get("ETag"); got != etag {
+			t.Errorf("ETag = %q, want %q", got, etag)
+		}
+	})
+
+	t.Run("varies with body", func(t *testing.T) {
+		changed := `[{"name":"active_users","value":2}]`
+		if got := serve(handlerFor(http.StatusOK, changed), "GET", "").Header().Get("ETag"); got == etag {
+			t.Errorf("ETag %q unchanged after body changed", got)
+		}
+	})
+
+	t.Run("matching If-None-Match", func(t *testing.T) {
+		w := serve(handlerFor(http.StatusOK, body), "GET", etag)
+		if w.Code != http.StatusNotModified {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusNotModified)
+		}
+		if w.Body.Len() != 0 {
+			t.Errorf("304 body = %q, want empty", w.Body.String())
+		}
+		if w.Header().Get("ETag") != etag {
+			t.Errorf("304 ETag = %q, want %q", w.Header().Get("ETag"), etag)
+		}
+	})
+
+	t.Run("stale If-None-Match", func(t *testing.T) {
+		w := serve(handlerFor(http.StatusOK, body), "GET", `W/"stale"`)
+		if w.Code != http.StatusOK || w.Body.String() != body {
+			t.Errorf("got %d %q, want 200 with full body", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("error responses untagged", func(t *testing.T) {
+		w := serve(handlerFor(http.StatusNotFound, `{"error":{}}`), "GET", "")
+		if w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+		}
+		if got := w.Header().Get("ETag"); got != "" {
+			t.Errorf("ETag = %q on error response, want none", got)
+		}
+	})
+
+	t.Run("POST untagged", func(t *testing.T) {
+		if got := serve(handlerFor(http.StatusOK, body), "POST", "").Header().Get("ETag"); got != "" {
+			t.Errorf("ETag = %q on POST, want none", got)
+		}
+	})
+}
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		header string
+		etag   string
+		want   bool
+	}{
+		{header: "", etag: `W/"abc"`, want: false},
+		{header: `W/"abc"`, etag: `W/"abc"`, want: true},
+		{header: `"abc"`, etag: `W/"abc"`, want: true},
+		{header: `"xyz", W/"abc"`, etag: `W/"abc"`, want: true},
+		{header: "*", etag: `W/"abc"`, want: true},
+		{header: `W/"xyz"`, etag: `W/"abc"`, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, tt.etag); got != tt.want {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.header, tt.etag, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Gzip compression middleware that skips responses below a size threshold.
+package api
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMinSize is the smallest response body worth compressing; below this
+// the gzip header and CPU cost outweigh any saving.
+const gzipMinSize = 1024
+
+// gzipMiddleware compresses responses for clients that accept gzip.
+// The body is buffered until it reaches minSize, so small responses are
+// sent uncompressed and the status code is only written once the
+// encoding decision has been made.
+func gzipMiddleware(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize, statusCode: http.StatusOK}
+			defer gw.Close()
+
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header permits gzip.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.TrimSpace(coding)
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of the body to decide whether to compress.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize       int
+	statusCode    int
+	buf           []byte
+	gz            *gzip.Writer
+	headerWritten bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.headerWritten {
+		return
+	}
+	g.statusCode = code
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if g.gz != nil {
+		return g.gz.Write(p)
+	}
+	if g.headerWritten {
+		return g.ResponseWriter.Write(p)
+	}
+
+	g.buf = append(g.buf, p...)
+	if len(g.buf) >= g.minSize {
+		if err := g.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// start commits to an encoding and writes the status and buffered body.
+// Responses that already carry a Content-Encoding are passed through as-is.
+func (g *gzipResponseWriter) start() error {
+	h := g.ResponseWriter.Header()
+	if h.Get("Content-Encoding") == "" {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+
+	g.ResponseWriter.WriteHeader(g.statusCode)
+	g.headerWritten = true
+
+	buf := g.buf
+	g.buf = nil
+	if g.gz != nil {
+		_, err := g.gz.Write(buf)
+		return err
+	}
+	_, err := g.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush commits to an encoding without waiting for minSize bytes, since a
+// streaming handler may never reach it, and pushes pending data to the client.
+func (g *gzipResponseWriter) Flush() {
+	if !g.headerWritten {
+		g.start()
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	http.NewResponseController(g.ResponseWriter).Flush()
+}
+
+// Close flushes any compressed data, or sends a small body uncompressed.
+func (g *gzipResponseWriter) Close() error {
+	if g.gz != nil {
+		return g.gz.Close()
+	}
+	if g.headerWritten {
+		return nil
+	}
+
+	g.ResponseWriter.WriteHeader(g.statusCode)
+	g.headerWritten = true
+	if len(g.buf) == 0 {
+		return nil
+	}
+	_, err := g.ResponseWriter.Write(g.buf)
+	return err
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"name":"row","value":12345},`, 100)
+	small := `{"name":"row"}`
+
+	tests := []struct {
+		name           string
+		body           string
+		status         int
+		acceptEncoding string
+		wantGzip       bool
+	}{
+		{"large body with gzip accepted", large, http.StatusOK, "gzip, deflate", true},
+		{"large body keeps status", large, http.StatusNotFound, "gzip", true},
+		{"small body left uncompressed", small, http.StatusOK, "gzip", false},
+		{"no accept-encoding", large, http.StatusOK, "", false},
+		{"gzip explicitly refused", large, http.StatusOK, "gzip;q=0", false},
+		{"wildcard encoding", large, http.StatusOK, "*", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := gzipMiddleware(gzipMinSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				// Write in chunks to exercise buffering across the threshold
+				for i := 0; i < len(tt.body); i += 100 {
+					end := min(i+100, len(tt.body))
+					io.WriteString(w, tt.body[i:end])
+				}
+			}))
+
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", w.Header().Get("Content-Type"))
+			}
+			if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+				t.Error("missing Vary: Accept-Encoding")
+			}
+
+			gotGzip := w.Header().Get("Content-Encoding") == "gzip"
+			if gotGzip != tt.wantGzip {
+				t.Fatalf("gzip = %v, want %v", gotGzip, tt.wantGzip)
+			}
+
+			body := w.Body.String()
+			if gotGzip {
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("invalid gzip body: %v", err)
+				}
+				decoded, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatalf("failed to decompress body: %v", err)
+				}
+				body = string(decoded)
+			}
+
+			if body != tt.body {
+				t.Errorf("body mismatch: got %d bytes, want %d", len(body), len(tt.body))
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Content negotiation and CSV serialization of metric results.
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+// Response formats a metric request can ask for.
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+)
+
+const (
+	csvContentType    = "text/csv"
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// responseFormat reports the format the client asked for, either explicitly
+// with ?format= or through the Accept header. JSON remains the default.
+func responseFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case formatJSON, formatCSV, formatNDJSON:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("invalid format %q: must be json, csv or ndjson", format)
+	}
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case csvContentType:
+			return formatCSV, nil
+		case ndjsonContentType:
+			return formatNDJSON, nil
+		}
+	}
+	return formatJSON, nil
+}
+
+// respondCSV writes a single metric result as a CSV download.
+func (h *MetricsHandler) respondCSV(w http.ResponseWriter, result models.MetricResult) {
+	w.Header().Set("Content-Type", csvContentType+"; charset=utf-8")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": result.Name + ".csv",
+	}))
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(csvRecords(result.Value, result.Columns)); err != nil {
+		h.logger.Error("failed to encode CSV response", "error", err)
+	}
+}
+
+// csvRecords converts a metric value to CSV records. Multi-row values, and
+// the one row of single_row metrics, get a header row of their column
+// names, in query order when columns gives it and otherwise sorted, because
+// row maps are unordered; single values become a one-cell CSV.
+func csvRecords(value interface{}, columns []string) [][]string {
+	if row, ok := value.(map[string]interface{}); ok {
+		value = []map[string]interface{}{row}
+	}
+	rows, ok := value.([]map[string]interface{})
+	if !ok {
+		return [][]string{{csvField(value)}}
+	}
+
+	if len(columns) == 0 {
+		seen := make(map[string]bool)
+		for _, row := range rows {
+			for col := range row {
+				if !seen[col] {
+					seen[col] = true
+					columns = append(columns, col)
+				}
+			}
+		}
+		sort.Strings(columns)
+	}
+
+	records := make([][]string, 0, len(rows)+1)
+	records = append(records, columns)
+	for _, row := range rows {
+		record := make([]string, len(columns))
+		for i, col := range columns {
+			record[i] = csvField(row[col])
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// csvField formats a scanned database value as a CSV cell.
+func csvField(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(val)
+	case json.RawMessage:
+		return string(val)
+	case time.Time:
+		return val.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(val)
+	}
+}
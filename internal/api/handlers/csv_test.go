@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+func TestResponseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		accept  string
+		want    string
+		wantErr bool
+	}{
+		{name: "default is JSON", want: formatJSON},
+		{name: "format=csv", query: "?format=csv", want: formatCSV},
+		{name: "format=json overrides Accept", query: "?format=json", accept: "text/csv", want: formatJSON},
+		{name: "Accept text/csv", accept: "text/csv", want: formatCSV},
+		{name: "Accept with parameters and alternatives", accept: "application/json;q=0.5, text/csv; charset=utf-8", want: formatCSV},
+		{name: "Accept JSON", accept: "application/json", want: formatJSON},
+		{name: "format=ndjson", query: "?format=ndjson", want: formatNDJSON},
+		{name: "Accept NDJSON", accept: "application/x-ndjson", want: formatNDJSON},
+		{name: "unknown format", query: "?format=xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics/x"+tt.query, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+
+			got, err := responseFormat(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("responseFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("responseFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVRecords(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		columns []string
+		want    [][]string
+	}{
+		{
+			name:  "single value",
+			value: int64(1523),
+			want:  [][]string{{"1523"}},
+		},
+		{
+			name:  "null value",
+			value: nil,
+			want:  [][]string{{""}},
+		},
+		{
+			name:    "single row",
+			value:   map[string]interface{}{"name": "Alice", "id": int64(1)},
+			columns: []string{"id", "name"},
+			want:    [][]string{{"id", "name"}, {"1", "Alice"}},
+		},
+		{
+			name: "multi-row with sorted header",
+			value: []map[string]interface{}{
+				{"name": "Alice", "id": int64(1), "email": nil},
+				{"name": []byte("Bob"), "id": int64(2), "email": "bob@example.com"},
+			},
+			want: [][]string{
+				{"email", "id", "name"},
+				{"", "1", "Alice"},
+				{"bob@example.com", "2", "Bob"},
+			},
+		},
+		{
+			name: "multi-row in query order",
+			value: []map[string]interface{}{
+				{"name": "Alice", "id": int64(1), "email": nil},
+			},
+			columns: []string{"name", "id", "email"},
+			want: [][]string{
+				{"name", "id", "email"},
+				{"Alice", "1", ""},
+			},
+		},
+		{
+			name:    "no rows with columns",
+			value:   []map[string]interface{}{},
+			columns: []string{"name", "id"},
+			want:    [][]string{{"name", "id"}},
+		},
+		{
+			name:  "embedded JSON",
+			value: []map[string]interface{}{{"payload": json.RawMessage(`{"a":1}`)}},
+			want:  [][]string{{"payload"}, {`{"a":1}`}},
+		},
+		{
+			name:  "no rows",
+			value: []map[string]interface{}{},
+			want:  [][]string{nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvRecords(tt.value, tt.columns); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("csvRecords() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMetric_CSV(t *testing.T) {
+	svc := &mockMetricService{
+		metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+			return []models.MetricResult{{
+				Name: "all_users",
+				Value: []map[string]interface{}{
+					{"id": int64(1), "name": "Alice, Jr."},
+				},
+			}}, nil
+		},
+	}
+
+	handler := &MetricsHandler{
+		service: svc,
+		logger:  slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+	}
+
+	req := httptest.NewRequest("GET", "/metrics/all_users?format=csv", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("name", "all_users")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.GetMetric(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/csv", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename=all_users.csv` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse CSV response: %v", err)
+	}
+	want := [][]string{{"id", "name"}, {"1", "Alice, Jr."}}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("CSV = %q, want %q", records, want)
+	}
+}
+
+func TestGetMultipleMetrics_CSVRejected(t *testing.T) {
+	handler := &MetricsHandler{
+		service: &mockMetricService{},
+		logger:  slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+	}
+
+	req := httptest.NewRequest("GET", "/metrics?names=a,b", nil)
+	req.Header.Set("Accept", "text/csv")
+	w := httptest.NewRecorder()
+
+	handler.GetMetrics(w, req)
+
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("expected status 406, got %d", w.Code)
+	}
+}
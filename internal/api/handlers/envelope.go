@@ -0,0 +1,79 @@
+// Response envelopes: an optional wrapper with a generation time, and the
+// data-and-page shape of a paginated single-metric response.
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+// ResultEnvelope wraps metric results for clients that want an object
+// rather than a bare array, so they can tell how fresh the data is.
+type ResultEnvelope struct {
+	Results     []models.MetricResult `json:"results"`
+	GeneratedAt time.Time             `json:"generated_at"`
+}
+
+// PageEnvelope answers a paginated single-metric request. The page of rows
+// sits under data beside the page metadata, rather than inside the value of
+// a one-element result array, so a client paging through a table reads both
+// from the top level.
+type PageEnvelope struct {
+	Name        string        `json:"name"`
+	Data        interface{}   `json:"data"`
+	Columns     []string      `json:"columns,omitempty"`
+	Unit        string        `json:"unit,omitempty"`
+	Format      models.Format `json:"format,omitempty"`
+	Page        models.Page   `json:"page"`
+	Truncated   bool          `json:"truncated,omitempty"`
+	DurationMS  *float64      `json:"duration_ms,omitempty"`
+	Degraded    bool          `json:"degraded,omitempty"`
+	GeneratedAt time.Time     `json:"generated_at,omitzero"`
+}
+
+// pageEnvelope reshapes a paginated result as a PageEnvelope.
+func pageEnvelope(result models.MetricResult) PageEnvelope {
+	return PageEnvelope{
+		Name:        result.Name,
+		Data:        result.Value,
+		Columns:     result.Columns,
+		Unit:        result.Unit,
+		Format:      result.Format,
+		Page:        *result.Page,
+		Truncated:   result.Truncated,
+		DurationMS:  result.DurationMS,
+		Degraded:    result.Degraded,
+		GeneratedAt: result.GeneratedAt,
+	}
+}
+
+// wantsEnvelope reads the envelope query parameter. Unlike pretty, an
+// unparseable value is rejected because it changes the response shape.
+func wantsEnvelope(r *http.Request) (bool, error) {
+	v := r.URL.Query().Get("envelope")
+	if v == "" {
+		return false, nil
+	}
+	envelope, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid envelope value %q: must be true or false", v)
+	}
+	return envelope, nil
+}
+
+// respondResults writes metric results as a bare array, or wrapped in a
+// ResultEnvelope when the client asked for one.
+func (h *MetricsHandler) respondResults(w http.ResponseWriter, r *http.Request, results []models.MetricResult, envelope bool) {
+	if !envelope {
+		h.respondJSON(w, r, http.StatusOK, results)
+		return
+	}
+	h.respondJSON(w, r, http.StatusOK, ResultEnvelope{
+		Results:     results,
+		GeneratedAt: time.Now().UTC(),
+	})
+}
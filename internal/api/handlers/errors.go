@@ -0,0 +1,86 @@
+// Structured JSON error responses with machine-readable codes.
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ErrorCode identifies a class of API error so clients can branch on it
+// without parsing the message.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest   ErrorCode = "INVALID_REQUEST"
+	CodeMetricNotFound   ErrorCode = "METRIC_NOT_FOUND"
+	CodeMetricDisabled   ErrorCode = "METRIC_DISABLED"
+	CodeNotFound         ErrorCode = "NOT_FOUND"
+	CodeMethodNotAllowed ErrorCode = "METHOD_NOT_ALLOWED"
+	CodeParamMissing     ErrorCode = "PARAM_MISSING"
+	CodeParamInvalid     ErrorCode = "PARAM_INVALID"
+	CodeUnauthorized     ErrorCode = "UNAUTHORIZED"
+	CodeForbidden        ErrorCode = "FORBIDDEN"
+	CodeOriginNotAllowed ErrorCode = "ORIGIN_NOT_ALLOWED"
+	CodeNotAcceptable    ErrorCode = "NOT_ACCEPTABLE"
+	CodeBodyTooLarge     ErrorCode = "BODY_TOO_LARGE"
+	CodeResultTooLarge   ErrorCode = "RESULT_TOO_LARGE"
+	CodeRateLimited      ErrorCode = "RATE_LIMITED"
+	CodeRequestCanceled  ErrorCode = "REQUEST_CANCELED"
+	CodeTimeout          ErrorCode = "TIMEOUT"
+	CodeInternal         ErrorCode = "INTERNAL"
+)
+
+// statusClientClosedRequest is the non-standard status (from nginx) recorded
+// when the client goes away before the response is ready.
+const statusClientClosedRequest = 499
+
+var codeStatus = map[ErrorCode]int{
+	CodeInvalidRequest:   http.StatusBadRequest,
+	CodeMetricNotFound:   http.StatusNotFound,
+	CodeMetricDisabled:   http.StatusServiceUnavailable,
+	CodeNotFound:         http.StatusNotFound,
+	CodeMethodNotAllowed: http.StatusMethodNotAllowed,
+	CodeParamMissing:     http.StatusBadRequest,
+	CodeParamInvalid:     http.StatusBadRequest,
+	CodeUnauthorized:     http.StatusUnauthorized,
+	CodeForbidden:        http.StatusForbidden,
+	CodeOriginNotAllowed: http.StatusForbidden,
+	CodeNotAcceptable:    http.StatusNotAcceptable,
+	CodeBodyTooLarge:     http.StatusRequestEntityTooLarge,
+	CodeResultTooLarge:   http.StatusRequestEntityTooLarge,
+	CodeRateLimited:      http.StatusTooManyRequests,
+	CodeRequestCanceled:  statusClientClosedRequest,
+	CodeTimeout:          http.StatusGatewayTimeout,
+	CodeInternal:         http.StatusInternalServerError,
+}
+
+// Status returns the HTTP status paired with the code.
+func (c ErrorCode) Status() int {
+	if status, ok := codeStatus[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// APIError is the body of every error response, nested under "error".
+type APIError struct {
+	Code    ErrorCode              `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+type errorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// WriteError writes a JSON error response in the API's standard error shape.
+// It lets middleware outside this package fail requests consistently.
+func WriteError(w http.ResponseWriter, code ErrorCode, message string) {
+	writeAPIError(w, APIError{Code: code, Message: message})
+}
+
+func writeAPIError(w http.ResponseWriter, apiErr APIError) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Code.Status())
+	return json.NewEncoder(w).Encode(errorResponse{Error: apiErr})
+}
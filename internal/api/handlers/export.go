@@ -0,0 +1,118 @@
+// Prometheus text-format export of single-value metrics.
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// ExportPrometheus handles GET /metrics-export, running every single-value
+// metric without params and answering in the Prometheus text format so
+// Prometheus can scrape dashboard values directly. ?tags= and ?tag_match=
+// narrow the metrics as they do the catalog. Metrics that fail, or whose
+// value is NULL or not a number, are logged and left out, so one broken
+// metric does not fail the scrape.
+func (h *MetricsHandler) ExportPrometheus(w http.ResponseWriter, r *http.Request) {
+	opts, err := listOptions(r)
+	if err != nil {
+		h.respondError(w, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	var names []string
+	help := make(map[string]string)
+	for _, info := range h.service.ListMetrics(r.Context(), opts) {
+		if info.MultiRow || len(info.Params) > 0 {
+			continue
+		}
+		names = append(names, info.Name)
+		help[info.Name] = info.Description
+	}
+
+	var results []models.MetricResult
+	if len(names) > 0 {
+		results, err = h.service.GetMetrics(r.Context(), names, nil, models.QueryOptions{Partial: true})
+		if err != nil {
+			h.handleServiceError(w, r, err, false)
+			return
+		}
+	}
+
+	var b strings.Builder
+	exported := make(map[string]string, len(results))
+	for _, result := range results {
+		if result.Error != "" {
+			h.logger.Warn("metric export failed", "metric", result.Name, "error", result.Error)
+			continue
+		}
+		value, ok := prometheusValue(result.Value)
+		if !ok {
+			h.logger.Debug("metric export skipped non-numeric value", "metric", result.Name)
+			continue
+		}
+		// A repeated family would make Prometheus reject the whole scrape
+		name := prometheusName(result.Name)
+		if other, ok := exported[name]; ok {
+			h.logger.Warn("metric export skipped clashing name", "metric", result.Name, "clashes_with", other, "exported_as", name)
+			continue
+		}
+		exported[name] = result.Name
+
+		if desc := help[result.Name]; desc != "" {
+			fmt.Fprintf(&b, "# HELP %s %s\n", name, prometheusHelpEscaper.Replace(desc))
+		}
+		fmt.Fprintf(&b, "# TYPE %s gauge\n%s %s\n", name, name, value)
+	}
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(b.String())); err != nil {
+		h.logger.Error("failed to write export", "error", err)
+	}
+}
+
+// prometheusHelpEscaper escapes HELP text as the text format requires.
+var prometheusHelpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// prometheusName maps a metric name onto Prometheus's [a-zA-Z_:][a-zA-Z0-9_:]*.
+// Metric names allow only letters, digits, underscores and hyphens, so
+// hyphens become underscores and a leading digit gets an underscore prefix.
+func prometheusName(name string) string {
+	name = strings.ReplaceAll(name, "-", "_")
+	if name != "" && name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// prometheusValue formats a single-value result as a sample value. Booleans
+// become 1 or 0, and numeric strings, such as MySQL DECIMAL results, are
+// parsed. It reports false for NULL and anything else.
+func prometheusValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case int:
+		return strconv.Itoa(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), true
+	case bool:
+		if v {
+			return "1", true
+		}
+		return "0", true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return "", false
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), true
+	}
+	return "", false
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+func TestExportPrometheus(t *testing.T) {
+	var gotNames []string
+	var gotOpts models.QueryOptions
+	svc := &mockMetricService{
+		listFunc: func(opts models.ListOptions) []models.MetricInfo {
+			return []models.MetricInfo{
+				{Name: "active_users", Description: "Users active today"},
+				{Name: "revenue-total", Description: "Revenue in USD\nincluding tax, net of C:\\refunds"},
+				{Name: "7d_signups"},
+				{Name: "signups_by_day", MultiRow: true},
+				{Name: "user_orders", Params: []models.ParamDefinition{{Name: "user_id", Type: models.ParamTypeInt, Required: true}}},
+				{Name: "margin"},
+				{Name: "broken"},
+				{Name: "empty"},
+				{Name: "status_text"},
+				{Name: "healthy"},
+				{Name: "revenue_total"},
+			}
+		},
+		metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+			gotNames, gotOpts = names, opts
+			return []models.MetricResult{
+				{Name: "active_users", Value: int64(42)},
+				{Name: "revenue-total", Value: 1234.5},
+				{Name: "7d_signups", Value: int64(7)},
+				{Name: "margin", Value: "0.25"},
+				{Name: "broken", Error: "query failed"},
+				{Name: "empty", Value: nil},
+				{Name: "status_text", Value: "ok"},
+				{Name: "healthy", Value: true},
+				{Name: "revenue_total", Value: 1.0},
+			}, nil
+		},
+	}
+	handler := &MetricsHandler{service: svc, logger: slog.New(slog.DiscardHandler)}
+
+	w := httptest.NewRecorder()
+	handler.ExportPrometheus(w, httptest.NewRequest("GET", "/metrics-export", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != prometheusContentType {
+		t.Errorf("Content-Type = %q, want %q", got, prometheusContentType)
+	}
+	wantNames := []string{"active_users", "revenue-total", "7d_signups", "margin", "broken", "empty", "status_text", "healthy", "revenue_total"}
+	if !reflect.DeepEqual(gotNames, wantNames) {
+		t.Errorf("queried %v, want %v", gotNames, wantNames)
+	}
+	if !gotOpts.Partial {
+		t.Error("metrics queried without partial, so one failure would fail the scrape")
+	}
+
+	want := `# HELP active_users Users active today
+# TYPE active_users gauge
+active_users 42
+# HELP revenue_total Revenue in USD\nincluding tax, net of C:\\refunds
+# TYPE revenue_total gauge
+revenue_total 1234.5
+# TYPE _7d_signups gauge
+_7d_signups 7
+# TYPE margin gauge
+margin 0.25
+# TYPE healthy gauge
+healthy 1
+`
+	if got := w.Body.String(); got != want {
+		t.Errorf("body =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestExportPrometheus_TagFilter(t *testing.T) {
+	var gotOpts models.ListOptions
+	queried := false
+	svc := &mockMetricService{
+		listFunc: func(opts models.ListOptions) []models.MetricInfo {
+			gotOpts = opts
+			return nil
+		},
+		metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+			queried = true
+			return nil, nil
+		},
+	}
+	handler := &MetricsHandler{service: svc, logger: slog.New(slog.DiscardHandler)}
+
+	w := httptest.NewRecorder()
+	handler.ExportPrometheus(w, httptest.NewRequest("GET", "/metrics-export?tags=sales,daily&tag_match=all", nil))
+
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("status = %d, body = %q, want an empty 200", w.Code, w.Body.String())
+	}
+	if want := (models.ListOptions{Tags: []string{"sales", "daily"}, Match: models.TagMatchAll}); !reflect.DeepEqual(gotOpts, want) {
+		t.Errorf("list options = %+v, want %+v", gotOpts, want)
+	}
+	if queried {
+		t.Error("queried metrics when none matched")
+	}
+
+	w = httptest.NewRecorder()
+	handler.ExportPrometheus(w, httptest.NewRequest("GET", "/metrics-export?tag_match=some", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid tag_match status = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,26 @@
+// HTTP handler reporting whether the server's databases are reachable.
+package handlers
+
+import "net/http"
+
+// HealthStatus is the body of a GET /healthz response.
+type HealthStatus struct {
+	Status    string   `json:"status"`
+	Unhealthy []string `json:"unhealthy,omitempty"`
+}
+
+// GetHealth handles GET /healthz, answering 503 while any database has
+// failed its recent health checks so load balancers stop routing here.
+// Only database names are reported; the errors themselves are logged.
+func (h *MetricsHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	var unhealthy []string
+	if h.opts.Unhealthy != nil {
+		unhealthy = h.opts.Unhealthy()
+	}
+
+	if len(unhealthy) > 0 {
+		h.respondJSON(w, r, http.StatusServiceUnavailable, HealthStatus{Status: "unhealthy", Unhealthy: unhealthy})
+		return
+	}
+	h.respondJSON(w, r, http.StatusOK, HealthStatus{Status: "ok"})
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestGetHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		unhealthy  func() []string
+		wantStatus int
+		want       HealthStatus
+	}{
+		{
+			name:       "no health checks",
+			wantStatus: http.StatusOK,
+			want:       HealthStatus{Status: "ok"},
+		},
+		{
+			name:       "all databases healthy",
+			unhealthy:  func() []string { return nil },
+			wantStatus: http.StatusOK,
+			want:       HealthStatus{Status: "ok"},
+		},
+		{
+			name:       "failing database",
+			unhealthy:  func() []string { return []string{"data_sources.reports"} },
+			wantStatus: http.StatusServiceUnavailable,
+			want:       HealthStatus{Status: "unhealthy", Unhealthy: []string{"data_sources.reports"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewMetricsHandler(&mockMetricService{}, slog.New(slog.DiscardHandler), Options{Unhealthy: tt.unhealthy})
+
+			w := httptest.NewRecorder()
+			handler.GetHealth(w, httptest.NewRequest("GET", "/healthz", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var got HealthStatus
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("body = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
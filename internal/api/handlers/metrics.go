@@ -4,64 +4,157 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/service"
 )
 
 // MetricService defines the interface that handlers depend on.
 type MetricService interface {
-	GetMetricNames() []string
-	GetMetrics(ctx context.Context, names []string, params map[string]string) ([]models.MetricResult, error)
+	ListMetrics(ctx context.Context, opts models.ListOptions) []models.MetricInfo
+	GetMetricSchema(ctx context.Context, name string) (models.MetricSchema, error)
+	GetMetrics(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error)
+	GetMetricBatch(ctx context.Context, requests []models.MetricRequest, opts models.QueryOptions) ([]models.MetricResult, error)
+	StreamMetric(ctx context.Context, name string, params map[string]string, opts models.QueryOptions, fn func(row map[string]interface{}) error) error
+}
+
+// Options tunes MetricsHandler. The zero value applies no limits.
+type Options struct {
+	// MaxMetrics caps how many metrics one request may name, bounding the
+	// total work a request causes; 0 means unlimited.
+	MaxMetrics int
+
+	// Unhealthy reports the databases failing health checks, for GET
+	// /healthz; nil reports the server healthy whenever it can respond.
+	Unhealthy func() []string
 }
 
 // MetricsHandler handles HTTP requests for metrics.
 type MetricsHandler struct {
 	service MetricService
 	logger  *slog.Logger
+	opts    Options
 }
 
 // NewMetricsHandler creates a new metrics handler.
-func NewMetricsHandler(service MetricService, logger *slog.Logger) *MetricsHandler {
+func NewMetricsHandler(service MetricService, logger *slog.Logger, opts Options) *MetricsHandler {
 	return &MetricsHandler{
 		service: service,
 		logger:  logger,
+		opts:    opts,
 	}
 }
 
-// ListMetrics handles GET /metrics (with no ?names parameter).
+// ListMetrics handles GET /metrics (with no ?names parameter), returning the
+// metric catalog, optionally filtered with ?tags=a,b and ?tag_match=any|all.
 func (h *MetricsHandler) ListMetrics(w http.ResponseWriter, r *http.Request) {
-	names := h.service.GetMetricNames()
-	h.respondJSON(w, http.StatusOK, names)
+	opts, err := listOptions(r)
+	if err != nil {
+		h.respondError(w, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	h.respondJSON(w, r, http.StatusOK, h.service.ListMetrics(r.Context(), opts))
+}
+
+// listOptions reads the ?tags= and ?tag_match= catalog filter.
+func listOptions(r *http.Request) (models.ListOptions, error) {
+	opts := models.ListOptions{
+		Tags:  cleanNames(strings.Split(r.URL.Query().Get("tags"), ",")),
+		Match: models.TagMatch(r.URL.Query().Get("tag_match")),
+	}
+	return opts, opts.Validate()
+}
+
+// GetMetricSchema handles GET /metrics/{name}/schema.
+func (h *MetricsHandler) GetMetricSchema(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	schema, err := h.service.GetMetricSchema(r.Context(), name)
+	if err != nil {
+		h.handleServiceError(w, r, err, false)
+		return
+	}
+
+	h.respondJSON(w, r, http.StatusOK, schema)
 }
 
 // GetMetric handles GET /metrics/{name}.
 func (h *MetricsHandler) GetMetric(w http.ResponseWriter, r *http.Request) {
+	format, err := responseFormat(r)
+	if err != nil {
+		h.respondError(w, CodeInvalidRequest, err.Error())
+		return
+	}
+	h.getMetric(w, r, format)
+}
+
+// GetMetricCSV handles GET /metrics/{name}.csv, which always answers in CSV
+// so that a plain link downloads a file a spreadsheet can open. The format
+// parameter and Accept header are ignored.
+func (h *MetricsHandler) GetMetricCSV(w http.ResponseWriter, r *http.Request) {
+	h.getMetric(w, r, formatCSV)
+}
+
+// getMetric answers a single-metric request in the given format.
+func (h *MetricsHandler) getMetric(w http.ResponseWriter, r *http.Request, format string) {
 	name := chi.URLParam(r, "name")
 	if name == "" {
-		h.respondError(w, http.StatusBadRequest, "metric name required")
+		h.respondError(w, CodeInvalidRequest, "metric name required")
 		return
 	}
 
-	// Extract query parameters (excluding standard HTTP params)
+	opts, err := parseQueryOptions(r)
+	if err != nil {
+		h.respondError(w, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	envelope, err := wantsEnvelope(r)
+	if err != nil {
+		h.respondError(w, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Extract query parameters (excluding reserved ones)
 	params := extractQueryParams(r)
 
-	results, err := h.service.GetMetrics(r.Context(), []string{name}, params)
+	if format == formatNDJSON {
+		h.streamNDJSON(w, r, name, params, opts)
+		return
+	}
+
+	results, err := h.service.GetMetrics(r.Context(), []string{name}, params, opts)
 	if err != nil {
-		h.handleServiceError(w, err)
+		h.handleServiceError(w, r, err, opts.Debug)
 		return
 	}
+	maskResultErrors(r, results, opts.Debug)
 
 	if len(results) == 0 {
-		h.respondError(w, http.StatusNotFound, fmt.Sprintf("metric %q not found", name))
+		h.respondError(w, CodeMetricNotFound, fmt.Sprintf("metric %q not found", name))
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, results)
+	setCacheControl(w, results)
+	if format == formatCSV {
+		h.respondCSV(w, results[0])
+		return
+	}
+	// An explicit envelope=true still gets the ResultEnvelope it asked for.
+	if results[0].Page != nil && !envelope {
+		h.respondJSON(w, r, http.StatusOK, pageEnvelope(results[0]))
+		return
+	}
+
+	h.respondResults(w, r, results, envelope)
 }
 
 // GetMetrics handles GET /metrics?names=metric1,metric2.
@@ -75,69 +168,288 @@ func (h *MetricsHandler) GetMetrics(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse comma-separated metric names, handling whitespace
-	namesRaw := strings.Split(namesParam, ",")
-	names := make([]string, 0, len(namesRaw))
-	for _, name := range namesRaw {
-		trimmed := strings.TrimSpace(name)
-		if trimmed != "" {
-			names = append(names, trimmed)
-		}
+	names := cleanNames(strings.Split(namesParam, ","))
+	if len(names) == 0 {
+		h.respondError(w, CodeInvalidRequest, "no valid metric names provided")
+		return
+	}
+	if !h.checkMetricCount(w, names) {
+		return
 	}
 
-	if len(names) == 0 {
-		h.respondError(w, http.StatusBadRequest, "no valid metric names provided")
+	opts, err := parseQueryOptions(r)
+	if err != nil {
+		h.respondError(w, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	format, err := responseFormat(r)
+	if err != nil {
+		h.respondError(w, CodeInvalidRequest, err.Error())
 		return
 	}
 
-	// Extract query parameters (excluding 'names')
+	envelope, err := wantsEnvelope(r)
+	if err != nil {
+		h.respondError(w, CodeInvalidRequest, err.Error())
+		return
+	}
+	// CSV and NDJSON documents hold one table, so only single-metric
+	// batches can use them.
+	if format != formatJSON && len(names) > 1 {
+		h.respondError(w, CodeNotAcceptable, fmt.Sprintf("%s output supports a single metric", strings.ToUpper(format)))
+		return
+	}
+
+	// Extract query parameters (excluding reserved ones)
 	params := extractQueryParams(r)
 
-	results, err := h.service.GetMetrics(r.Context(), names, params)
+	if format == formatNDJSON {
+		h.streamNDJSON(w, r, names[0], params, opts)
+		return
+	}
+
+	results, err := h.service.GetMetrics(r.Context(), names, params, opts)
 	if err != nil {
-		h.handleServiceError(w, err)
+		h.handleServiceError(w, r, err, opts.Debug)
+		return
+	}
+	maskResultErrors(r, results, opts.Debug)
+
+	setCacheControl(w, results)
+	if format == formatCSV && len(results) == 1 {
+		h.respondCSV(w, results[0])
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, results)
+	h.respondResults(w, r, results, envelope)
+}
+
+// parseQueryOptions reads the reserved query parameters that control execution.
+func parseQueryOptions(r *http.Request) (models.QueryOptions, error) {
+	var opts models.QueryOptions
+
+	if v := r.URL.Query().Get("partial"); v != "" {
+		partial, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid partial value %q: must be true or false", v)
+		}
+		opts.Partial = partial
+	}
+
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid limit value %q: must be an integer", v)
+		}
+		opts.Limit = limit
+	}
+
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid offset value %q: must be an integer", v)
+		}
+		opts.Offset = offset
+	}
+
+	if v := r.URL.Query().Get("debug"); v != "" {
+		debug, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid debug value %q: must be true or false", v)
+		}
+		opts.Debug = debug
+	}
+
+	if v := r.URL.Query().Get("omit_nulls"); v != "" {
+		omit, err := strconv.ParseBool(v)
+		if err != nil {
+			return opts, fmt.Errorf("invalid omit_nulls value %q: must be true or false", v)
+		}
+		opts.OmitNulls = omit
+	}
+
+	// The service parses the range, since it expands it against its clock.
+	opts.Range = r.URL.Query().Get("range")
+
+	return withPageDefaults(opts)
+}
+
+// withPageDefaults fills in the page size when only an offset was given,
+// since an offset on its own still needs a page size to be meaningful,
+// and then validates the options.
+func withPageDefaults(opts models.QueryOptions) (models.QueryOptions, error) {
+	if opts.Offset != 0 && opts.Limit == 0 {
+		opts.Limit = models.DefaultPageLimit
+	}
+	if err := opts.Validate(); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// checkMetricCount responds with 400 and returns false when names exceeds
+// Options.MaxMetrics.
+func (h *MetricsHandler) checkMetricCount(w http.ResponseWriter, names []string) bool {
+	if h.opts.MaxMetrics > 0 && len(names) > h.opts.MaxMetrics {
+		h.respondError(w, CodeInvalidRequest, fmt.Sprintf("too many metrics: %d requested, at most %d allowed per request", len(names), h.opts.MaxMetrics))
+		return false
+	}
+	return true
+}
+
+// cleanNames trims whitespace from metric names and drops empty entries and
+// repeats, keeping first-seen order, so ?names=a,a queries a only once.
+func cleanNames(raw []string) []string {
+	names := make([]string, 0, len(raw))
+	seen := make(map[string]bool, len(raw))
+	for _, name := range raw {
+		trimmed := strings.TrimSpace(name)
+		if trimmed == "" || seen[trimmed] {
+			continue
+		}
+		seen[trimmed] = true
+		names = append(names, trimmed)
+	}
+	return names
 }
 
-// extractQueryParams extracts all query parameters except 'names'.
+// extractQueryParams extracts all query parameters except reserved ones.
+// A repeated parameter is joined with commas, so ?id=1&id=2 reaches a list
+// parameter as "1,2" rather than losing all but the first value. A repeated
+// scalar parameter receives the joined value too, which fails conversion for
+// every type but string.
 func extractQueryParams(r *http.Request) map[string]string {
 	params := make(map[string]string)
 	for key, values := range r.URL.Query() {
-		if key != "names" && len(values) > 0 {
-			params[key] = values[0]
+		if !models.IsReservedParam(key) && len(values) > 0 {
+			params[key] = strings.Join(values, ",")
 		}
 	}
 	return params
 }
 
-// respondJSON writes a JSON response.
-func (h *MetricsHandler) respondJSON(w http.ResponseWriter, status int, data interface{}) {
+// setCacheControl lets clients reuse a response for the shortest max_age of
+// the metrics it holds. A metric without max_age, or a failed one in a
+// partial batch, makes the whole response uncacheable.
+func setCacheControl(w http.ResponseWriter, results []models.MetricResult) {
+	maxAge := 0
+	for i, result := range results {
+		if result.Error != "" || result.MaxAge <= 0 {
+			maxAge = 0
+			break
+		}
+		if i == 0 || result.MaxAge < maxAge {
+			maxAge = result.MaxAge
+		}
+	}
+
+	if maxAge == 0 {
+		w.Header().Set("Cache-Control", "no-store")
+		return
+	}
+	w.Header().Set("Cache-Control", "max-age="+strconv.Itoa(maxAge))
+}
+
+// respondJSON writes a JSON response, indented when the request asks for
+// ?pretty=true so it reads well in a terminal.
+func (h *MetricsHandler) respondJSON(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
+	enc := json.NewEncoder(w)
+	if wantsPretty(r) {
+		enc.SetIndent("", "  ")
+	}
+	if err := enc.Encode(data); err != nil {
 		h.logger.Error("failed to encode JSON response", "error", err)
 	}
 }
 
+// wantsPretty reports whether the request set pretty to a true value. An
+// unparseable value is ignored rather than failing a request over layout.
+func wantsPretty(r *http.Request) bool {
+	pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty"))
+	return pretty
+}
+
 // respondError writes a JSON error response.
-func (h *MetricsHandler) respondError(w http.ResponseWriter, status int, message string) {
-	h.respondJSON(w, status, map[string]string{"error": message})
+func (h *MetricsHandler) respondError(w http.ResponseWriter, code ErrorCode, message string) {
+	h.respondAPIError(w, APIError{Code: code, Message: message})
+}
+
+// respondAPIError writes a JSON error response that may carry details.
+func (h *MetricsHandler) respondAPIError(w http.ResponseWriter, apiErr APIError) {
+	if err := writeAPIError(w, apiErr); err != nil {
+		h.logger.Error("failed to encode JSON response", "error", err)
+	}
 }
 
 // handleServiceError converts service layer errors to HTTP responses.
-func (h *MetricsHandler) handleServiceError(w http.ResponseWriter, err error) {
-	h.logger.Error("service error", "error", err)
-
-	errMsg := err.Error()
-
-	// Determine status code based on error message
-	if strings.Contains(errMsg, "not found") || strings.Contains(errMsg, "unknown metric") {
-		h.respondError(w, http.StatusNotFound, errMsg)
-	} else if strings.Contains(errMsg, "invalid") || strings.Contains(errMsg, "required") {
-		h.respondError(w, http.StatusBadRequest, errMsg)
-	} else {
-		h.respondError(w, http.StatusInternalServerError, "internal server error")
+func (h *MetricsHandler) handleServiceError(w http.ResponseWriter, r *http.Request, err error, debug bool) {
+	apiErr := serviceError(err, r.Context().Err(), debug)
+	switch {
+	case apiErr.Code == CodeTimeout:
+		h.logger.Warn("metric query timed out", "error", err)
+	case apiErr.Code == CodeRequestCanceled:
+		h.logger.Info("request canceled by client", "error", err)
+	case apiErr.Code == CodeInternal && !errors.Is(err, service.ErrQueryFailed):
+		// Query failures are already logged by the service along with the
+		// offending SQL
+		h.logger.Error("service error", "error", err)
+	}
+	h.respondAPIError(w, apiErr)
+}
+
+// serviceError maps a service layer error to the API error reported for it.
+// A failed query's message is only shown when the request asked for debug
+// output, since it can reveal table and column names, and an unclassified
+// error's never is.
+func serviceError(err, ctxErr error, debug bool) APIError {
+	// Some drivers report an interrupted query with their own error rather
+	// than the context's, so the request context is consulted as well.
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctxErr, context.DeadlineExceeded):
+		return APIError{Code: CodeTimeout, Message: "metric query timed out"}
+	case errors.Is(err, context.Canceled) || errors.Is(ctxErr, context.Canceled):
+		return APIError{Code: CodeRequestCanceled, Message: "request canceled"}
+	}
+
+	switch {
+	case errors.Is(err, service.ErrMetricNotFound):
+		return APIError{Code: CodeMetricNotFound, Message: err.Error()}
+	case errors.Is(err, service.ErrMetricDisabled):
+		return APIError{Code: CodeMetricDisabled, Message: err.Error()}
+	case errors.Is(err, service.ErrForbidden):
+		return APIError{Code: CodeForbidden, Message: err.Error()}
+	case errors.Is(err, service.ErrParamMissing):
+		apiErr := APIError{Code: CodeParamMissing, Message: err.Error()}
+		var missing *service.MissingParamError
+		if errors.As(err, &missing) {
+			apiErr.Details = map[string]interface{}{
+				"metric": missing.Metric,
+				"param":  missing.Param,
+				"params": missing.Params,
+			}
+		}
+		return apiErr
+	case errors.Is(err, service.ErrParamInvalid):
+		return APIError{Code: CodeParamInvalid, Message: err.Error()}
+	case errors.Is(err, service.ErrResultTooLarge):
+		return APIError{Code: CodeResultTooLarge, Message: err.Error()}
+	case errors.Is(err, service.ErrQueryFailed) && debug:
+		return APIError{Code: CodeInternal, Message: err.Error()}
+	default:
+		return APIError{Code: CodeInternal, Message: "internal server error"}
+	}
+}
+
+// maskResultErrors rewrites the error of each failed result of a partial
+// batch to the message serviceError gives, so a failing query in a batch
+// reveals no more than it would on its own.
+func maskResultErrors(r *http.Request, results []models.MetricResult, debug bool) {
+	for i := range results {
+		if results[i].Err != nil {
+			results[i].Error = serviceError(results[i].Err, r.Context().Err(), debug).Message
+		}
 	}
 }
@@ -3,33 +3,62 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/service"
 )
 
 // Mock service for testing
 type mockMetricService struct {
-	metricsFunc func(ctx context.Context, names []string, params map[string]string) ([]models.MetricResult, error)
-	namesFunc   func() []string
+	metricsFunc func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error)
+	listFunc    func(opts models.ListOptions) []models.MetricInfo
+	schemaFunc  func(ctx context.Context, name string) (models.MetricSchema, error)
+	streamFunc  func(ctx context.Context, name string, params map[string]string, opts models.QueryOptions, fn func(row map[string]interface{}) error) error
+	batchFunc   func(ctx context.Context, requests []models.MetricRequest, opts models.QueryOptions) ([]models.MetricResult, error)
 }
 
-func (m *mockMetricService) GetMetricNames() []string {
-	if m.namesFunc != nil {
-		return m.namesFunc()
+func (m *mockMetricService) StreamMetric(ctx context.Context, name string, params map[string]string, opts models.QueryOptions, fn func(row map[string]interface{}) error) error {
+	if m.streamFunc != nil {
+		return m.streamFunc(ctx, name, params, opts, fn)
 	}
-	return []string{}
+	return nil
 }
 
-func (m *mockMetricService) GetMetrics(ctx context.Context, names []string, params map[string]string) ([]models.MetricResult, error) {
+func (m *mockMetricService) GetMetricSchema(ctx context.Context, name string) (models.MetricSchema, error) {
+	if m.schemaFunc != nil {
+		return m.schemaFunc(ctx, name)
+	}
+	return models.MetricSchema{}, nil
+}
+
+func (m *mockMetricService) ListMetrics(ctx context.Context, opts models.ListOptions) []models.MetricInfo {
+	if m.listFunc != nil {
+		return m.listFunc(opts)
+	}
+	return []models.MetricInfo{}
+}
+
+func (m *mockMetricService) GetMetrics(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
 	if m.metricsFunc != nil {
-		return m.metricsFunc(ctx, names, params)
+		return m.metricsFunc(ctx, names, params, opts)
+	}
+	return nil, nil
+}
+
+func (m *mockMetricService) GetMetricBatch(ctx context.Context, requests []models.MetricRequest, opts models.QueryOptions) ([]models.MetricResult, error) {
+	if m.batchFunc != nil {
+		return m.batchFunc(ctx, requests, opts)
 	}
 	return nil, nil
 }
@@ -37,17 +66,25 @@ func (m *mockMetricService) GetMetrics(ctx context.Context, names []string, para
 func TestListMetrics(t *testing.T) {
 	tests := []struct {
 		name           string
-		mockMetrics    []string
+		mockMetrics    []models.MetricInfo
 		expectedStatus int
 	}{
 		{
-			name:           "list all metrics",
-			mockMetrics:    []string{"active_users", "revenue_total", "user_signups"},
+			name: "list all metrics",
+			mockMetrics: []models.MetricInfo{
+				{Name: "active_users", Description: "Users active today", Unit: "users", Category: "engagement"},
+				{Name: "revenue_total", Unit: "USD"},
+				{
+					Name:     "user_signups",
+					MultiRow: true,
+					Params:   []models.ParamDefinition{{Name: "since", Type: models.ParamTypeDate, Required: true}},
+				},
+			},
 			expectedStatus: http.StatusOK,
 		},
 		{
 			name:           "empty metrics list",
-			mockMetrics:    []string{},
+			mockMetrics:    []models.MetricInfo{},
 			expectedStatus: http.StatusOK,
 		},
 	}
@@ -55,7 +92,7 @@ func TestListMetrics(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			svc := &mockMetricService{
-				namesFunc: func() []string {
+				listFunc: func(opts models.ListOptions) []models.MetricInfo {
 					return tt.mockMetrics
 				},
 			}
@@ -74,20 +111,77 @@ func TestListMetrics(t *testing.T) {
 				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
 			}
 
-			var result []string
+			var result []models.MetricInfo
 			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
 				t.Fatalf("failed to unmarshal response: %v", err)
 			}
 
-			if len(result) != len(tt.mockMetrics) {
-				t.Errorf("expected %d metrics, got %d", len(tt.mockMetrics), len(result))
+			if !reflect.DeepEqual(result, tt.mockMetrics) {
+				t.Errorf("expected %+v, got %+v", tt.mockMetrics, result)
+			}
+		})
+	}
+}
+
+func TestListMetrics_TagFilter(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedOpts   models.ListOptions
+	}{
+		{
+			name:           "no filter",
+			query:          "",
+			expectedStatus: http.StatusOK,
+			expectedOpts:   models.ListOptions{Tags: []string{}},
+		},
+		{
+			name:           "tags trimmed",
+			query:          "?tags=sales,+daily,",
+			expectedStatus: http.StatusOK,
+			expectedOpts:   models.ListOptions{Tags: []string{"sales", "daily"}},
+		},
+		{
+			name:           "match all",
+			query:          "?tags=sales,daily&tag_match=all",
+			expectedStatus: http.StatusOK,
+			expectedOpts:   models.ListOptions{Tags: []string{"sales", "daily"}, Match: models.TagMatchAll},
+		},
+		{
+			name:           "invalid match mode",
+			query:          "?tags=sales&tag_match=most",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotOpts models.ListOptions
+			called := false
+			svc := &mockMetricService{
+				listFunc: func(opts models.ListOptions) []models.MetricInfo {
+					gotOpts, called = opts, true
+					return []models.MetricInfo{}
+				},
 			}
+			handler := NewMetricsHandler(svc, slog.New(slog.DiscardHandler), Options{})
 
-			// Verify order and content
-			for i, name := range result {
-				if name != tt.mockMetrics[i] {
-					t.Errorf("metric %d: expected %q, got %q", i, tt.mockMetrics[i], name)
+			req := httptest.NewRequest("GET", "/metrics"+tt.query, nil)
+			w := httptest.NewRecorder()
+			handler.GetMetrics(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				if called {
+					t.Error("service called for an invalid filter")
 				}
+				return
+			}
+			if !reflect.DeepEqual(gotOpts, tt.expectedOpts) {
+				t.Errorf("ListMetrics() opts = %+v, want %+v", gotOpts, tt.expectedOpts)
 			}
 		})
 	}
@@ -102,6 +196,7 @@ func TestGetSingleMetric(t *testing.T) {
 		mockError       error
 		expectedStatus  int
 		expectedHasBody bool
+		expectedCode    ErrorCode
 	}{
 		{
 			name:       "get single metric",
@@ -115,8 +210,9 @@ func TestGetSingleMetric(t *testing.T) {
 		{
 			name:            "metric not found",
 			metricName:      "nonexistent",
-			mockError:       fmt.Errorf("metric not found"),
+			mockError:       fmt.Errorf("metric %q not found: %w", "nonexistent", service.ErrMetricNotFound),
 			expectedStatus:  http.StatusNotFound,
+			expectedCode:    CodeMetricNotFound,
 			expectedHasBody: true,
 		},
 		{
@@ -131,7 +227,7 @@ func TestGetSingleMetric(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			svc := &mockMetricService{
-				metricsFunc: func(ctx context.Context, names []string, params map[string]string) ([]models.MetricResult, error) {
+				metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
 					if tt.mockError != nil {
 						return nil, tt.mockError
 					}
@@ -164,10 +260,42 @@ func TestGetSingleMetric(t *testing.T) {
 					t.Error("expected response body, got empty")
 				}
 			}
+
+			if tt.expectedCode != "" {
+				if code := decodeAPIError(t, w).Code; code != tt.expectedCode {
+					t.Errorf("code = %q, want %q", code, tt.expectedCode)
+				}
+			}
 		})
 	}
 }
 
+func TestGetSingleMetric_RepeatedParam(t *testing.T) {
+	var got map[string]string
+	svc := &mockMetricService{
+		metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+			got = params
+			return []models.MetricResult{{Name: names[0], Value: int64(2)}}, nil
+		},
+	}
+	handler := &MetricsHandler{service: svc, logger: slog.New(slog.DiscardHandler)}
+
+	req := httptest.NewRequest("GET", "/metrics/orders?status=pending&status=shipped&region=eu", nil)
+	ctx := chi.NewRouteContext()
+	ctx.URLParams.Add("name", "orders")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, ctx))
+	w := httptest.NewRecorder()
+	handler.GetMetric(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	want := map[string]string{"status": "pending,shipped", "region": "eu"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("params = %v, want %v", got, want)
+	}
+}
+
 func TestGetMultipleMetrics(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -214,7 +342,7 @@ func TestGetMultipleMetrics(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			svc := &mockMetricService{
-				metricsFunc: func(ctx context.Context, names []string, params map[string]string) ([]models.MetricResult, error) {
+				metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
 					if tt.mockError != nil {
 						return nil, tt.mockError
 					}
@@ -250,6 +378,315 @@ func TestGetMultipleMetrics(t *testing.T) {
 	}
 }
 
+func TestGetMultipleMetrics_DedupesNames(t *testing.T) {
+	var got []string
+	svc := &mockMetricService{
+		metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+			got = names
+			return []models.MetricResult{}, nil
+		},
+	}
+	handler := &MetricsHandler{service: svc, logger: slog.New(slog.DiscardHandler)}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "?names=b,a,b,%20a", want: []string{"b", "a"}},
+		{query: "?names=a,,b", want: []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.GetMetrics(w, httptest.NewRequest("GET", "/metrics"+tt.query, nil))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", w.Code)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("names = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMultipleMetrics_MaxMetrics(t *testing.T) {
+	called := false
+	svc := &mockMetricService{
+		metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+			called = true
+			return make([]models.MetricResult, len(names)), nil
+		},
+	}
+	handler := NewMetricsHandler(svc, slog.New(slog.DiscardHandler), Options{MaxMetrics: 2})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+	}{
+		{name: "at the limit", query: "?names=a,b", wantStatus: http.StatusOK},
+		{name: "duplicates count once", query: "?names=a,b,a", wantStatus: http.StatusOK},
+		{name: "over the limit", query: "?names=a,b,c", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = false
+			w := httptest.NewRecorder()
+			handler.GetMetrics(w, httptest.NewRequest("GET", "/metrics"+tt.query, nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantStatus != http.StatusBadRequest {
+				return
+			}
+			if called {
+				t.Error("service called despite too many metrics")
+			}
+			if msg := decodeAPIError(t, w).Message; msg != "too many metrics: 3 requested, at most 2 allowed per request" {
+				t.Errorf("message = %q", msg)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	handler.QueryMetrics(w, httptest.NewRequest("POST", "/metrics", strings.NewReader(`{"names":["a","b","c"]}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("POST: expected status 400, got %d", w.Code)
+	}
+}
+
+func TestGetSingleMetric_NullValue(t *testing.T) {
+	mock := &mockMetricService{
+		metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+			return []models.MetricResult{{Name: "revenue", Value: nil}}, nil
+		},
+	}
+	handler := NewMetricsHandler(mock, slog.New(slog.DiscardHandler), Options{})
+
+	r := chi.NewRouter()
+	r.Get("/metrics/{name}", handler.GetMetric)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/revenue", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got, want := w.Body.String(), `[{"name":"revenue","value":null}]`+"\n"; got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestGetSingleMetric_Pretty(t *testing.T) {
+	mock := &mockMetricService{
+		metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+			return []models.MetricResult{{Name: "revenue", Value: int64(5)}}, nil
+		},
+	}
+	handler := NewMetricsHandler(mock, slog.New(slog.DiscardHandler), Options{})
+
+	r := chi.NewRouter()
+	r.Get("/metrics/{name}", handler.GetMetric)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "?pretty=true", want: "[\n  {\n    \"name\": \"revenue\",\n    \"value\": 5\n  }\n]\n"},
+		{query: "?pretty=false", want: `[{"name":"revenue","value":5}]` + "\n"},
+		{query: "?pretty=nonsense", want: `[{"name":"revenue","value":5}]` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/revenue"+tt.query, nil))
+
+			if w.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("body = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	mock := &mockMetricService{
+		metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+			if _, ok := params["envelope"]; ok {
+				t.Error("envelope was passed to the metric as a param")
+			}
+			results := make([]models.MetricResult, len(names))
+			for i, name := range names {
+				results[i] = models.MetricResult{Name: name, Value: int64(i)}
+			}
+			return results, nil
+		},
+	}
+	handler := NewMetricsHandler(mock, slog.New(slog.DiscardHandler), Options{})
+
+	r := chi.NewRouter()
+	r.Get("/metrics", handler.GetMetrics)
+	r.Post("/metrics", handler.QueryMetrics)
+	r.Get("/metrics/{name}", handler.GetMetric)
+
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		body      string
+		wantCount int
+	}{
+		{name: "single metric", method: "GET", target: "/metrics/revenue?envelope=true", wantCount: 1},
+		{name: "batch", method: "GET", target: "/metrics?names=revenue,signups&envelope=1", wantCount: 2},
+		{name: "body", method: "POST", target: "/metrics", body: `{"names":["revenue","signups"],"envelope":true}`, wantCount: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			var got ResultEnvelope
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("response is not an envelope: %v: %s", err, w.Body.String())
+			}
+			if len(got.Results) != tt.wantCount {
+				t.Errorf("got %d results, want %d", len(got.Results), tt.wantCount)
+			}
+			if got.GeneratedAt.Before(before.Truncate(time.Second)) || got.GeneratedAt.After(time.Now()) {
+				t.Errorf("generated_at = %v, want the time of the request", got.GeneratedAt)
+			}
+			if got.GeneratedAt.Location() != time.UTC {
+				t.Errorf("generated_at = %v, want UTC", got.GeneratedAt)
+			}
+		})
+	}
+
+	t.Run("bare array by default", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/revenue?envelope=false", nil))
+
+		if got, want := w.Body.String(), `[{"name":"revenue","value":0}]`+"\n"; got != want {
+			t.Errorf("body = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/revenue?envelope=maybe", nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+		if code := decodeAPIError(t, w).Code; code != CodeInvalidRequest {
+			t.Errorf("code = %q, want %q", code, CodeInvalidRequest)
+		}
+	})
+}
+
+func TestGetMetrics_CacheControl(t *testing.T) {
+	maxAges := map[string]int{"revenue": 300, "signups": 60, "live_users": 0}
+
+	tests := []struct {
+		name    string
+		url     string
+		failing string
+		want    string
+	}{
+		{name: "single metric", url: "/metrics/revenue", want: "max-age=300"},
+		{name: "batch uses minimum", url: "/metrics?names=revenue,signups", want: "max-age=60"},
+		{name: "unset is not stored", url: "/metrics/live_users", want: "no-store"},
+		{name: "batch with unset metric", url: "/metrics?names=revenue,live_users", want: "no-store"},
+		{name: "partial failure", url: "/metrics?names=revenue,signups&partial=true", failing: "signups", want: "no-store"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := &mockMetricService{
+				metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+					results := make([]models.MetricResult, len(names))
+					for i, name := range names {
+						results[i] = models.MetricResult{Name: name, Value: int64(1), MaxAge: maxAges[name]}
+						if name == tt.failing {
+							results[i] = models.MetricResult{Name: name, Error: "query failed"}
+						}
+					}
+					return results, nil
+				},
+			}
+			handler := NewMetricsHandler(mock, slog.New(slog.DiscardHandler), Options{})
+
+			r := chi.NewRouter()
+			r.Get("/metrics", handler.GetMetrics)
+			r.Get("/metrics/{name}", handler.GetMetric)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+
+			if got := w.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMetricSchema(t *testing.T) {
+	mock := &mockMetricService{
+		schemaFunc: func(ctx context.Context, name string) (models.MetricSchema, error) {
+			if name != "signups_by_day" {
+				return models.MetricSchema{}, fmt.Errorf("metric %q not found: %w", name, service.ErrMetricNotFound)
+			}
+			return models.MetricSchema{
+				MetricInfo: models.MetricInfo{
+					Name:     "signups_by_day",
+					MultiRow: true,
+					Params:   []models.ParamDefinition{{Name: "since", Type: models.ParamTypeDate, Required: true}},
+				},
+				Columns: []string{"date", "count"},
+			}, nil
+		},
+	}
+	handler := NewMetricsHandler(mock, slog.New(slog.DiscardHandler), Options{})
+
+	r := chi.NewRouter()
+	r.Get("/metrics/{name}/schema", handler.GetMetricSchema)
+
+	t.Run("known metric", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/signups_by_day/schema", nil))
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		want := `{"name":"signups_by_day","multi_row":true,"params":[{"name":"since","type":"date","required":true}],"columns":["date","count"]}` + "\n"
+		if w.Body.String() != want {
+			t.Errorf("body = %s, want %s", w.Body.String(), want)
+		}
+	})
+
+	t.Run("unknown metric", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/missing/schema", nil))
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+		}
+		if apiErr := decodeAPIError(t, w); apiErr.Code != CodeMetricNotFound {
+			t.Errorf("code = %q, want %q", apiErr.Code, CodeMetricNotFound)
+		}
+	})
+}
+
 func TestErrorResponse(t *testing.T) {
 	handler := &MetricsHandler{
 		service: nil,
@@ -257,18 +694,609 @@ func TestErrorResponse(t *testing.T) {
 	}
 
 	w := httptest.NewRecorder()
-	handler.respondError(w, http.StatusBadRequest, "invalid input")
+	handler.respondError(w, CodeParamInvalid, "invalid input")
 
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("expected status 400, got %d", w.Code)
 	}
 
-	var result map[string]interface{}
-	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+	apiErr := decodeAPIError(t, w)
+	if apiErr.Code != CodeParamInvalid {
+		t.Errorf("code = %q, want %q", apiErr.Code, CodeParamInvalid)
+	}
+	if apiErr.Message != "invalid input" {
+		t.Errorf("message = %q, want %q", apiErr.Message, "invalid input")
+	}
+}
+
+func TestErrorCode_Status(t *testing.T) {
+	for code, want := range codeStatus {
+		if got := code.Status(); got != want {
+			t.Errorf("%s.Status() = %d, want %d", code, got, want)
+		}
+	}
+	if got := ErrorCode("UNKNOWN").Status(); got != http.StatusInternalServerError {
+		t.Errorf("unknown code status = %d, want 500", got)
+	}
+}
+
+// decodeAPIError parses a structured error response body.
+func decodeAPIError(t *testing.T, w *httptest.ResponseRecorder) APIError {
+	t.Helper()
+
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
 		t.Fatalf("failed to unmarshal error response: %v", err)
 	}
+	return body.Error
+}
 
-	if result["error"] == nil {
-		t.Error("expected error field in response")
+func TestGetMultipleMetrics_Partial(t *testing.T) {
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+		wantPartial    bool
+	}{
+		{
+			name:           "partial enabled",
+			queryParams:    "?names=active_users,broken&partial=true",
+			expectedStatus: http.StatusOK,
+			wantPartial:    true,
+		},
+		{
+			name:           "partial disabled",
+			queryParams:    "?names=active_users,broken&partial=false",
+			expectedStatus: http.StatusOK,
+			wantPartial:    false,
+		},
+		{
+			name:           "invalid partial value",
+			queryParams:    "?names=active_users,broken&partial=maybe",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotOpts models.QueryOptions
+			var gotParams map[string]string
+			svc := &mockMetricService{
+				metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+					gotOpts = opts
+					gotParams = params
+					return []models.MetricResult{
+						{Name: "active_users", Value: int64(1523)},
+						{Name: "broken", Error: "metric \"broken\" failed: query failed"},
+					}, nil
+				},
+			}
+
+			handler := &MetricsHandler{
+				service: svc,
+				logger:  slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+			}
+
+			req := httptest.NewRequest("GET", "/metrics"+tt.queryParams, nil)
+			w := httptest.NewRecorder()
+
+			handler.GetMetrics(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			if gotOpts.Partial != tt.wantPartial {
+				t.Errorf("opts.Partial = %v, want %v", gotOpts.Partial, tt.wantPartial)
+			}
+
+			if _, ok := gotParams["partial"]; ok {
+				t.Error("reserved 'partial' parameter was passed to the service")
+			}
+
+			var result []map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+
+			if _, ok := result[0]["error"]; ok {
+				t.Error("successful result should omit the error field")
+			}
+			if result[1]["error"] == nil {
+				t.Error("failed result should include the error field")
+			}
+		})
+	}
+}
+
+func TestGetMultipleMetrics_PartialHidesQueryErrors(t *testing.T) {
+	svc := &mockMetricService{
+		metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+			queryErr := fmt.Errorf("metric \"broken\" failed: no such table: payroll: %w", service.ErrQueryFailed)
+			notFound := fmt.Errorf("metric %q not found: %w", "missing", service.ErrMetricNotFound)
+			internalErr := errors.New("decoding row: unexpected type []uint8 for column salary")
+			return []models.MetricResult{
+				{Name: "broken", Error: queryErr.Error(), Err: queryErr},
+				{Name: "missing", Error: notFound.Error(), Err: notFound},
+				{Name: "odd", Error: internalErr.Error(), Err: internalErr},
+			}, nil
+		},
+	}
+	handler := &MetricsHandler{service: svc, logger: slog.New(slog.DiscardHandler)}
+
+	tests := []struct {
+		name  string
+		debug string
+		want  []string
+	}{
+		{
+			name: "without debug",
+			want: []string{"internal server error", `metric "missing" not found: metric not found`, "internal server error"},
+		},
+		{
+			name:  "with debug",
+			debug: "&debug=true",
+			want:  []string{`metric "broken" failed: no such table: payroll: query failed`, `metric "missing" not found: metric not found`, "internal server error"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics?names=broken,missing,odd&partial=true"+tt.debug, nil)
+			w := httptest.NewRecorder()
+			handler.GetMetrics(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", w.Code)
+			}
+			var results []models.MetricResult
+			if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			var got []string
+			for _, result := range results {
+				got = append(got, result.Error)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %q, want %q", got, tt.want)
+			}
+			if tt.debug == "" && strings.Contains(w.Body.String(), "payroll") {
+				t.Errorf("body = %s, want the query error hidden", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetMetric_Pagination(t *testing.T) {
+	tests := []struct {
+		name           string
+		queryParams    string
+		expectedStatus int
+		wantOpts       models.QueryOptions
+	}{
+		{
+			name:           "no pagination",
+			queryParams:    "",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "limit and offset",
+			queryParams:    "?limit=10&offset=30",
+			expectedStatus: http.StatusOK,
+			wantOpts:       models.QueryOptions{Limit: 10, Offset: 30},
+		},
+		{
+			name:           "offset without limit uses default",
+			queryParams:    "?offset=5",
+			expectedStatus: http.StatusOK,
+			wantOpts:       models.QueryOptions{Limit: models.DefaultPageLimit, Offset: 5},
+		},
+		{
+			name:           "debug",
+			queryParams:    "?debug=true",
+			expectedStatus: http.StatusOK,
+			wantOpts:       models.QueryOptions{Debug: true},
+		},
+		{
+			name:           "invalid debug",
+			queryParams:    "?debug=yes",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "omit nulls",
+			queryParams:    "?omit_nulls=true",
+			expectedStatus: http.StatusOK,
+			wantOpts:       models.QueryOptions{OmitNulls: true},
+		},
+		{
+			name:           "invalid omit nulls",
+			queryParams:    "?omit_nulls=sometimes",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "range",
+			queryParams:    "?range=7d",
+			expectedStatus: http.StatusOK,
+			wantOpts:       models.QueryOptions{Range: "7d"},
+		},
+		{
+			name:           "non-integer limit",
+			queryParams:    "?limit=ten",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "negative offset",
+			queryParams:    "?limit=10&offset=-1",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "limit above maximum",
+			queryParams:    fmt.Sprintf("?limit=%d", models.MaxPageLimit+1),
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotOpts models.QueryOptions
+			var gotParams map[string]string
+			svc := &mockMetricService{
+				metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+					gotOpts = opts
+					gotParams = params
+					return []models.MetricResult{{Name: "signups", Value: []map[string]interface{}{}}}, nil
+				},
+			}
+
+			handler := &MetricsHandler{
+				service: svc,
+				logger:  slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+			}
+
+			req := httptest.NewRequest("GET", "/metrics/signups"+tt.queryParams, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("name", "signups")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+
+			handler.GetMetric(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			if gotOpts != tt.wantOpts {
+				t.Errorf("opts = %+v, want %+v", gotOpts, tt.wantOpts)
+			}
+
+			for _, reserved := range []string{"limit", "offset", "debug", "omit_nulls", "range"} {
+				if _, ok := gotParams[reserved]; ok {
+					t.Errorf("reserved %q parameter was passed to the service", reserved)
+				}
+			}
+		})
+	}
+}
+
+func TestGetMetric_PageEnvelope(t *testing.T) {
+	rows := []map[string]interface{}{{"day": "2025-10-20", "count": int64(12)}}
+	mock := &mockMetricService{
+		metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+			results := make([]models.MetricResult, len(names))
+			for i, name := range names {
+				results[i] = models.MetricResult{Name: name, Value: rows, Columns: []string{"day", "count"}}
+				if opts.Limit > 0 {
+					results[i].Page = &models.Page{Limit: opts.Limit, Offset: opts.Offset, Total: 30}
+				}
+			}
+			return results, nil
+		},
+	}
+	handler := NewMetricsHandler(mock, slog.New(slog.DiscardHandler), Options{})
+
+	r := chi.NewRouter()
+	r.Get("/metrics", handler.GetMetrics)
+	r.Get("/metrics/{name}", handler.GetMetric)
+
+	get := func(t *testing.T, target string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+		}
+		return w
+	}
+
+	t.Run("paginated", func(t *testing.T) {
+		w := get(t, "/metrics/signups_by_day?limit=1&offset=10")
+
+		want := `{"name":"signups_by_day","data":[{"count":12,"day":"2025-10-20"}],"columns":["day","count"],"page":{"limit":1,"offset":10,"total":30}}` + "\n"
+		if got := w.Body.String(); got != want {
+			t.Errorf("body = %s, want %s", got, want)
+		}
+	})
+
+	t.Run("unpaginated", func(t *testing.T) {
+		w := get(t, "/metrics/signups_by_day")
+
+		var got []models.MetricResult
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("response is not a result array: %v: %s", err, w.Body.String())
+		}
+		if len(got) != 1 || got[0].Page != nil {
+			t.Errorf("results = %+v, want one result without a page", got)
+		}
+	})
+
+	t.Run("explicit envelope", func(t *testing.T) {
+		w := get(t, "/metrics/signups_by_day?limit=1&envelope=true")
+
+		var got ResultEnvelope
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("response is not an envelope: %v: %s", err, w.Body.String())
+		}
+		if len(got.Results) != 1 || got.Results[0].Page == nil || got.Results[0].Page.Total != 30 {
+			t.Errorf("results = %+v, want one result with a page of total 30", got.Results)
+		}
+	})
+
+	t.Run("batch keeps per-result pages", func(t *testing.T) {
+		w := get(t, "/metrics?names=signups_by_day,orders_by_day&limit=1")
+
+		var got []models.MetricResult
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("response is not a result array: %v: %s", err, w.Body.String())
+		}
+		if len(got) != 2 || got[0].Page == nil || got[1].Page == nil {
+			t.Errorf("results = %+v, want two results with pages", got)
+		}
+	})
+}
+
+func TestHandleServiceError(t *testing.T) {
+	tests := []struct {
+		name           string
+		ctx            func() (context.Context, context.CancelFunc)
+		serviceErr     func(ctx context.Context) error
+		expectedStatus int
+		expectedCode   ErrorCode
+	}{
+		{
+			name: "request deadline exceeded",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Millisecond)
+			},
+			serviceErr: func(ctx context.Context) error {
+				<-ctx.Done()
+				return fmt.Errorf("metric %q failed: query failed: %w", "slow", ctx.Err())
+			},
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedCode:   CodeTimeout,
+		},
+		{
+			name: "driver-specific error after deadline",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), time.Millisecond)
+			},
+			serviceErr: func(ctx context.Context) error {
+				<-ctx.Done()
+				return errors.New(`metric "slow" failed: query failed: interrupted`)
+			},
+			expectedStatus: http.StatusGatewayTimeout,
+			expectedCode:   CodeTimeout,
+		},
+		{
+			name: "client canceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			serviceErr: func(ctx context.Context) error {
+				return fmt.Errorf("metric %q failed: %w", "slow", ctx.Err())
+			},
+			expectedStatus: statusClientClosedRequest,
+			expectedCode:   CodeRequestCanceled,
+		},
+		{
+			name: "database error mentioning invalid",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			serviceErr: func(ctx context.Context) error {
+				return errors.New(`metric "broken" failed: query failed: invalid input syntax for type integer`)
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   CodeInternal,
+		},
+		{
+			name: "missing parameter",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			serviceErr: func(ctx context.Context) error {
+				return fmt.Errorf(`metric "signups": required parameter "since" is missing: %w`, service.ErrParamMissing)
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   CodeParamMissing,
+		},
+		{
+			name: "invalid parameter",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			serviceErr: func(ctx context.Context) error {
+				return fmt.Errorf(`metric "signups": parameter "since": %w`, service.ErrParamInvalid)
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   CodeParamInvalid,
+		},
+		{
+			name: "disabled metric",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			serviceErr: func(ctx context.Context) error {
+				return fmt.Errorf(`metric "revenue" is disabled: %w`, service.ErrMetricDisabled)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   CodeMetricDisabled,
+		},
+		{
+			name: "forbidden metric",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			serviceErr: func(ctx context.Context) error {
+				return fmt.Errorf(`metric "user_emails" requires scope "pii": %w`, service.ErrForbidden)
+			},
+			expectedStatus: http.StatusForbidden,
+			expectedCode:   CodeForbidden,
+		},
+		{
+			name: "result too large",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			serviceErr: func(ctx context.Context) error {
+				return fmt.Errorf(`metric "all_users" returned 5 rows: %w`, service.ErrResultTooLarge)
+			},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedCode:   CodeResultTooLarge,
+		},
+		{
+			name: "other error",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			serviceErr: func(ctx context.Context) error {
+				return errors.New(`metric "broken" failed: query failed: no such table`)
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   CodeInternal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &mockMetricService{
+				metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+					return nil, tt.serviceErr(ctx)
+				},
+			}
+
+			handler := &MetricsHandler{
+				service: svc,
+				logger:  slog.New(slog.DiscardHandler),
+			}
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			req := httptest.NewRequest("GET", "/metrics?names=slow", nil).WithContext(ctx)
+			w := httptest.NewRecorder()
+
+			handler.GetMetrics(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if code := decodeAPIError(t, w).Code; code != tt.expectedCode {
+				t.Errorf("code = %q, want %q", code, tt.expectedCode)
+			}
+		})
+	}
+}
+
+func TestHandleServiceError_MissingParamSpec(t *testing.T) {
+	params := []models.ParamDefinition{
+		{Name: "since", Type: models.ParamTypeDate, Required: true},
+		{Name: "max_rows", Type: models.ParamTypeInt, Default: "10"},
+	}
+	missing := &service.MissingParamError{
+		Metric: "signups",
+		Param:  "since",
+		Params: params,
+		Err:    errors.New(`metric "signups": required parameter "since" is missing`),
+	}
+	svc := &mockMetricService{
+		metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+			return nil, fmt.Errorf("%w: %w", missing, service.ErrParamMissing)
+		},
+	}
+	handler := NewMetricsHandler(svc, slog.New(slog.DiscardHandler), Options{})
+
+	w := httptest.NewRecorder()
+	handler.GetMetrics(w, httptest.NewRequest("GET", "/metrics?names=signups", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	var body struct {
+		Error struct {
+			Code    ErrorCode `json:"code"`
+			Message string    `json:"message"`
+			Details struct {
+				Metric string                   `json:"metric"`
+				Param  string                   `json:"param"`
+				Params []models.ParamDefinition `json:"params"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal error response: %v", err)
+	}
+	if body.Error.Code != CodeParamMissing || !strings.HasPrefix(body.Error.Message, missing.Error()) {
+		t.Errorf("error = %s %q, want PARAM_MISSING with the service's message", body.Error.Code, body.Error.Message)
+	}
+	if body.Error.Details.Metric != "signups" || body.Error.Details.Param != "since" {
+		t.Errorf("details name %s.%s, want signups.since", body.Error.Details.Metric, body.Error.Details.Param)
+	}
+	if !reflect.DeepEqual(body.Error.Details.Params, params) {
+		t.Errorf("details.params = %+v, want %+v", body.Error.Details.Params, params)
+	}
+}
+
+func TestHandleServiceError_QueryFailedDebug(t *testing.T) {
+	queryErr := fmt.Errorf(`metric "broken" failed: query failed: no such column: emial: %w`, service.ErrQueryFailed)
+
+	tests := []struct {
+		name        string
+		url         string
+		wantMessage string
+	}{
+		{name: "hidden by default", url: "/metrics?names=broken", wantMessage: "internal server error"},
+		{name: "shown with debug", url: "/metrics?names=broken&debug=true", wantMessage: queryErr.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &mockMetricService{
+				metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+					return nil, queryErr
+				},
+			}
+			handler := NewMetricsHandler(svc, slog.New(slog.DiscardHandler), Options{})
+
+			w := httptest.NewRecorder()
+			handler.GetMetrics(w, httptest.NewRequest("GET", tt.url, nil))
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusInternalServerError)
+			}
+			apiErr := decodeAPIError(t, w)
+			if apiErr.Code != CodeInternal || apiErr.Message != tt.wantMessage {
+				t.Errorf("error = %s %q, want %s %q", apiErr.Code, apiErr.Message, CodeInternal, tt.wantMessage)
+			}
+		})
 	}
 }
@@ -0,0 +1,59 @@
+// Streams multi-row metric results as newline-delimited JSON.
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+// ndjsonFlushRows is how many rows are written between flushes. Flushing
+// every row would cost a syscall each; the first row is always flushed so
+// the client sees the response start promptly.
+const ndjsonFlushRows = 1000
+
+// streamNDJSON writes a multi-row metric one JSON object per line as rows
+// arrive from the database, so large exports are never held in memory.
+// Headers are sent with the first row: a failure before then gets a normal
+// error response, but one after can only end the stream with an error line.
+func (h *MetricsHandler) streamNDJSON(w http.ResponseWriter, r *http.Request, name string, params map[string]string, opts models.QueryOptions) {
+	if opts.Paginated() {
+		h.respondError(w, CodeInvalidRequest, "limit and offset cannot be used with NDJSON output")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	rows := 0
+	start := func() {
+		w.Header().Set("Content-Type", ndjsonContentType)
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	}
+
+	err := h.service.StreamMetric(r.Context(), name, params, opts, func(row map[string]interface{}) error {
+		if rows == 0 {
+			start()
+		}
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+		rows++
+		if rows == 1 || rows%ndjsonFlushRows == 0 {
+			// Best effort: a writer that cannot flush still delivers every row
+			rc.Flush()
+		}
+		return nil
+	})
+
+	switch {
+	case err != nil && rows == 0:
+		h.handleServiceError(w, r, err, opts.Debug)
+	case err != nil:
+		h.logger.Error("NDJSON stream ended early", "metric", name, "rows", rows, "error", err)
+		enc.Encode(errorResponse{Error: APIError{Code: CodeInternal, Message: "stream ended early"}})
+	case rows == 0:
+		start()
+	}
+}
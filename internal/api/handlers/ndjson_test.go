@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/service"
+)
+
+func streamRows(rows int, err error) func(ctx context.Context, name string, params map[string]string, opts models.QueryOptions, fn func(row map[string]interface{}) error) error {
+	return func(ctx context.Context, name string, params map[string]string, opts models.QueryOptions, fn func(row map[string]interface{}) error) error {
+		for i := 1; i <= rows; i++ {
+			if ferr := fn(map[string]interface{}{"id": i}); ferr != nil {
+				return ferr
+			}
+		}
+		return err
+	}
+}
+
+func serveNDJSON(t *testing.T, svc *mockMetricService, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	handler := &MetricsHandler{service: svc, logger: slog.New(slog.DiscardHandler)}
+
+	req := httptest.NewRequest("GET", target, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("name", "all_users")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.GetMetric(w, req)
+	return w
+}
+
+func ndjsonLines(t *testing.T, w *httptest.ResponseRecorder) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestGetMetric_NDJSON(t *testing.T) {
+	w := serveNDJSON(t, &mockMetricService{streamFunc: streamRows(3, nil)}, "/metrics/all_users?format=ndjson")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ndjsonContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ndjsonContentType)
+	}
+	if !w.Flushed {
+		t.Error("expected the response to be flushed after the first row")
+	}
+	lines := ndjsonLines(t, w)
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3", len(lines))
+	}
+	if lines[2]["id"] != float64(3) {
+		t.Errorf("last line = %v, want id 3", lines[2])
+	}
+}
+
+func TestGetMetric_NDJSONEmpty(t *testing.T) {
+	w := serveNDJSON(t, &mockMetricService{streamFunc: streamRows(0, nil)}, "/metrics/all_users?format=ndjson")
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ndjsonContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ndjsonContentType)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("body = %q, want empty", w.Body.String())
+	}
+}
+
+func TestGetMetric_NDJSONErrors(t *testing.T) {
+	t.Run("before first row", func(t *testing.T) {
+		err := service.ErrMetricNotFound
+		w := serveNDJSON(t, &mockMetricService{streamFunc: streamRows(0, err)}, "/metrics/all_users?format=ndjson")
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+	})
+
+	t.Run("mid-stream", func(t *testing.T) {
+		w := serveNDJSON(t, &mockMetricService{streamFunc: streamRows(2, errors.New("connection reset"))}, "/metrics/all_users?format=ndjson")
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", w.Code)
+		}
+		lines := ndjsonLines(t, w)
+		if len(lines) != 3 {
+			t.Fatalf("got %d lines, want 2 rows and an error", len(lines))
+		}
+		apiErr, ok := lines[2]["error"].(map[string]interface{})
+		if !ok || apiErr["code"] != string(CodeInternal) {
+			t.Errorf("last line = %v, want an internal error", lines[2])
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		w := serveNDJSON(t, &mockMetricService{streamFunc: streamRows(3, nil)}, "/metrics/all_users?format=ndjson&limit=10")
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", w.Code)
+		}
+	})
+}
+
+func TestGetMultipleMetrics_NDJSONRejected(t *testing.T) {
+	handler := &MetricsHandler{service: &mockMetricService{}, logger: slog.New(slog.DiscardHandler)}
+
+	req := httptest.NewRequest("GET", "/metrics?names=a,b&format=ndjson", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetMetrics(w, req)
+
+	if w.Code != http.StatusNotAcceptable {
+		t.Errorf("expected status 406, got %d", w.Code)
+	}
+}
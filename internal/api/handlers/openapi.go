@@ -0,0 +1,17 @@
+// HTTP handler serving the OpenAPI document for the configured metrics.
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/openapi"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/version"
+)
+
+// GetOpenAPI handles GET /openapi.json. The document is built per request
+// from the current catalog, so it reflects configuration reloads.
+func (h *MetricsHandler) GetOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc := openapi.Build(h.service.ListMetrics(r.Context(), models.ListOptions{}), version.Version)
+	h.respondJSON(w, r, http.StatusOK, doc)
+}
@@ -0,0 +1,221 @@
+// HTTP handler for querying metrics with a JSON request body.
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+// QueryRequest is the JSON body accepted by POST /metrics. Params are
+// strings, as in the query string, and are converted using each metric's
+// declared parameter types. A body either shares Params across Names, or
+// lists Metrics that each carry their own params.
+type QueryRequest struct {
+	Names     []string               `json:"names"`
+	Params    map[string]string      `json:"params"`
+	Metrics   []models.MetricRequest `json:"metrics"`
+	Partial   bool                   `json:"partial"`
+	Limit     int                    `json:"limit"`
+	Offset    int                    `json:"offset"`
+	Debug     bool                   `json:"debug"`
+	OmitNulls bool                   `json:"omit_nulls"`
+	Range     string                 `json:"range"`
+	Envelope  bool                   `json:"envelope"`
+}
+
+// QueryMetrics handles POST /metrics, the body-based equivalent of
+// GET /metrics?names=... for batches too large or awkward for a URL.
+func (h *MetricsHandler) QueryMetrics(w http.ResponseWriter, r *http.Request) {
+	var req QueryRequest
+
+	// The body size limit is applied by router middleware; exceeding it
+	// surfaces here as a decode error.
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			h.respondAPIError(w, APIError{
+				Code:    CodeBodyTooLarge,
+				Message: fmt.Sprintf("request body exceeds %d bytes", maxErr.Limit),
+				Details: map[string]interface{}{"limit_bytes": maxErr.Limit},
+			})
+			return
+		}
+		h.respondAPIError(w, decodeError(err))
+		return
+	}
+	if dec.More() {
+		h.respondError(w, CodeInvalidRequest, "invalid JSON body: unexpected data after the top-level object")
+		return
+	}
+
+	if len(req.Metrics) > 0 {
+		h.queryMetricBatch(w, r, req)
+		return
+	}
+
+	names := cleanNames(req.Names)
+	if len(names) == 0 {
+		h.respondAPIError(w, APIError{
+			Code:    CodeInvalidRequest,
+			Message: "names: expected a non-empty array of metric names",
+			Details: map[string]interface{}{"field": "names"},
+		})
+		return
+	}
+	if !h.checkMetricCount(w, names) {
+		return
+	}
+
+	opts, err := req.queryOptions()
+	if err != nil {
+		h.respondError(w, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	params := req.Params
+	if params == nil {
+		params = map[string]string{}
+	}
+
+	results, err := h.service.GetMetrics(r.Context(), names, params, opts)
+	if err != nil {
+		h.handleServiceError(w, r, err, opts.Debug)
+		return
+	}
+	maskResultErrors(r, results, opts.Debug)
+
+	setCacheControl(w, results)
+	h.respondResults(w, r, results, req.Envelope)
+}
+
+// queryMetricBatch answers a body that lists metrics with their own params.
+// Entries are run as given, so the same metric may appear with different
+// params; only blank names are rejected.
+func (h *MetricsHandler) queryMetricBatch(w http.ResponseWriter, r *http.Request, req QueryRequest) {
+	if len(req.Names) > 0 || req.Params != nil {
+		h.respondError(w, CodeInvalidRequest, "metrics cannot be combined with names or params; give each metric its own params")
+		return
+	}
+
+	requests := make([]models.MetricRequest, len(req.Metrics))
+	names := make([]string, len(req.Metrics))
+	for i, m := range req.Metrics {
+		name := strings.TrimSpace(m.Name)
+		if name == "" {
+			h.respondError(w, CodeInvalidRequest, fmt.Sprintf("metrics[%d]: name is required", i))
+			return
+		}
+		params := m.Params
+		if params == nil {
+			params = map[string]string{}
+		}
+		requests[i] = models.MetricRequest{Name: name, Params: params}
+		names[i] = name
+	}
+	if !h.checkMetricCount(w, names) {
+		return
+	}
+
+	opts, err := req.queryOptions()
+	if err != nil {
+		h.respondError(w, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	results, err := h.service.GetMetricBatch(r.Context(), requests, opts)
+	if err != nil {
+		h.handleServiceError(w, r, err, opts.Debug)
+		return
+	}
+	maskResultErrors(r, results, opts.Debug)
+
+	setCacheControl(w, results)
+	h.respondResults(w, r, results, req.Envelope)
+}
+
+// decodeError describes why a body failed to decode. Type mismatches and
+// unknown fields name the field, in details as well as the message, so a
+// client can point at the mistake rather than parse encoding/json's wording.
+func decodeError(err error) APIError {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "body"
+		}
+		expected := jsonTypeName(typeErr.Type)
+		return APIError{
+			Code:    CodeInvalidRequest,
+			Message: fmt.Sprintf("invalid JSON body: %s: expected %s, got %s", field, expected, typeErr.Value),
+			Details: map[string]interface{}{"field": field, "expected": expected, "got": typeErr.Value},
+		}
+	case errors.As(err, &syntaxErr):
+		return APIError{
+			Code:    CodeInvalidRequest,
+			Message: fmt.Sprintf("invalid JSON body: %v at byte %d", err, syntaxErr.Offset),
+			Details: map[string]interface{}{"offset": syntaxErr.Offset},
+		}
+	case errors.Is(err, io.EOF):
+		return APIError{Code: CodeInvalidRequest, Message: "invalid JSON body: body is empty"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return APIError{Code: CodeInvalidRequest, Message: "invalid JSON body: unexpected end of input"}
+	}
+
+	// DisallowUnknownFields reports a plain error with no type to match.
+	if quoted, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if field, err := strconv.Unquote(quoted); err == nil {
+			return APIError{
+				Code:    CodeInvalidRequest,
+				Message: fmt.Sprintf("invalid JSON body: unknown field %q", field),
+				Details: map[string]interface{}{"field": field},
+			}
+		}
+	}
+	return APIError{Code: CodeInvalidRequest, Message: fmt.Sprintf("invalid JSON body: %v", err)}
+}
+
+// jsonTypeName describes the JSON a Go type decodes from, such as "array
+// of strings" for []string.
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array of " + jsonTypeName(t.Elem()) + "s"
+	case reflect.Map:
+		return "object of " + jsonTypeName(t.Elem()) + "s"
+	default:
+		return "object"
+	}
+}
+
+// queryOptions converts the body's execution flags, applying page defaults.
+func (req QueryRequest) queryOptions() (models.QueryOptions, error) {
+	return withPageDefaults(models.QueryOptions{
+		Partial:   req.Partial,
+		Limit:     req.Limit,
+		Offset:    req.Offset,
+		Debug:     req.Debug,
+		OmitNulls: req.OmitNulls,
+		Range:     req.Range,
+	})
+}
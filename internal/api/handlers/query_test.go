@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+func TestQueryMetrics(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		wantNames      []string
+		wantParams     map[string]string
+		wantOpts       models.QueryOptions
+	}{
+		{
+			name:           "valid batch",
+			body:           `{"names":["active_users"," revenue "],"params":{"start_date":"2025-01-01","tags":"a,b&c"}}`,
+			expectedStatus: http.StatusOK,
+			wantNames:      []string{"active_users", "revenue"},
+			wantParams:     map[string]string{"start_date": "2025-01-01", "tags": "a,b&c"},
+		},
+		{
+			name:           "options in body",
+			body:           `{"names":["signups"],"partial":true,"offset":20,"range":"this_month"}`,
+			expectedStatus: http.StatusOK,
+			wantNames:      []string{"signups"},
+			wantParams:     map[string]string{},
+			wantOpts:       models.QueryOptions{Partial: true, Limit: models.DefaultPageLimit, Offset: 20, Range: "this_month"},
+		},
+		{
+			name:           "malformed JSON",
+			body:           `{"names":["active_users"]`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "non-string param",
+			body:           `{"names":["active_users"],"params":{"user_id":2}}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown field",
+			body:           `{"metrics":["active_users"]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "no names",
+			body:           `{"names":[" "]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid limit",
+			body:           `{"names":["signups"],"limit":-1}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotNames []string
+			var gotParams map[string]string
+			var gotOpts models.QueryOptions
+			svc := &mockMetricService{
+				metricsFunc: func(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+					gotNames, gotParams, gotOpts = names, params, opts
+					results := make([]models.MetricResult, len(names))
+					for i, name := range names {
+						results[i] = models.MetricResult{Name: name, Value: int64(1)}
+					}
+					return results, nil
+				},
+			}
+
+			handler := &MetricsHandler{
+				service: svc,
+				logger:  slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+			}
+
+			req := httptest.NewRequest("POST", "/metrics", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+
+			handler.QueryMetrics(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+
+			if tt.expectedStatus != http.StatusOK {
+				if code := decodeAPIError(t, w).Code; code != CodeInvalidRequest {
+					t.Errorf("code = %q, want %q", code, CodeInvalidRequest)
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(gotNames, tt.wantNames) {
+				t.Errorf("names = %q, want %q", gotNames, tt.wantNames)
+			}
+			if !reflect.DeepEqual(gotParams, tt.wantParams) {
+				t.Errorf("params = %v, want %v", gotParams, tt.wantParams)
+			}
+			if gotOpts != tt.wantOpts {
+				t.Errorf("opts = %+v, want %+v", gotOpts, tt.wantOpts)
+			}
+
+			var results []models.MetricResult
+			if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if len(results) != len(tt.wantNames) {
+				t.Errorf("got %d results, want %d", len(results), len(tt.wantNames))
+			}
+		})
+	}
+}
+
+func TestQueryMetrics_MalformedBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantDetails map[string]interface{}
+	}{
+		{
+			name:        "names is a string",
+			body:        `{"names":"active_users"}`,
+			wantDetails: map[string]interface{}{"field": "names", "expected": "array of strings", "got": "string"},
+		},
+		{
+			name:        "name is a number",
+			body:        `{"names":["active_users",7]}`,
+			wantDetails: map[string]interface{}{"field": "names.1", "expected": "string", "got": "number"},
+		},
+		{
+			name:        "params is an array",
+			body:        `{"names":["active_users"],"params":["user_id"]}`,
+			wantDetails: map[string]interface{}{"field": "params", "expected": "object of strings", "got": "array"},
+		},
+		{
+			name:        "param value is a number",
+			body:        `{"names":["active_users"],"params":{"user_id":2}}`,
+			wantDetails: map[string]interface{}{"field": "params.user_id", "expected": "string", "got": "number"},
+		},
+		{
+			name:        "body is an array",
+			body:        `["active_users"]`,
+			wantDetails: map[string]interface{}{"field": "body", "expected": "object", "got": "array"},
+		},
+		{
+			name:        "unknown field",
+			body:        `{"name":["active_users"]}`,
+			wantDetails: map[string]interface{}{"field": "name"},
+		},
+		{
+			name:        "missing names",
+			body:        `{"params":{"user_id":"2"}}`,
+			wantDetails: map[string]interface{}{"field": "names"},
+		},
+		{
+			name:        "empty names",
+			body:        `{"names":[]}`,
+			wantDetails: map[string]interface{}{"field": "names"},
+		},
+		{
+			name:        "syntax error",
+			body:        `{"names":["active_users"],}`,
+			wantDetails: map[string]interface{}{"offset": float64(27)},
+		},
+		{
+			name: "truncated",
+			body: `{"names":["active_users"`,
+		},
+		{
+			name: "empty body",
+			body: ``,
+		},
+		{
+			name: "trailing data",
+			body: `{"names":["active_users"]} {"names":["revenue"]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &MetricsHandler{
+				service: &mockMetricService{},
+				logger:  slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+			}
+
+			req := httptest.NewRequest("POST", "/metrics", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.QueryMetrics(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d: %s", w.Code, w.Body.String())
+			}
+			apiErr := decodeAPIError(t, w)
+			if apiErr.Code != CodeInvalidRequest {
+				t.Errorf("code = %q, want %q", apiErr.Code, CodeInvalidRequest)
+			}
+			if len(apiErr.Details) != 0 || len(tt.wantDetails) != 0 {
+				if !reflect.DeepEqual(apiErr.Details, tt.wantDetails) {
+					t.Errorf("details = %v, want %v", apiErr.Details, tt.wantDetails)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryMetrics_BodyTooLarge(t *testing.T) {
+	handler := &MetricsHandler{
+		service: &mockMetricService{},
+		logger:  slog.New(slog.NewJSONHandler(os.Stderr, nil)),
+	}
+
+	body := `{"names":["` + strings.Repeat("a", 2048) + `"]}`
+	req := httptest.NewRequest("POST", "/metrics", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	req.Body = http.MaxBytesReader(w, req.Body, 1024)
+
+	handler.QueryMetrics(w, req)
+
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", w.Code)
+	}
+
+	apiErr := decodeAPIError(t, w)
+	if apiErr.Code != CodeBodyTooLarge {
+		t.Errorf("code = %q, want %q", apiErr.Code, CodeBodyTooLarge)
+	}
+	if apiErr.Details["limit_bytes"] != float64(1024) {
+		t.Errorf("details = %v, want limit_bytes 1024", apiErr.Details)
+	}
+}
+
+func TestQueryMetrics_PerMetricParams(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		wantStatus   int
+		wantRequests []models.MetricRequest
+		wantOpts     models.QueryOptions
+	}{
+		{
+			name:       "mixed params",
+			body:       `{"metrics":[{"name":"signups","params":{"start_date":"2025-01-01"}},{"name":" top_orders ","params":{"count":"10"}},{"name":"server_time"}],"partial":true}`,
+			wantStatus: http.StatusOK,
+			wantRequests: []models.MetricRequest{
+				{Name: "signups", Params: map[string]string{"start_date": "2025-01-01"}},
+				{Name: "top_orders", Params: map[string]string{"count": "10"}},
+				{Name: "server_time", Params: map[string]string{}},
+			},
+			wantOpts: models.QueryOptions{Partial: true},
+		},
+		{
+			name:       "same metric twice",
+			body:       `{"metrics":[{"name":"signups","params":{"start_date":"2025-01-01"}},{"name":"signups","params":{"start_date":"2025-06-01"}}]}`,
+			wantStatus: http.StatusOK,
+			wantRequests: []models.MetricRequest{
+				{Name: "signups", Params: map[string]string{"start_date": "2025-01-01"}},
+				{Name: "signups", Params: map[string]string{"start_date": "2025-06-01"}},
+			},
+		},
+		{
+			name:       "blank name",
+			body:       `{"metrics":[{"name":"signups"},{"name":" "}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "combined with shared params",
+			body:       `{"metrics":[{"name":"signups"}],"params":{"start_date":"2025-01-01"}}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "combined with names",
+			body:       `{"metrics":[{"name":"signups"}],"names":["revenue"]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too many metrics",
+			body:       `{"metrics":[{"name":"a"},{"name":"b"},{"name":"c"},{"name":"d"}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRequests []models.MetricRequest
+			var gotOpts models.QueryOptions
+			svc := &mockMetricService{
+				batchFunc: func(ctx context.Context, requests []models.MetricRequest, opts models.QueryOptions) ([]models.MetricResult, error) {
+					gotRequests, gotOpts = requests, opts
+					results := make([]models.MetricResult, len(requests))
+					for i, req := range requests {
+						results[i] = models.MetricResult{Name: req.Name, Value: int64(i)}
+					}
+					return results, nil
+				},
+			}
+			handler := NewMetricsHandler(svc, slog.New(slog.DiscardHandler), Options{MaxMetrics: 3})
+
+			w := httptest.NewRecorder()
+			handler.QueryMetrics(w, httptest.NewRequest("POST", "/metrics", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				if code := decodeAPIError(t, w).Code; code != CodeInvalidRequest {
+					t.Errorf("code = %q, want %q", code, CodeInvalidRequest)
+				}
+				return
+			}
+
+			if !reflect.DeepEqual(gotRequests, tt.wantRequests) {
+				t.Errorf("requests = %+v, want %+v", gotRequests, tt.wantRequests)
+			}
+			if gotOpts != tt.wantOpts {
+				t.Errorf("opts = %+v, want %+v", gotOpts, tt.wantOpts)
+			}
+
+			var results []models.MetricResult
+			if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if len(results) != len(tt.wantRequests) {
+				t.Errorf("got %d results, want %d", len(results), len(tt.wantRequests))
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+// HTTP handler reporting the build information of the running server.
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/version"
+)
+
+// GetVersion handles GET /version.
+func (h *MetricsHandler) GetVersion(w http.ResponseWriter, r *http.Request) {
+	h.respondJSON(w, r, http.StatusOK, version.Get())
+}
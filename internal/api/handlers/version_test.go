@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/version"
+)
+
+func TestGetVersion(t *testing.T) {
+	orig := version.Get()
+	t.Cleanup(func() {
+		version.Version, version.Commit, version.Built = orig.Version, orig.Commit, orig.Built
+	})
+	version.Version, version.Commit, version.Built = "v1.2.0", "abc1234", "2025-10-01T12:00:00Z"
+
+	handler := NewMetricsHandler(&mockMetricService{}, slog.New(slog.DiscardHandler), Options{})
+
+	req := httptest.NewRequest("GET", "/version", nil)
+	w := httptest.NewRecorder()
+	handler.GetVersion(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var got version.Info
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	want := version.Info{Version: "v1.2.0", Commit: "abc1234", Built: "2025-10-01T12:00:00Z"}
+	if got != want {
+		t.Errorf("version = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,46 @@
+// Prometheus instrumentation for HTTP requests.
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var httpRequestDuration = promauto.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "dashboard_http_request_duration_seconds",
+		Help:    "Duration of HTTP requests by route pattern and status code.",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"path", "status"},
+)
+
+// prometheusMiddleware records request duration labelled by chi route pattern
+// rather than raw path, so per-metric URLs don't explode label cardinality.
+func prometheusMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(wrapped, r)
+
+		httpRequestDuration.
+			WithLabelValues(routePattern(r), strconv.Itoa(wrapped.statusCode)).
+			Observe(time.Since(start).Seconds())
+	})
+}
+
+// routePattern returns the matched chi route, or "unmatched" for unknown paths.
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return "unmatched"
+}
@@ -0,0 +1,123 @@
+// Per-client token-bucket rate limiting middleware.
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/api/handlers"
+	"golang.org/x/time/rate"
+)
+
+// rateLimitIdleTTL is how long a client's limiter is kept after its last
+// request. Evicting it then loses nothing as long as the bucket has refilled.
+const rateLimitIdleTTL = 3 * time.Minute
+
+// rateLimiter holds one token bucket per client IP.
+type rateLimiter struct {
+	limit   rate.Limit
+	burst   int
+	idleTTL time.Duration
+	now     func() time.Time
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimiter
+	lastSweep time.Time
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	idleTTL := rateLimitIdleTTL
+	if refill := time.Duration(float64(burst) / perSecond * float64(time.Second)); refill > idleTTL {
+		idleTTL = refill
+	}
+
+	return &rateLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   burst,
+		idleTTL: idleTTL,
+		now:     time.Now,
+		clients: make(map[string]*clientLimiter),
+	}
+}
+
+// reserve takes a token for client, returning how long it must wait when
+// none is available. A denied request does not consume a token.
+func (rl *rateLimiter) reserve(client string) time.Duration {
+	now := rl.now()
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	c, ok := rl.clients[client]
+	if !ok {
+		c = &clientLimiter{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.clients[client] = c
+	}
+	c.lastSeen = now
+
+	res := c.limiter.ReserveN(now, 1)
+	delay := res.DelayFrom(now)
+	if delay > 0 {
+		res.CancelAt(now)
+	}
+	return delay
+}
+
+// sweep evicts idle clients, at most once per idleTTL so the cost stays
+// proportional to the request rate. Callers must hold mu.
+func (rl *rateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < rl.idleTTL {
+		return
+	}
+	rl.lastSweep = now
+
+	for client, c := range rl.clients {
+		if now.Sub(c.lastSeen) >= rl.idleTTL {
+			delete(rl.clients, client)
+		}
+	}
+}
+
+// rateLimitMiddleware rejects requests beyond perSecond (with bursts up to
+// burst) from any one client IP with 429 and a Retry-After header. It relies
+// on middleware.RealIP having already replaced RemoteAddr.
+func rateLimitMiddleware(perSecond float64, burst int) func(http.Handler) http.Handler {
+	rl := newRateLimiter(perSecond, burst)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if delay := rl.reserve(clientIP(r)); delay > 0 {
+				retryAfter := int(math.Ceil(delay.Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				handlers.WriteError(w, handlers.CodeRateLimited, "rate limit exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP strips the port from RemoteAddr, which RealIP leaves in place
+// when no forwarding header was present.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/api/handlers"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	handler := rateLimitMiddleware(1, 2)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The burst is allowed; the port differs per connection but the client is the same
+	for i, addr := range []string{"192.0.2.1:1000", "192.0.2.1:1001"} {
+		if w := serve(addr); w.Code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want %d", i+1, w.Code, http.StatusOK)
+		}
+	}
+
+	w := serve("192.0.2.1:1002")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("over-limit status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want %q", got, "1")
+	}
+
+	var body struct {
+		Error handlers.APIError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to decode error body: %v", err)
+	}
+	if body.Error.Code != handlers.CodeRateLimited {
+		t.Errorf("error code = %q, want %q", body.Error.Code, handlers.CodeRateLimited)
+	}
+
+	if w := serve("198.51.100.7:1000"); w.Code != http.StatusOK {
+		t.Errorf("other client status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRateLimiter_Refill(t *testing.T) {
+	now := time.Unix(0, 0)
+	rl := newRateLimiter(2, 1)
+	rl.now = func() time.Time { return now }
+
+	if delay := rl.reserve("a"); delay != 0 {
+		t.Fatalf("first request delay = %v, want 0", delay)
+	}
+	if delay := rl.reserve("a"); delay != 500*time.Millisecond {
+		t.Errorf("over-limit delay = %v, want 500ms", delay)
+	}
+
+	// A denied request must not consume the token that is refilling
+	now = now.Add(500 * time.Millisecond)
+	if delay := rl.reserve("a"); delay != 0 {
+		t.Errorf("delay after refill = %v, want 0", delay)
+	}
+}
+
+func TestRateLimiter_EvictsIdleClients(t *testing.T) {
+	now := time.Unix(0, 0)
+	rl := newRateLimiter(10, 5)
+	rl.now = func() time.Time { return now }
+
+	rl.reserve("idle")
+	now = now.Add(rl.idleTTL / 2)
+	rl.reserve("active")
+
+	now = now.Add(rl.idleTTL / 2)
+	rl.reserve("active")
+
+	if _, ok := rl.clients["idle"]; ok {
+		t.Error("idle client was not evicted")
+	}
+	if _, ok := rl.clients["active"]; !ok {
+		t.Error("active client was evicted")
+	}
+}
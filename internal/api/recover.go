@@ -0,0 +1,46 @@
+// Recovery from handler panics with a JSON error response.
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/api/handlers"
+)
+
+// recoverMiddleware turns a panic in a later handler into a 500 in the
+// API's error shape. The panic and its stack are logged with the request
+// ID so the failure can be traced, but only a generic message reaches the
+// client.
+func recoverMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				// The server uses this panic to abort a response on purpose
+				if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(rec)
+				}
+
+				logger.Error(
+					"panic serving request",
+					"panic", fmt.Sprint(rec),
+					"method", r.Method,
+					"path", r.URL.Path,
+					"request_id", middleware.GetReqID(r.Context()),
+					"stack", string(debug.Stack()),
+				)
+				handlers.WriteError(w, handlers.CodeInternal, "internal server error")
+			}()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
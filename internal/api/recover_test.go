@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/api/handlers"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	handler := middleware.RequestID(recoverMiddleware(logger)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("metric cache corrupted")
+	})))
+
+	req := httptest.NewRequest("GET", "/metrics/active_users", nil)
+	req.Header.Set(middleware.RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	var body struct {
+		Error handlers.APIError `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal error response: %v", err)
+	}
+	if body.Error.Code != handlers.CodeInternal || body.Error.Message != "internal server error" {
+		t.Errorf("error = %+v, want INTERNAL internal server error", body.Error)
+	}
+	if body := w.Body.String(); strings.Contains(body, "goroutine") || strings.Contains(body, "corrupted") {
+		t.Errorf("body leaks the panic: %s", body)
+	}
+
+	for _, want := range []string{`"panic":"metric cache corrupted"`, `"request_id":"req-42"`, `"stack":"goroutine`} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("log missing %s: %s", want, logs.String())
+		}
+	}
+}
+
+func TestRecoverMiddleware_AbortHandler(t *testing.T) {
+	handler := recoverMiddleware(slog.New(slog.DiscardHandler))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		rec := recover()
+		if err, ok := rec.(error); !ok || !errors.Is(err, http.ErrAbortHandler) {
+			t.Errorf("recovered %v, want http.ErrAbortHandler to propagate", rec)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+// panickingService panics while serving any metric.
+type panickingService struct{ stubService }
+
+func (panickingService) GetMetrics(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+	panic("metric cache corrupted")
+}
+
+func TestNewRouter_RecoversPanic(t *testing.T) {
+	logger := slog.New(slog.DiscardHandler)
+	router := NewRouter(handlers.NewMetricsHandler(panickingService{}, logger, handlers.Options{}), logger, Options{})
+
+	for _, encoding := range []string{"", "gzip"} {
+		t.Run("accept-encoding "+encoding, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics/active_users", nil)
+			if encoding != "" {
+				req.Header.Set("Accept-Encoding", encoding)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("status = %d, want 500", w.Code)
+			}
+			var body io.Reader = w.Body
+			if w.Header().Get("Content-Encoding") == "gzip" {
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("gzip.NewReader() error = %v", err)
+				}
+				body = zr
+			}
+			data, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("reading body: %v", err)
+			}
+			if !strings.Contains(string(data), `"code":"INTERNAL"`) {
+				t.Errorf("body = %s, want an INTERNAL error", data)
+			}
+		})
+	}
+}
@@ -2,35 +2,212 @@
 package api
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/api/handlers"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/service"
 )
 
+// Options configures optional router behaviour. The zero value disables
+// every optional feature.
+type Options struct {
+	// APIKeys enables authentication when non-empty; requests must present one of them.
+	APIKeys []string
+
+	// ScopedAPIKeys maps further accepted keys to the scopes they grant,
+	// limiting them to metrics whose scopes they cover. It also enables
+	// authentication when non-empty.
+	ScopedAPIKeys map[string][]string
+
+	// CORSOrigins enables CORS when non-empty. "*" allows any origin without credentials.
+	CORSOrigins []string
+
+	// MaxBodyBytes caps request body size when positive; larger bodies get 413.
+	MaxBodyBytes int64
+
+	// RateLimit enables per-client-IP rate limiting when positive, in requests
+	// per second. RateBurst is how many requests may arrive at once.
+	RateLimit float64
+	RateBurst int
+
+	// SecurityHeaders sets nosniff, frame-denying and Content-Security-Policy
+	// headers on every response.
+	SecurityHeaders bool
+
+	// RequestTimeout cancels each request's context after this long when
+	// positive, answering 504; see RequestTimeout for deriving it from the
+	// server's write timeout.
+	RequestTimeout time.Duration
+
+	// SensitiveParam reports whether a query parameter's value must be
+	// redacted from request logs; nil logs every value.
+	SensitiveParam func(name string) bool
+}
+
+// requestTimeoutMargin is how long before the server's write timeout a
+// request is cancelled, leaving time to write its 504 before the server
+// cuts the connection.
+const requestTimeoutMargin = 5 * time.Second
+
+// RequestTimeout returns the request timeout suited to a server write
+// timeout: the write timeout less requestTimeoutMargin, or half of it when
+// it is too short to spare the margin. A write timeout of 0 (no limit)
+// gives 0, so slow metrics are bounded only by METRIC_TIMEOUT.
+func RequestTimeout(writeTimeout time.Duration) time.Duration {
+	if writeTimeout <= 0 {
+		return 0
+	}
+	if writeTimeout <= 2*requestTimeoutMargin {
+		return writeTimeout / 2
+	}
+	return writeTimeout - requestTimeoutMargin
+}
+
 // NewRouter creates and configures the HTTP router with middleware.
-func NewRouter(handler *handlers.MetricsHandler, logger *slog.Logger) *chi.Mux {
+func NewRouter(handler *handlers.MetricsHandler, logger *slog.Logger, opts Options) *chi.Mux {
 	r := chi.NewRouter()
 
 	// Middleware stack
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Recoverer)
-	r.Use(requestLoggerMiddleware(logger))
-	r.Use(middleware.Timeout(25 * time.Second))
+	r.Use(callerMiddleware)
+	r.Use(tracingMiddleware)
+	if opts.SecurityHeaders {
+		r.Use(securityHeadersMiddleware)
+	}
+	r.Use(requestLoggerMiddleware(logger, opts.SensitiveParam))
+	r.Use(prometheusMiddleware)
+
+	if opts.RateLimit > 0 {
+		r.Use(rateLimitMiddleware(opts.RateLimit, opts.RateBurst))
+	}
+
+	// HEAD runs the GET handler so its headers are exact; the server
+	// discards the body
+	r.Use(middleware.GetHead)
+
+	r.Use(gzipMiddleware(gzipMinSize))
+	r.Use(etagMiddleware)
+	if opts.RequestTimeout > 0 {
+		r.Use(middleware.Timeout(opts.RequestTimeout))
+	}
+
+	// Recovery sits next to the handler, inside gzip and ETag, whose
+	// deferred flushes would otherwise send a 200 before the 500 could be
+	// written; the logger and Prometheus then record the 500 too
+	r.Use(recoverMiddleware(logger))
+
+	if opts.MaxBodyBytes > 0 {
+		r.Use(middleware.RequestSize(opts.MaxBodyBytes))
+	}
+
+	// CORS runs before authentication because browsers send preflight
+	// requests without credentials.
+	if len(opts.CORSOrigins) > 0 {
+		r.Use(corsMiddleware(opts.CORSOrigins))
+	}
+
+	// Unknown paths and methods answer in the API's error shape rather
+	// than chi's plain text
+	r.NotFound(notFound)
+	r.MethodNotAllowed(methodNotAllowed(r))
+
+	// Health probes from load balancers and orchestrators carry no API key
+	r.Get("/healthz", handler.GetHealth)
+	r.Options("/healthz", allowMethods(http.MethodGet))
 
-	// Routes
-	r.Get("/metrics", handler.GetMetrics)
-	r.Get("/metrics/{name}", handler.GetMetric)
+	r.Group(func(r chi.Router) {
+		if len(opts.APIKeys) > 0 || len(opts.ScopedAPIKeys) > 0 {
+			r.Use(apiKeyMiddleware(opts.APIKeys, opts.ScopedAPIKeys))
+		}
+
+		// Routes
+		r.Get("/metrics", handler.GetMetrics)
+		r.Post("/metrics", handler.QueryMetrics)
+		r.Get("/metrics/{name}", handler.GetMetric)
+		r.Get("/metrics/{name}.csv", handler.GetMetricCSV)
+		r.Get("/metrics/{name}/schema", handler.GetMetricSchema)
+		r.Get("/version", handler.GetVersion)
+		r.Get("/openapi.json", handler.GetOpenAPI)
+		r.Get("/metrics-export", handler.ExportPrometheus)
+
+		r.Options("/metrics", allowMethods(http.MethodGet, http.MethodPost))
+		r.Options("/metrics/{name}", allowMethods(http.MethodGet))
+		r.Options("/metrics/{name}.csv", allowMethods(http.MethodGet))
+		r.Options("/metrics/{name}/schema", allowMethods(http.MethodGet))
+		r.Options("/version", allowMethods(http.MethodGet))
+		r.Options("/openapi.json", allowMethods(http.MethodGet))
+		r.Options("/metrics-export", allowMethods(http.MethodGet))
+
+		// Operational metrics for Prometheus; kept off /metrics, which serves dashboard data
+		r.Handle("/metrics-internal", promhttp.Handler())
+	})
 
 	return r
 }
 
+// allowMethods answers a plain OPTIONS request with the route's methods in
+// an Allow header. CORS preflight requests are answered by corsMiddleware
+// before reaching it.
+func allowMethods(methods ...string) http.HandlerFunc {
+	header := allowHeader(methods)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", header)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// allowHeader formats a route's methods for an Allow header. HEAD is listed
+// wherever GET is, since GetHead serves it, and every route answers OPTIONS.
+func allowHeader(methods []string) string {
+	var allow []string
+	for _, method := range methods {
+		allow = append(allow, method)
+		if method == http.MethodGet {
+			allow = append(allow, http.MethodHead)
+		}
+	}
+	allow = append(allow, http.MethodOptions)
+	return strings.Join(allow, ", ")
+}
+
+// notFound answers requests for paths no route matches.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	handlers.WriteError(w, handlers.CodeNotFound, fmt.Sprintf("no endpoint at %s", r.URL.Path))
+}
+
+// routeMethods are the methods methodNotAllowed probes for, in Allow order.
+var routeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// methodNotAllowed answers a request whose path matches a route but not
+// its method. chi does not pass a custom handler the route's methods, so
+// they are found by probing routes for each one.
+func methodNotAllowed(routes chi.Routes) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var methods []string
+		for _, method := range routeMethods {
+			if routes.Match(chi.NewRouteContext(), method, r.URL.Path) {
+				methods = append(methods, method)
+			}
+		}
+		w.Header().Set("Allow", allowHeader(methods))
+		handlers.WriteError(w, handlers.CodeMethodNotAllowed, fmt.Sprintf("method %s is not allowed on %s", r.Method, r.URL.Path))
+	}
+}
+
 // requestLoggerMiddleware logs HTTP requests with timing information.
-func requestLoggerMiddleware(logger *slog.Logger) func(http.Handler) http.Handler {
+// Values of parameters for which sensitive returns true are redacted.
+func requestLoggerMiddleware(logger *slog.Logger, sensitive func(name string) bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Wrap response writer to capture status and size
@@ -43,7 +220,7 @@ func requestLoggerMiddleware(logger *slog.Logger) func(http.Handler) http.Handle
 			logger.Info(
 				"request",
 				"method", r.Method,
-				"path", r.RequestURI,
+				"path", redactQuery(r.RequestURI, sensitive),
 				"status", wrapped.statusCode,
 				"duration_ms", duration.Milliseconds(),
 				"request_id", middleware.GetReqID(r.Context()),
@@ -52,6 +229,41 @@ func requestLoggerMiddleware(logger *slog.Logger) func(http.Handler) http.Handle
 	}
 }
 
+// redactQuery replaces the values of sensitive parameters in a request URI
+// with models.RedactedValue. Pairs are rewritten in place rather than
+// re-encoded, so the logged URI otherwise matches what the client sent.
+func redactQuery(uri string, sensitive func(name string) bool) string {
+	path, rawQuery, ok := strings.Cut(uri, "?")
+	if !ok || sensitive == nil {
+		return uri
+	}
+
+	pairs := strings.Split(rawQuery, "&")
+	for i, pair := range pairs {
+		key, _, hasValue := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if hasValue && sensitive(name) {
+			pairs[i] = key + "=" + models.RedactedValue
+		}
+	}
+	return path + "?" + strings.Join(pairs, "&")
+}
+
+// callerMiddleware records the client IP and request ID in the context so
+// the service can attribute audit records without depending on HTTP.
+func callerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := service.WithCaller(r.Context(), service.Caller{
+			IP:        clientIP(r),
+			RequestID: middleware.GetReqID(r.Context()),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // responseWriter wraps http.ResponseWriter to capture status code.
 type responseWriter struct {
 	http.ResponseWriter
@@ -62,3 +274,9 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap lets http.ResponseController reach the underlying writer, so
+// streaming handlers can flush through this wrapper.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
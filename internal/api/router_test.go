@@ -0,0 +1,489 @@
+package api
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/api/handlers"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/service"
+)
+
+// stubService is a minimal handlers.MetricService for exercising the router.
+type stubService struct{}
+
+func (stubService) ListMetrics(ctx context.Context, opts models.ListOptions) []models.MetricInfo {
+	return []models.MetricInfo{{Name: "active_users"}}
+}
+
+func (stubService) GetMetricSchema(ctx context.Context, name string) (models.MetricSchema, error) {
+	return models.MetricSchema{MetricInfo: models.MetricInfo{Name: name}}, nil
+}
+
+func (stubService) GetMetrics(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+	results := make([]models.MetricResult, len(names))
+	for i, name := range names {
+		results[i] = models.MetricResult{Name: name, Value: int64(1)}
+	}
+	return results, nil
+}
+
+func (stubService) GetMetricBatch(ctx context.Context, requests []models.MetricRequest, opts models.QueryOptions) ([]models.MetricResult, error) {
+	results := make([]models.MetricResult, len(requests))
+	for i, req := range requests {
+		results[i] = models.MetricResult{Name: req.Name, Value: int64(1)}
+	}
+	return results, nil
+}
+
+func (stubService) StreamMetric(ctx context.Context, name string, params map[string]string, opts models.QueryOptions, fn func(row map[string]interface{}) error) error {
+	for i := int64(1); i <= 3; i++ {
+		if err := fn(map[string]interface{}{"id": i}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newTestRouter(t *testing.T, opts Options) http.Handler {
+	t.Helper()
+	logger := slog.New(slog.DiscardHandler)
+	return NewRouter(handlers.NewMetricsHandler(stubService{}, logger, handlers.Options{}), logger, opts)
+}
+
+func TestPrometheusMiddleware_LabelsByRoutePattern(t *testing.T) {
+	router := newTestRouter(t, Options{})
+
+	before := testutil.CollectAndCount(httpRequestDuration)
+
+	req := httptest.NewRequest("GET", "/metrics/active_users", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := testutil.CollectAndCount(httpRequestDuration); got <= before {
+		t.Fatalf("expected a new histogram series, count went from %d to %d", before, got)
+	}
+
+	body := scrape(t, router)
+	want := `dashboard_http_request_duration_seconds_count{path="/metrics/{name}",status="200"}`
+	if !strings.Contains(body, want) {
+		t.Errorf("scrape output missing %s", want)
+	}
+	if strings.Contains(body, `path="/metrics/active_users"`) {
+		t.Error("histogram labelled with raw path instead of route pattern")
+	}
+}
+
+func TestNewRouter_PostMetrics(t *testing.T) {
+	router := newTestRouter(t, Options{})
+
+	req := httptest.NewRequest("POST", "/metrics", strings.NewReader(`{"names":["active_users"]}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("POST /metrics status = %d, want 200", w.Code)
+	}
+}
+
+func TestNewRouter_MetricSchema(t *testing.T) {
+	router := newTestRouter(t, Options{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/active_users/schema", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /metrics/{name}/schema status = %d, want 200", w.Code)
+	}
+}
+
+func TestNewRouter_CSVSuffix(t *testing.T) {
+	router := newTestRouter(t, Options{})
+
+	req := httptest.NewRequest("GET", "/metrics/active_users.csv?region=eu", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /metrics/{name}.csv status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/csv") {
+		t.Errorf("Content-Type = %q, want text/csv despite Accept", got)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename=active_users.csv` {
+		t.Errorf("Content-Disposition = %q, want the metric name without the suffix", got)
+	}
+	if got := w.Body.String(); got != "1\n" {
+		t.Errorf("body = %q, want %q", got, "1\n")
+	}
+
+	// Without the suffix the same metric is still JSON.
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/active_users", nil))
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+		t.Errorf("GET /metrics/{name} Content-Type = %q, want application/json", got)
+	}
+}
+
+func TestNewRouter_OpenAPI(t *testing.T) {
+	router := newTestRouter(t, Options{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json status = %d, want 200", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"/metrics/active_users"`) {
+		t.Error("document does not describe the configured metric")
+	}
+}
+
+func TestNewRouter_MaxBodyBytes(t *testing.T) {
+	router := newTestRouter(t, Options{MaxBodyBytes: 64})
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "within limit", body: `{"names":["active_users"]}`, wantStatus: http.StatusOK},
+		{name: "over limit", body: `{"names":["` + strings.Repeat("a", 100) + `"]}`, wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/metrics", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("POST /metrics status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestNewRouter_ConditionalGet(t *testing.T) {
+	router := newTestRouter(t, Options{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/active_users", nil))
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("missing ETag")
+	}
+
+	req := httptest.NewRequest("GET", "/metrics/active_users", nil)
+	req.Header.Set("If-None-Match", etag)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("body = %q, want empty", w.Body.String())
+	}
+}
+
+func TestNewRouter_NDJSONStreamsThroughMiddleware(t *testing.T) {
+	router := newTestRouter(t, Options{})
+
+	req := httptest.NewRequest("GET", "/metrics/all_users?format=ndjson", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if etag := w.Header().Get("ETag"); etag != "" {
+		t.Errorf("ETag = %q, want none on a streamed response", etag)
+	}
+	if !w.Flushed {
+		t.Error("expected flushes to reach the client")
+	}
+	if ce := w.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", ce)
+	}
+
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v", err)
+	}
+	body, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	if want := "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n"; string(body) != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	sensitive := func(name string) bool { return name == "account id" || name == "token" }
+
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{uri: "/metrics/balance", want: "/metrics/balance"},
+		{uri: "/metrics/balance?token=s3cret&region=eu", want: "/metrics/balance?token=***&region=eu"},
+		{uri: "/metrics/balance?account+id=4111&token=a&token=b", want: "/metrics/balance?account+id=***&token=***&token=***"},
+		{uri: "/metrics/balance?token", want: "/metrics/balance?token"},
+	}
+	for _, tt := range tests {
+		if got := redactQuery(tt.uri, sensitive); got != tt.want {
+			t.Errorf("redactQuery(%q) = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+
+	if got := redactQuery("/metrics?token=s3cret", nil); got != "/metrics?token=s3cret" {
+		t.Errorf("redactQuery() with nil func = %q, want URI unchanged", got)
+	}
+}
+
+func TestNewRouter_RequestLogRedactsSensitiveParams(t *testing.T) {
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	router := NewRouter(handlers.NewMetricsHandler(stubService{}, logger, handlers.Options{}), logger, Options{
+		SensitiveParam: func(name string) bool { return name == "token" },
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics/active_users?token=s3cret", nil))
+
+	if strings.Contains(logs.String(), "s3cret") {
+		t.Errorf("request log %q contains a sensitive value", logs.String())
+	}
+	if !strings.Contains(logs.String(), "token=***") {
+		t.Errorf("request log %q does not show the redacted param", logs.String())
+	}
+}
+
+func TestNewRouter_RequestLogRedactsSensitiveAlias(t *testing.T) {
+	svc := service.NewMetricService(nil, []models.Metric{{
+		Name:   "balance",
+		Query:  "SELECT balance FROM accounts WHERE token = ?",
+		Params: []models.ParamDefinition{{Name: "token", Type: models.ParamTypeString, Aliases: []string{"api_token"}, Sensitive: true}},
+	}}, nil, service.Options{})
+
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	router := NewRouter(handlers.NewMetricsHandler(stubService{}, logger, handlers.Options{}), logger, Options{
+		SensitiveParam: svc.IsSensitiveParam,
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics/balance?api_token=s3cret", nil))
+
+	if strings.Contains(logs.String(), "s3cret") {
+		t.Errorf("request log %q contains a sensitive value", logs.String())
+	}
+	if !strings.Contains(logs.String(), "api_token=***") {
+		t.Errorf("request log %q does not show the redacted alias", logs.String())
+	}
+}
+
+func TestNewRouter_Head(t *testing.T) {
+	srv := httptest.NewServer(newTestRouter(t, Options{}))
+	defer srv.Close()
+
+	get, err := http.Get(srv.URL + "/metrics/active_users")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	get.Body.Close()
+
+	head, err := http.Head(srv.URL + "/metrics/active_users")
+	if err != nil {
+		t.Fatalf("HEAD: %v", err)
+	}
+	defer head.Body.Close()
+
+	if head.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", head.StatusCode, http.StatusOK)
+	}
+	for _, name := range []string{"Content-Type", "ETag", "Cache-Control"} {
+		if got, want := head.Header.Get(name), get.Header.Get(name); got == "" || got != want {
+			t.Errorf("HEAD %s = %q, want %q as for GET", name, got, want)
+		}
+	}
+	if body, _ := io.ReadAll(head.Body); len(body) != 0 {
+		t.Errorf("HEAD body = %q, want empty", body)
+	}
+}
+
+func TestNewRouter_Options(t *testing.T) {
+	router := newTestRouter(t, Options{})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/metrics", want: "GET, HEAD, POST, OPTIONS"},
+		{path: "/metrics/active_users", want: "GET, HEAD, OPTIONS"},
+		{path: "/metrics/active_users.csv", want: "GET, HEAD, OPTIONS"},
+		{path: "/metrics/active_users/schema", want: "GET, HEAD, OPTIONS"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("OPTIONS", tt.path, nil))
+
+		if w.Code != http.StatusNoContent {
+			t.Errorf("OPTIONS %s: status = %d, want %d", tt.path, w.Code, http.StatusNoContent)
+		}
+		if got := w.Header().Get("Allow"); got != tt.want {
+			t.Errorf("OPTIONS %s: Allow = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNewRouter_MethodNotAllowed(t *testing.T) {
+	router := newTestRouter(t, Options{})
+
+	tests := []struct {
+		method    string
+		path      string
+		wantAllow string
+	}{
+		{method: "DELETE", path: "/metrics", wantAllow: "GET, HEAD, POST, OPTIONS"},
+		{method: "POST", path: "/metrics/active_users", wantAllow: "GET, HEAD, OPTIONS"},
+		{method: "PUT", path: "/healthz", wantAllow: "GET, HEAD, OPTIONS"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+
+		if w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: status = %d, want 405", tt.method, tt.path, w.Code)
+		}
+		if got := w.Header().Get("Allow"); got != tt.wantAllow {
+			t.Errorf("%s %s: Allow = %q, want %q", tt.method, tt.path, got, tt.wantAllow)
+		}
+		if got := w.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("%s %s: Content-Type = %q, want application/json", tt.method, tt.path, got)
+		}
+		if !strings.Contains(w.Body.String(), `"code":"METHOD_NOT_ALLOWED"`) {
+			t.Errorf("%s %s: body = %s, want a METHOD_NOT_ALLOWED error", tt.method, tt.path, w.Body.String())
+		}
+	}
+}
+
+func TestNewRouter_NotFound(t *testing.T) {
+	router := newTestRouter(t, Options{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/no/such/endpoint", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	want := `{"error":{"code":"NOT_FOUND","message":"no endpoint at /no/such/endpoint"}}` + "\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+}
+
+func TestMetricsInternalEndpoint(t *testing.T) {
+	router := newTestRouter(t, Options{})
+
+	body := scrape(t, router)
+	if !strings.Contains(body, "dashboard_http_request_duration_seconds") {
+		t.Error("scrape output missing HTTP duration histogram")
+	}
+}
+
+func scrape(t *testing.T, router http.Handler) string {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/metrics-internal", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /metrics-internal status = %d, want 200", w.Code)
+	}
+	return w.Body.String()
+}
+
+func TestRequestTimeout(t *testing.T) {
+	tests := []struct {
+		write time.Duration
+		want  time.Duration
+	}{
+		{write: 30 * time.Second, want: 25 * time.Second},
+		{write: 2 * time.Minute, want: 115 * time.Second},
+		{write: 6 * time.Second, want: 3 * time.Second},
+		{write: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := RequestTimeout(tt.write); got != tt.want {
+			t.Errorf("RequestTimeout(%v) = %v, want %v", tt.write, got, tt.want)
+		}
+	}
+}
+
+// deadlineService records the deadline of the context a metric runs with.
+// With wait set, it runs until that context ends, as a slow query would.
+type deadlineService struct {
+	stubService
+	wait     bool
+	deadline *time.Time
+}
+
+func (s deadlineService) GetMetrics(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+	*s.deadline, _ = ctx.Deadline()
+	if s.wait {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return s.stubService.GetMetrics(ctx, names, params, opts)
+}
+
+func TestNewRouter_RequestTimeout(t *testing.T) {
+	tests := []struct {
+		name       string
+		timeout    time.Duration
+		wait       bool
+		wantStatus int
+	}{
+		{name: "longer than 25s", timeout: RequestTimeout(2 * time.Minute), wantStatus: http.StatusOK},
+		{name: "slow metric cut off", timeout: 20 * time.Millisecond, wait: true, wantStatus: http.StatusGatewayTimeout},
+		{name: "disabled", timeout: 0, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deadline time.Time
+			logger := slog.New(slog.DiscardHandler)
+			svc := deadlineService{wait: tt.wait, deadline: &deadline}
+			router := NewRouter(handlers.NewMetricsHandler(svc, logger, handlers.Options{}), logger, Options{RequestTimeout: tt.timeout})
+
+			start := time.Now()
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics/active_users", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			switch {
+			case tt.timeout == 0 && !deadline.IsZero():
+				t.Errorf("deadline in %v, want none", deadline.Sub(start))
+			case tt.timeout > 0 && (deadline.Before(start.Add(tt.timeout-time.Second)) || deadline.After(time.Now().Add(tt.timeout))):
+				t.Errorf("deadline in %v, want %v", deadline.Sub(start), tt.timeout)
+			}
+		})
+	}
+}
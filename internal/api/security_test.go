@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewRouter_SecurityHeaders(t *testing.T) {
+	want := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Content-Security-Policy": securityCSP,
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		path    string
+		enabled bool
+	}{
+		{name: "metric", opts: Options{SecurityHeaders: true}, path: "/metrics/active_users", enabled: true},
+		{name: "error response", opts: Options{SecurityHeaders: true, APIKeys: []string{"secret"}}, path: "/metrics/active_users", enabled: true},
+		{name: "disabled", opts: Options{}, path: "/metrics/active_users", enabled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newTestRouter(t, tt.opts)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+
+			if tt.opts.APIKeys != nil && w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401", w.Code)
+			}
+			for header, value := range want {
+				got := w.Header().Get(header)
+				if tt.enabled && got != value {
+					t.Errorf("%s = %q, want %q", header, got, value)
+				}
+				if !tt.enabled && got != "" {
+					t.Errorf("%s = %q, want unset", header, got)
+				}
+			}
+		})
+	}
+}
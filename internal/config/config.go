@@ -2,48 +2,412 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/BurntSushi/toml"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/formula"
 	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/sqlutil"
 )
 
+// Drivers lists the database drivers a data source may use.
+var Drivers = []string{"sqlite", "postgres", "mysql"}
+
 type Config struct {
-	Metrics []models.Metric `toml:"metrics"`
+	// Attach maps schema aliases to SQLite files attached to the primary
+	// database, which must then be SQLite too.
+	Attach      map[string]string `toml:"attach"`
+	DataSources []DataSource      `toml:"data_sources"`
+	APIKeys     []APIKey          `toml:"api_keys"`
+	Defaults    Defaults          `toml:"defaults"`
+	Metrics     []models.Metric   `toml:"metrics"`
+}
+
+// Defaults holds deployment-wide settings shared by every metric.
+type Defaults struct {
+	// Params are given to every metric declaring a param of the same name,
+	// as if the request had, unless the request gives its own value.
+	Params map[string]string `toml:"params"`
+}
+
+// APIKey is an API key limited to the metrics whose scopes are all among
+// Scopes, unlike the unrestricted keys in API_KEYS. Use ${NAME} to keep the
+// key itself in the environment.
+type APIKey struct {
+	Key    string   `toml:"key"`
+	Scopes []string `toml:"scopes"`
+}
+
+// DataSource is a database beyond the primary one (DB_DRIVER and DB_PATH)
+// that metrics can select by name with data_source. DSN takes the same form
+// as DB_PATH for its driver; use ${NAME} to keep credentials in the environment.
+type DataSource struct {
+	Name   string `toml:"name"`
+	Driver string `toml:"driver"`
+	DSN    string `toml:"dsn"`
+	// Attach is Config.Attach for a sqlite data source.
+	Attach map[string]string `toml:"attach"`
+}
+
+// attachAlias matches aliases usable unquoted as alias.table in queries.
+var attachAlias = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateAttach checks one set of attachments; owner names it in errors.
+func validateAttach(owner string, attach map[string]string) error {
+	var errs []error
+	for _, alias := range slices.Sorted(maps.Keys(attach)) {
+		path := attach[alias]
+		switch {
+		case !attachAlias.MatchString(alias):
+			errs = append(errs, fmt.Errorf("invalid %s attachment %q: alias must be letters, digits and underscores", owner, alias))
+		case strings.EqualFold(alias, "main") || strings.EqualFold(alias, "temp"):
+			errs = append(errs, fmt.Errorf("invalid %s attachment %q: alias is reserved by SQLite", owner, alias))
+		}
+		if path == "" {
+			errs = append(errs, fmt.Errorf("invalid %s attachment %q: path cannot be empty", owner, alias))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateSchemaRefs checks that the schema in every schema.table a query
+// reads from is attached to the metric's SQLite database, so a typo such as
+// analytcs.events stops startup instead of failing each request. The
+// primary database is only checked when it has attachments, since otherwise
+// config cannot tell it is SQLite rather than a database with real schemas.
+func validateSchemaRefs(config Config) error {
+	sources := make(map[string]DataSource, len(config.DataSources))
+	for _, source := range config.DataSources {
+		sources[source.Name] = source
+	}
+
+	var errs []error
+	for _, metric := range config.Metrics {
+		owner, attach := "the primary database", config.Attach
+		if metric.DataSource != "" {
+			source, ok := sources[metric.DataSource]
+			if !ok || source.Driver != "sqlite" {
+				continue
+			}
+			owner, attach = "data source "+source.Name, source.Attach
+		} else if len(attach) == 0 {
+			continue
+		}
+
+		for _, schema := range slices.Concat(sqlutil.SchemaQualifiers(metric.Query), sqlutil.SchemaQualifiers(metric.FallbackQuery)) {
+			if strings.EqualFold(schema, "main") || strings.EqualFold(schema, "temp") {
+				continue
+			}
+			if !slices.ContainsFunc(slices.Collect(maps.Keys(attach)), func(alias string) bool {
+				return strings.EqualFold(alias, schema)
+			}) {
+				errs = append(errs, fmt.Errorf("invalid metric %s: query reads from schema %q, which is not attached to %s", metric.Name, schema, owner))
+			}
+		}
+	}
+	return errors.Join(errs...)
 }
 
+// LoadConfig loads and validates the configuration file, returning only
+// its metrics.
 func LoadConfig(path string) ([]models.Metric, error) {
+	config, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return config.Metrics, nil
+}
+
+// Load loads and validates the configuration file.
+func Load(path string) (Config, error) {
 	var config Config
 
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Config{}, fmt.Errorf("config file %q does not exist: %w", path, fs.ErrNotExist)
+		}
+		return Config{}, fmt.Errorf("failed to read config file %q: %w", path, err)
+	}
+
 	// Parse TOML file
-	if _, err := toml.DecodeFile(path, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	if _, err := toml.Decode(string(data), &config); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config file %q: %w", path, err)
 	}
 
-	// Validate all metrics
-	if err := validateMetrics(config.Metrics); err != nil {
-		return nil, err
+	if err := expandEnv(&config); err != nil {
+		return Config{}, fmt.Errorf("config file %q: %w", path, err)
 	}
 
-	return config.Metrics, nil
+	// Validate data sources and metrics together, so one run reports both
+	if err := errors.Join(validateAttach("primary database", config.Attach), validateDataSources(config.DataSources), validateAPIKeys(config.APIKeys), validateDefaultParams(config.Defaults.Params, config.Metrics), validateMetrics(config.Metrics, config.DataSources), validateSchemaRefs(config)); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+func validateDataSources(sources []DataSource) error {
+	var errs []error
+	names := make(map[string]bool)
+	for i, source := range sources {
+		switch {
+		case source.Name == "":
+			errs = append(errs, fmt.Errorf("data source %d: name cannot be empty", i+1))
+		case names[source.Name]:
+			errs = append(errs, fmt.Errorf("duplicate data source name: %s", source.Name))
+		}
+		names[source.Name] = true
+
+		if !slices.Contains(Drivers, source.Driver) {
+			errs = append(errs, fmt.Errorf("invalid data source %s: driver must be one of %s, not %q", source.Name, strings.Join(Drivers, ", "), source.Driver))
+		}
+		if source.DSN == "" {
+			errs = append(errs, fmt.Errorf("invalid data source %s: dsn cannot be empty", source.Name))
+		}
+		if len(source.Attach) > 0 && source.Driver != "sqlite" {
+			errs = append(errs, fmt.Errorf("invalid data source %s: attach requires the sqlite driver", source.Name))
+		}
+		errs = append(errs, validateAttach("data source "+source.Name, source.Attach))
+	}
+	return errors.Join(errs...)
+}
+
+// validateAPIKeys checks the scoped keys. Errors identify keys by position,
+// so a key never appears in logs.
+func validateAPIKeys(keys []APIKey) error {
+	var errs []error
+	seen := make(map[string]int)
+	for i, key := range keys {
+		switch first, dup := seen[key.Key]; {
+		case key.Key == "":
+			errs = append(errs, fmt.Errorf("api key %d: key cannot be empty", i+1))
+		case dup:
+			errs = append(errs, fmt.Errorf("api key %d: key repeats api key %d", i+1, first))
+		default:
+			seen[key.Key] = i + 1
+		}
+		for _, scope := range key.Scopes {
+			if scope == "" || scope != strings.TrimSpace(scope) {
+				errs = append(errs, fmt.Errorf("api key %d: scopes must be non-empty, without surrounding spaces, not %q", i+1, scope))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validateDefaultParams checks the default params: their names, since a
+// reserved name could never reach a metric, and their values against every
+// metric param that would receive them, so a bad default fails to load
+// rather than failing each request as if the client had sent it.
+func validateDefaultParams(params map[string]string, metrics []models.Metric) error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(params)) {
+		switch {
+		case name == "":
+			errs = append(errs, errors.New("defaults.params: param name cannot be empty"))
+		case models.IsReservedParam(name):
+			errs = append(errs, fmt.Errorf("defaults.params: %q is reserved by the API", name))
+		}
+	}
+	for _, metric := range metrics {
+		for _, param := range metric.Params {
+			value, ok := params[param.Name]
+			if !ok {
+				continue
+			}
+			if err := param.CheckValue(value); err != nil {
+				errs = append(errs, fmt.Errorf("defaults.params: %q does not suit metric %s: %w", param.Name, metric.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// envRef matches ${NAME} references. Bare $NAME is left alone so that
+// PostgreSQL $1 placeholders and other dollar signs in queries survive.
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv substitutes ${NAME} references in the decoded config's strings
+// from the process environment. Expanding after decoding takes each value
+// literally, quotes and backslashes included, and ignores references in
+// comments. An unset variable is an error rather than an empty string, so a
+// typo cannot silently produce a query against the wrong table.
+func expandEnv(config *Config) error {
+	var missing []string
+	expandStrings(reflect.ValueOf(config).Elem(), func(text string) string {
+		return envRef.ReplaceAllStringFunc(text, func(ref string) string {
+			name := envRef.FindStringSubmatch(ref)[1]
+			value, ok := os.LookupEnv(name)
+			if !ok && !slices.Contains(missing, name) {
+				missing = append(missing, name)
+			}
+			return value
+		})
+	})
+
+	if len(missing) > 0 {
+		return fmt.Errorf("undefined environment variables: %s", strings.Join(missing, ", "))
+	}
+	return nil
 }
 
-func validateMetrics(metrics []models.Metric) error {
+// expandStrings replaces every string reachable from v with expand's
+// result: struct fields, slice elements, map values, and what pointers and
+// interfaces hold. Map keys are names rather than values and are left
+// alone; maps are walked in key order so errors list variables in a stable
+// order.
+func expandStrings(v reflect.Value, expand func(string) string) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(expand(v.String()))
+	case reflect.Pointer:
+		if !v.IsNil() {
+			expandStrings(v.Elem(), expand)
+		}
+	case reflect.Interface:
+		if text, ok := v.Interface().(string); ok {
+			v.Set(reflect.ValueOf(expand(text)))
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				expandStrings(v.Field(i), expand)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			expandStrings(v.Index(i), expand)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		for _, key := range keys {
+			// Map values are not addressable, so each is expanded in a copy
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			expandStrings(value, expand)
+			v.SetMapIndex(key, value)
+		}
+	}
+}
+
+func validateMetrics(metrics []models.Metric, sources []DataSource) error {
 	if len(metrics) == 0 {
 		return fmt.Errorf("no metrics defined in config")
 	}
 
-	// Check for duplicate names
+	// Every metric is checked before reporting, so one run lists all
+	// problems rather than one per attempt.
+	var errs []error
 	names := make(map[string]bool)
 	for _, metric := range metrics {
 		if names[metric.Name] {
-			return fmt.Errorf("duplicate metric name: %s", metric.Name)
+			errs = append(errs, fmt.Errorf("duplicate metric name: %s", metric.Name))
 		}
 		names[metric.Name] = true
 
-		// Validate each metric
 		if err := metric.Validate(); err != nil {
-			return fmt.Errorf("invalid metric %s: %w", metric.Name, err)
+			if name, ok := unreferenceableName(metric.Formula, metrics); ok && errors.Is(err, formula.ErrSyntax) {
+				err = fmt.Errorf("%w; formulas cannot reference metric %q, whose name has a hyphen or starts with a digit", err, name)
+			}
+			errs = append(errs, fmt.Errorf("invalid metric %s: %w", metric.Name, err))
+		}
+
+		if metric.DataSource != "" && !slices.ContainsFunc(sources, func(source DataSource) bool {
+			return source.Name == metric.DataSource
+		}) {
+			errs = append(errs, fmt.Errorf("invalid metric %s: unknown data source %q", metric.Name, metric.DataSource))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	return validateDependencies(metrics)
+}
+
+// unreferenceableName returns the name of a metric that appears in
+// formulaText but cannot be written in a formula, such as page-views, which
+// parses as page minus views. It explains the otherwise puzzling errors such
+// a formula fails with.
+func unreferenceableName(formulaText string, metrics []models.Metric) (string, bool) {
+	if formulaText == "" {
+		return "", false
+	}
+	for _, metric := range metrics {
+		if !formula.IsIdentifier(metric.Name) && strings.Contains(formulaText, metric.Name) {
+			return metric.Name, true
+		}
+	}
+	return "", false
+}
+
+// validateDependencies checks that every metric a formula references exists
+// and yields a single value, and that no formula depends on itself.
+func validateDependencies(metrics []models.Metric) error {
+	byName := make(map[string]models.Metric, len(metrics))
+	for _, metric := range metrics {
+		byName[metric.Name] = metric
+	}
+
+	for _, metric := range metrics {
+		for _, dep := range metric.Dependencies() {
+			target, ok := byName[dep]
+			if !ok {
+				if name, ok := unreferenceableName(metric.Formula, metrics); ok {
+					return fmt.Errorf("invalid metric %s: formula references unknown metric %q; formulas cannot reference metric %q, whose name has a hyphen or starts with a digit", metric.Name, dep, name)
+				}
+				return fmt.Errorf("invalid metric %s: formula references unknown metric %q", metric.Name, dep)
+			}
+			if target.MultiRow {
+				return fmt.Errorf("invalid metric %s: formula references multi-row metric %q", metric.Name, dep)
+			}
+		}
+	}
+
+	// Depth-first search; a metric reached again while still on the path
+	// closes a cycle.
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int, len(metrics))
+	var path []string
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("metric dependency cycle: %s -> %s", strings.Join(path, " -> "), name)
+		}
+
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range byName[name].Dependencies() {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+
+	for _, metric := range metrics {
+		if err := visit(metric.Name); err != nil {
+			return err
 		}
 	}
 
@@ -1,9 +1,16 @@
 package config
 
 import (
+	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -62,10 +69,87 @@ required = true
 		}
 	})
 
+	t.Run("date param", func(t *testing.T) {
+		content := `
+[[metrics]]
+name = "signups_since"
+query = "SELECT COUNT(*) FROM users WHERE created_at >= ?"
+params = [
+  { name = "start_date", type = "date", required = true }
+]
+`
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "metrics.toml")
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test config: %v", err)
+		}
+
+		metrics, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+
+		if metrics[0].Params[0].Type != models.ParamTypeDate {
+			t.Errorf("param type = %s, want date", metrics[0].Params[0].Type)
+		}
+	})
+
+	t.Run("cache ttl", func(t *testing.T) {
+		content := `
+[[metrics]]
+name = "slow_metric"
+query = "SELECT COUNT(*) FROM events"
+cache_ttl = "30s"
+`
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "metrics.toml")
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test config: %v", err)
+		}
+
+		metrics, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+
+		if metrics[0].CacheTTL != 30*time.Second {
+			t.Errorf("CacheTTL = %v, want 30s", metrics[0].CacheTTL)
+		}
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		content := `
+[[metrics]]
+name = "revenue"
+description = "Revenue booked today"
+unit = "USD"
+category = "finance"
+query = "SELECT SUM(amount) FROM orders"
+`
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "metrics.toml")
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test config: %v", err)
+		}
+
+		metrics, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+
+		m := metrics[0]
+		if m.Description != "Revenue booked today" || m.Unit != "USD" || m.Category != "finance" {
+			t.Errorf("metadata = (%q, %q, %q), want (Revenue booked today, USD, finance)", m.Description, m.Unit, m.Category)
+		}
+	})
+
 	t.Run("nonexistent file", func(t *testing.T) {
 		_, err := LoadConfig("/nonexistent/path.toml")
-		if err == nil {
-			t.Error("expected error for nonexistent file")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("error = %v, want fs.ErrNotExist", err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "/nonexistent/path.toml") {
+			t.Errorf("error %q does not name the path", err)
 		}
 	})
 
@@ -104,6 +188,247 @@ query = "SELECT 2"
 		}
 	})
 
+	t.Run("param range", func(t *testing.T) {
+		content := `
+[[metrics]]
+name = "recent_users"
+query = "SELECT * FROM users LIMIT ?"
+multi_row = true
+params = [
+  { name = "max_rows", type = "int", required = true, min = 1, max = 1000 }
+]
+`
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "metrics.toml")
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test config: %v", err)
+		}
+
+		metrics, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+
+		p := metrics[0].Params[0]
+		if p.Min == nil || *p.Min != 1 || p.Max == nil || *p.Max != 1000 {
+			t.Errorf("range = (%v, %v), want (1, 1000)", p.Min, p.Max)
+		}
+	})
+
+	t.Run("placeholder count mismatch", func(t *testing.T) {
+		content := `
+[[metrics]]
+name = "mismatched"
+query = "SELECT COUNT(*) FROM users WHERE created > ? AND status = ? AND plan = ?"
+params = [
+  { name = "since", type = "date", required = true },
+  { name = "status", type = "string", required = true }
+]
+`
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "mismatch.toml")
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test config: %v", err)
+		}
+
+		_, err := LoadConfig(configPath)
+		if !errors.Is(err, models.ErrParamCount) {
+			t.Fatalf("LoadConfig() error = %v, want %v", err, models.ErrParamCount)
+		}
+		want := "invalid metric mismatched: query placeholders do not match declared params: query has 3 placeholders but 2 params declared"
+		if err.Error() != want {
+			t.Errorf("error = %q, want %q", err.Error(), want)
+		}
+	})
+
+	t.Run("non-select query", func(t *testing.T) {
+		content := `
+[[metrics]]
+name = "deactivate"
+query = "UPDATE users SET active = 0"
+`
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "update.toml")
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test config: %v", err)
+		}
+
+		_, err := LoadConfig(configPath)
+		if !errors.Is(err, models.ErrQueryNotSelect) {
+			t.Fatalf("LoadConfig() error = %v, want %v", err, models.ErrQueryNotSelect)
+		}
+		want := `invalid metric deactivate: metric query must begin with SELECT or WITH, not "UPDATE"`
+		if err.Error() != want {
+			t.Errorf("error = %q, want %q", err.Error(), want)
+		}
+	})
+
+	t.Run("formula metric", func(t *testing.T) {
+		content := `
+[[metrics]]
+name = "signups"
+query = "SELECT COUNT(*) FROM users"
+
+[[metrics]]
+name = "visitors"
+query = "SELECT COUNT(*) FROM visits"
+
+[[metrics]]
+name = "conversion_rate"
+formula = "signups / visitors * 100"
+`
+		tmpDir := t.TempDir()
+		configPath := filepath.Join(tmpDir, "formula.toml")
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test config: %v", err)
+		}
+
+		metrics, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+
+		if metrics[2].Formula != "signups / visitors * 100" {
+			t.Errorf("formula = %q, want %q", metrics[2].Formula, "signups / visitors * 100")
+		}
+	})
+
+	t.Run("invalid formula dependencies", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			content string
+			want    string
+		}{
+			{
+				name: "unknown metric",
+				content: `
+[[metrics]]
+name = "conversion_rate"
+formula = "signups / visitors"
+
+[[metrics]]
+name = "signups"
+query = "SELECT COUNT(*) FROM users"
+`,
+				want: `invalid metric conversion_rate: formula references unknown metric "visitors"`,
+			},
+			{
+				name: "hyphenated metric",
+				content: `
+[[metrics]]
+name = "page-views"
+query = "SELECT COUNT(*) FROM views"
+
+[[metrics]]
+name = "doubled"
+formula = "page-views * 2"
+`,
+				want: `invalid metric doubled: formula references unknown metric "page"; formulas cannot reference metric "page-views", whose name has a hyphen or starts with a digit`,
+			},
+			{
+				name: "metric starting with a digit",
+				content: `
+[[metrics]]
+name = "5xx"
+query = "SELECT COUNT(*) FROM requests WHERE status >= 500"
+
+[[metrics]]
+name = "doubled"
+formula = "5xx * 2"
+`,
+				want: `invalid metric doubled: invalid formula at position 2: unexpected 'x'; formulas cannot reference metric "5xx", whose name has a hyphen or starts with a digit`,
+			},
+			{
+				name: "multi-row dependency",
+				content: `
+[[metrics]]
+name = "users"
+query = "SELECT * FROM users"
+multi_row = true
+
+[[metrics]]
+name = "doubled"
+formula = "users * 2"
+`,
+				want: `invalid metric doubled: formula references multi-row metric "users"`,
+			},
+			{
+				name: "self reference",
+				content: `
+[[metrics]]
+name = "loop"
+formula = "loop + 1"
+`,
+				want: "metric dependency cycle: loop -> loop",
+			},
+			{
+				name: "indirect cycle",
+				content: `
+[[metrics]]
+name = "a"
+formula = "b + 1"
+
+[[metrics]]
+name = "b"
+formula = "c * 2"
+
+[[metrics]]
+name = "c"
+formula = "a / 2"
+`,
+				want: "metric dependency cycle: a -> b -> c -> a",
+			},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				configPath := filepath.Join(t.TempDir(), "metrics.toml")
+				if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+					t.Fatalf("failed to write test config: %v", err)
+				}
+
+				_, err := LoadConfig(configPath)
+				if err == nil || err.Error() != tt.want {
+					t.Errorf("LoadConfig() error = %v, want %q", err, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("default on empty", func(t *testing.T) {
+		content := `
+[[metrics]]
+name = "revenue"
+query = "SELECT SUM(amount) FROM orders"
+default_on_empty = 0
+
+[[metrics]]
+name = "rating"
+query = "SELECT AVG(rating) FROM reviews"
+default_on_empty = 2.5
+
+[[metrics]]
+name = "status"
+query = "SELECT status FROM deployments ORDER BY id DESC LIMIT 1"
+default_on_empty = "unknown"
+`
+		configPath := filepath.Join(t.TempDir(), "metrics.toml")
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test config: %v", err)
+		}
+
+		metrics, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		want := []interface{}{int64(0), 2.5, "unknown"}
+		for i, metric := range metrics {
+			if metric.DefaultOnEmpty != want[i] {
+				t.Errorf("%s DefaultOnEmpty = %#v, want %#v", metric.Name, metric.DefaultOnEmpty, want[i])
+			}
+		}
+	})
+
 	t.Run("empty metrics array", func(t *testing.T) {
 		content := `# Valid TOML but no metrics defined
 `
@@ -119,3 +444,514 @@ query = "SELECT 2"
 		}
 	})
 }
+
+func TestLoadConfig_EnvSubstitution(t *testing.T) {
+	writeConfig := func(t *testing.T, content string) string {
+		t.Helper()
+		configPath := filepath.Join(t.TempDir(), "metrics.toml")
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test config: %v", err)
+		}
+		return configPath
+	}
+
+	t.Run("set variables are expanded", func(t *testing.T) {
+		t.Setenv("DASHBOARD_SCHEMA", "analytics")
+		t.Setenv("DASHBOARD_UNIT", "")
+		configPath := writeConfig(t, `
+[[metrics]]
+name = "user_count"
+unit = "${DASHBOARD_UNIT}"
+query = "SELECT COUNT(*) FROM ${DASHBOARD_SCHEMA}.users WHERE price > '$5' OR name = '$DASHBOARD_SCHEMA'"
+`)
+
+		metrics, err := LoadConfig(configPath)
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		want := "SELECT COUNT(*) FROM analytics.users WHERE price > '$5' OR name = '$DASHBOARD_SCHEMA'"
+		if metrics[0].Query != want {
+			t.Errorf("Query = %q, want %q", metrics[0].Query, want)
+		}
+		if metrics[0].Unit != "" {
+			t.Errorf("Unit = %q, want empty", metrics[0].Unit)
+		}
+	})
+
+	t.Run("unset variables are an error", func(t *testing.T) {
+		os.Unsetenv("DASHBOARD_MISSING_A")
+		os.Unsetenv("DASHBOARD_MISSING_B")
+		configPath := writeConfig(t, `
+[[metrics]]
+name = "user_count"
+query = "SELECT COUNT(*) FROM ${DASHBOARD_MISSING_A}.users JOIN ${DASHBOARD_MISSING_B}.x JOIN ${DASHBOARD_MISSING_A}.y"
+`)
+
+		_, err := LoadConfig(configPath)
+		if err == nil {
+			t.Fatal("expected error for undefined variables")
+		}
+		if !strings.Contains(err.Error(), "undefined environment variables: DASHBOARD_MISSING_A, DASHBOARD_MISSING_B") {
+			t.Errorf("error %q does not list the undefined variables once each", err)
+		}
+	})
+
+	t.Run("values are taken literally", func(t *testing.T) {
+		dsn := `postgres://app:pa"ss\word@db/analytics` + "\nextra = 1"
+		t.Setenv("DASHBOARD_DSN", dsn)
+		t.Setenv("DASHBOARD_KEY", `k"ey`)
+		configPath := writeConfig(t, `
+[[data_sources]]
+name = "analytics"
+driver = "postgres"
+dsn = "${DASHBOARD_DSN}"
+
+[[api_keys]]
+key = '${DASHBOARD_KEY}'
+
+[[metrics]]
+name = "user_count"
+data_source = "analytics"
+query = "SELECT COUNT(*) FROM users"
+`)
+
+		config, err := Load(configPath)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if got := config.DataSources[0].DSN; got != dsn {
+			t.Errorf("DSN = %q, want %q", got, dsn)
+		}
+		if got := config.APIKeys[0].Key; got != `k"ey` {
+			t.Errorf("Key = %q, want %q", got, `k"ey`)
+		}
+	})
+
+	t.Run("references in comments are ignored", func(t *testing.T) {
+		os.Unsetenv("DASHBOARD_MISSING_A")
+		configPath := writeConfig(t, `
+# Set schema = "${DASHBOARD_MISSING_A}" to read another schema
+[[metrics]]
+name = "user_count"
+query = "SELECT COUNT(*) FROM users" # not ${DASHBOARD_MISSING_A}.users
+`)
+
+		if _, err := LoadConfig(configPath); err != nil {
+			t.Errorf("LoadConfig() error = %v, want comments ignored", err)
+		}
+	})
+}
+
+func TestLoadConfig_ReportsEveryInvalidMetric(t *testing.T) {
+	content := `
+[[metrics]]
+name = "deletes"
+query = "DELETE FROM users"
+
+[[metrics]]
+name = "ok"
+query = "SELECT 1"
+
+[[metrics]]
+name = "ok"
+query = "SELECT ?"
+`
+	configPath := filepath.Join(t.TempDir(), "metrics.toml")
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write test config: %v", err)
+	}
+
+	_, err := LoadConfig(configPath)
+	if err == nil {
+		t.Fatal("expected error for invalid metrics")
+	}
+	if !errors.Is(err, models.ErrQueryNotSelect) || !errors.Is(err, models.ErrParamCount) {
+		t.Errorf("error %v does not wrap both metric errors", err)
+	}
+	if !strings.Contains(err.Error(), "duplicate metric name: ok") {
+		t.Errorf("error %v does not report the duplicate name", err)
+	}
+}
+
+func TestLoad_DataSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "valid",
+			content: `
+[[data_sources]]
+name = "analytics"
+driver = "postgres"
+dsn = "postgres://localhost/analytics"
+
+[[metrics]]
+name = "events"
+query = "SELECT COUNT(*) FROM events"
+data_source = "analytics"
+
+[[metrics]]
+name = "users"
+query = "SELECT COUNT(*) FROM users"
+`,
+		},
+		{
+			name: "unknown data source",
+			content: `
+[[metrics]]
+name = "events"
+query = "SELECT COUNT(*) FROM events"
+data_source = "analytics"
+`,
+			want: []string{`invalid metric events: unknown data source "analytics"`},
+		},
+		{
+			name: "invalid data sources",
+			content: `
+[[data_sources]]
+name = "analytics"
+driver = "oracle"
+dsn = "x"
+
+[[data_sources]]
+name = "analytics"
+driver = "sqlite"
+
+[[metrics]]
+name = "events"
+query = "SELECT 1"
+`,
+			want: []string{
+				`invalid data source analytics: driver must be one of sqlite, postgres, mysql, not "oracle"`,
+				"duplicate data source name: analytics",
+				"invalid data source analytics: dsn cannot be empty",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "metrics.toml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Load() error = %v", err)
+				}
+				if len(cfg.DataSources) != 1 || cfg.DataSources[0].Name != "analytics" {
+					t.Errorf("DataSources = %+v, want analytics", cfg.DataSources)
+				}
+				if cfg.Metrics[0].DataSource != "analytics" || cfg.Metrics[1].DataSource != "" {
+					t.Errorf("metric data sources = %q, %q, want analytics and primary", cfg.Metrics[0].DataSource, cfg.Metrics[1].DataSource)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Load() error = nil")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_APIKeys(t *testing.T) {
+	t.Setenv("SALES_KEY", "sales-secret")
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "valid",
+			content: `
+[[api_keys]]
+key = "${SALES_KEY}"
+scopes = ["sales"]
+
+[[metrics]]
+name = "revenue"
+query = "SELECT 1"
+scopes = ["sales"]
+`,
+		},
+		{
+			name: "invalid keys",
+			content: `
+[[api_keys]]
+key = ""
+
+[[api_keys]]
+key = "a"
+scopes = ["sales", " pii"]
+
+[[api_keys]]
+key = "a"
+
+[[metrics]]
+name = "revenue"
+query = "SELECT 1"
+`,
+			want: []string{
+				"api key 1: key cannot be empty",
+				`api key 2: scopes must be non-empty, without surrounding spaces, not " pii"`,
+				"api key 3: key repeats api key 2",
+			},
+		},
+		{
+			name: "invalid metric scope",
+			content: `
+[[metrics]]
+name = "revenue"
+query = "SELECT 1"
+scopes = [""]
+`,
+			want: []string{"invalid metric revenue: metric scopes must be non-empty"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "metrics.toml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Load() error = %v", err)
+				}
+				want := []APIKey{{Key: "sales-secret", Scopes: []string{"sales"}}}
+				if !reflect.DeepEqual(cfg.APIKeys, want) {
+					t.Errorf("APIKeys = %+v, want %+v", cfg.APIKeys, want)
+				}
+				if !reflect.DeepEqual(cfg.Metrics[0].Scopes, []string{"sales"}) {
+					t.Errorf("metric scopes = %v, want [sales]", cfg.Metrics[0].Scopes)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Load() error = nil")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoad_DefaultParams(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		t.Helper()
+		configPath := filepath.Join(t.TempDir(), "metrics.toml")
+		if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write test config: %v", err)
+		}
+		return configPath
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		t.Setenv("TENANT", "acme")
+		cfg, err := Load(write(t, `
+[defaults.params]
+tenant_id = "${TENANT}"
+region = "eu"
+
+[[metrics]]
+name = "orders"
+query = "SELECT COUNT(*) FROM orders WHERE tenant_id = ?"
+params = [{name = "tenant_id", type = "string", required = true}]
+`))
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		want := map[string]string{"tenant_id": "acme", "region": "eu"}
+		if !reflect.DeepEqual(cfg.Defaults.Params, want) {
+			t.Errorf("Defaults.Params = %v, want %v", cfg.Defaults.Params, want)
+		}
+	})
+
+	t.Run("reserved name", func(t *testing.T) {
+		_, err := Load(write(t, `
+[defaults.params]
+limit = "10"
+
+[[metrics]]
+name = "orders"
+query = "SELECT 1"
+`))
+		if err == nil || !strings.Contains(err.Error(), `defaults.params: "limit" is reserved by the API`) {
+			t.Errorf("Load() error = %v, want limit reported as reserved", err)
+		}
+	})
+
+	t.Run("value unsuited to a metric's param", func(t *testing.T) {
+		_, err := Load(write(t, `
+[defaults.params]
+tenant_id = "acme"
+status = "void"
+
+[[metrics]]
+name = "users"
+query = "SELECT COUNT(*) FROM users WHERE tenant = ?"
+params = [{name = "tenant_id", type = "string", required = true}]
+
+[[metrics]]
+name = "orders"
+query = "SELECT COUNT(*) FROM orders WHERE tenant_id = :tenant_id AND status = :status"
+params = [
+  {name = "tenant_id", type = "int", required = true},
+  {name = "status", type = "string", allowed_values = ["paid", "refunded"], default = "paid"},
+]
+`))
+		if err == nil {
+			t.Fatal("Load() error = nil")
+		}
+		for _, want := range []string{
+			`defaults.params: "tenant_id" does not suit metric orders`,
+			`defaults.params: "status" does not suit metric orders: invalid value "void": must be one of paid, refunded`,
+		} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error %q does not contain %q", err, want)
+			}
+		}
+		if strings.Contains(err.Error(), "metric users") {
+			t.Errorf("error %q blames users, whose tenant_id is a string", err)
+		}
+	})
+}
+
+func TestLoad_Attach(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "valid",
+			content: `
+[attach]
+analytics = "/data/analytics.db"
+
+[[data_sources]]
+name = "archive"
+driver = "sqlite"
+dsn = "/data/archive.db"
+attach = { logs = "/data/logs.db" }
+
+[[metrics]]
+name = "events"
+query = "SELECT COUNT(*) FROM analytics.events"
+
+[[metrics]]
+name = "archived_visits"
+data_source = "archive"
+query = "SELECT COUNT(*) FROM main.visits v JOIN Logs.requests r ON r.visit_id = v.id"
+`,
+		},
+		{
+			name: "undefined schema",
+			content: `
+[attach]
+analytics = "/data/analytics.db"
+
+[[data_sources]]
+name = "archive"
+driver = "sqlite"
+dsn = "/data/archive.db"
+attach = { logs = "/data/logs.db" }
+
+[[data_sources]]
+name = "warehouse"
+driver = "postgres"
+dsn = "postgres://localhost/warehouse"
+
+[[metrics]]
+name = "events"
+query = "SELECT COUNT(*) FROM analytcs.events"
+
+[[metrics]]
+name = "archived_events"
+data_source = "archive"
+query = "SELECT COUNT(*) FROM analytics.events"
+
+[[metrics]]
+name = "warehouse_events"
+data_source = "warehouse"
+query = "SELECT COUNT(*) FROM reporting.events"
+`,
+			want: []string{
+				`invalid metric events: query reads from schema "analytcs", which is not attached to the primary database`,
+				`invalid metric archived_events: query reads from schema "analytics", which is not attached to data source archive`,
+			},
+		},
+		{
+			name: "invalid attachments",
+			content: `
+[attach]
+"bad-alias" = "/data/a.db"
+main = "/data/b.db"
+empty = ""
+
+[[data_sources]]
+name = "warehouse"
+driver = "postgres"
+dsn = "postgres://localhost/warehouse"
+attach = { logs = "/data/logs.db" }
+
+[[metrics]]
+name = "events"
+query = "SELECT 1"
+`,
+			want: []string{
+				`invalid primary database attachment "bad-alias": alias must be letters, digits and underscores`,
+				`invalid primary database attachment "main": alias is reserved by SQLite`,
+				`invalid primary database attachment "empty": path cannot be empty`,
+				"invalid data source warehouse: attach requires the sqlite driver",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "metrics.toml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("failed to write test config: %v", err)
+			}
+
+			cfg, err := Load(configPath)
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Load() error = %v", err)
+				}
+				if cfg.Attach["analytics"] != "/data/analytics.db" {
+					t.Errorf("Attach = %v, want analytics", cfg.Attach)
+				}
+				if cfg.DataSources[0].Attach["logs"] != "/data/logs.db" {
+					t.Errorf("data source Attach = %v, want logs", cfg.DataSources[0].Attach)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Load() error = nil")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+// Parses and evaluates arithmetic formulas over named metric values.
+package formula
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var (
+	ErrSyntax         = errors.New("invalid formula")
+	ErrDivisionByZero = errors.New("division by zero")
+)
+
+// Expr is a parsed formula supporting + - * /, unary minus, parentheses,
+// numeric literals and identifiers naming other metrics.
+type Expr struct {
+	root node
+	vars []string
+}
+
+type node interface {
+	eval(vars map[string]float64) (float64, error)
+}
+
+type number float64
+
+type variable string
+
+type negate struct{ operand node }
+
+type binary struct {
+	op          byte
+	left, right node
+}
+
+func (n number) eval(map[string]float64) (float64, error) {
+	return float64(n), nil
+}
+
+func (v variable) eval(vars map[string]float64) (float64, error) {
+	value, ok := vars[string(v)]
+	if !ok {
+		return 0, fmt.Errorf("no value for %q", string(v))
+	}
+	return value, nil
+}
+
+func (n negate) eval(vars map[string]float64) (float64, error) {
+	v, err := n.operand.eval(vars)
+	return -v, err
+}
+
+func (b binary) eval(vars map[string]float64) (float64, error) {
+	l, err := b.left.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+	r, err := b.right.eval(vars)
+	if err != nil {
+		return 0, err
+	}
+
+	switch b.op {
+	case '+':
+		return l + r, nil
+	case '-':
+		return l - r, nil
+	case '*':
+		return l * r, nil
+	default:
+		if r == 0 {
+			return 0, ErrDivisionByZero
+		}
+		return l / r, nil
+	}
+}
+
+// Parse parses a formula such as "(signups / visitors) * 100".
+func Parse(s string) (*Expr, error) {
+	p := &parser{src: s}
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	return &Expr{root: root, vars: p.vars}, nil
+}
+
+// Vars returns the distinct identifiers in the formula in order of first appearance.
+func (e *Expr) Vars() []string {
+	return e.vars
+}
+
+// Eval evaluates the formula with the given identifier values. Dividing by
+// zero returns ErrDivisionByZero.
+func (e *Expr) Eval(vars map[string]float64) (float64, error) {
+	return e.root.eval(vars)
+}
+
+// parser is a recursive-descent parser over the grammar:
+//
+//	expr    = term { ("+" | "-") term }
+//	term    = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | identifier | "(" expr ")"
+type parser struct {
+	src  string
+	pos  int
+	vars []string
+}
+
+func (p *parser) expr() (node, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept('+', '-')
+		if !ok {
+			return left, nil
+		}
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept('*', '/')
+		if !ok {
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if _, ok := p.accept('-'); ok {
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return negate{operand: operand}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, p.errorf("unexpected end of formula")
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case c == '(':
+		p.pos++
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := p.accept(')'); !ok {
+			return nil, p.errorf("missing closing parenthesis")
+		}
+		return inner, nil
+	case isDigit(c) || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(p.src[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.src[start:p.pos])
+		}
+		return number(v), nil
+	case isIdentStart(c):
+		start := p.pos
+		for p.pos < len(p.src) && isIdentChar(p.src[p.pos]) {
+			p.pos++
+		}
+		name := p.src[start:p.pos]
+		p.addVar(name)
+		return variable(name), nil
+	default:
+		return nil, p.errorf("unexpected %q", c)
+	}
+}
+
+// accept consumes the next non-space character if it is one of ops.
+func (p *parser) accept(ops ...byte) (byte, bool) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return 0, false
+	}
+	for _, op := range ops {
+		if p.src[p.pos] == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return 0, false
+}
+
+func (p *parser) addVar(name string) {
+	for _, v := range p.vars {
+		if v == name {
+			return
+		}
+	}
+	p.vars = append(p.vars, name)
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t' || p.src[p.pos] == '\n' || p.src[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w at position %d: %s", ErrSyntax, p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// IsIdentifier reports whether name can be written in a formula to reference
+// a metric. Metric names with a hyphen or a leading digit cannot, since they
+// would read as subtraction or a number.
+func IsIdentifier(name string) bool {
+	if name == "" || !isIdentStart(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isIdentChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
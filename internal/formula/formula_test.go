@@ -0,0 +1,105 @@
+package formula
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]float64{"signups": 25, "visitors": 200, "refunds": 5}
+
+	tests := []struct {
+		name    string
+		formula string
+		want    float64
+	}{
+		{name: "literal", formula: "42", want: 42},
+		{name: "decimal literal", formula: "0.5", want: 0.5},
+		{name: "variable", formula: "signups", want: 25},
+		{name: "division", formula: "signups / visitors", want: 0.125},
+		{name: "precedence", formula: "signups - refunds * 2", want: 15},
+		{name: "left associative", formula: "visitors / signups / 2", want: 4},
+		{name: "parentheses", formula: "(signups - refunds) / visitors * 100", want: 10},
+		{name: "unary minus", formula: "-signups + visitors", want: 175},
+		{name: "nested parentheses", formula: "((signups))", want: 25},
+		{name: "no spaces", formula: "signups*2+1", want: 51},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.formula)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.formula, err)
+			}
+			got, err := expr.Eval(vars)
+			if err != nil {
+				t.Fatalf("Eval() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Eval(%q) = %v, want %v", tt.formula, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEval_DivisionByZero(t *testing.T) {
+	expr, err := Parse("signups / visitors")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	_, err = expr.Eval(map[string]float64{"signups": 1, "visitors": 0})
+	if !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("Eval() error = %v, want %v", err, ErrDivisionByZero)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []string{
+		"",
+		"signups /",
+		"(signups / visitors",
+		"signups visitors",
+		"signups % visitors",
+		"1..2",
+		")",
+	}
+
+	for _, formula := range tests {
+		t.Run(formula, func(t *testing.T) {
+			if _, err := Parse(formula); !errors.Is(err, ErrSyntax) {
+				t.Errorf("Parse(%q) error = %v, want %v", formula, err, ErrSyntax)
+			}
+		})
+	}
+}
+
+func TestVars(t *testing.T) {
+	expr, err := Parse("(signups - refunds) / visitors + signups")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	want := []string{"signups", "refunds", "visitors"}
+	if got := expr.Vars(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Vars() = %v, want %v", got, want)
+	}
+}
+
+func TestIsIdentifier(t *testing.T) {
+	tests := map[string]bool{
+		"signups":    true,
+		"_private":   true,
+		"rate_5xx":   true,
+		"page-views": false,
+		"5xx_rate":   false,
+		"":           false,
+	}
+
+	for name, want := range tests {
+		if got := IsIdentifier(name); got != want {
+			t.Errorf("IsIdentifier(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+// Defines which date params a metric fills from a request's range shorthand.
+package models
+
+import "errors"
+
+var (
+	ErrDateRangeIncomplete = errors.New("range needs from and to")
+	ErrDateRangeParam      = errors.New("range from and to must name date params of the metric")
+)
+
+// DateRange names the params a request's range (such as range=7d) expands
+// into, so a client can ask for the last week without computing dates.
+type DateRange struct {
+	// From and To name the params given the first and last day of the
+	// range, inclusive.
+	From string `toml:"from" json:"from"`
+	To   string `toml:"to" json:"to"`
+}
+
+// validate checks the range against the metric's declared params.
+func (r DateRange) validate(m Metric) error {
+	if r.From == "" || r.To == "" {
+		return ErrDateRangeIncomplete
+	}
+	for _, name := range []string{r.From, r.To} {
+		p, ok := m.GetParamByName(name)
+		if !ok || p.Type != ParamTypeDate || p.List {
+			return ErrDateRangeParam
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// Defines per-metric configuration for filling missing days in a series.
+package models
+
+import "errors"
+
+var (
+	ErrGapFillMultiRow   = errors.New("fill_gaps applies only to multi_row metrics")
+	ErrGapFillIncomplete = errors.New("fill_gaps needs column, values, from and to")
+	ErrGapFillParam      = errors.New("fill_gaps from and to must name date params of the metric")
+)
+
+// GapFill adds a row for each day between two date params that a multi-row
+// metric's result has no row for, so charts of daily counts have no holes.
+// Filled rows hold the day in Column, zero in each of Values, and NULL in
+// any other column.
+type GapFill struct {
+	// Column holds each row's day, as a date or a timestamp.
+	Column string `toml:"column"`
+	// Values are the columns set to zero in filled rows.
+	Values []string `toml:"values"`
+	// From and To name the params bounding the filled range, inclusive.
+	From string `toml:"from"`
+	To   string `toml:"to"`
+}
+
+// validate checks the fill against the metric's declared params.
+func (g GapFill) validate(m Metric) error {
+	if !m.MultiRow {
+		return ErrGapFillMultiRow
+	}
+	if g.Column == "" || len(g.Values) == 0 || g.From == "" || g.To == "" {
+		return ErrGapFillIncomplete
+	}
+	for _, name := range []string{g.From, g.To} {
+		p, ok := m.GetParamByName(name)
+		if !ok || p.Type != ParamTypeDate || p.List {
+			return ErrGapFillParam
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Defines filters applied when listing the metric catalog.
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidTagMatch = errors.New("invalid tag_match: must be any or all")
+
+// TagMatch selects whether a metric needs any or all of the requested tags.
+type TagMatch string
+
+const (
+	TagMatchAny TagMatch = "any"
+	TagMatchAll TagMatch = "all"
+)
+
+// ListOptions filters the catalog returned by ListMetrics. The zero value
+// lists every metric.
+type ListOptions struct {
+	Tags  []string
+	Match TagMatch
+}
+
+// Validate checks that Match is empty (meaning any) or a known mode.
+func (o ListOptions) Validate() error {
+	if o.Match != "" && o.Match != TagMatchAny && o.Match != TagMatchAll {
+		return fmt.Errorf("%w, not %q", ErrInvalidTagMatch, o.Match)
+	}
+	return nil
+}
+
+// Matches reports whether a metric with the given tags passes the filter.
+func (o ListOptions) Matches(tags []string) bool {
+	if len(o.Tags) == 0 {
+		return true
+	}
+
+	has := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		has[tag] = true
+	}
+
+	for _, want := range o.Tags {
+		if has[want] && o.Match != TagMatchAll {
+			return true
+		}
+		if !has[want] && o.Match == TagMatchAll {
+			return false
+		}
+	}
+	return o.Match == TagMatchAll
+}
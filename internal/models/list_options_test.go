@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestListOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    ListOptions
+		wantErr error
+	}{
+		{"zero value", ListOptions{}, nil},
+		{"any", ListOptions{Tags: []string{"sales"}, Match: TagMatchAny}, nil},
+		{"all", ListOptions{Tags: []string{"sales"}, Match: TagMatchAll}, nil},
+		{"unknown mode", ListOptions{Tags: []string{"sales"}, Match: "some"}, ErrInvalidTagMatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ListOptions.Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestListOptions_Matches(t *testing.T) {
+	tags := []string{"sales", "daily"}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		tags []string
+		want bool
+	}{
+		{name: "no filter", opts: ListOptions{}, tags: nil, want: true},
+		{name: "any with one match", opts: ListOptions{Tags: []string{"sales", "weekly"}}, tags: tags, want: true},
+		{name: "any with no match", opts: ListOptions{Tags: []string{"weekly"}}, tags: tags, want: false},
+		{name: "untagged metric", opts: ListOptions{Tags: []string{"sales"}}, tags: nil, want: false},
+		{name: "all present", opts: ListOptions{Tags: []string{"daily", "sales"}, Match: TagMatchAll}, tags: tags, want: true},
+		{name: "all with one missing", opts: ListOptions{Tags: []string{"sales", "weekly"}, Match: TagMatchAll}, tags: tags, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.Matches(tt.tags); got != tt.want {
+				t.Errorf("Matches(%v) = %v, want %v", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,32 +1,405 @@
 // Defines metric configuration structure with query and parameter definitions.
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/formula"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/sqlutil"
+)
 
 var (
-	ErrMetricNameEmpty  = errors.New("metric name cannot be empty")
-	ErrMetricQueryEmpty = errors.New("metric query cannot be empty")
+	ErrMetricNameEmpty   = errors.New("metric name cannot be empty")
+	ErrInvalidMetricName = errors.New("metric name must contain only letters, digits, underscores and hyphens")
+	ErrMetricQueryEmpty  = errors.New("metric query cannot be empty")
+	ErrQueryNotSelect    = errors.New("metric query must begin with SELECT or WITH")
+	ErrCacheTTLNegative  = errors.New("metric cache_ttl cannot be negative")
+	ErrRefreshNegative   = errors.New("metric refresh_interval cannot be negative")
+	ErrRefreshCacheTTL   = errors.New("refresh_interval must be shorter than cache_ttl, so a refreshed result is still cached when the next refresh runs")
+	ErrRefreshParams     = errors.New("refresh_interval requires every param to have a default, since refreshes run without request params")
+	ErrParamCount        = errors.New("query placeholders do not match declared params")
+	ErrMixedPlaceholders = errors.New("query cannot mix ? and :name placeholders")
+	ErrFormulaWithQuery  = errors.New("metric cannot have both a query and a formula")
+	ErrFormulaMultiRow   = errors.New("formula metric cannot be multi_row")
+	ErrFormulaParams     = errors.New("formula metric cannot declare params; its dependencies declare their own")
+	ErrFormulaCacheTTL   = errors.New("formula metric cannot set cache_ttl; cache its dependencies instead")
+	ErrFormulaDataSource = errors.New("formula metric cannot set data_source; its dependencies query their own")
+	ErrFormulaRefresh    = errors.New("formula metric cannot set refresh_interval; refresh its dependencies instead")
+	ErrFormulaFallback   = errors.New("formula metric cannot set fallback_query; set it on its dependencies")
+	ErrFormulaRange      = errors.New("formula metric cannot set range; its dependencies declare their own")
+	ErrInvalidValueType  = errors.New("invalid value_type: must be int, float or bool")
+	ErrValueTypeMultiRow = errors.New("value_type applies only to single-value metrics")
+	ErrInvalidTag        = errors.New("metric tags must be non-empty, without commas or surrounding spaces")
+	ErrInvalidScope      = errors.New("metric scopes must be non-empty, without surrounding spaces")
+	ErrMaxAgeNegative    = errors.New("metric max_age cannot be negative")
+	ErrMaxRowsNegative   = errors.New("metric max_rows cannot be negative")
+	ErrMaxRowsMultiRow   = errors.New("max_rows applies only to multi_row metrics")
+	ErrMaxRowsGapFill    = errors.New("max_rows cannot be combined with fill_gaps, which would fill in the rows it leaves out")
+	ErrSingleRow         = errors.New("single_row applies only to multi_row metrics")
+	ErrSingleRowLimits   = errors.New("single_row cannot be combined with max_rows or fill_gaps")
+	ErrJSONColumns       = errors.New("json_columns applies only to multi_row metrics")
+	ErrBoolColumns       = errors.New("bool_columns applies only to multi_row metrics")
+	ErrOmitNulls         = errors.New("omit_nulls applies only to multi_row metrics")
+	ErrInvalidFormat     = errors.New("invalid format: must be count, currency, percent or duration_ms")
+	ErrDefaultOnEmpty    = errors.New("default_on_empty must be a number or a string")
+	ErrDefaultMultiRow   = errors.New("default_on_empty applies only to single-value metrics")
+	ErrFormulaDefault    = errors.New("formula metric cannot set default_on_empty; set it on its dependencies")
+)
+
+// metricName is the form a metric name must take. Names appear as a path
+// segment in /metrics/{name}, so a slash or space would make the metric
+// unreachable, and a dot would be confused with the .csv suffix.
+var metricName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValueType forces a single-value metric's result to one type, since
+// drivers (SQLite especially) choose between integer and float per value,
+// and SQLite has no boolean type at all.
+type ValueType string
+
+const (
+	ValueTypeInt   ValueType = "int"
+	ValueTypeFloat ValueType = "float"
+	ValueTypeBool  ValueType = "bool"
 )
 
+// IsValid reports whether vt is empty (no conversion) or a known type.
+func (vt ValueType) IsValid() bool {
+	return vt == "" || vt == ValueTypeInt || vt == ValueTypeFloat || vt == ValueTypeBool
+}
+
+// Format tells charting clients how to render a metric's values, e.g. to
+// label an axis as a percentage. The server never changes values for it.
+type Format string
+
+const (
+	FormatCount      Format = "count"
+	FormatCurrency   Format = "currency"
+	FormatPercent    Format = "percent"
+	FormatDurationMS Format = "duration_ms"
+)
+
+// IsValid reports whether f is empty (unspecified) or a known format.
+func (f Format) IsValid() bool {
+	switch f {
+	case "", FormatCount, FormatCurrency, FormatPercent, FormatDurationMS:
+		return true
+	}
+	return false
+}
+
 type Metric struct {
-	Name     string            `toml:"name"`
-	Query    string            `toml:"query"`
-	MultiRow bool              `toml:"multi_row"`
-	Params   []ParamDefinition `toml:"params"`
+	Name        string            `toml:"name"`
+	Description string            `toml:"description"`
+	Unit        string            `toml:"unit"`
+	Format      Format            `toml:"format"`
+	Category    string            `toml:"category"`
+	Tags        []string          `toml:"tags"`
+	Query       string            `toml:"query"`
+	Formula     string            `toml:"formula"`
+	MultiRow    bool              `toml:"multi_row"`
+	ValueType   ValueType         `toml:"value_type"`
+	Params      []ParamDefinition `toml:"params"`
+	CacheTTL    time.Duration     `toml:"cache_ttl"`
+	// SingleRow, on a multi_row metric, returns only the first row as an
+	// object, such as the latest record, rather than an array of rows.
+	SingleRow bool `toml:"single_row"`
+	// Enabled, when set to false, takes the metric out of service without
+	// deleting its config. A pointer, since an unset value means enabled.
+	Enabled *bool `toml:"enabled"`
+	// Scopes are all required of a scoped API key reading the metric; keys
+	// without scopes, and requests when auth is off, are not restricted.
+	Scopes []string `toml:"scopes"`
+	// RefreshInterval, when set, has the service rerun the metric with its
+	// default params on this schedule, so requests find it already cached.
+	RefreshInterval time.Duration `toml:"refresh_interval"`
+	// DataSource names one of the config's data_sources to query; empty
+	// uses the primary database.
+	DataSource string `toml:"data_source"`
+	// MaxAge is how many seconds clients and proxies may reuse a response
+	// (Cache-Control: max-age); 0 forbids storing it.
+	MaxAge int `toml:"max_age"`
+	// FillGaps, when set, adds zero rows for days missing from the result.
+	FillGaps *GapFill `toml:"fill_gaps"`
+	// Range, when set, names the date params a request's range shorthand
+	// fills in.
+	Range *DateRange `toml:"range"`
+	// JSONColumns names columns holding JSON text, which responses embed as
+	// JSON rather than as an escaped string.
+	JSONColumns []string `toml:"json_columns"`
+	// BoolColumns names columns holding 0/1 flags, which responses render
+	// as JSON booleans.
+	BoolColumns []string `toml:"bool_columns"`
+	// OmitNulls drops NULL columns from each row instead of returning them
+	// as null, so rows no longer all share the same keys.
+	OmitNulls bool `toml:"omit_nulls"`
+	// MaxRows, when set, truncates the metric's rows to at most this many
+	// and marks the result as truncated, in place of the server-wide row
+	// limit that would reject it.
+	MaxRows int `toml:"max_rows"`
+	// DefaultOnEmpty, when set, is the value of a single-value metric whose
+	// query returns no rows, which is otherwise an error. TOML decodes it as
+	// int64, float64 or string.
+	DefaultOnEmpty interface{} `toml:"default_on_empty"`
+	// FallbackQuery, when set, runs in place of Query when Query fails, for
+	// example a live aggregate standing in for a materialized view. It takes
+	// the same params, and its result is marked as degraded.
+	FallbackQuery string `toml:"fallback_query"`
 }
 
 func (m Metric) Validate() error {
 	if m.Name == "" {
 		return ErrMetricNameEmpty
 	}
+	if !metricName.MatchString(m.Name) {
+		return fmt.Errorf("%w, not %q", ErrInvalidMetricName, m.Name)
+	}
+	if !m.ValueType.IsValid() {
+		return ErrInvalidValueType
+	}
+	if !m.Format.IsValid() {
+		return fmt.Errorf("%w, not %q", ErrInvalidFormat, m.Format)
+	}
+	if m.ValueType != "" && m.MultiRow {
+		return ErrValueTypeMultiRow
+	}
+	if m.MaxAge < 0 {
+		return ErrMaxAgeNegative
+	}
+	switch m.DefaultOnEmpty.(type) {
+	case nil, int64, float64, string:
+	default:
+		return fmt.Errorf("%w, not %v", ErrDefaultOnEmpty, m.DefaultOnEmpty)
+	}
+	// Tags are filtered with a comma-separated, trimmed query parameter, so
+	// these tags could never be matched.
+	for _, tag := range m.Tags {
+		if tag == "" || tag != strings.TrimSpace(tag) || strings.Contains(tag, ",") {
+			return fmt.Errorf("%w: %q", ErrInvalidTag, tag)
+		}
+	}
+	for _, scope := range m.Scopes {
+		if scope == "" || scope != strings.TrimSpace(scope) {
+			return fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+	}
+	if m.Formula != "" {
+		return m.validateFormula()
+	}
 	if m.Query == "" {
 		return ErrMetricQueryEmpty
 	}
+	// Metrics only read data; rejecting anything else at load time keeps a
+	// misconfigured UPDATE or DROP from ever reaching the database.
+	if kw := sqlutil.FirstKeyword(m.Query); kw != "SELECT" && kw != "WITH" {
+		return fmt.Errorf("%w, not %q", ErrQueryNotSelect, kw)
+	}
+	if m.CacheTTL < 0 {
+		return ErrCacheTTLNegative
+	}
+	if err := m.validateRefresh(); err != nil {
+		return err
+	}
 
+	keys := make(map[string]bool)
 	for _, param := range m.Params {
 		if err := param.Validate(); err != nil {
 			return err
 		}
+		keys[param.Name] = true
+	}
+	for _, param := range m.Params {
+		for _, alias := range param.Aliases {
+			if keys[alias] {
+				return fmt.Errorf("%w: %q", ErrParamAliasTaken, alias)
+			}
+			keys[alias] = true
+		}
+	}
+	if m.FillGaps != nil {
+		if err := m.FillGaps.validate(m); err != nil {
+			return err
+		}
+	}
+	if m.Range != nil {
+		if err := m.Range.validate(m); err != nil {
+			return err
+		}
+	}
+	if len(m.JSONColumns) > 0 && !m.MultiRow {
+		return ErrJSONColumns
+	}
+	if len(m.BoolColumns) > 0 && !m.MultiRow {
+		return ErrBoolColumns
+	}
+	if m.OmitNulls && !m.MultiRow {
+		return ErrOmitNulls
+	}
+	if err := m.validateMaxRows(); err != nil {
+		return err
+	}
+	switch {
+	case m.SingleRow && !m.MultiRow:
+		return ErrSingleRow
+	case m.SingleRow && (m.MaxRows > 0 || m.FillGaps != nil):
+		return ErrSingleRowLimits
+	}
+	if m.DefaultOnEmpty != nil && m.MultiRow {
+		return ErrDefaultMultiRow
+	}
+
+	if err := m.validatePlaceholders(); err != nil {
+		return err
+	}
+	return m.validateFallback()
+}
+
+// validateMaxRows checks the row cap of a query metric.
+func (m Metric) validateMaxRows() error {
+	switch {
+	case m.MaxRows < 0:
+		return ErrMaxRowsNegative
+	case m.MaxRows > 0 && !m.MultiRow:
+		return ErrMaxRowsMultiRow
+	case m.MaxRows > 0 && m.FillGaps != nil:
+		return ErrMaxRowsGapFill
+	}
+	return nil
+}
+
+// validateFallback checks the fallback query by the rules for the primary
+// one, since it is run with the same params.
+func (m Metric) validateFallback() error {
+	if m.FallbackQuery == "" {
+		return nil
+	}
+	if kw := sqlutil.FirstKeyword(m.FallbackQuery); kw != "SELECT" && kw != "WITH" {
+		return fmt.Errorf("fallback_query: %w, not %q", ErrQueryNotSelect, kw)
+	}
+	fallback := m
+	fallback.Query = m.FallbackQuery
+	if err := fallback.validatePlaceholders(); err != nil {
+		return fmt.Errorf("fallback_query: %w", err)
+	}
+	return nil
+}
+
+// validateFormula checks a computed metric. Whether the metrics it references
+// exist is checked by the config loader, which sees the whole metric set.
+func (m Metric) validateFormula() error {
+	switch {
+	case m.Query != "":
+		return ErrFormulaWithQuery
+	case m.MultiRow:
+		return ErrFormulaMultiRow
+	case m.FillGaps != nil:
+		return ErrGapFillMultiRow
+	case len(m.JSONColumns) > 0:
+		return ErrJSONColumns
+	case len(m.BoolColumns) > 0:
+		return ErrBoolColumns
+	case m.OmitNulls:
+		return ErrOmitNulls
+	case m.MaxRows != 0:
+		return ErrMaxRowsMultiRow
+	case m.SingleRow:
+		return ErrSingleRow
+	case len(m.Params) > 0:
+		return ErrFormulaParams
+	case m.CacheTTL != 0:
+		return ErrFormulaCacheTTL
+	case m.FallbackQuery != "":
+		return ErrFormulaFallback
+	case m.Range != nil:
+		return ErrFormulaRange
+	case m.DataSource != "":
+		return ErrFormulaDataSource
+	case m.RefreshInterval != 0:
+		return ErrFormulaRefresh
+	case m.DefaultOnEmpty != nil:
+		return ErrFormulaDefault
+	}
+
+	_, err := formula.Parse(m.Formula)
+	return err
+}
+
+// validateRefresh checks refresh_interval against the cache and params it
+// depends on.
+func (m Metric) validateRefresh() error {
+	switch {
+	case m.RefreshInterval < 0:
+		return ErrRefreshNegative
+	case m.RefreshInterval == 0:
+		return nil
+	case m.RefreshInterval >= m.CacheTTL:
+		return ErrRefreshCacheTTL
+	}
+	for _, param := range m.Params {
+		if param.Default == "" {
+			return fmt.Errorf("%w; %q has none", ErrRefreshParams, param.Name)
+		}
+	}
+	return nil
+}
+
+// IsEnabled reports whether the metric is served, which it is unless its
+// config sets enabled = false.
+func (m Metric) IsEnabled() bool {
+	return m.Enabled == nil || *m.Enabled
+}
+
+// IsComputed reports whether the metric is evaluated from a formula over
+// other metrics rather than by running a query.
+func (m Metric) IsComputed() bool {
+	return m.Formula != ""
+}
+
+// Dependencies returns the names of the metrics a computed metric's formula
+// references, or nil for a query metric or an unparseable formula.
+func (m Metric) Dependencies() []string {
+	if !m.IsComputed() {
+		return nil
+	}
+	expr, err := formula.Parse(m.Formula)
+	if err != nil {
+		return nil
+	}
+	return expr.Vars()
+}
+
+// validatePlaceholders checks the query's placeholders against the declared
+// params, since a mismatch would otherwise only surface as a driver error
+// when the metric is first requested.
+func (m Metric) validatePlaceholders() error {
+	positional := sqlutil.CountPlaceholders(m.Query)
+	_, names := sqlutil.ParseNamed(m.Query)
+
+	if len(names) == 0 {
+		if positional != len(m.Params) {
+			return fmt.Errorf("%w: query has %d placeholders but %d params declared", ErrParamCount, positional, len(m.Params))
+		}
+		return nil
+	}
+
+	if positional > 0 {
+		return ErrMixedPlaceholders
+	}
+
+	used := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := m.GetParamByName(name); !ok {
+			return fmt.Errorf("%w: query uses :%s but no such param is declared", ErrParamCount, name)
+		}
+		used[name] = true
+	}
+	for _, param := range m.Params {
+		if !used[param.Name] {
+			return fmt.Errorf("%w: param %q is not used in the query", ErrParamCount, param.Name)
+		}
 	}
 
 	return nil
@@ -40,3 +413,23 @@ func (m Metric) GetParamByName(name string) (ParamDefinition, bool) {
 	}
 	return ParamDefinition{}, false
 }
+
+// Info returns the client-facing description of the metric, leaving out the
+// query and other server-side details.
+func (m Metric) Info() MetricInfo {
+	return MetricInfo{
+		Name:        m.Name,
+		Description: m.Description,
+		Unit:        m.Unit,
+		Format:      m.Format,
+		Category:    m.Category,
+		Tags:        m.Tags,
+		MultiRow:    m.MultiRow,
+		SingleRow:   m.SingleRow,
+		ValueType:   m.ValueType,
+		Params:      m.Params,
+		MaxAge:      m.MaxAge,
+		Range:       m.Range,
+		Scopes:      m.Scopes,
+	}
+}
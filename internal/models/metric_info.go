@@ -0,0 +1,22 @@
+// Defines the catalog entry returned when listing available metrics.
+package models
+
+// MetricInfo describes a metric to API clients so dashboards can label and
+// group values and know which parameters to send.
+type MetricInfo struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Unit        string            `json:"unit,omitempty"`
+	Format      Format            `json:"format,omitempty"`
+	Category    string            `json:"category,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	MultiRow    bool              `json:"multi_row"`
+	SingleRow   bool              `json:"single_row,omitempty"`
+	ValueType   ValueType         `json:"value_type,omitempty"`
+	Params      []ParamDefinition `json:"params,omitempty"`
+	MaxAge      int               `json:"max_age,omitempty"`
+	// Range names the params a request's range shorthand fills in.
+	Range *DateRange `json:"range,omitempty"`
+	// Scopes are the API key scopes needed to read the metric.
+	Scopes []string `json:"scopes,omitempty"`
+}
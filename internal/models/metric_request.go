@@ -0,0 +1,9 @@
+// Defines one entry of a batch in which each metric has its own params.
+package models
+
+// MetricRequest names a metric and the params to run it with. Params are
+// strings, as in the query string, converted using the metric's declared types.
+type MetricRequest struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params"`
+}
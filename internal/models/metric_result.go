@@ -1,7 +1,42 @@
 // Defines the API response structure for metric results.
 package models
 
+import "time"
+
 type MetricResult struct {
 	Name  string      `json:"name"`
 	Value interface{} `json:"value"`
+	// Columns names a multi-row value's columns in the order the query
+	// selects them, since each row, as a JSON object, has its keys sorted.
+	Columns []string `json:"columns,omitempty"`
+	// Unit and Format repeat the metric's configuration so a chart can
+	// render each result of a batch without looking up the catalog.
+	Unit   string `json:"unit,omitempty"`
+	Format Format `json:"format,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Page   *Page  `json:"page,omitempty"`
+	// Truncated reports that the metric's max_rows left out some rows.
+	Truncated bool `json:"truncated,omitempty"`
+	// DurationMS is how long the database took to answer, reported only
+	// when a request asks for debug output.
+	DurationMS *float64 `json:"duration_ms,omitempty"`
+	// Degraded reports that the metric's query failed and the value came
+	// from its fallback_query instead.
+	Degraded bool `json:"degraded,omitempty"`
+	// GeneratedAt is when the value was queried, so a result served from
+	// cache carries the time it was first computed rather than now.
+	GeneratedAt time.Time `json:"generated_at,omitzero"`
+	// MaxAge is the metric's max_age, which the handler turns into a
+	// Cache-Control header rather than a field of the body.
+	MaxAge int `json:"-"`
+	// Err is the failure behind Error, kept so the handler can decide how
+	// much of it a client may see.
+	Err error `json:"-"`
+}
+
+// Page describes the slice of a paginated multi-row result.
+type Page struct {
+	Limit  int   `json:"limit"`
+	Offset int   `json:"offset"`
+	Total  int64 `json:"total"`
 }
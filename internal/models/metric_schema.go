@@ -0,0 +1,10 @@
+// Defines the schema response describing a metric's parameters and columns.
+package models
+
+// MetricSchema extends a metric's catalog entry with the columns a multi-row
+// metric returns, in query order, so clients can build forms and charts
+// before requesting data.
+type MetricSchema struct {
+	MetricInfo
+	Columns []string `json:"columns,omitempty"`
+}
@@ -1,6 +1,13 @@
 package models
 
-import "testing"
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/formula"
+)
 
 func TestMetric_Validate(t *testing.T) {
 	tests := []struct {
@@ -38,6 +45,26 @@ func TestMetric_Validate(t *testing.T) {
 			},
 			wantErr: ErrMetricNameEmpty,
 		},
+		{
+			name:    "name with hyphen and digits",
+			metric:  Metric{Name: "signups-7d", Query: "SELECT 1"},
+			wantErr: nil,
+		},
+		{
+			name:    "name with slash",
+			metric:  Metric{Name: "foo/bar", Query: "SELECT 1"},
+			wantErr: ErrInvalidMetricName,
+		},
+		{
+			name:    "name with space",
+			metric:  Metric{Name: "daily users", Query: "SELECT 1"},
+			wantErr: ErrInvalidMetricName,
+		},
+		{
+			name:    "name with dot",
+			metric:  Metric{Name: "users.csv", Query: "SELECT 1"},
+			wantErr: ErrInvalidMetricName,
+		},
 		{
 			name: "empty query",
 			metric: Metric{
@@ -46,6 +73,267 @@ func TestMetric_Validate(t *testing.T) {
 			},
 			wantErr: ErrMetricQueryEmpty,
 		},
+		{
+			name: "with query",
+			metric: Metric{
+				Name:  "test",
+				Query: "WITH recent AS (SELECT * FROM users) SELECT COUNT(*) FROM recent",
+			},
+			wantErr: nil,
+		},
+		{
+			name: "recursive CTE",
+			metric: Metric{
+				Name:     "test",
+				MultiRow: true,
+				Query: `-- reports under a manager
+					with recursive reports(id, depth) AS (
+						SELECT id, 0 FROM employees WHERE id = :manager_id
+						UNION ALL
+						SELECT e.id, r.depth + 1 FROM employees e JOIN reports r ON e.manager_id = r.id
+					)
+					SELECT * FROM reports`,
+				Params: []ParamDefinition{{Name: "manager_id", Type: "int", Required: true}},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "lower case select after comment",
+			metric: Metric{
+				Name:  "test",
+				Query: "-- active users\n/* v2 */ select count(*) from users",
+			},
+			wantErr: nil,
+		},
+		{
+			name: "insert query",
+			metric: Metric{
+				Name:  "test",
+				Query: "INSERT INTO audit (note) VALUES ('hi')",
+			},
+			wantErr: ErrQueryNotSelect,
+		},
+		{
+			name: "delete query",
+			metric: Metric{
+				Name:  "test",
+				Query: "  delete FROM users",
+			},
+			wantErr: ErrQueryNotSelect,
+		},
+		{
+			name: "pragma query",
+			metric: Metric{
+				Name:  "test",
+				Query: "PRAGMA table_info(users)",
+			},
+			wantErr: ErrQueryNotSelect,
+		},
+		{
+			name: "update hidden after comment",
+			metric: Metric{
+				Name:  "test",
+				Query: "-- SELECT\nUPDATE users SET active = 0",
+			},
+			wantErr: ErrQueryNotSelect,
+		},
+		{
+			name: "formula metric",
+			metric: Metric{
+				Name:    "conversion_rate",
+				Formula: "signups / visitors * 100",
+			},
+			wantErr: nil,
+		},
+		{
+			name: "formula with query",
+			metric: Metric{
+				Name:    "conversion_rate",
+				Query:   "SELECT 1",
+				Formula: "signups / visitors",
+			},
+			wantErr: ErrFormulaWithQuery,
+		},
+		{
+			name: "multi-row formula",
+			metric: Metric{
+				Name:     "conversion_rate",
+				Formula:  "signups / visitors",
+				MultiRow: true,
+			},
+			wantErr: ErrFormulaMultiRow,
+		},
+		{
+			name: "formula with params",
+			metric: Metric{
+				Name:    "conversion_rate",
+				Formula: "signups / visitors",
+				Params:  []ParamDefinition{{Name: "since", Type: ParamTypeDate, Required: true}},
+			},
+			wantErr: ErrFormulaParams,
+		},
+		{
+			name: "formula with cache ttl",
+			metric: Metric{
+				Name:     "conversion_rate",
+				Formula:  "signups / visitors",
+				CacheTTL: time.Minute,
+			},
+			wantErr: ErrFormulaCacheTTL,
+		},
+		{
+			name: "formula with data source",
+			metric: Metric{
+				Name:       "conversion_rate",
+				Formula:    "signups / visitors",
+				DataSource: "analytics",
+			},
+			wantErr: ErrFormulaDataSource,
+		},
+		{
+			name: "formula syntax error",
+			metric: Metric{
+				Name:    "conversion_rate",
+				Formula: "signups / (visitors",
+			},
+			wantErr: formula.ErrSyntax,
+		},
+		{
+			name: "int value type",
+			metric: Metric{
+				Name:      "test",
+				Query:     "SELECT AVG(score) FROM reviews",
+				ValueType: ValueTypeInt,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "unknown value type",
+			metric: Metric{
+				Name:      "test",
+				Query:     "SELECT 1",
+				ValueType: "decimal",
+			},
+			wantErr: ErrInvalidValueType,
+		},
+		{
+			name: "known format",
+			metric: Metric{
+				Name:   "test",
+				Query:  "SELECT 1",
+				Format: FormatPercent,
+			},
+			wantErr: nil,
+		},
+		{
+			name: "unknown format",
+			metric: Metric{
+				Name:   "test",
+				Query:  "SELECT 1",
+				Format: "dollars",
+			},
+			wantErr: ErrInvalidFormat,
+		},
+		{
+			name: "value type on multi-row metric",
+			metric: Metric{
+				Name:      "test",
+				Query:     "SELECT * FROM users",
+				MultiRow:  true,
+				ValueType: ValueTypeFloat,
+			},
+			wantErr: ErrValueTypeMultiRow,
+		},
+		{
+			name: "default on empty",
+			metric: Metric{
+				Name:           "test",
+				Query:          "SELECT SUM(amount) FROM orders",
+				DefaultOnEmpty: 0.0,
+			},
+		},
+		{
+			name: "default on empty of unsupported type",
+			metric: Metric{
+				Name:           "test",
+				Query:          "SELECT SUM(amount) FROM orders",
+				DefaultOnEmpty: true,
+			},
+			wantErr: ErrDefaultOnEmpty,
+		},
+		{
+			name: "default on empty on multi-row metric",
+			metric: Metric{
+				Name:           "test",
+				Query:          "SELECT * FROM users",
+				MultiRow:       true,
+				DefaultOnEmpty: int64(0),
+			},
+			wantErr: ErrDefaultMultiRow,
+		},
+		{
+			name: "default on empty on formula metric",
+			metric: Metric{
+				Name:           "test",
+				Formula:        "a / b",
+				DefaultOnEmpty: int64(0),
+			},
+			wantErr: ErrFormulaDefault,
+		},
+		{
+			name: "valid tags",
+			metric: Metric{
+				Name:  "test",
+				Query: "SELECT 1",
+				Tags:  []string{"sales", "daily"},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "empty tag",
+			metric: Metric{
+				Name:  "test",
+				Query: "SELECT 1",
+				Tags:  []string{"sales", ""},
+			},
+			wantErr: ErrInvalidTag,
+		},
+		{
+			name: "tag containing comma",
+			metric: Metric{
+				Name:  "test",
+				Query: "SELECT 1",
+				Tags:  []string{"sales,daily"},
+			},
+			wantErr: ErrInvalidTag,
+		},
+		{
+			name: "tag with surrounding space",
+			metric: Metric{
+				Name:  "test",
+				Query: "SELECT 1",
+				Tags:  []string{" sales"},
+			},
+			wantErr: ErrInvalidTag,
+		},
+		{
+			name: "negative cache ttl",
+			metric: Metric{
+				Name:     "test",
+				Query:    "SELECT 1",
+				CacheTTL: -time.Second,
+			},
+			wantErr: ErrCacheTTLNegative,
+		},
+		{
+			name: "negative max age",
+			metric: Metric{
+				Name:    "test",
+				Formula: "a + b",
+				MaxAge:  -1,
+			},
+			wantErr: ErrMaxAgeNegative,
+		},
 		{
 			name: "invalid param",
 			metric: Metric{
@@ -57,18 +345,338 @@ func TestMetric_Validate(t *testing.T) {
 			},
 			wantErr: ErrParamNameEmpty,
 		},
+		{
+			name: "more placeholders than params",
+			metric: Metric{
+				Name:  "test",
+				Query: "SELECT * FROM users WHERE id = ? AND status = ?",
+				Params: []ParamDefinition{
+					{Name: "user_id", Type: ParamTypeInt, Required: true},
+				},
+			},
+			wantErr: ErrParamCount,
+		},
+		{
+			name: "params without placeholders",
+			metric: Metric{
+				Name:  "test",
+				Query: "SELECT COUNT(*) FROM users",
+				Params: []ParamDefinition{
+					{Name: "user_id", Type: ParamTypeInt, Required: true},
+				},
+			},
+			wantErr: ErrParamCount,
+		},
+		{
+			name: "named placeholders in any declaration order",
+			metric: Metric{
+				Name:  "test",
+				Query: "SELECT COUNT(*) FROM users WHERE created >= :start_date AND created < :end_date AND :start_date < :end_date",
+				Params: []ParamDefinition{
+					{Name: "end_date", Type: ParamTypeDate, Required: true},
+					{Name: "start_date", Type: ParamTypeDate, Required: true},
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "named placeholder without declared param",
+			metric: Metric{
+				Name:  "test",
+				Query: "SELECT * FROM users WHERE id = :user_id",
+				Params: []ParamDefinition{
+					{Name: "id", Type: ParamTypeInt, Required: true},
+				},
+			},
+			wantErr: ErrParamCount,
+		},
+		{
+			name: "declared param unused by named query",
+			metric: Metric{
+				Name:  "test",
+				Query: "SELECT * FROM users WHERE id = :id",
+				Params: []ParamDefinition{
+					{Name: "id", Type: ParamTypeInt, Required: true},
+					{Name: "status", Type: ParamTypeString, Required: true},
+				},
+			},
+			wantErr: ErrParamCount,
+		},
+		{
+			name: "mixed placeholders",
+			metric: Metric{
+				Name:  "test",
+				Query: "SELECT * FROM users WHERE id = :id AND status = ?",
+				Params: []ParamDefinition{
+					{Name: "id", Type: ParamTypeInt, Required: true},
+					{Name: "status", Type: ParamTypeString, Required: true},
+				},
+			},
+			wantErr: ErrMixedPlaceholders,
+		},
+		{
+			name: "question mark in literal is not a placeholder",
+			metric: Metric{
+				Name:  "test",
+				Query: "SELECT * FROM faq WHERE question LIKE '%?' AND id = ?",
+				Params: []ParamDefinition{
+					{Name: "id", Type: ParamTypeInt, Required: true},
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "gap fill",
+			metric:  gapFillMetric(func(m *Metric) {}),
+			wantErr: nil,
+		},
+		{
+			name:    "gap fill on single-value metric",
+			metric:  gapFillMetric(func(m *Metric) { m.MultiRow = false }),
+			wantErr: ErrGapFillMultiRow,
+		},
+		{
+			name:    "gap fill without values",
+			metric:  gapFillMetric(func(m *Metric) { m.FillGaps.Values = nil }),
+			wantErr: ErrGapFillIncomplete,
+		},
+		{
+			name:    "gap fill range from undeclared param",
+			metric:  gapFillMetric(func(m *Metric) { m.FillGaps.To = "until" }),
+			wantErr: ErrGapFillParam,
+		},
+		{
+			name:    "gap fill range from non-date param",
+			metric:  gapFillMetric(func(m *Metric) { m.Params[0].Type = ParamTypeString }),
+			wantErr: ErrGapFillParam,
+		},
+		{
+			name:    "date range",
+			metric:  gapFillMetric(func(m *Metric) { m.Range = &DateRange{From: "from", To: "to"} }),
+			wantErr: nil,
+		},
+		{
+			name:    "date range on single-value metric",
+			metric:  Metric{Name: "test", Query: "SELECT COUNT(*) FROM orders WHERE day >= ?", Params: []ParamDefinition{{Name: "since", Type: ParamTypeDate, Required: true}}, Range: &DateRange{From: "since", To: "since"}},
+			wantErr: nil,
+		},
+		{
+			name:    "date range without to",
+			metric:  gapFillMetric(func(m *Metric) { m.Range = &DateRange{From: "from"} }),
+			wantErr: ErrDateRangeIncomplete,
+		},
+		{
+			name:    "date range to undeclared param",
+			metric:  gapFillMetric(func(m *Metric) { m.Range = &DateRange{From: "from", To: "until"} }),
+			wantErr: ErrDateRangeParam,
+		},
+		{
+			name: "date range to non-date param",
+			metric: gapFillMetric(func(m *Metric) {
+				m.FillGaps = nil
+				m.Params[0].Type = ParamTypeString
+				m.Range = &DateRange{From: "from", To: "to"}
+			}),
+			wantErr: ErrDateRangeParam,
+		},
+		{
+			name:    "date range on formula metric",
+			metric:  Metric{Name: "test", Formula: "a + b", Range: &DateRange{From: "from", To: "to"}},
+			wantErr: ErrFormulaRange,
+		},
+		{
+			name:    "single row",
+			metric:  Metric{Name: "test", Query: "SELECT 1", MultiRow: true, SingleRow: true},
+			wantErr: nil,
+		},
+		{
+			name:    "single row without multi_row",
+			metric:  Metric{Name: "test", Query: "SELECT 1", SingleRow: true},
+			wantErr: ErrSingleRow,
+		},
+		{
+			name:    "single row with max_rows",
+			metric:  Metric{Name: "test", Query: "SELECT 1", MultiRow: true, SingleRow: true, MaxRows: 5},
+			wantErr: ErrSingleRowLimits,
+		},
+		{
+			name:    "scopes",
+			metric:  Metric{Name: "test", Query: "SELECT 1", Scopes: []string{"sales", "finance"}},
+			wantErr: nil,
+		},
+		{
+			name:    "blank scope",
+			metric:  Metric{Name: "test", Query: "SELECT 1", Scopes: []string{"sales", " "}},
+			wantErr: ErrInvalidScope,
+		},
+		{
+			name:    "json columns on multi-row metric",
+			metric:  Metric{Name: "test", Query: "SELECT payload FROM events", MultiRow: true, JSONColumns: []string{"payload"}},
+			wantErr: nil,
+		},
+		{
+			name:    "json columns on single-value metric",
+			metric:  Metric{Name: "test", Query: "SELECT payload FROM events LIMIT 1", JSONColumns: []string{"payload"}},
+			wantErr: ErrJSONColumns,
+		},
+		{
+			name:    "refresh interval",
+			metric:  Metric{Name: "test", Query: "SELECT COUNT(*) FROM orders WHERE region = ?", CacheTTL: 10 * time.Minute, RefreshInterval: 5 * time.Minute, Params: []ParamDefinition{{Name: "region", Type: ParamTypeString, Default: "eu"}}},
+			wantErr: nil,
+		},
+		{
+			name:    "negative refresh interval",
+			metric:  Metric{Name: "test", Query: "SELECT 1", RefreshInterval: -time.Minute},
+			wantErr: ErrRefreshNegative,
+		},
+		{
+			name:    "refresh interval not shorter than cache ttl",
+			metric:  Metric{Name: "test", Query: "SELECT 1", CacheTTL: 5 * time.Minute, RefreshInterval: 5 * time.Minute},
+			wantErr: ErrRefreshCacheTTL,
+		},
+		{
+			name:    "refresh interval with required param",
+			metric:  Metric{Name: "test", Query: "SELECT COUNT(*) FROM orders WHERE region = ?", CacheTTL: 10 * time.Minute, RefreshInterval: 5 * time.Minute, Params: []ParamDefinition{{Name: "region", Type: ParamTypeString, Required: true}}},
+			wantErr: ErrRefreshParams,
+		},
+		{
+			name:    "refresh interval on formula metric",
+			metric:  Metric{Name: "test", Formula: "a + b", RefreshInterval: time.Minute},
+			wantErr: ErrFormulaRefresh,
+		},
+		{
+			name:    "bool columns on multi-row metric",
+			metric:  Metric{Name: "test", Query: "SELECT id, is_active FROM users", MultiRow: true, BoolColumns: []string{"is_active"}},
+			wantErr: nil,
+		},
+		{
+			name:    "bool columns on single-value metric",
+			metric:  Metric{Name: "test", Query: "SELECT is_active FROM users LIMIT 1", BoolColumns: []string{"is_active"}},
+			wantErr: ErrBoolColumns,
+		},
+		{
+			name:    "omit nulls on single-value metric",
+			metric:  Metric{Name: "test", Query: "SELECT optional FROM test_data LIMIT 1", OmitNulls: true},
+			wantErr: ErrOmitNulls,
+		},
+		{
+			name:    "fallback query with the same params",
+			metric:  Metric{Name: "test", Query: "SELECT total FROM mv_revenue WHERE region = ?", FallbackQuery: "SELECT SUM(amount) FROM orders WHERE region = ?", Params: []ParamDefinition{{Name: "region", Type: ParamTypeString, Required: true}}},
+			wantErr: nil,
+		},
+		{
+			name:    "fallback query with different params",
+			metric:  Metric{Name: "test", Query: "SELECT total FROM mv_revenue WHERE region = ?", FallbackQuery: "SELECT SUM(amount) FROM orders", Params: []ParamDefinition{{Name: "region", Type: ParamTypeString, Required: true}}},
+			wantErr: ErrParamCount,
+		},
+		{
+			name:    "fallback query not a select",
+			metric:  Metric{Name: "test", Query: "SELECT total FROM mv_revenue", FallbackQuery: "DELETE FROM orders"},
+			wantErr: ErrQueryNotSelect,
+		},
+		{
+			name:    "fallback query on formula metric",
+			metric:  Metric{Name: "test", Formula: "a + b", FallbackQuery: "SELECT 1"},
+			wantErr: ErrFormulaFallback,
+		},
+		{
+			name:    "max rows on multi-row metric",
+			metric:  Metric{Name: "test", Query: "SELECT id FROM test_data", MultiRow: true, MaxRows: 2},
+			wantErr: nil,
+		},
+		{
+			name:    "negative max rows",
+			metric:  Metric{Name: "test", Query: "SELECT id FROM test_data", MultiRow: true, MaxRows: -1},
+			wantErr: ErrMaxRowsNegative,
+		},
+		{
+			name:    "max rows on single-value metric",
+			metric:  Metric{Name: "test", Query: "SELECT COUNT(*) FROM test_data", MaxRows: 2},
+			wantErr: ErrMaxRowsMultiRow,
+		},
+		{
+			name:    "max rows with gap fill",
+			metric:  Metric{Name: "test", Query: "SELECT day, n FROM daily WHERE day BETWEEN :from AND :to", MultiRow: true, MaxRows: 2, Params: []ParamDefinition{{Name: "from", Type: ParamTypeDate, Required: true}, {Name: "to", Type: ParamTypeDate, Required: true}}, FillGaps: &GapFill{Column: "day", Values: []string{"n"}, From: "from", To: "to"}},
+			wantErr: ErrMaxRowsGapFill,
+		},
+		{
+			name: "alias matches another param",
+			metric: Metric{Name: "test", Query: "SELECT COUNT(*) FROM orders WHERE created >= ? AND created < ?", Params: []ParamDefinition{
+				{Name: "from", Type: ParamTypeDate, Required: true},
+				{Name: "end_date", Type: ParamTypeDate, Required: true, Aliases: []string{"from"}},
+			}},
+			wantErr: ErrParamAliasTaken,
+		},
+		{
+			name: "alias shared by two params",
+			metric: Metric{Name: "test", Query: "SELECT COUNT(*) FROM orders WHERE created >= ? AND created < ?", Params: []ParamDefinition{
+				{Name: "start_date", Type: ParamTypeDate, Required: true, Aliases: []string{"date"}},
+				{Name: "end_date", Type: ParamTypeDate, Required: true, Aliases: []string{"date"}},
+			}},
+			wantErr: ErrParamAliasTaken,
+		},
+		{
+			name:    "alias repeats its own name",
+			metric:  Metric{Name: "test", Query: "SELECT COUNT(*) FROM orders WHERE region = ?", Params: []ParamDefinition{{Name: "region", Type: ParamTypeString, Required: true, Aliases: []string{"region"}}}},
+			wantErr: ErrParamAliasTaken,
+		},
+		{
+			name:    "bool value type",
+			metric:  Metric{Name: "test", Query: "SELECT is_active FROM users LIMIT 1", ValueType: ValueTypeBool},
+			wantErr: nil,
+		},
+		{
+			name:    "gap fill on formula metric",
+			metric:  Metric{Name: "test", Formula: "a + b", FillGaps: &GapFill{}},
+			wantErr: ErrGapFillMultiRow,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			err := tt.metric.Validate()
-			if err != tt.wantErr {
+			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("Metric.Validate() error = %v, want %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
+// gapFillMetric returns a valid gap-filled metric after applying modify.
+func gapFillMetric(modify func(m *Metric)) Metric {
+	m := Metric{
+		Name:     "daily_signups",
+		Query:    "SELECT date(created) AS day, COUNT(*) AS signups FROM users WHERE created BETWEEN ? AND ? GROUP BY day ORDER BY day",
+		MultiRow: true,
+		Params: []ParamDefinition{
+			{Name: "from", Type: ParamTypeDate, Required: true},
+			{Name: "to", Type: ParamTypeDate, Required: true},
+		},
+		FillGaps: &GapFill{Column: "day", Values: []string{"signups"}, From: "from", To: "to"},
+	}
+	modify(&m)
+	return m
+}
+
+func TestMetric_Dependencies(t *testing.T) {
+	tests := []struct {
+		name   string
+		metric Metric
+		want   []string
+	}{
+		{name: "query metric", metric: Metric{Name: "signups", Query: "SELECT COUNT(*) FROM users"}, want: nil},
+		{name: "formula metric", metric: Metric{Name: "conversion_rate", Formula: "signups / visitors"}, want: []string{"signups", "visitors"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.metric.Dependencies(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Dependencies() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestMetric_GetParamByName(t *testing.T) {
 	metric := Metric{
 		Name:  "test",
@@ -1,25 +1,251 @@
 // Defines parameter definitions for metric queries with validation.
 package models
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 var (
 	ErrParamNameEmpty    = errors.New("parameter name cannot be empty")
-	ErrInvalidParamType  = errors.New("parameter type must be string, int, or float")
+	ErrParamNameReserved = errors.New("parameter name is reserved by the API (names, partial, limit, offset, format, tags, tag_match, debug, pretty, envelope, omit_nulls, range)")
+	ErrParamAliasEmpty   = errors.New("parameter aliases cannot contain an empty name")
+	ErrParamAliasTaken   = errors.New("parameter alias is already the name or alias of a parameter of this metric")
+	ErrParamAliasClash   = errors.New("parameter given under more than one of its names with different values")
+	ErrInvalidParamType  = errors.New("parameter type must be string, int, float, date, or timestamp")
+	ErrDefaultOnRequired = errors.New("required parameter cannot have a default")
+	ErrInvalidDefault    = errors.New("parameter default does not match its type")
+	ErrAllowedValueEmpty = errors.New("parameter allowed_values cannot contain an empty value")
+	ErrInvalidAllowed    = errors.New("parameter allowed_values entry does not match its type")
+	ErrDefaultNotAllowed = errors.New("parameter default is not one of its allowed_values")
+	ErrRangeNotNumeric   = errors.New("parameter min and max apply only to int and float types")
+	ErrInvalidRange      = errors.New("parameter min cannot be greater than max")
+	ErrDefaultOutOfRange = errors.New("parameter default is outside its min/max range")
+	ErrInvalidWrap       = errors.New("parameter wrap must be contains, prefix, or suffix")
+	ErrWrapNotString     = errors.New("parameter wrap applies only to string types")
+)
+
+// RedactedValue stands in for a sensitive parameter's value in logs and errors.
+const RedactedValue = "***"
+
+// Wrap modes for LIKE patterns.
+const (
+	WrapContains = "contains"
+	WrapPrefix   = "prefix"
+	WrapSuffix   = "suffix"
 )
 
 type ParamDefinition struct {
-	Name     string    `toml:"name"`
-	Type     ParamType `toml:"type"`
-	Required bool      `toml:"required"`
+	Name     string    `toml:"name" json:"name"`
+	Type     ParamType `toml:"type" json:"type"`
+	Required bool      `toml:"required" json:"required"`
+	// Default is used when an optional parameter is absent from the request.
+	Default string `toml:"default" json:"default,omitempty"`
+	// AllowedValues, when set, restricts the parameter to a fixed set.
+	AllowedValues []string `toml:"allowed_values" json:"allowed_values,omitempty"`
+	// Min and Max bound numeric parameters; nil leaves that side unbounded.
+	Min *float64 `toml:"min" json:"min,omitempty"`
+	Max *float64 `toml:"max" json:"max,omitempty"`
+	// List accepts a comma-separated value whose elements each bind to their
+	// own placeholder, for use in "IN (?)" clauses.
+	List bool `toml:"list" json:"list,omitempty"`
+	// Wrap turns the value into a LIKE pattern: its wildcards are escaped
+	// with a backslash and "%" is added on the side(s) the mode names.
+	Wrap string `toml:"wrap" json:"wrap,omitempty"`
+	// Sensitive replaces the value with RedactedValue wherever it would be
+	// logged or echoed in an error message.
+	Sensitive bool `toml:"sensitive" json:"sensitive,omitempty"`
+	// Aliases are further request keys the parameter may be given under,
+	// so clients and queries can each keep their own names for it.
+	Aliases []string `toml:"aliases" json:"aliases,omitempty"`
 }
 
 func (pd ParamDefinition) Validate() error {
 	if pd.Name == "" {
 		return ErrParamNameEmpty
 	}
+	if IsReservedParam(pd.Name) {
+		return ErrParamNameReserved
+	}
+	for _, alias := range pd.Aliases {
+		if alias == "" {
+			return ErrParamAliasEmpty
+		}
+		if IsReservedParam(alias) {
+			return fmt.Errorf("%w: alias %q", ErrParamNameReserved, alias)
+		}
+	}
 	if !pd.Type.IsValid() {
 		return ErrInvalidParamType
 	}
+	if pd.Default != "" {
+		if pd.Required {
+			return ErrDefaultOnRequired
+		}
+		for _, element := range pd.Elements(pd.Default) {
+			if _, err := pd.Type.Convert(element); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidDefault, err)
+			}
+		}
+	}
+	for _, allowed := range pd.AllowedValues {
+		if allowed == "" {
+			return ErrAllowedValueEmpty
+		}
+		if _, err := pd.Type.Convert(allowed); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAllowed, err)
+		}
+	}
+	if pd.Min != nil || pd.Max != nil {
+		if pd.Type != ParamTypeInt && pd.Type != ParamTypeFloat {
+			return ErrRangeNotNumeric
+		}
+		if pd.Min != nil && pd.Max != nil && *pd.Min > *pd.Max {
+			return ErrInvalidRange
+		}
+	}
+	switch pd.Wrap {
+	case "":
+	case WrapContains, WrapPrefix, WrapSuffix:
+		if pd.Type != ParamTypeString {
+			return ErrWrapNotString
+		}
+	default:
+		return ErrInvalidWrap
+	}
+	if pd.Default != "" {
+		for _, element := range pd.Elements(pd.Default) {
+			v, _ := pd.Type.Convert(element)
+			if !pd.Allows(v) {
+				return ErrDefaultNotAllowed
+			}
+			if err := pd.CheckRange(v); err != nil {
+				return fmt.Errorf("%w: %v", ErrDefaultOutOfRange, err)
+			}
+		}
+	}
 	return nil
 }
+
+// Lookup returns the parameter's value from request params, given under its
+// name or any alias. Different values under more than one of them are an
+// error, since the client's intent is unclear; the same value is accepted.
+func (pd ParamDefinition) Lookup(params map[string]string) (string, bool, error) {
+	var value, foundKey string
+	found := false
+	for _, key := range append([]string{pd.Name}, pd.Aliases...) {
+		v, ok := params[key]
+		if !ok {
+			continue
+		}
+		if found && v != value {
+			return "", false, fmt.Errorf("%w: %q and %q", ErrParamAliasClash, foundKey, key)
+		}
+		value, foundKey, found = v, key, true
+	}
+	return value, found, nil
+}
+
+// Elements splits a raw value into the strings to convert. A list value is
+// split on commas with blank elements dropped, so it may yield none; any
+// other value is a single element.
+func (pd ParamDefinition) Elements(value string) []string {
+	if !pd.List {
+		return []string{value}
+	}
+
+	var elements []string
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// likeEscaper escapes the backslash first so that escapes added for % and _
+// cannot themselves be reinterpreted.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// WrapValue applies Wrap to a string value, so user input matches literally
+// within the pattern. Values are returned unchanged when Wrap is unset.
+func (pd ParamDefinition) WrapValue(value string) string {
+	switch pd.Wrap {
+	case WrapContains:
+		return "%" + likeEscaper.Replace(value) + "%"
+	case WrapPrefix:
+		return likeEscaper.Replace(value) + "%"
+	case WrapSuffix:
+		return "%" + likeEscaper.Replace(value)
+	}
+	return value
+}
+
+// Redact returns value, or RedactedValue for a sensitive parameter.
+func (pd ParamDefinition) Redact(value string) string {
+	if pd.Sensitive {
+		return RedactedValue
+	}
+	return value
+}
+
+// CheckValue returns an error if a raw value, such as one from the config
+// rather than a request, would be rejected for the parameter: each element
+// must convert to its type and satisfy AllowedValues and Min and Max.
+func (pd ParamDefinition) CheckValue(value string) error {
+	for _, element := range pd.Elements(value) {
+		v, err := pd.Type.Convert(element)
+		if err != nil {
+			return err
+		}
+		if !pd.Allows(v) {
+			return fmt.Errorf("invalid value %q: must be one of %s", pd.Redact(element), strings.Join(pd.AllowedValues, ", "))
+		}
+		if err := pd.CheckRange(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckRange returns an error if a converted numeric value falls outside
+// Min or Max. Non-numeric values always pass.
+func (pd ParamDefinition) CheckRange(value interface{}) error {
+	var f float64
+	switch v := value.(type) {
+	case int64:
+		f = float64(v)
+	case float64:
+		f = v
+	default:
+		return nil
+	}
+
+	if pd.Min != nil && f < *pd.Min {
+		return fmt.Errorf("invalid value %s: must be at least %s", pd.Redact(fmt.Sprint(value)), formatBound(*pd.Min))
+	}
+	if pd.Max != nil && f > *pd.Max {
+		return fmt.Errorf("invalid value %s: must be at most %s", pd.Redact(fmt.Sprint(value)), formatBound(*pd.Max))
+	}
+	return nil
+}
+
+func formatBound(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Allows reports whether a converted value satisfies AllowedValues.
+// Values are compared after conversion, so "07" matches an allowed int "7".
+func (pd ParamDefinition) Allows(value interface{}) bool {
+	if len(pd.AllowedValues) == 0 {
+		return true
+	}
+	for _, allowed := range pd.AllowedValues {
+		if v, err := pd.Type.Convert(allowed); err == nil && v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -22,7 +25,7 @@ func TestParamDefinition_Validate(t *testing.T) {
 		{
 			name: "valid optional int param",
 			param: ParamDefinition{
-				Name:     "limit",
+				Name:     "page_size",
 				Type:     ParamTypeInt,
 				Required: false,
 			},
@@ -37,6 +40,15 @@ func TestParamDefinition_Validate(t *testing.T) {
 			},
 			wantErr: ErrParamNameEmpty,
 		},
+		{
+			name: "reserved name",
+			param: ParamDefinition{
+				Name:     "limit",
+				Type:     ParamTypeInt,
+				Required: true,
+			},
+			wantErr: ErrParamNameReserved,
+		},
 		{
 			name: "invalid type",
 			param: ParamDefinition{
@@ -46,14 +58,356 @@ func TestParamDefinition_Validate(t *testing.T) {
 			},
 			wantErr: ErrInvalidParamType,
 		},
+		{
+			name: "valid default",
+			param: ParamDefinition{
+				Name:    "page_size",
+				Type:    ParamTypeInt,
+				Default: "100",
+			},
+			wantErr: nil,
+		},
+		{
+			name: "default not matching type",
+			param: ParamDefinition{
+				Name:    "page_size",
+				Type:    ParamTypeInt,
+				Default: "lots",
+			},
+			wantErr: ErrInvalidDefault,
+		},
+		{
+			name: "default on required param",
+			param: ParamDefinition{
+				Name:     "since",
+				Type:     ParamTypeDate,
+				Required: true,
+				Default:  "2025-01-01",
+			},
+			wantErr: ErrDefaultOnRequired,
+		},
+		{
+			name: "valid allowed values with default",
+			param: ParamDefinition{
+				Name:          "period",
+				Type:          ParamTypeString,
+				Default:       "week",
+				AllowedValues: []string{"day", "week", "month"},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "empty allowed value",
+			param: ParamDefinition{
+				Name:          "period",
+				Type:          ParamTypeString,
+				Required:      true,
+				AllowedValues: []string{"day", ""},
+			},
+			wantErr: ErrAllowedValueEmpty,
+		},
+		{
+			name: "allowed value not matching type",
+			param: ParamDefinition{
+				Name:          "days",
+				Type:          ParamTypeInt,
+				Required:      true,
+				AllowedValues: []string{"7", "thirty"},
+			},
+			wantErr: ErrInvalidAllowed,
+		},
+		{
+			name: "default outside allowed values",
+			param: ParamDefinition{
+				Name:          "period",
+				Type:          ParamTypeString,
+				Default:       "year",
+				AllowedValues: []string{"day", "week", "month"},
+			},
+			wantErr: ErrDefaultNotAllowed,
+		},
+		{
+			name: "valid range",
+			param: ParamDefinition{
+				Name:    "max_rows",
+				Type:    ParamTypeInt,
+				Default: "100",
+				Min:     ptr(1.0),
+				Max:     ptr(1000.0),
+			},
+			wantErr: nil,
+		},
+		{
+			name: "min greater than max",
+			param: ParamDefinition{
+				Name:     "max_rows",
+				Type:     ParamTypeInt,
+				Required: true,
+				Min:      ptr(10.0),
+				Max:      ptr(1.0),
+			},
+			wantErr: ErrInvalidRange,
+		},
+		{
+			name: "range on string param",
+			param: ParamDefinition{
+				Name:     "name",
+				Type:     ParamTypeString,
+				Required: true,
+				Max:      ptr(10.0),
+			},
+			wantErr: ErrRangeNotNumeric,
+		},
+		{
+			name: "default outside range",
+			param: ParamDefinition{
+				Name:    "max_rows",
+				Type:    ParamTypeInt,
+				Default: "5000",
+				Max:     ptr(1000.0),
+			},
+			wantErr: ErrDefaultOutOfRange,
+		},
+		{
+			name: "valid list default",
+			param: ParamDefinition{
+				Name:          "status",
+				Type:          ParamTypeString,
+				List:          true,
+				Default:       "pending, shipped",
+				AllowedValues: []string{"pending", "shipped", "delivered"},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "list default element of wrong type",
+			param: ParamDefinition{
+				Name:    "ids",
+				Type:    ParamTypeInt,
+				List:    true,
+				Default: "1,two",
+			},
+			wantErr: ErrInvalidDefault,
+		},
+		{
+			name: "list default element not allowed",
+			param: ParamDefinition{
+				Name:          "status",
+				Type:          ParamTypeString,
+				List:          true,
+				Default:       "pending,lost",
+				AllowedValues: []string{"pending", "shipped"},
+			},
+			wantErr: ErrDefaultNotAllowed,
+		},
+		{
+			name:    "valid wrap",
+			param:   ParamDefinition{Name: "q", Type: ParamTypeString, Required: true, Wrap: WrapContains},
+			wantErr: nil,
+		},
+		{
+			name:    "unknown wrap",
+			param:   ParamDefinition{Name: "q", Type: ParamTypeString, Required: true, Wrap: "infix"},
+			wantErr: ErrInvalidWrap,
+		},
+		{
+			name:    "wrap on int param",
+			param:   ParamDefinition{Name: "id", Type: ParamTypeInt, Required: true, Wrap: WrapPrefix},
+			wantErr: ErrWrapNotString,
+		},
+		{
+			name:    "aliases",
+			param:   ParamDefinition{Name: "start_date", Type: ParamTypeDate, Required: true, Aliases: []string{"from", "since"}},
+			wantErr: nil,
+		},
+		{
+			name:    "empty alias",
+			param:   ParamDefinition{Name: "start_date", Type: ParamTypeDate, Required: true, Aliases: []string{""}},
+			wantErr: ErrParamAliasEmpty,
+		},
+		{
+			name:    "reserved alias",
+			param:   ParamDefinition{Name: "start_date", Type: ParamTypeDate, Required: true, Aliases: []string{"offset"}},
+			wantErr: ErrParamNameReserved,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			err := tt.param.Validate()
-			if err != tt.wantErr {
+			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("ParamDefinition.Validate() error = %v, want %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestParamDefinition_Allows(t *testing.T) {
+	tests := []struct {
+		name  string
+		param ParamDefinition
+		value interface{}
+		want  bool
+	}{
+		{name: "no restriction", param: ParamDefinition{Type: ParamTypeString}, value: "anything", want: true},
+		{name: "listed string", param: ParamDefinition{Type: ParamTypeString, AllowedValues: []string{"day", "week"}}, value: "week", want: true},
+		{name: "unlisted string", param: ParamDefinition{Type: ParamTypeString, AllowedValues: []string{"day", "week"}}, value: "year", want: false},
+		{name: "int compared after conversion", param: ParamDefinition{Type: ParamTypeInt, AllowedValues: []string{"7", "30"}}, value: int64(7), want: true},
+		{name: "unlisted int", param: ParamDefinition{Type: ParamTypeInt, AllowedValues: []string{"7", "30"}}, value: int64(14), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.param.Allows(tt.value); got != tt.want {
+				t.Errorf("Allows(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParamDefinition_CheckRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		param   ParamDefinition
+		value   interface{}
+		wantErr bool
+	}{
+		{name: "unbounded", param: ParamDefinition{Type: ParamTypeInt}, value: int64(10000000)},
+		{name: "within range", param: ParamDefinition{Type: ParamTypeInt, Min: ptr(1.0), Max: ptr(1000.0)}, value: int64(1000)},
+		{name: "below min", param: ParamDefinition{Type: ParamTypeInt, Min: ptr(1.0)}, value: int64(0), wantErr: true},
+		{name: "above max", param: ParamDefinition{Type: ParamTypeInt, Max: ptr(1000.0)}, value: int64(10000000), wantErr: true},
+		{name: "float above max", param: ParamDefinition{Type: ParamTypeFloat, Max: ptr(0.5)}, value: 0.75, wantErr: true},
+		{name: "non-numeric ignored", param: ParamDefinition{Type: ParamTypeString, Max: ptr(1.0)}, value: "zzz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.param.CheckRange(tt.value); (err != nil) != tt.wantErr {
+				t.Errorf("CheckRange(%v) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParamDefinition_CheckValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		param   ParamDefinition
+		value   string
+		wantErr bool
+	}{
+		{name: "valid", param: ParamDefinition{Type: ParamTypeInt, Min: ptr(1.0)}, value: "7"},
+		{name: "wrong type", param: ParamDefinition{Type: ParamTypeInt}, value: "acme", wantErr: true},
+		{name: "out of range", param: ParamDefinition{Type: ParamTypeInt, Min: ptr(1.0)}, value: "0", wantErr: true},
+		{name: "not allowed", param: ParamDefinition{Type: ParamTypeString, AllowedValues: []string{"paid"}}, value: "void", wantErr: true},
+		{name: "list element", param: ParamDefinition{Type: ParamTypeInt, List: true}, value: "1,x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.param.CheckValue(tt.value); (err != nil) != tt.wantErr {
+				t.Errorf("CheckValue(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParamDefinition_Redact(t *testing.T) {
+	plain := ParamDefinition{Name: "id", Type: ParamTypeInt, Max: ptr(10.0)}
+	if got := plain.Redact("42"); got != "42" {
+		t.Errorf("Redact() = %q, want value unchanged", got)
+	}
+
+	sensitive := plain
+	sensitive.Sensitive = true
+	if got := sensitive.Redact("42"); got != RedactedValue {
+		t.Errorf("Redact() = %q, want %q", got, RedactedValue)
+	}
+	if err := sensitive.CheckRange(int64(4242)); err == nil || strings.Contains(err.Error(), "4242") {
+		t.Errorf("CheckRange() error = %v, want an error without the value", err)
+	}
+}
+
+func TestParamDefinition_Lookup(t *testing.T) {
+	param := ParamDefinition{Name: "start_date", Aliases: []string{"from", "since"}}
+
+	tests := []struct {
+		name      string
+		params    map[string]string
+		wantValue string
+		wantOK    bool
+		wantErr   error
+	}{
+		{name: "absent", params: map[string]string{"to": "2025-02-01"}},
+		{name: "name", params: map[string]string{"start_date": "2025-01-01"}, wantValue: "2025-01-01", wantOK: true},
+		{name: "alias", params: map[string]string{"since": "2025-01-01"}, wantValue: "2025-01-01", wantOK: true},
+		{name: "name and alias agree", params: map[string]string{"start_date": "2025-01-01", "from": "2025-01-01"}, wantValue: "2025-01-01", wantOK: true},
+		{name: "name and alias differ", params: map[string]string{"start_date": "2025-01-01", "from": "2024-01-01"}, wantErr: ErrParamAliasClash},
+		{name: "aliases differ", params: map[string]string{"from": "2025-01-01", "since": ""}, wantErr: ErrParamAliasClash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, ok, err := param.Lookup(tt.params)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Lookup() error = %v, want %v", err, tt.wantErr)
+			}
+			if value != tt.wantValue || ok != tt.wantOK {
+				t.Errorf("Lookup() = %q, %v, want %q, %v", value, ok, tt.wantValue, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParamDefinition_Elements(t *testing.T) {
+	tests := []struct {
+		name  string
+		param ParamDefinition
+		value string
+		want  []string
+	}{
+		{name: "scalar keeps commas", param: ParamDefinition{}, value: "a,b", want: []string{"a,b"}},
+		{name: "scalar empty", param: ParamDefinition{}, value: "", want: []string{""}},
+		{name: "list split and trimmed", param: ParamDefinition{List: true}, value: "pending, shipped", want: []string{"pending", "shipped"}},
+		{name: "list drops blanks", param: ParamDefinition{List: true}, value: "a,,b,", want: []string{"a", "b"}},
+		{name: "empty list", param: ParamDefinition{List: true}, value: "", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.param.Elements(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Elements(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParamDefinition_WrapValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		wrap  string
+		value string
+		want  string
+	}{
+		{name: "unset", wrap: "", value: "50%_off", want: "50%_off"},
+		{name: "contains", wrap: WrapContains, value: "ann", want: "%ann%"},
+		{name: "prefix", wrap: WrapPrefix, value: "ann", want: "ann%"},
+		{name: "suffix", wrap: WrapSuffix, value: "ann", want: "%ann"},
+		{name: "wildcards escaped", wrap: WrapContains, value: "50%_off", want: `%50\%\_off%`},
+		{name: "backslash escaped", wrap: WrapPrefix, value: `a\%`, want: `a\\\%%`},
+		{name: "empty contains", wrap: WrapContains, value: "", want: "%%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pd := ParamDefinition{Type: ParamTypeString, Wrap: tt.wrap}
+			if got := pd.WrapValue(tt.value); got != tt.want {
+				t.Errorf("WrapValue(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func ptr(f float64) *float64 {
+	return &f
+}
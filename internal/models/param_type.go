@@ -1,18 +1,96 @@
 // Defines parameter types supported in metric queries.
 package models
 
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
 type ParamType string
 
 const (
-	ParamTypeString ParamType = "string"
-	ParamTypeInt    ParamType = "int"
-	ParamTypeFloat  ParamType = "float"
+	ParamTypeString    ParamType = "string"
+	ParamTypeInt       ParamType = "int"
+	ParamTypeFloat     ParamType = "float"
+	ParamTypeDate      ParamType = "date"
+	ParamTypeTimestamp ParamType = "timestamp"
 )
 
+// maxTimestamp is the last second of year 9999, beyond which timestamps
+// no longer fit the four-digit year of the formatted value.
+const maxTimestamp = 253402300799
+
 func (pt ParamType) IsValid() bool {
 	switch pt {
-	case ParamTypeString, ParamTypeInt, ParamTypeFloat:
+	case ParamTypeString, ParamTypeInt, ParamTypeFloat, ParamTypeDate, ParamTypeTimestamp:
 		return true
 	}
 	return false
 }
+
+// Convert converts a string parameter value to this type.
+// Returns interface{} containing int64, float64, or string depending on the type.
+// Dates and timestamps are returned as normalized strings (see convertDate
+// and convertTimestamp).
+// Returns an error if the conversion fails.
+func (pt ParamType) Convert(value string) (interface{}, error) {
+	switch pt {
+	case ParamTypeString:
+		return value, nil
+
+	case ParamTypeInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer value %q: %w", value, err)
+		}
+		return n, nil
+
+	case ParamTypeFloat:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float value %q: %w", value, err)
+		}
+		return f, nil
+
+	case ParamTypeDate:
+		return convertDate(value)
+
+	case ParamTypeTimestamp:
+		return convertTimestamp(value)
+
+	default:
+		return nil, fmt.Errorf("unsupported parameter type: %s", pt)
+	}
+}
+
+// convertDate parses a date given as YYYY-MM-DD or RFC3339 and returns it
+// in the text form SQLite compares correctly: "2006-01-02" for plain dates
+// and "2006-01-02 15:04:05" (UTC) for timestamps, matching datetime().
+func convertDate(value string) (interface{}, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t.Format(time.DateOnly), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date value %q: expected YYYY-MM-DD or RFC3339", value)
+	}
+
+	return t.UTC().Format(time.DateTime), nil
+}
+
+// convertTimestamp parses Unix epoch seconds and returns the same UTC text
+// form as an RFC3339 date, so timestamp and date params compare alike.
+// Negative values are rejected as almost always a client bug.
+func convertTimestamp(value string) (interface{}, error) {
+	secs, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp value %q: expected Unix seconds", value)
+	}
+	if secs < 0 || secs > maxTimestamp {
+		return nil, fmt.Errorf("invalid timestamp value %q: must be between 0 and %d", value, maxTimestamp)
+	}
+
+	return time.Unix(secs, 0).UTC().Format(time.DateTime), nil
+}
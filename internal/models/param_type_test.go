@@ -4,13 +4,14 @@ import "testing"
 
 func TestParamType_IsValid(t *testing.T) {
 	tests := []struct {
-		name     string
+		name      string
 		paramType ParamType
-		want     bool
+		want      bool
 	}{
 		{"string is valid", ParamTypeString, true},
 		{"int is valid", ParamTypeInt, true},
 		{"float is valid", ParamTypeFloat, true},
+		{"date is valid", ParamTypeDate, true},
 		{"invalid type", ParamType("boolean"), false},
 		{"empty type", ParamType(""), false},
 	}
@@ -0,0 +1,81 @@
+// Defines per-request options that change how metrics are executed.
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// DefaultPageLimit applies when a request sets offset without limit.
+	DefaultPageLimit = 100
+	// MaxPageLimit caps the page size a client can request.
+	MaxPageLimit = 10000
+)
+
+var (
+	ErrInvalidLimit  = fmt.Errorf("invalid limit: must be between 1 and %d", MaxPageLimit)
+	ErrInvalidOffset = errors.New("invalid offset: must not be negative")
+)
+
+// reservedParams are query parameter names interpreted by the API itself,
+// so they are never passed to metric queries.
+var reservedParams = map[string]bool{
+	"names":      true,
+	"partial":    true,
+	"limit":      true,
+	"offset":     true,
+	"format":     true,
+	"tags":       true,
+	"tag_match":  true,
+	"debug":      true,
+	"pretty":     true,
+	"envelope":   true,
+	"omit_nulls": true,
+	"range":      true,
+}
+
+// IsReservedParam reports whether name is a query parameter reserved by the API.
+func IsReservedParam(name string) bool {
+	return reservedParams[name]
+}
+
+// QueryOptions carries request-level flags from the HTTP layer to the service.
+// The zero value gives the default behaviour.
+type QueryOptions struct {
+	// Partial records per-metric failures in each MetricResult instead of
+	// failing the whole batch when any metric errors.
+	Partial bool
+
+	// Limit and Offset page through multi-row results. Pagination is
+	// applied when Limit is non-zero; single-value metrics ignore both.
+	Limit  int
+	Offset int
+
+	// Debug reports each metric's query duration in its MetricResult.
+	Debug bool
+
+	// OmitNulls drops NULL columns from multi-row results, as a metric's
+	// omit_nulls setting does.
+	OmitNulls bool
+
+	// Range is a shorthand such as "7d" or "this_month" that the service
+	// expands into the date params named by each metric's range setting.
+	Range string
+}
+
+// Paginated reports whether the options request a page of results.
+func (o QueryOptions) Paginated() bool {
+	return o.Limit != 0
+}
+
+// Validate checks that the pagination values are within range.
+func (o QueryOptions) Validate() error {
+	if o.Limit < 0 || o.Limit > MaxPageLimit {
+		return ErrInvalidLimit
+	}
+	if o.Offset < 0 {
+		return ErrInvalidOffset
+	}
+	return nil
+}
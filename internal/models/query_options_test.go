@@ -0,0 +1,37 @@
+package models
+
+import "testing"
+
+func TestQueryOptions_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    QueryOptions
+		wantErr error
+	}{
+		{"zero value", QueryOptions{}, nil},
+		{"valid page", QueryOptions{Limit: 50, Offset: 100}, nil},
+		{"max limit", QueryOptions{Limit: MaxPageLimit}, nil},
+		{"negative limit", QueryOptions{Limit: -1}, ErrInvalidLimit},
+		{"limit too large", QueryOptions{Limit: MaxPageLimit + 1}, ErrInvalidLimit},
+		{"negative offset", QueryOptions{Limit: 10, Offset: -5}, ErrInvalidOffset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.opts.Validate(); err != tt.wantErr {
+				t.Errorf("QueryOptions.Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsReservedParam(t *testing.T) {
+	for _, name := range []string{"names", "partial", "limit", "offset", "format", "tags", "tag_match", "debug", "pretty", "envelope"} {
+		if !IsReservedParam(name) {
+			t.Errorf("IsReservedParam(%q) = false, want true", name)
+		}
+	}
+	if IsReservedParam("user_id") {
+		t.Error("IsReservedParam(\"user_id\") = true, want false")
+	}
+}
@@ -0,0 +1,600 @@
+// Builds an OpenAPI 3 document describing the API and its configured metrics.
+package openapi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+// Version is the OpenAPI specification version the document follows.
+const Version = "3.0.3"
+
+// object is a JSON object in the generated document. Maps marshal with
+// sorted keys, so the same metrics always produce byte-identical output.
+type object = map[string]interface{}
+
+// Build returns the OpenAPI document for the given metric catalog. Each
+// metric gets its own GET /metrics/<name> path listing its declared params,
+// so generated clients have a typed call per metric.
+func Build(metrics []models.MetricInfo, apiVersion string) object {
+	names := make([]interface{}, len(metrics))
+	for i, m := range metrics {
+		names[i] = m.Name
+	}
+
+	paths := object{
+		"/metrics": object{
+			"get":  listOrBatchOperation(names),
+			"post": queryOperation(),
+		},
+		"/metrics/{name}/schema": object{
+			"get": schemaOperation(names),
+		},
+		"/version": object{
+			"get": object{
+				"operationId": "getVersion",
+				"summary":     "Build information of the running server",
+				"responses": object{
+					"200": jsonResponse("Build information", ref("VersionInfo")),
+				},
+			},
+		},
+		"/metrics-export": object{
+			"get": object{
+				"operationId": "exportPrometheus",
+				"summary":     "Values of single-value metrics without params, in the Prometheus text format",
+				"parameters": []interface{}{
+					object{
+						"name":        "tags",
+						"in":          "query",
+						"description": "Comma-separated tags to filter by",
+						"schema":      object{"type": "array", "items": object{"type": "string"}},
+						"style":       "form",
+						"explode":     false,
+					},
+					queryParam("tag_match", "Whether a metric needs any or all of the tags", object{"type": "string", "enum": []interface{}{"any", "all"}, "default": "any"}),
+				},
+				"responses": object{
+					"200": object{
+						"description": "One gauge per metric; failing and non-numeric metrics are left out",
+						"content":     object{"text/plain": object{"schema": object{"type": "string"}}},
+					},
+					"400": errorResponse("Invalid tag filter"),
+				},
+			},
+		},
+		"/healthz": object{
+			"get": object{
+				"operationId": "getHealth",
+				"summary":     "Whether the server's databases are passing health checks; needs no API key",
+				"responses": object{
+					"200": jsonResponse("Every database is healthy", ref("HealthStatus")),
+					"503": jsonResponse("Some databases failed repeated health checks", ref("HealthStatus")),
+				},
+			},
+		},
+	}
+	for _, m := range metrics {
+		paths["/metrics/"+m.Name] = object{"get": metricOperation(m)}
+		paths["/metrics/"+m.Name+".csv"] = object{"get": csvOperation(m)}
+	}
+
+	return object{
+		"openapi": Version,
+		"info": object{
+			"title":       "Personal Dashboard Metrics API",
+			"description": "Serves metrics defined by SQL queries in configuration. Request values are always sent as strings and converted using each parameter's declared type.",
+			"version":     apiVersion,
+		},
+		"paths":      paths,
+		"components": object{"schemas": componentSchemas()},
+	}
+}
+
+// metricOperation describes GET /metrics/<name> for one configured metric.
+func metricOperation(m models.MetricInfo) object {
+	params := make([]interface{}, 0, len(m.Params)+4)
+	for _, p := range m.Params {
+		params = append(params, paramObject(p))
+	}
+	switch {
+	case m.SingleRow:
+		params = append(params, omitNullsParam())
+	case m.MultiRow:
+		params = append(params, pageParams()...)
+		params = append(params, omitNullsParam())
+	}
+	if m.Range != nil {
+		params = append(params, rangeParam())
+	}
+	params = append(params, formatParam(), debugParam(), prettyParam(), envelopeParam())
+
+	description := m.Description
+	if description == "" {
+		description = fmt.Sprintf("Returns the %s metric.", m.Name)
+	}
+
+	shapes := []interface{}{
+		object{
+			"type":     "array",
+			"minItems": 1,
+			"maxItems": 1,
+			"items":    metricResultSchema(m),
+		},
+		ref("ResultEnvelope"),
+	}
+	paged := m.MultiRow && !m.SingleRow
+	if paged {
+		shapes = append(shapes, ref("PageEnvelope"))
+	}
+	content := object{
+		"application/json": object{"schema": object{"oneOf": shapes}},
+		"text/csv":         object{"schema": object{"type": "string"}},
+	}
+	if paged {
+		content["application/x-ndjson"] = object{"schema": object{"type": "string"}}
+	}
+
+	op := object{
+		"operationId": "getMetric_" + m.Name,
+		"summary":     description,
+		"parameters":  params,
+		"responses": object{
+			"200": object{
+				"description": "A one-element array holding the metric result, or a PageEnvelope when limit or offset is given",
+				"content":     content,
+			},
+			"400": errorResponse("Invalid or missing parameter"),
+			"413": errorResponse("Result exceeds the server's row limit"),
+		},
+	}
+	if m.Category != "" {
+		op["tags"] = []interface{}{m.Category}
+	}
+	return op
+}
+
+// csvOperation describes GET /metrics/<name>.csv, which takes the metric's
+// params but always answers with a CSV download.
+func csvOperation(m models.MetricInfo) object {
+	params := make([]interface{}, 0, len(m.Params)+2)
+	for _, p := range m.Params {
+		params = append(params, paramObject(p))
+	}
+	if m.MultiRow && !m.SingleRow {
+		params = append(params, pageParams()...)
+	}
+
+	op := object{
+		"operationId": "getMetricCSV_" + m.Name,
+		"summary":     fmt.Sprintf("Downloads the %s metric as CSV.", m.Name),
+		"parameters":  params,
+		"responses": object{
+			"200": object{
+				"description": "The metric result as a CSV file",
+				"content":     object{"text/csv": object{"schema": object{"type": "string"}}},
+			},
+			"400": errorResponse("Invalid or missing parameter"),
+			"413": errorResponse("Result exceeds the server's row limit"),
+		},
+	}
+	if m.Category != "" {
+		op["tags"] = []interface{}{m.Category}
+	}
+	return op
+}
+
+// pageParams describes limit and offset, which page multi-row metrics.
+func pageParams() []interface{} {
+	return []interface{}{
+		queryParam("limit", "Page size for multi-row results", object{"type": "integer", "minimum": 1, "maximum": models.MaxPageLimit}),
+		queryParam("offset", "Rows to skip; uses a page size of 100 without limit", object{"type": "integer", "minimum": 0}),
+	}
+}
+
+// metricResultSchema narrows MetricResult's value to the metric's shape.
+func metricResultSchema(m models.MetricInfo) object {
+	var value object
+	switch {
+	case m.SingleRow:
+		value = object{"type": "object", "additionalProperties": true, "nullable": true, "description": "The first row, or null when there are none"}
+	case m.MultiRow:
+		value = object{"type": "array", "items": object{"type": "object", "additionalProperties": true}}
+	case m.ValueType == models.ValueTypeInt:
+		value = object{"type": "integer", "format": "int64", "nullable": true}
+	case m.ValueType == models.ValueTypeFloat:
+		value = object{"type": "number", "format": "double", "nullable": true}
+	case m.ValueType == models.ValueTypeBool:
+		value = object{"type": "boolean", "nullable": true}
+	default:
+		value = object{"nullable": true, "description": "A single value of whatever type the query returns"}
+	}
+	if m.Unit != "" {
+		value["description"] = "Measured in " + m.Unit
+	}
+
+	return object{
+		"allOf": []interface{}{
+			ref("MetricResult"),
+			object{"properties": object{"value": value}},
+		},
+	}
+}
+
+// paramObject converts a declared metric param to an OpenAPI query parameter.
+func paramObject(p models.ParamDefinition) object {
+	schema := typeSchema(p.Type)
+	if len(p.AllowedValues) > 0 {
+		enum := make([]interface{}, len(p.AllowedValues))
+		for i, v := range p.AllowedValues {
+			enum[i] = exampleValue(p.Type, v)
+		}
+		schema["enum"] = enum
+	}
+	if p.Min != nil {
+		schema["minimum"] = *p.Min
+	}
+	if p.Max != nil {
+		schema["maximum"] = *p.Max
+	}
+
+	param := object{
+		"name":     p.Name,
+		"in":       "query",
+		"required": p.Required,
+	}
+	var aliases string
+	if len(p.Aliases) > 0 {
+		aliases = "Also accepted as " + strings.Join(p.Aliases, ", ") + "."
+		param["description"] = aliases
+	}
+
+	if p.List {
+		list := object{"type": "array", "items": schema}
+		if p.Default != "" {
+			defaults := []interface{}{}
+			for _, element := range p.Elements(p.Default) {
+				defaults = append(defaults, exampleValue(p.Type, element))
+			}
+			list["default"] = defaults
+		}
+		param["schema"] = list
+		param["style"] = "form"
+		param["explode"] = false
+		param["description"] = "Comma-separated list of values"
+		if aliases != "" {
+			param["description"] = "Comma-separated list of values. " + aliases
+		}
+		return param
+	}
+
+	if p.Default != "" {
+		schema["default"] = exampleValue(p.Type, p.Default)
+	}
+	param["schema"] = schema
+	return param
+}
+
+// typeSchema maps a param type to its OpenAPI schema.
+func typeSchema(t models.ParamType) object {
+	switch t {
+	case models.ParamTypeInt:
+		return object{"type": "integer", "format": "int64"}
+	case models.ParamTypeFloat:
+		return object{"type": "number", "format": "double"}
+	case models.ParamTypeDate:
+		return object{"type": "string", "description": "YYYY-MM-DD or an RFC3339 timestamp"}
+	case models.ParamTypeTimestamp:
+		return object{"type": "integer", "format": "int64", "minimum": 0, "description": "Unix time in seconds"}
+	default:
+		return object{"type": "string"}
+	}
+}
+
+// exampleValue renders a configured value with its JSON type, so an int
+// enum lists numbers rather than strings. Dates keep their written form,
+// and timestamps are shown as the epoch seconds a client sends.
+func exampleValue(t models.ParamType, raw string) interface{} {
+	switch t {
+	case models.ParamTypeDate:
+		return raw
+	case models.ParamTypeTimestamp:
+		t = models.ParamTypeInt
+	}
+	if v, err := t.Convert(raw); err == nil {
+		return v
+	}
+	return raw
+}
+
+// listOrBatchOperation describes GET /metrics, which lists the catalog
+// without names and runs a batch with them.
+func listOrBatchOperation(names []interface{}) object {
+	return object{
+		"operationId": "getMetrics",
+		"summary":     "List the metric catalog, or fetch several metrics with names",
+		"description": "Without names, returns the catalog (optionally filtered by tags). With names, returns one result per name in request order; query parameters other than the reserved ones are passed to every metric.",
+		"parameters": []interface{}{
+			object{
+				"name":        "names",
+				"in":          "query",
+				"description": "Comma-separated metric names to fetch",
+				"schema":      object{"type": "array", "items": object{"type": "string", "enum": names}},
+				"style":       "form",
+				"explode":     false,
+			},
+			object{
+				"name":        "tags",
+				"in":          "query",
+				"description": "Catalog only: comma-separated tags to filter by",
+				"schema":      object{"type": "array", "items": object{"type": "string"}},
+				"style":       "form",
+				"explode":     false,
+			},
+			queryParam("tag_match", "Catalog only: whether a metric needs any or all of the tags", object{"type": "string", "enum": []interface{}{"any", "all"}, "default": "any"}),
+			queryParam("partial", "Return per-metric errors instead of failing the whole batch", object{"type": "boolean", "default": false}),
+			queryParam("limit", "Page size for multi-row results", object{"type": "integer", "minimum": 1, "maximum": models.MaxPageLimit}),
+			queryParam("offset", "Rows to skip; uses a page size of 100 without limit", object{"type": "integer", "minimum": 0}),
+			omitNullsParam(),
+			rangeParam(),
+			formatParam(),
+			debugParam(),
+			prettyParam(),
+			envelopeParam(),
+		},
+		"responses": object{
+			"200": jsonResponse("The catalog, or one result per requested metric", object{
+				"oneOf": []interface{}{
+					object{"type": "array", "items": ref("MetricInfo")},
+					object{"type": "array", "items": ref("MetricResult")},
+					ref("ResultEnvelope"),
+				},
+			}),
+			"400": errorResponse("Invalid request or parameter"),
+			"404": errorResponse("A requested metric does not exist"),
+		},
+	}
+}
+
+// queryOperation describes POST /metrics.
+func queryOperation() object {
+	return object{
+		"operationId": "queryMetrics",
+		"summary":     "Fetch several metrics, with names and params in a JSON body",
+		"requestBody": object{
+			"required": true,
+			"content":  object{"application/json": object{"schema": ref("QueryRequest")}},
+		},
+		"responses": object{
+			"200": jsonResponse("One result per requested metric", object{
+				"oneOf": []interface{}{
+					object{"type": "array", "items": ref("MetricResult")},
+					ref("ResultEnvelope"),
+				},
+			}),
+			"400": errorResponse("Invalid body or parameter"),
+			"404": errorResponse("A requested metric does not exist"),
+			"413": errorResponse("Body or result too large"),
+		},
+	}
+}
+
+// schemaOperation describes GET /metrics/{name}/schema.
+func schemaOperation(names []interface{}) object {
+	return object{
+		"operationId": "getMetricSchema",
+		"summary":     "Describe a metric's params and, for multi-row metrics, its columns",
+		"parameters": []interface{}{
+			object{
+				"name":     "name",
+				"in":       "path",
+				"required": true,
+				"schema":   object{"type": "string", "enum": names},
+			},
+		},
+		"responses": object{
+			"200": jsonResponse("The metric's schema", ref("MetricSchema")),
+			"404": errorResponse("The metric does not exist"),
+		},
+	}
+}
+
+func formatParam() object {
+	return queryParam("format", "Set to csv for a CSV download of a single metric, or ndjson to stream a multi-row metric", object{"type": "string", "enum": []interface{}{"json", "csv", "ndjson"}})
+}
+
+func debugParam() object {
+	return queryParam("debug", "Include each metric's database time as duration_ms", object{"type": "boolean", "default": false})
+}
+
+func omitNullsParam() object {
+	return queryParam("omit_nulls", "Leave NULL columns out of multi-row results instead of returning null", object{"type": "boolean", "default": false})
+}
+
+func rangeParam() object {
+	return queryParam("range", "Fill the metric's range date params with today, this_month or the N days ending today, such as 7d", object{"type": "string", "pattern": "^(today|this_month|[0-9]+d)$"})
+}
+
+func prettyParam() object {
+	return queryParam("pretty", "Indent JSON responses for reading in a terminal", object{"type": "boolean", "default": false})
+}
+
+func envelopeParam() object {
+	return queryParam("envelope", "Wrap results in an object with a generated_at timestamp", object{"type": "boolean", "default": false})
+}
+
+func queryParam(name, description string, schema object) object {
+	return object{"name": name, "in": "query", "description": description, "schema": schema}
+}
+
+func jsonResponse(description string, schema object) object {
+	return object{
+		"description": description,
+		"content":     object{"application/json": object{"schema": schema}},
+	}
+}
+
+func errorResponse(description string) object {
+	return jsonResponse(description, ref("ErrorResponse"))
+}
+
+func ref(name string) object {
+	return object{"$ref": "#/components/schemas/" + name}
+}
+
+// componentSchemas mirrors the JSON shapes of the API's response types.
+func componentSchemas() object {
+	return object{
+		"MetricResult": object{
+			"type":     "object",
+			"required": []interface{}{"name", "value"},
+			"properties": object{
+				"name":         object{"type": "string"},
+				"value":        object{"nullable": true},
+				"columns":      object{"type": "array", "items": object{"type": "string"}, "description": "Multi-row column names in query order"},
+				"unit":         object{"type": "string"},
+				"format":       object{"type": "string", "enum": []interface{}{"count", "currency", "percent", "duration_ms"}},
+				"error":        object{"type": "string", "description": "Set on failed metrics in partial batches"},
+				"page":         ref("Page"),
+				"truncated":    object{"type": "boolean", "description": "Set when the metric's max_rows left out some rows"},
+				"duration_ms":  object{"type": "number", "description": "Database time, when debug=true"},
+				"degraded":     object{"type": "boolean", "description": "Set when the metric's query failed and the value came from its fallback query"},
+				"generated_at": object{"type": "string", "format": "date-time", "description": "When the value was queried; earlier than the response for cached results"},
+			},
+		},
+		"ResultEnvelope": object{
+			"type":     "object",
+			"required": []interface{}{"results", "generated_at"},
+			"properties": object{
+				"results":      object{"type": "array", "items": ref("MetricResult")},
+				"generated_at": object{"type": "string", "format": "date-time"},
+			},
+		},
+		"PageEnvelope": object{
+			"type":     "object",
+			"required": []interface{}{"name", "data", "page"},
+			"properties": object{
+				"name":         object{"type": "string"},
+				"data":         object{"type": "array", "items": object{"type": "object", "additionalProperties": true}},
+				"columns":      object{"type": "array", "items": object{"type": "string"}},
+				"unit":         object{"type": "string"},
+				"format":       object{"type": "string", "enum": []interface{}{"count", "currency", "percent", "duration_ms"}},
+				"page":         ref("Page"),
+				"truncated":    object{"type": "boolean"},
+				"duration_ms":  object{"type": "number"},
+				"degraded":     object{"type": "boolean"},
+				"generated_at": object{"type": "string", "format": "date-time"},
+			},
+		},
+		"Page": object{
+			"type":     "object",
+			"required": []interface{}{"limit", "offset", "total"},
+			"properties": object{
+				"limit":  object{"type": "integer"},
+				"offset": object{"type": "integer"},
+				"total":  object{"type": "integer", "format": "int64"},
+			},
+		},
+		"MetricInfo": object{
+			"type":     "object",
+			"required": []interface{}{"name", "multi_row"},
+			"properties": object{
+				"name":        object{"type": "string"},
+				"description": object{"type": "string"},
+				"unit":        object{"type": "string"},
+				"format":      object{"type": "string", "enum": []interface{}{"count", "currency", "percent", "duration_ms"}},
+				"category":    object{"type": "string"},
+				"tags":        object{"type": "array", "items": object{"type": "string"}},
+				"scopes":      object{"type": "array", "items": object{"type": "string"}, "description": "Scopes a scoped API key must all hold to read the metric"},
+				"multi_row":   object{"type": "boolean"},
+				"single_row":  object{"type": "boolean", "description": "The multi-row query answers with only its first row, as an object"},
+				"value_type":  object{"type": "string", "enum": []interface{}{"int", "float", "bool"}},
+				"params":      object{"type": "array", "items": ref("ParamDefinition")},
+				"range": object{
+					"type":        "object",
+					"description": "The date params the range query parameter fills in",
+					"properties":  object{"from": object{"type": "string"}, "to": object{"type": "string"}},
+				},
+			},
+		},
+		"MetricSchema": object{
+			"allOf": []interface{}{
+				ref("MetricInfo"),
+				object{"properties": object{"columns": object{"type": "array", "items": object{"type": "string"}}}},
+			},
+		},
+		"ParamDefinition": object{
+			"type":     "object",
+			"required": []interface{}{"name", "type", "required"},
+			"properties": object{
+				"name":           object{"type": "string"},
+				"type":           object{"type": "string", "enum": []interface{}{"string", "int", "float", "date"}},
+				"required":       object{"type": "boolean"},
+				"default":        object{"type": "string"},
+				"allowed_values": object{"type": "array", "items": object{"type": "string"}},
+				"min":            object{"type": "number"},
+				"max":            object{"type": "number"},
+				"list":           object{"type": "boolean"},
+			},
+		},
+		"QueryRequest": object{
+			"type":        "object",
+			"description": "Either names with shared params, or metrics that each carry their own params",
+			"properties": object{
+				"names":  object{"type": "array", "items": object{"type": "string"}},
+				"params": object{"type": "object", "additionalProperties": object{"type": "string"}},
+				"metrics": object{"type": "array", "items": object{
+					"type":     "object",
+					"required": []interface{}{"name"},
+					"properties": object{
+						"name":   object{"type": "string"},
+						"params": object{"type": "object", "additionalProperties": object{"type": "string"}},
+					},
+					"additionalProperties": false,
+				}},
+				"partial":    object{"type": "boolean"},
+				"limit":      object{"type": "integer"},
+				"offset":     object{"type": "integer"},
+				"debug":      object{"type": "boolean"},
+				"omit_nulls": object{"type": "boolean"},
+				"range":      object{"type": "string"},
+				"envelope":   object{"type": "boolean"},
+			},
+			"additionalProperties": false,
+		},
+		"VersionInfo": object{
+			"type":     "object",
+			"required": []interface{}{"version", "commit", "built"},
+			"properties": object{
+				"version": object{"type": "string"},
+				"commit":  object{"type": "string"},
+				"built":   object{"type": "string"},
+			},
+		},
+		"HealthStatus": object{
+			"type":     "object",
+			"required": []interface{}{"status"},
+			"properties": object{
+				"status":    object{"type": "string", "enum": []interface{}{"ok", "unhealthy"}},
+				"unhealthy": object{"type": "array", "items": object{"type": "string"}},
+			},
+		},
+		"ErrorResponse": object{
+			"type":     "object",
+			"required": []interface{}{"error"},
+			"properties": object{
+				"error": object{
+					"type":     "object",
+					"required": []interface{}{"code", "message"},
+					"properties": object{
+						"code":    object{"type": "string"},
+						"message": object{"type": "string"},
+						"details": object{"type": "object", "additionalProperties": true},
+					},
+				},
+			},
+		},
+	}
+}
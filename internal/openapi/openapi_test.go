@@ -0,0 +1,158 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+func float(f float64) *float64 {
+	return &f
+}
+
+// roundTrip marshals the document and decodes it generically, so tests see
+// exactly what clients receive.
+func roundTrip(t *testing.T, doc interface{}) map[string]interface{} {
+	t.Helper()
+	body, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	return decoded
+}
+
+func paramByName(t *testing.T, op map[string]interface{}, name string) map[string]interface{} {
+	t.Helper()
+	for _, p := range op["parameters"].([]interface{}) {
+		param := p.(map[string]interface{})
+		if param["name"] == name {
+			return param
+		}
+	}
+	t.Fatalf("parameter %q not found", name)
+	return nil
+}
+
+func TestBuild(t *testing.T) {
+	metrics := []models.MetricInfo{
+		{
+			Name:      "orders",
+			Category:  "sales",
+			ValueType: models.ValueTypeInt,
+			Params: []models.ParamDefinition{
+				{Name: "status", Type: models.ParamTypeString, List: true, Default: "pending,shipped", AllowedValues: []string{"pending", "shipped"}},
+				{Name: "days", Type: models.ParamTypeInt, Required: true, AllowedValues: []string{"7", "30"}, Min: float(1), Max: float(90)},
+			},
+		},
+		{Name: "all_users", MultiRow: true},
+	}
+
+	doc := roundTrip(t, Build(metrics, "v1.2.0"))
+
+	if doc["openapi"] != Version {
+		t.Errorf("openapi = %v, want %s", doc["openapi"], Version)
+	}
+	if got := doc["info"].(map[string]interface{})["version"]; got != "v1.2.0" {
+		t.Errorf("info.version = %v, want v1.2.0", got)
+	}
+
+	paths := doc["paths"].(map[string]interface{})
+	for _, path := range []string{"/metrics", "/metrics/orders", "/metrics/orders.csv", "/metrics/all_users", "/metrics/{name}/schema", "/version", "/healthz"} {
+		if _, ok := paths[path]; !ok {
+			t.Errorf("paths missing %s", path)
+		}
+	}
+
+	orders := paths["/metrics/orders"].(map[string]interface{})["get"].(map[string]interface{})
+	if orders["operationId"] != "getMetric_orders" {
+		t.Errorf("operationId = %v, want getMetric_orders", orders["operationId"])
+	}
+	if !reflect.DeepEqual(orders["tags"], []interface{}{"sales"}) {
+		t.Errorf("tags = %v, want [sales]", orders["tags"])
+	}
+
+	t.Run("typed param with enum and range", func(t *testing.T) {
+		days := paramByName(t, orders, "days")
+		if days["required"] != true || days["in"] != "query" {
+			t.Errorf("days = %v, want a required query parameter", days)
+		}
+		schema := days["schema"].(map[string]interface{})
+		if schema["type"] != "integer" {
+			t.Errorf("type = %v, want integer", schema["type"])
+		}
+		if !reflect.DeepEqual(schema["enum"], []interface{}{7.0, 30.0}) {
+			t.Errorf("enum = %v, want numbers [7 30]", schema["enum"])
+		}
+		if schema["minimum"] != 1.0 || schema["maximum"] != 90.0 {
+			t.Errorf("range = %v..%v, want 1..90", schema["minimum"], schema["maximum"])
+		}
+	})
+
+	t.Run("list param", func(t *testing.T) {
+		status := paramByName(t, orders, "status")
+		if status["explode"] != false || status["style"] != "form" {
+			t.Errorf("status = %v, want comma-separated form style", status)
+		}
+		schema := status["schema"].(map[string]interface{})
+		if schema["type"] != "array" {
+			t.Errorf("type = %v, want array", schema["type"])
+		}
+		if !reflect.DeepEqual(schema["default"], []interface{}{"pending", "shipped"}) {
+			t.Errorf("default = %v, want [pending shipped]", schema["default"])
+		}
+	})
+
+	t.Run("pagination only on multi-row metrics", func(t *testing.T) {
+		allUsers := paths["/metrics/all_users"].(map[string]interface{})["get"].(map[string]interface{})
+		paramByName(t, allUsers, "limit")
+		for _, p := range orders["parameters"].([]interface{}) {
+			if p.(map[string]interface{})["name"] == "limit" {
+				t.Error("single-value metric lists limit")
+			}
+		}
+	})
+
+	t.Run("ndjson only on multi-row metrics", func(t *testing.T) {
+		content := func(op map[string]interface{}) map[string]interface{} {
+			ok := op["responses"].(map[string]interface{})["200"].(map[string]interface{})
+			return ok["content"].(map[string]interface{})
+		}
+		allUsers := paths["/metrics/all_users"].(map[string]interface{})["get"].(map[string]interface{})
+		if _, ok := content(allUsers)["application/x-ndjson"]; !ok {
+			t.Error("multi-row metric is missing an NDJSON response")
+		}
+		if _, ok := content(orders)["application/x-ndjson"]; ok {
+			t.Error("single-value metric lists an NDJSON response")
+		}
+	})
+
+	t.Run("schema path enumerates metric names", func(t *testing.T) {
+		op := paths["/metrics/{name}/schema"].(map[string]interface{})["get"].(map[string]interface{})
+		schema := paramByName(t, op, "name")["schema"].(map[string]interface{})
+		if !reflect.DeepEqual(schema["enum"], []interface{}{"orders", "all_users"}) {
+			t.Errorf("enum = %v, want [orders all_users]", schema["enum"])
+		}
+	})
+}
+
+func TestBuild_Deterministic(t *testing.T) {
+	metrics := []models.MetricInfo{{Name: "a"}, {Name: "b", MultiRow: true}}
+
+	first, err := json.Marshal(Build(metrics, "dev"))
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	second, err := json.Marshal(Build(metrics, "dev"))
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if string(first) != string(second) {
+		t.Error("identical catalogs produced different documents")
+	}
+}
@@ -0,0 +1,131 @@
+// Background health checking of database connections.
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Health check defaults used when the corresponding HealthOptions field is zero.
+const (
+	DefaultHealthInterval  = 30 * time.Second
+	DefaultHealthTimeout   = 5 * time.Second
+	DefaultHealthThreshold = 3
+)
+
+// Pinger is the part of Repository a HealthChecker needs.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthOptions configures a HealthChecker. Zero fields use the defaults above.
+type HealthOptions struct {
+	// Interval is the time between rounds of pings.
+	Interval time.Duration
+	// Timeout bounds each ping.
+	Timeout time.Duration
+	// Threshold is how many consecutive failed pings mark a database
+	// unhealthy, so a single dropped connection doesn't fail health checks.
+	Threshold int
+}
+
+// HealthChecker pings a set of named databases in the background and
+// tracks which have failed repeatedly.
+type HealthChecker struct {
+	targets map[string]Pinger
+	opts    HealthOptions
+	logger  *slog.Logger
+
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+// NewHealthChecker creates a checker for targets, keyed by the name used
+// in logs and health reports. A nil logger discards all log output.
+func NewHealthChecker(targets map[string]Pinger, logger *slog.Logger, opts HealthOptions) *HealthChecker {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultHealthInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultHealthTimeout
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = DefaultHealthThreshold
+	}
+
+	return &HealthChecker{
+		targets:  targets,
+		opts:     opts,
+		logger:   logger,
+		failures: make(map[string]int, len(targets)),
+	}
+}
+
+// Run pings every target each interval until ctx is cancelled.
+func (hc *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(hc.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			hc.Check(ctx)
+		}
+	}
+}
+
+// Check pings every target once and updates their failure counts,
+// logging failures and recoveries.
+func (hc *HealthChecker) Check(ctx context.Context) {
+	for name, target := range hc.targets {
+		pingCtx, cancel := context.WithTimeout(ctx, hc.opts.Timeout)
+		err := target.Ping(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		hc.mu.Lock()
+		previous := hc.failures[name]
+		if err == nil {
+			hc.failures[name] = 0
+		} else {
+			hc.failures[name] = previous + 1
+		}
+		failures := hc.failures[name]
+		hc.mu.Unlock()
+
+		switch {
+		case err != nil && failures == hc.opts.Threshold:
+			hc.logger.Error("database marked unhealthy", "database", name, "failures", failures, "error", err)
+		case err != nil:
+			hc.logger.Warn("database ping failed", "database", name, "failures", failures, "error", err)
+		case previous >= hc.opts.Threshold:
+			hc.logger.Info("database healthy again", "database", name)
+		}
+	}
+}
+
+// Unhealthy returns the sorted names of targets whose consecutive failed
+// pings have reached the threshold.
+func (hc *HealthChecker) Unhealthy() []string {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	var names []string
+	for name, failures := range hc.failures {
+		if failures >= hc.opts.Threshold {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
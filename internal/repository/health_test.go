@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakePinger fails while err is set.
+type fakePinger struct {
+	err error
+}
+
+func (p *fakePinger) Ping(ctx context.Context) error {
+	return p.err
+}
+
+func TestHealthChecker(t *testing.T) {
+	primary := &fakePinger{}
+	reports := &fakePinger{err: errors.New("connection refused")}
+	hc := NewHealthChecker(map[string]Pinger{"primary": primary, "reports": reports}, nil, HealthOptions{Threshold: 2})
+	ctx := context.Background()
+
+	hc.Check(ctx)
+	if got := hc.Unhealthy(); len(got) != 0 {
+		t.Errorf("after one failure Unhealthy() = %v, want none", got)
+	}
+
+	hc.Check(ctx)
+	if got, want := hc.Unhealthy(), []string{"reports"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after two failures Unhealthy() = %v, want %v", got, want)
+	}
+
+	primary.err = errors.New("timeout")
+	hc.Check(ctx)
+	hc.Check(ctx)
+	if got, want := hc.Unhealthy(), []string{"primary", "reports"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unhealthy() = %v, want %v", got, want)
+	}
+
+	reports.err = nil
+	hc.Check(ctx)
+	if got, want := hc.Unhealthy(), []string{"primary"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after recovery Unhealthy() = %v, want %v", got, want)
+	}
+}
+
+func TestHealthChecker_SQLite(t *testing.T) {
+	repo, err := NewSQLiteRepository(":memory:", SQLiteOptions{})
+	if err != nil {
+		t.Fatalf("NewSQLiteRepository() error = %v", err)
+	}
+	hc := NewHealthChecker(map[string]Pinger{"primary": repo}, nil, HealthOptions{Threshold: 1})
+
+	hc.Check(context.Background())
+	if got := hc.Unhealthy(); len(got) != 0 {
+		t.Errorf("open database Unhealthy() = %v, want none", got)
+	}
+
+	repo.Close()
+	hc.Check(context.Background())
+	if got, want := hc.Unhealthy(), []string{"primary"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("closed database Unhealthy() = %v, want %v", got, want)
+	}
+}
+
+func TestHealthChecker_Run(t *testing.T) {
+	down := &fakePinger{err: errors.New("connection refused")}
+	hc := NewHealthChecker(map[string]Pinger{"primary": down}, nil, HealthOptions{Interval: time.Millisecond, Threshold: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		hc.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for len(hc.Unhealthy()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Run() never marked the database unhealthy")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run() did not return after cancellation")
+	}
+}
@@ -0,0 +1,21 @@
+// Implements the repository interface using MySQL or MariaDB.
+package repository
+
+import (
+	_ "github.com/go-sql-driver/mysql"
+)
+
+type MySQLRepository struct {
+	sqlRepository
+}
+
+// NewMySQLRepository creates a MySQL repository from a go-sql-driver/mysql
+// DSN, e.g. "user:pass@tcp(localhost:3306)/app".
+func NewMySQLRepository(dsn string, pool PoolOptions) (Repository, error) {
+	db, err := openDB("mysql", dsn, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MySQLRepository{sqlRepository{db: db, decode: decodeBytes}}, nil
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestPostgresRepository_DecodesNumeric(t *testing.T) {
+	// No PostgreSQL server is available to tests, so SQLite stands in,
+	// returning bytes for a BLOB as lib/pq does for NUMERIC columns.
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	repo := newPostgresRepository(db)
+	defer repo.Close()
+
+	value, err := repo.QuerySingleValue(context.Background(), "SELECT CAST('1234.50' AS BLOB)")
+	if err != nil {
+		t.Fatalf("QuerySingleValue() error = %v", err)
+	}
+	if value != "1234.50" {
+		t.Errorf("single value = %#v, want \"1234.50\"", value)
+	}
+
+	rows, err := repo.QueryMultiRow(context.Background(), "SELECT CAST('0.25' AS BLOB) AS margin WHERE 1 = ?", 1)
+	if err != nil {
+		t.Fatalf("QueryMultiRow() error = %v", err)
+	}
+	if got := rows[0]["margin"]; got != "0.25" {
+		t.Errorf("margin = %#v, want \"0.25\"", got)
+	}
+}
+
+func TestRebindDollar(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "no placeholders",
+			query: "SELECT COUNT(*) FROM users",
+			want:  "SELECT COUNT(*) FROM users",
+		},
+		{
+			name:  "single placeholder",
+			query: "SELECT name FROM users WHERE id = ?",
+			want:  "SELECT name FROM users WHERE id = $1",
+		},
+		{
+			name:  "multiple placeholders",
+			query: "SELECT * FROM t WHERE a = ? AND b > ? LIMIT ?",
+			want:  "SELECT * FROM t WHERE a = $1 AND b > $2 LIMIT $3",
+		},
+		{
+			name:  "question mark in string literal",
+			query: "SELECT '?' AS q FROM t WHERE id = ?",
+			want:  "SELECT '?' AS q FROM t WHERE id = $1",
+		},
+		{
+			name:  "escaped quote in literal",
+			query: "SELECT 'it''s ?' FROM t WHERE id = ?",
+			want:  "SELECT 'it''s ?' FROM t WHERE id = $1",
+		},
+		{
+			name:  "question mark in quoted identifier",
+			query: `SELECT "what?" FROM t WHERE id = ?`,
+			want:  `SELECT "what?" FROM t WHERE id = $1`,
+		},
+		{
+			name:  "question mark in comments",
+			query: "SELECT id -- why?\nFROM t /* really? */ WHERE id = ?",
+			want:  "SELECT id -- why?\nFROM t /* really? */ WHERE id = $1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rebindDollar(tt.query); got != tt.want {
+				t.Errorf("rebindDollar(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,49 @@
 // Defines the database repository interface for metric queries.
 package repository
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoRows is returned by QuerySingleValue when the query produces no rows.
+// A row holding NULL is not an error; it yields a nil value.
+var ErrNoRows = errors.New("no rows returned")
+
+// QueryError is a failure the database reported while running a query,
+// such as a syntax error or a missing table, as distinct from ErrNoRows. Op
+// names the step that failed. Query is the SQL text only; bound argument
+// values are deliberately left out so the error can be logged safely.
+type QueryError struct {
+	Op    string
+	Query string
+	Err   error
+}
+
+func (e *QueryError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
 
 // Repository abstracts database operations from business logic.
 type Repository interface {
+	// QuerySingleValue returns the first column of the first row, or nil
+	// when that value is NULL, e.g. SUM over no matching rows.
 	QuerySingleValue(ctx context.Context, query string, args ...interface{}) (interface{}, error)
 	QueryMultiRow(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error)
+	// QueryMultiRowColumns is QueryMultiRow that also returns the column
+	// names in the order the query selects them, which row maps cannot keep.
+	QueryMultiRowColumns(ctx context.Context, query string, args ...interface{}) ([]string, []map[string]interface{}, error)
+	// QueryRowsStream calls fn with each row as it is read, so results need
+	// not fit in memory. An error from fn stops the query and is returned.
+	QueryRowsStream(ctx context.Context, query string, fn func(row map[string]interface{}) error, args ...interface{}) error
+	// QueryColumns returns the names of the query's result columns in order.
+	// Rows are not read, so callers should limit the query to none.
+	QueryColumns(ctx context.Context, query string, args ...interface{}) ([]string, error)
+	// Ping checks that the database is reachable, for health checks.
+	Ping(ctx context.Context) error
 	Close() error
 }
@@ -0,0 +1,250 @@
+// Shared database/sql implementation of the repository interface.
+// Driver-specific repositories embed sqlRepository and supply rebind and decode functions.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// Pool defaults used when the corresponding PoolOptions field is zero.
+const (
+	DefaultMaxOpenConns = 25
+	DefaultMaxIdleConns = 5
+)
+
+// PoolOptions sizes the database/sql connection pool. Zero fields use the
+// defaults above; a zero ConnMaxLifetime or ConnMaxIdleTime keeps
+// connections indefinitely. Network databases and the proxies in front of
+// them drop idle connections, so those bounds retire them first.
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// sqlRepository runs queries against any database/sql driver.
+// Queries are written with "?" placeholders; rebind translates them
+// into the driver's native placeholder syntax when it differs, and decode
+// normalizes scanned values the driver represents awkwardly for JSON.
+// When stmts is set, queries run through cached prepared statements.
+type sqlRepository struct {
+	db     *sql.DB
+	rebind func(query string) string
+	decode func(value interface{}) interface{}
+	stmts  *stmtCache
+}
+
+// openDB opens a connection pool for the given driver and verifies it with a ping.
+func openDB(driverName, dsn string, pool PoolOptions) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	return setupPool(db, pool)
+}
+
+// setupPool sizes db's connection pool and verifies it with a ping, closing
+// db if the database cannot be reached.
+func setupPool(db *sql.DB, pool PoolOptions) (*sql.DB, error) {
+	// Configure connection pool
+	if pool.MaxOpenConns == 0 {
+		pool.MaxOpenConns = DefaultMaxOpenConns
+	}
+	if pool.MaxIdleConns == 0 {
+		pool.MaxIdleConns = DefaultMaxIdleConns
+	}
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+
+	// Verify connection
+	if err := db.PingContext(context.Background()); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return db, nil
+}
+
+// Ping checks that the database is reachable. database/sql discards a
+// connection the driver reports as broken and dials another, so a ping
+// after an outage also reconnects the pool.
+func (r *sqlRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+func (r *sqlRepository) bind(query string) string {
+	if r.rebind == nil {
+		return query
+	}
+	return r.rebind(query)
+}
+
+// decodeBytes converts []byte values holding valid UTF-8 to strings. Drivers
+// return text columns as raw bytes in several cases (MySQL text and DECIMAL
+// columns, PostgreSQL NUMERIC columns, SQLite values cast to BLOB), which
+// encoding/json would emit as base64. Genuinely binary values are left as
+// bytes, and so stay base64.
+func decodeBytes(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok && utf8.Valid(b) {
+		return string(b)
+	}
+	return value
+}
+
+// queryRows runs query, through a cached statement when caching is enabled.
+func (r *sqlRepository) queryRows(ctx context.Context, query string, args []interface{}) (*sql.Rows, error) {
+	query = r.bind(query)
+	if r.stmts != nil {
+		stmt, err := r.stmts.prepare(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if stmt != nil {
+			return stmt.QueryContext(ctx, args...)
+		}
+	}
+	return r.db.QueryContext(ctx, query, args...)
+}
+
+// queryRow is the single-row form of queryRows.
+func (r *sqlRepository) queryRow(ctx context.Context, query string, args []interface{}) (*sql.Row, error) {
+	query = r.bind(query)
+	if r.stmts != nil {
+		stmt, err := r.stmts.prepare(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		if stmt != nil {
+			return stmt.QueryRowContext(ctx, args...), nil
+		}
+	}
+	return r.db.QueryRowContext(ctx, query, args...), nil
+}
+
+func (r *sqlRepository) decodeValue(value interface{}) interface{} {
+	if r.decode == nil {
+		return value
+	}
+	return r.decode(value)
+}
+
+func (r *sqlRepository) QuerySingleValue(ctx context.Context, query string, args ...interface{}) (value interface{}, err error) {
+	ctx, span := startSpan(ctx, "db.query_single_value", query)
+	defer func() { endSpan(span, err) }()
+
+	// NULL scans into interface{} as nil, which is returned as-is so the
+	// API can render it as JSON null.
+	row, err := r.queryRow(ctx, query, args)
+	if err == nil {
+		err = row.Scan(&value)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRows
+		}
+		return nil, &QueryError{Op: "query failed", Query: query, Err: err}
+	}
+
+	return r.decodeValue(value), nil
+}
+
+func (r *sqlRepository) QueryMultiRow(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	_, results, err := r.QueryMultiRowColumns(ctx, query, args...)
+	return results, err
+}
+
+func (r *sqlRepository) QueryMultiRowColumns(ctx context.Context, query string, args ...interface{}) ([]string, []map[string]interface{}, error) {
+	// Non-nil so an empty result encodes as [] rather than null
+	results := make([]map[string]interface{}, 0)
+
+	columns, err := r.streamRows(ctx, query, args, func(row map[string]interface{}) error {
+		results = append(results, row)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return columns, results, nil
+}
+
+func (r *sqlRepository) QueryRowsStream(ctx context.Context, query string, fn func(row map[string]interface{}) error, args ...interface{}) error {
+	_, err := r.streamRows(ctx, query, args, fn)
+	return err
+}
+
+// streamRows calls fn with each row of the query, returning the result's
+// column names in order.
+func (r *sqlRepository) streamRows(ctx context.Context, query string, args []interface{}, fn func(row map[string]interface{}) error) (columns []string, err error) {
+	ctx, span := startSpan(ctx, "db.query_rows", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := r.queryRows(ctx, query, args)
+	if err != nil {
+		return nil, &QueryError{Op: "query failed", Query: query, Err: err}
+	}
+	defer rows.Close()
+
+	columns, err = rows.Columns()
+	if err != nil {
+		return nil, &QueryError{Op: "failed to get columns", Query: query, Err: err}
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		valuePtrs := make([]interface{}, len(columns))
+		for i := range columns {
+			valuePtrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, &QueryError{Op: "failed to scan row", Query: query, Err: err}
+		}
+
+		row := make(map[string]interface{})
+		for i, col := range columns {
+			row[col] = r.decodeValue(values[i])
+		}
+		if err := fn(row); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, &QueryError{Op: "error iterating rows", Query: query, Err: err}
+	}
+
+	return columns, nil
+}
+
+func (r *sqlRepository) QueryColumns(ctx context.Context, query string, args ...interface{}) (columns []string, err error) {
+	ctx, span := startSpan(ctx, "db.query_columns", query)
+	defer func() { endSpan(span, err) }()
+
+	rows, err := r.queryRows(ctx, query, args)
+	if err != nil {
+		return nil, &QueryError{Op: "query failed", Query: query, Err: err}
+	}
+	defer rows.Close()
+
+	columns, err = rows.Columns()
+	if err != nil {
+		return nil, &QueryError{Op: "failed to get columns", Query: query, Err: err}
+	}
+	return columns, nil
+}
+
+func (r *sqlRepository) Close() error {
+	if r.stmts != nil {
+		r.stmts.close()
+	}
+	return r.db.Close()
+}
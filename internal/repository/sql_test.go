@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecodeBytes(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  interface{}
+	}{
+		{name: "bytes", value: []byte("alice"), want: "alice"},
+		{name: "empty bytes", value: []byte{}, want: ""},
+		{name: "utf-8 bytes", value: []byte("café"), want: "café"},
+		{name: "numeric bytes", value: []byte("1234.50"), want: "1234.50"},
+		{name: "invalid utf-8", value: []byte{0xff, 0x00}, want: []byte{0xff, 0x00}},
+		{name: "int64", value: int64(42), want: int64(42)},
+		{name: "float64", value: 1.5, want: 1.5},
+		{name: "nil", value: nil, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeBytes(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeBytes(%#v) = %#v, want %#v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
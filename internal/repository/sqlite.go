@@ -4,89 +4,165 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
 
-	_ "modernc.org/sqlite"
+	"modernc.org/sqlite"
 )
 
+// DefaultBusyTimeout is how long a SQLite connection waits for a lock held
+// by another connection or process before failing with "database is locked".
+const DefaultBusyTimeout = 5 * time.Second
+
+// journalModes are the values SQLite accepts for PRAGMA journal_mode.
+var journalModes = map[string]bool{
+	"delete": true, "truncate": true, "persist": true, "memory": true, "wal": true, "off": true,
+}
+
+// SQLiteOptions configures a SQLite connection. The zero value opens a
+// read-write connection, in WAL mode for file databases.
+type SQLiteOptions struct {
+	// ReadOnly sets PRAGMA query_only on every pooled connection, so any
+	// statement that would modify the database fails.
+	ReadOnly bool
+
+	// JournalMode sets PRAGMA journal_mode for file databases; empty means
+	// "wal", which lets readers proceed while a writer holds the database.
+	// In-memory databases keep SQLite's own journal.
+	JournalMode string
+
+	// BusyTimeout sets PRAGMA busy_timeout; zero uses DefaultBusyTimeout.
+	BusyTimeout time.Duration
+
+	// Pool sizes the connection pool. For ":memory:" MaxOpenConns defaults
+	// to 1, because each connection would otherwise get its own empty database.
+	Pool PoolOptions
+
+	// Attach maps schema aliases to further database files, attached to
+	// every pooled connection so queries can name tables as alias.table.
+	// The files must already exist.
+	Attach map[string]string
+}
+
 type SQLiteRepository struct {
-	db *sql.DB
+	sqlRepository
 }
 
 // NewSQLiteRepository creates a SQLite repository.
 // Path can be a file path or ":memory:" for an in-memory database.
-func NewSQLiteRepository(path string) (Repository, error) {
-	db, err := sql.Open("sqlite", path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+func NewSQLiteRepository(path string, opts SQLiteOptions) (Repository, error) {
+	if opts.JournalMode != "" && !journalModes[strings.ToLower(opts.JournalMode)] {
+		return nil, fmt.Errorf("invalid SQLite journal mode %q", opts.JournalMode)
 	}
 
-	// Configure connection pool
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
+	pool := opts.Pool
+	if isMemoryPath(path) && pool.MaxOpenConns == 0 {
+		pool.MaxOpenConns = 1
+	}
 
-	// Verify connection
-	if err := db.PingContext(context.Background()); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	var db *sql.DB
+	var err error
+	if len(opts.Attach) > 0 {
+		db, err = openAttached(sqliteDSN(path, opts), opts.Attach, pool)
+	} else {
+		db, err = openDB("sqlite", sqliteDSN(path, opts), pool)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return &SQLiteRepository{db: db}, nil
+	// Statements are cached only for SQLite: a PostgreSQL or MySQL server
+	// behind a transaction-pooling proxy cannot keep them prepared.
+	return &SQLiteRepository{sqlRepository{db: db, decode: decodeBytes, stmts: newStmtCache(db)}}, nil
 }
 
-func (r *SQLiteRepository) QuerySingleValue(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
-	var value interface{}
-	err := r.db.QueryRowContext(ctx, query, args...).Scan(&value)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("no rows returned")
-		}
-		return nil, fmt.Errorf("query failed: %w", err)
-	}
-	return value, nil
+// isMemoryPath reports whether path names an in-memory database.
+func isMemoryPath(path string) bool {
+	return path == ":memory:" || strings.HasPrefix(path, "file::memory:") || strings.Contains(path, "mode=memory")
 }
 
-func (r *SQLiteRepository) QueryMultiRow(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
-	rows, err := r.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("query failed: %w", err)
+// sqliteDSN appends the driver's _pragma parameters for opts to path. The
+// driver runs them for each connection it opens, which a one-off PRAGMA
+// statement would not cover since database/sql pools connections.
+func sqliteDSN(path string, opts SQLiteOptions) string {
+	busyTimeout := opts.BusyTimeout
+	if busyTimeout == 0 {
+		busyTimeout = DefaultBusyTimeout
 	}
-	defer rows.Close()
-
-	columns, err := rows.Columns()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get columns: %w", err)
+	pragmas := []string{fmt.Sprintf("_pragma=busy_timeout(%d)", busyTimeout.Milliseconds())}
+
+	// journal_mode comes before query_only, which would otherwise refuse
+	// the header write that switching to WAL needs.
+	if !isMemoryPath(path) {
+		mode := strings.ToLower(opts.JournalMode)
+		if mode == "" {
+			mode = "wal"
+		}
+		pragmas = append(pragmas, "_pragma=journal_mode("+mode+")")
+	}
+	if opts.ReadOnly {
+		pragmas = append(pragmas, "_pragma=query_only(1)")
 	}
 
-	var results []map[string]interface{}
-
-	for rows.Next() {
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-
-		for i := range columns {
-			valuePtrs[i] = &values[i]
-		}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + strings.Join(pragmas, "&")
+}
 
-		if err := rows.Scan(valuePtrs...); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %w", err)
+// openAttached opens a pool whose connections each attach the given files.
+// ATTACH applies only to the connection that runs it, and database/sql opens
+// and replaces connections as it pleases, so it is run by the connector.
+func openAttached(dsn string, attach map[string]string, pool PoolOptions) (*sql.DB, error) {
+	for alias, path := range attach {
+		// ATTACH would otherwise create an empty database at a mistyped path
+		if !isMemoryPath(path) {
+			if _, err := os.Stat(path); err != nil {
+				return nil, fmt.Errorf("attached database %q: %w", alias, err)
+			}
 		}
+	}
+	return setupPool(sql.OpenDB(&attachConnector{dsn: dsn, attach: attach}), pool)
+}
 
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			row[col] = values[i]
-		}
+// attachConnector opens SQLite connections with extra databases attached.
+type attachConnector struct {
+	dsn    string
+	attach map[string]string
+}
 
-		results = append(results, row)
+func (c *attachConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Driver().Open(c.dsn)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+		return nil, fmt.Errorf("SQLite driver connection cannot execute ATTACH")
 	}
 
-	return results, nil
+	aliases := make([]string, 0, len(c.attach))
+	for alias := range c.attach {
+		aliases = append(aliases, alias)
+	}
+	slices.Sort(aliases)
+	for _, alias := range aliases {
+		stmt := `ATTACH DATABASE ? AS "` + strings.ReplaceAll(alias, `"`, `""`) + `"`
+		if _, err := execer.ExecContext(ctx, stmt, []driver.NamedValue{{Ordinal: 1, Value: c.attach[alias]}}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to attach database %q: %w", alias, err)
+		}
+	}
+	return conn, nil
 }
 
-func (r *SQLiteRepository) Close() error {
-	return r.db.Close()
+func (c *attachConnector) Driver() driver.Driver {
+	return &sqlite.Driver{}
 }
@@ -2,12 +2,19 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
 
 func setupTestDB(t *testing.T) Repository {
-	repo, err := NewSQLiteRepository(":memory:")
+	repo, err := NewSQLiteRepository(":memory:", SQLiteOptions{})
 	if err != nil {
 		t.Fatalf("failed to create test repository: %v", err)
 	}
@@ -41,7 +48,7 @@ func setupTestDB(t *testing.T) Repository {
 }
 
 func TestNewSQLiteRepository_Memory(t *testing.T) {
-	repo, err := NewSQLiteRepository(":memory:")
+	repo, err := NewSQLiteRepository(":memory:", SQLiteOptions{})
 	if err != nil {
 		t.Fatalf("failed to create in-memory repository: %v", err)
 	}
@@ -52,14 +59,226 @@ func TestNewSQLiteRepository_Memory(t *testing.T) {
 	}
 }
 
+func TestNewSQLiteRepository_Pool(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		pool PoolOptions
+		want int
+	}{
+		{name: "file defaults", path: filepath.Join(t.TempDir(), "data.db"), want: DefaultMaxOpenConns},
+		{name: "memory defaults to one connection", path: ":memory:", want: 1},
+		{name: "explicit size", path: filepath.Join(t.TempDir(), "data.db"), pool: PoolOptions{MaxOpenConns: 3}, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := NewSQLiteRepository(tt.path, SQLiteOptions{Pool: tt.pool})
+			if err != nil {
+				t.Fatalf("failed to create repository: %v", err)
+			}
+			defer repo.Close()
+
+			if got := repo.(*SQLiteRepository).db.Stats().MaxOpenConnections; got != tt.want {
+				t.Errorf("MaxOpenConnections = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestNewSQLiteRepository_BadPath(t *testing.T) {
 	// Try to open a database in a nonexistent directory
-	_, err := NewSQLiteRepository("/nonexistent/path/db.sqlite")
+	_, err := NewSQLiteRepository("/nonexistent/path/db.sqlite", SQLiteOptions{})
 	if err == nil {
 		t.Error("expected error for nonexistent path")
 	}
 }
 
+func TestNewSQLiteRepository_ReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+
+	rw, err := NewSQLiteRepository(path, SQLiteOptions{})
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	if _, err := rw.(*SQLiteRepository).db.Exec("CREATE TABLE items (id INTEGER); INSERT INTO items VALUES (1)"); err != nil {
+		t.Fatalf("failed to create test table: %v", err)
+	}
+	rw.Close()
+
+	repo, err := NewSQLiteRepository(path, SQLiteOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("failed to create read-only repository: %v", err)
+	}
+	defer repo.Close()
+
+	count, err := repo.QuerySingleValue(context.Background(), "SELECT COUNT(*) FROM items")
+	if err != nil {
+		t.Fatalf("read query failed: %v", err)
+	}
+	if count != int64(1) {
+		t.Errorf("expected 1, got %v", count)
+	}
+
+	writes := []string{
+		"DELETE FROM items",
+		"DROP TABLE items",
+		"INSERT INTO items VALUES (2) RETURNING id",
+	}
+	for _, query := range writes {
+		if _, err := repo.QueryMultiRow(context.Background(), query); err == nil {
+			t.Errorf("expected %q to fail on a read-only connection", query)
+		}
+	}
+
+	count, err = repo.QuerySingleValue(context.Background(), "SELECT COUNT(*) FROM items")
+	if err != nil {
+		t.Fatalf("read query failed: %v", err)
+	}
+	if count != int64(1) {
+		t.Errorf("expected table unchanged with 1 row, got %v", count)
+	}
+}
+
+func TestNewSQLiteRepository_Attach(t *testing.T) {
+	dir := t.TempDir()
+	events := filepath.Join(dir, "events.db")
+	setup, err := NewSQLiteRepository(events, SQLiteOptions{})
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	if _, err := setup.(*SQLiteRepository).db.Exec("CREATE TABLE events (id INTEGER); INSERT INTO events VALUES (1), (2)"); err != nil {
+		t.Fatalf("failed to create test table: %v", err)
+	}
+	setup.Close()
+
+	repo, err := NewSQLiteRepository(filepath.Join(dir, "main.db"), SQLiteOptions{
+		ReadOnly: true,
+		Attach:   map[string]string{"analytics": events},
+		Pool:     PoolOptions{MaxOpenConns: 2},
+	})
+	if err != nil {
+		t.Fatalf("failed to create repository with attachment: %v", err)
+	}
+	defer repo.Close()
+
+	// Hold two connections at once so both come from the connector.
+	db := repo.(*SQLiteRepository).db
+	ctx := context.Background()
+	var conns []*sql.Conn
+	for i := 0; i < 2; i++ {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("failed to get connection %d: %v", i, err)
+		}
+		conns = append(conns, conn)
+
+		var count int64
+		if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM analytics.events").Scan(&count); err != nil {
+			t.Fatalf("connection %d: query on attached database failed: %v", i, err)
+		}
+		if count != 2 {
+			t.Errorf("connection %d: count = %d, want 2", i, count)
+		}
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+
+	if _, err := repo.QueryMultiRow(ctx, "DELETE FROM analytics.events RETURNING id"); err == nil {
+		t.Error("expected a write to the attached database to fail on a read-only connection")
+	}
+
+	// A misspelt alias is what VALIDATE_ON_START's probe reports.
+	if _, err := repo.QueryColumns(ctx, "SELECT * FROM (SELECT COUNT(*) FROM analytcs.events) AS probed LIMIT 0"); err == nil || !strings.Contains(err.Error(), "no such table: analytcs.events") {
+		t.Errorf("QueryColumns() on an unattached schema error = %v, want no such table", err)
+	}
+}
+
+func TestNewSQLiteRepository_AttachMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.db")
+
+	_, err := NewSQLiteRepository(filepath.Join(dir, "main.db"), SQLiteOptions{Attach: map[string]string{"analytics": missing}})
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("error = %v, want a missing file error", err)
+	}
+	if _, statErr := os.Stat(missing); statErr == nil {
+		t.Error("attaching created the missing database file")
+	}
+}
+
+func TestNewSQLiteRepository_Pragmas(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		opts        SQLiteOptions
+		wantJournal string
+		wantTimeout int64
+	}{
+		{name: "file defaults to WAL", path: filepath.Join(t.TempDir(), "data.db"), wantJournal: "wal", wantTimeout: 5000},
+		{name: "explicit journal and timeout", path: filepath.Join(t.TempDir(), "data.db"), opts: SQLiteOptions{JournalMode: "delete", BusyTimeout: 2 * time.Second}, wantJournal: "delete", wantTimeout: 2000},
+		{name: "read-only file still uses WAL", path: filepath.Join(t.TempDir(), "data.db"), opts: SQLiteOptions{ReadOnly: true}, wantJournal: "wal", wantTimeout: 5000},
+		{name: "memory", path: ":memory:", wantJournal: "memory", wantTimeout: 5000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, err := NewSQLiteRepository(tt.path, tt.opts)
+			if err != nil {
+				t.Fatalf("failed to create repository: %v", err)
+			}
+			defer repo.Close()
+
+			journal, err := repo.QuerySingleValue(context.Background(), "PRAGMA journal_mode")
+			if err != nil {
+				t.Fatalf("PRAGMA journal_mode failed: %v", err)
+			}
+			if journal != tt.wantJournal {
+				t.Errorf("journal_mode = %v, want %s", journal, tt.wantJournal)
+			}
+
+			timeout, err := repo.QuerySingleValue(context.Background(), "PRAGMA busy_timeout")
+			if err != nil {
+				t.Fatalf("PRAGMA busy_timeout failed: %v", err)
+			}
+			if timeout != tt.wantTimeout {
+				t.Errorf("busy_timeout = %v, want %d", timeout, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestNewSQLiteRepository_InvalidJournalMode(t *testing.T) {
+	_, err := NewSQLiteRepository(filepath.Join(t.TempDir(), "data.db"), SQLiteOptions{JournalMode: "wal) --"})
+	if err == nil {
+		t.Error("expected error for invalid journal mode")
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		opts SQLiteOptions
+		want string
+	}{
+		{name: "defaults", path: "./data.db", want: "./data.db?_pragma=busy_timeout(5000)&_pragma=journal_mode(wal)"},
+		{name: "read-only", path: "./data.db", opts: SQLiteOptions{ReadOnly: true}, want: "./data.db?_pragma=busy_timeout(5000)&_pragma=journal_mode(wal)&_pragma=query_only(1)"},
+		{name: "existing query", path: "file:data.db?cache=shared", opts: SQLiteOptions{ReadOnly: true}, want: "file:data.db?cache=shared&_pragma=busy_timeout(5000)&_pragma=journal_mode(wal)&_pragma=query_only(1)"},
+		{name: "explicit journal and timeout", path: "./data.db", opts: SQLiteOptions{JournalMode: "DELETE", BusyTimeout: 250 * time.Millisecond}, want: "./data.db?_pragma=busy_timeout(250)&_pragma=journal_mode(delete)"},
+		{name: "memory keeps its journal", path: ":memory:", want: ":memory:?_pragma=busy_timeout(5000)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sqliteDSN(tt.path, tt.opts); got != tt.want {
+				t.Errorf("sqliteDSN(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestQuerySingleValue_Integer(t *testing.T) {
 	repo := setupTestDB(t)
 	defer repo.Close()
@@ -103,13 +322,95 @@ func TestQuerySingleValue_Float(t *testing.T) {
 	}
 }
 
+// TestQuerySingleValue_NumericTypes documents how SQLite's dynamic typing
+// surfaces: the Go type follows each value's storage class, not the column's
+// declared type, so metrics that need a stable type set value_type.
+func TestQuerySingleValue_NumericTypes(t *testing.T) {
+	repo := setupTestDB(t)
+	defer repo.Close()
+
+	if _, err := repo.(*SQLiteRepository).db.Exec("INSERT INTO test_data (id, name, count) VALUES (4, 'Dana', 12.5)"); err != nil {
+		t.Fatalf("failed to insert row: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  interface{}
+	}{
+		{query: "SELECT COUNT(*) FROM test_data", want: int64(4)},
+		{query: "SELECT SUM(count) FROM test_data WHERE id <= 3", want: int64(600)},
+		{query: "SELECT AVG(count) FROM test_data WHERE id <= 3", want: 200.0},
+		{query: "SELECT count FROM test_data WHERE id = 4", want: 12.5},
+		{query: "SELECT SUM(count) FROM test_data", want: 612.5},
+	}
+
+	for _, tt := range tests {
+		got, err := repo.QuerySingleValue(context.Background(), tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %#v, want %#v", tt.query, got, tt.want)
+		}
+	}
+}
+
 func TestQuerySingleValue_NoRows(t *testing.T) {
 	repo := setupTestDB(t)
 	defer repo.Close()
 
 	_, err := repo.QuerySingleValue(context.Background(), "SELECT name FROM test_data WHERE id = ?", 999)
-	if err == nil {
-		t.Error("expected error for no rows")
+	if !errors.Is(err, ErrNoRows) {
+		t.Errorf("expected ErrNoRows, got %v", err)
+	}
+}
+
+func TestQuery_QueryError(t *testing.T) {
+	repo := setupTestDB(t)
+	defer repo.Close()
+	ctx := context.Background()
+	query := "SELECT emial FROM test_data WHERE name = ?"
+
+	_, singleErr := repo.QuerySingleValue(ctx, query, "secret@example.com")
+	_, multiErr := repo.QueryMultiRow(ctx, query, "secret@example.com")
+
+	for _, err := range []error{singleErr, multiErr} {
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Fatalf("error %v is not a *QueryError", err)
+		}
+		if queryErr.Op != "query failed" || queryErr.Query != query {
+			t.Errorf("QueryError = %q, %q, want op %q and the query text", queryErr.Op, queryErr.Query, "query failed")
+		}
+		if errors.Is(err, ErrNoRows) {
+			t.Error("a failed query should not be reported as ErrNoRows")
+		}
+	}
+
+	// No rows is not a query error.
+	_, err := repo.QuerySingleValue(ctx, "SELECT name FROM test_data WHERE id = ?", 999)
+	var queryErr *QueryError
+	if errors.As(err, &queryErr) {
+		t.Errorf("no rows reported as QueryError: %v", err)
+	}
+}
+
+func TestQuerySingleValue_Null(t *testing.T) {
+	repo := setupTestDB(t)
+	defer repo.Close()
+
+	queries := []string{
+		"SELECT SUM(amount) FROM test_data WHERE 1 = 0",
+		"SELECT optional FROM test_data WHERE id = 2",
+	}
+	for _, query := range queries {
+		value, err := repo.QuerySingleValue(context.Background(), query)
+		if err != nil {
+			t.Errorf("%s: expected no error for a NULL row, got %v", query, err)
+		}
+		if value != nil {
+			t.Errorf("%s: expected nil, got %v", query, value)
+		}
 	}
 }
 
@@ -174,8 +475,8 @@ func TestQueryMultiRow_NoRows(t *testing.T) {
 		t.Fatalf("query failed: %v", err)
 	}
 
-	if len(rows) != 0 {
-		t.Errorf("expected empty slice, got %d rows", len(rows))
+	if rows == nil || len(rows) != 0 {
+		t.Errorf("expected empty non-nil slice, got %#v", rows)
 	}
 }
 
@@ -204,6 +505,63 @@ func TestQueryMultiRow_NullHandling(t *testing.T) {
 	}
 }
 
+func TestQueryMultiRowColumns_Order(t *testing.T) {
+	repo := setupTestDB(t)
+	defer repo.Close()
+
+	columns, rows, err := repo.QueryMultiRowColumns(context.Background(), "SELECT optional, name, id FROM test_data WHERE id > ? ORDER BY id", 1)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	wantColumns := []string{"optional", "name", "id"}
+	if !reflect.DeepEqual(columns, wantColumns) {
+		t.Errorf("columns = %v, want %v", columns, wantColumns)
+	}
+	if len(rows) != 2 || rows[0]["name"] != "Bob" {
+		t.Errorf("rows = %v, want Bob and Charlie", rows)
+	}
+
+	// Columns are known even when no rows match.
+	columns, rows, err = repo.QueryMultiRowColumns(context.Background(), "SELECT amount, id FROM test_data WHERE id > 10")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if !reflect.DeepEqual(columns, []string{"amount", "id"}) || rows == nil || len(rows) != 0 {
+		t.Errorf("columns = %v, rows = %v, want [amount id] and no rows", columns, rows)
+	}
+}
+
+func TestQueryMultiRow_RecursiveCTE(t *testing.T) {
+	repo := setupTestDB(t)
+	defer repo.Close()
+
+	query := `WITH RECURSIVE chain(id, name, depth) AS (
+		SELECT id, name, 0 FROM test_data WHERE id = ?
+		UNION ALL
+		SELECT t.id, t.name, c.depth + 1 FROM test_data t JOIN chain c ON t.id = c.id + 1
+	)
+	SELECT name, depth FROM chain ORDER BY depth`
+
+	rows, err := repo.QueryMultiRow(context.Background(), query, 1)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if len(rows) != 3 || rows[2]["name"] != "Charlie" || rows[2]["depth"] != int64(2) {
+		t.Errorf("rows = %v, want Alice, Bob and Charlie at depths 0 to 2", rows)
+	}
+
+	// Pagination and max_rows run the query as a subquery, which SQLite
+	// accepts for a CTE too.
+	rows, err = repo.QueryMultiRow(context.Background(), "SELECT * FROM ("+query+") AS paged LIMIT ? OFFSET ?", 1, 1, 1)
+	if err != nil {
+		t.Fatalf("wrapped query failed: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["name"] != "Bob" {
+		t.Errorf("rows = %v, want only Bob", rows)
+	}
+}
+
 func TestQueryMultiRow_ColumnTypes(t *testing.T) {
 	repo := setupTestDB(t)
 	defer repo.Close()
@@ -232,6 +590,59 @@ func TestQueryMultiRow_ColumnTypes(t *testing.T) {
 	}
 }
 
+func TestQueryMultiRow_BytesDecoded(t *testing.T) {
+	repo := setupTestDB(t)
+	defer repo.Close()
+
+	rows, err := repo.QueryMultiRow(context.Background(), "SELECT CAST(name AS BLOB) AS name, X'FF00' AS raw FROM test_data WHERE id = ?", 1)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	row := rows[0]
+
+	if name, ok := row["name"].(string); !ok || name != "Alice" {
+		t.Errorf("expected string 'Alice' for name, got %T %v", row["name"], row["name"])
+	}
+
+	// Binary data that is not valid UTF-8 stays as bytes
+	if _, ok := row["raw"].([]byte); !ok {
+		t.Errorf("expected []byte for raw, got %T", row["raw"])
+	}
+}
+
+func TestQueryRowsStream(t *testing.T) {
+	repo := setupTestDB(t)
+	defer repo.Close()
+	ctx := context.Background()
+
+	var names []string
+	err := repo.QueryRowsStream(ctx, "SELECT name FROM test_data WHERE id >= ? ORDER BY id", func(row map[string]interface{}) error {
+		names = append(names, row["name"].(string))
+		return nil
+	}, 2)
+	if err != nil {
+		t.Fatalf("QueryRowsStream() error = %v", err)
+	}
+	if want := []string{"Bob", "Charlie"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("rows = %v, want %v", names, want)
+	}
+
+	// An error from the callback stops reading and is returned unchanged.
+	errStop := errors.New("client went away")
+	calls := 0
+	err = repo.QueryRowsStream(ctx, "SELECT id FROM test_data", func(row map[string]interface{}) error {
+		calls++
+		return errStop
+	})
+	if err != errStop {
+		t.Errorf("QueryRowsStream() error = %v, want %v", err, errStop)
+	}
+	if calls != 1 {
+		t.Errorf("callback called %d times after failing, want 1", calls)
+	}
+}
+
 func TestQueryMultiRow_ColumnNames(t *testing.T) {
 	repo := setupTestDB(t)
 	defer repo.Close()
@@ -260,8 +671,23 @@ func TestQueryMultiRow_ColumnNames(t *testing.T) {
 	}
 }
 
+func TestQueryColumns(t *testing.T) {
+	repo := setupTestDB(t)
+	defer repo.Close()
+
+	columns, err := repo.QueryColumns(context.Background(), "SELECT name, id AS user_id, count FROM test_data WHERE id > ? LIMIT 0", 0)
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+
+	want := []string{"name", "user_id", "count"}
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("columns = %v, want %v", columns, want)
+	}
+}
+
 func TestClose(t *testing.T) {
-	repo, err := NewSQLiteRepository(":memory:")
+	repo, err := NewSQLiteRepository(":memory:", SQLiteOptions{})
 	if err != nil {
 		t.Fatalf("failed to create repository: %v", err)
 	}
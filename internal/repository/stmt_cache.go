@@ -0,0 +1,74 @@
+// Caches prepared statements by query text so hot metrics are parsed once.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// maxCachedStmts bounds the cache. Metric queries are fixed by configuration,
+// but list params and pagination derive further query texts from them, so
+// queries beyond the limit run unprepared rather than growing it forever.
+const maxCachedStmts = 256
+
+// stmtCache prepares each distinct query once, on first use. A *sql.Stmt
+// is safe for concurrent use and re-prepares itself on other pooled
+// connections as needed.
+type stmtCache struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, stmts: make(map[string]*sql.Stmt)}
+}
+
+// prepare returns the cached statement for query, preparing it if needed.
+// It returns nil without error when the cache is full and query is not in it.
+func (c *stmtCache) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	stmt, ok := c.stmts[query]
+	full := len(c.stmts) >= maxCachedStmts
+	c.mu.Unlock()
+	if ok {
+		return stmt, nil
+	}
+	if full {
+		return nil, nil
+	}
+
+	// Prepared outside the lock so a slow prepare does not hold up queries
+	// whose statements are already cached.
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.stmts[query]; ok {
+		// Another caller prepared the same query concurrently
+		stmt.Close()
+		return existing, nil
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// close closes every cached statement and empties the cache.
+func (c *stmtCache) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for query, stmt := range c.stmts {
+		if err := stmt.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(c.stmts, query)
+	}
+	return firstErr
+}
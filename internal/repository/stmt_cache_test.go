@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSQLiteRepository_ReusesStatements(t *testing.T) {
+	repo := setupTestDB(t)
+	defer repo.Close()
+	cache := repo.(*SQLiteRepository).stmts
+	ctx := context.Background()
+
+	query := "SELECT name FROM test_data WHERE id = ?"
+	for _, id := range []int64{1, 2} {
+		if _, err := repo.QuerySingleValue(ctx, query, id); err != nil {
+			t.Fatalf("QuerySingleValue() error = %v", err)
+		}
+	}
+	first := cache.stmts[query]
+
+	if _, err := repo.QueryMultiRow(ctx, query, int64(3)); err != nil {
+		t.Fatalf("QueryMultiRow() error = %v", err)
+	}
+
+	if len(cache.stmts) != 1 {
+		t.Errorf("cached statements = %d, want 1", len(cache.stmts))
+	}
+	if first == nil || cache.stmts[query] != first {
+		t.Error("repeated calls did not reuse the prepared statement")
+	}
+}
+
+func TestSQLiteRepository_StatementErrors(t *testing.T) {
+	repo := setupTestDB(t)
+	defer repo.Close()
+	ctx := context.Background()
+
+	// Errors surface on every call, whether found when preparing or executing.
+	for i := 0; i < 2; i++ {
+		if _, err := repo.QuerySingleValue(ctx, "SELECT * FROM missing"); err == nil {
+			t.Fatalf("call %d: expected error for missing table", i+1)
+		}
+	}
+
+	// A table created after a failed attempt is then found.
+	if _, err := repo.(*SQLiteRepository).db.Exec("CREATE TABLE missing (id INTEGER)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	if _, err := repo.QueryMultiRow(ctx, "SELECT * FROM missing"); err != nil {
+		t.Errorf("QueryMultiRow() after creating table error = %v", err)
+	}
+}
+
+func TestStmtCache_Limit(t *testing.T) {
+	repo := setupTestDB(t)
+	defer repo.Close()
+	cache := repo.(*SQLiteRepository).stmts
+	ctx := context.Background()
+
+	for i := 0; i < maxCachedStmts+10; i++ {
+		if _, err := repo.QuerySingleValue(ctx, fmt.Sprintf("SELECT %d", i)); err != nil {
+			t.Fatalf("QuerySingleValue() error = %v", err)
+		}
+	}
+
+	if len(cache.stmts) != maxCachedStmts {
+		t.Errorf("cached statements = %d, want %d", len(cache.stmts), maxCachedStmts)
+	}
+}
+
+func TestStmtCache_Concurrent(t *testing.T) {
+	repo := setupTestDB(t)
+	defer repo.Close()
+	cache := repo.(*SQLiteRepository).stmts
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := repo.QuerySingleValue(context.Background(), "SELECT COUNT(*) FROM test_data"); err != nil {
+				t.Errorf("QuerySingleValue() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(cache.stmts) != 1 {
+		t.Errorf("cached statements = %d, want 1", len(cache.stmts))
+	}
+}
+
+func TestSQLiteRepository_CloseClosesStatements(t *testing.T) {
+	repo := setupTestDB(t)
+	cache := repo.(*SQLiteRepository).stmts
+
+	if _, err := repo.QuerySingleValue(context.Background(), "SELECT COUNT(*) FROM test_data"); err != nil {
+		t.Fatalf("QuerySingleValue() error = %v", err)
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if len(cache.stmts) != 0 {
+		t.Errorf("cached statements after Close = %d, want 0", len(cache.stmts))
+	}
+}
@@ -0,0 +1,35 @@
+// OpenTelemetry spans around database calls.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer uses the global provider, which records nothing until one with an
+// exporter is installed.
+var tracer = otel.Tracer("github.com/roryirvine/vibe-personal-dashboard-backend/internal/repository")
+
+// startSpan starts a client span for one database call. Only the SQL text is
+// recorded, never the bound values, for the same reason as QueryError.
+func startSpan(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.query.text", query)),
+	)
+}
+
+// endSpan records err, if any, and ends span. ErrNoRows is an expected
+// outcome rather than a failure of the call.
+func endSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
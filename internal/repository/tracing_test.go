@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSQLRepository_Spans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	repo := setupTestDB(t)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "metric")
+	if _, err := repo.QuerySingleValue(ctx, "SELECT COUNT(*) FROM test_data WHERE id > ?", 1); err != nil {
+		t.Fatalf("QuerySingleValue() error = %v", err)
+	}
+	if _, err := repo.QueryMultiRow(ctx, "SELECT * FROM missing_table"); err == nil {
+		t.Fatal("QueryMultiRow() error = nil, want a missing table error")
+	}
+	if _, err := repo.QuerySingleValue(ctx, "SELECT id FROM test_data WHERE id < 0"); !errors.Is(err, ErrNoRows) {
+		t.Fatalf("QuerySingleValue() error = %v, want ErrNoRows", err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 4 {
+		t.Fatalf("recorded %d spans, want 3 database spans and the parent", len(spans))
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus codes.Code
+	}{
+		{name: "db.query_single_value", query: "SELECT COUNT(*) FROM test_data WHERE id > ?", wantStatus: codes.Unset},
+		{name: "db.query_rows", query: "SELECT * FROM missing_table", wantStatus: codes.Error},
+		{name: "db.query_single_value", query: "SELECT id FROM test_data WHERE id < 0", wantStatus: codes.Unset},
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		if span.Name() != tt.name {
+			t.Errorf("span %d name = %q, want %q", i, span.Name(), tt.name)
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %d is not a child of the caller's span", i)
+		}
+		if span.Status().Code != tt.wantStatus {
+			t.Errorf("span %d status = %v, want %v", i, span.Status().Code, tt.wantStatus)
+		}
+		var query string
+		for _, kv := range span.Attributes() {
+			if kv.Key == "db.query.text" {
+				query = kv.Value.AsString()
+			}
+		}
+		if query != tt.query {
+			t.Errorf("span %d db.query.text = %q, want %q", i, query, tt.query)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Classifies database errors that may succeed if the query is retried.
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+)
+
+// SQLite primary result codes; extended codes keep these in the low byte.
+const (
+	sqliteBusy   = 5
+	sqliteLocked = 6
+)
+
+// MySQL server error numbers for lock contention.
+const (
+	mysqlLockWaitTimeout = 1205
+	mysqlDeadlock        = 1213
+)
+
+// IsTransient reports whether err is a lock, deadlock or connection failure
+// that may not recur, as opposed to an error in the query itself such as a
+// syntax error or missing table. Context cancellation is never transient:
+// retrying cannot help a request that has already been abandoned.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code() & 0xff
+		return code == sqliteBusy || code == sqliteLocked
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch {
+		case pqErr.Code.Class() == "08": // connection exception
+			return true
+		case pqErr.Code == "40001", pqErr.Code == "40P01": // serialization failure, deadlock
+			return true
+		case pqErr.Code == "57P03": // cannot connect now, e.g. during startup
+			return true
+		}
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlLockWaitTimeout || mysqlErr.Number == mysqlDeadlock
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
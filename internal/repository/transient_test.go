@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "bad connection", err: fmt.Errorf("query: %w", driver.ErrBadConn), want: true},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "deadline", err: fmt.Errorf("query: %w", context.DeadlineExceeded), want: false},
+		{name: "postgres connection failure", err: &pq.Error{Code: "08006"}, want: true},
+		{name: "postgres serialization failure", err: &pq.Error{Code: "40001"}, want: true},
+		{name: "postgres deadlock", err: &pq.Error{Code: "40P01"}, want: true},
+		{name: "postgres undefined table", err: &pq.Error{Code: "42P01"}, want: false},
+		{name: "mysql deadlock", err: &mysql.MySQLError{Number: 1213}, want: true},
+		{name: "mysql syntax error", err: &mysql.MySQLError{Number: 1064}, want: false},
+		{name: "mysql invalid connection", err: mysql.ErrInvalidConn, want: true},
+		{name: "network error", err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}, want: true},
+		{name: "plain error", err: errors.New("something else"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTransient_SQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	ctx := context.Background()
+
+	holder, err := NewSQLiteRepository(path, SQLiteOptions{})
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	defer holder.Close()
+	db := holder.(*SQLiteRepository).db
+	if _, err := db.Exec("CREATE TABLE items (id INTEGER)"); err != nil {
+		t.Fatalf("failed to create test table: %v", err)
+	}
+
+	t.Run("locked database", func(t *testing.T) {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("failed to get connection: %v", err)
+		}
+		defer conn.Close()
+		if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+			t.Fatalf("failed to take write lock: %v", err)
+		}
+		defer conn.ExecContext(ctx, "ROLLBACK")
+
+		writer, err := NewSQLiteRepository(path, SQLiteOptions{BusyTimeout: time.Millisecond})
+		if err != nil {
+			t.Fatalf("failed to create repository: %v", err)
+		}
+		defer writer.Close()
+
+		_, err = writer.(*SQLiteRepository).db.Exec("INSERT INTO items VALUES (1)")
+		if err == nil {
+			t.Fatal("expected write to fail while another connection holds the lock")
+		}
+		if !IsTransient(err) {
+			t.Errorf("IsTransient(%v) = false, want true", err)
+		}
+	})
+
+	t.Run("missing table", func(t *testing.T) {
+		_, err := holder.QuerySingleValue(ctx, "SELECT COUNT(*) FROM missing")
+		if err == nil {
+			t.Fatal("expected error for missing table")
+		}
+		if IsTransient(err) {
+			t.Errorf("IsTransient(%v) = true, want false", err)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+// Records which metrics were queried, by whom and with which params.
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+// Caller identifies who made a request, for the audit log.
+type Caller struct {
+	IP        string
+	RequestID string
+}
+
+type callerKey struct{}
+
+// WithCaller returns a context carrying c, which audit records then include.
+func WithCaller(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+func callerFrom(ctx context.Context) Caller {
+	c, _ := ctx.Value(callerKey{}).(Caller)
+	return c
+}
+
+// audit records that metric was requested, with the params it declares.
+// Sensitive params appear by name only. Cache hits and failed requests are
+// recorded too, since the audit trail is of access rather than database work.
+func (ms *MetricService) audit(ctx context.Context, metric models.Metric, params map[string]string) {
+	if ms.opts.AuditLogger == nil {
+		return
+	}
+
+	var attrs []any
+	for _, p := range metric.Params {
+		value, ok, _ := p.Lookup(params)
+		if !ok {
+			continue
+		}
+		attrs = append(attrs, slog.String(p.Name, p.Redact(value)))
+	}
+
+	caller := callerFrom(ctx)
+	ms.opts.AuditLogger.InfoContext(ctx, "metric requested",
+		"metric", metric.Name,
+		"remote_ip", caller.IP,
+		"request_id", caller.RequestID,
+		slog.Group("params", attrs...),
+	)
+}
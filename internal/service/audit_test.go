@@ -0,0 +1,64 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"testing"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+func TestMetricService_Audit(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:  "orders_for",
+			Query: "SELECT COUNT(*) FROM orders WHERE customer = ? AND token = ?",
+			Params: []models.ParamDefinition{
+				{Name: "customer", Type: models.ParamTypeString, Required: true},
+				{Name: "token", Type: models.ParamTypeString, Required: true, Sensitive: true},
+				{Name: "region", Type: models.ParamTypeString, Default: "all"},
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	service := NewMetricService(&mockRepository{singleValueResult: int64(3)}, metrics, nil, Options{
+		AuditLogger: slog.New(slog.NewJSONHandler(&buf, nil)),
+	})
+
+	ctx := WithCaller(context.Background(), Caller{IP: "203.0.113.7", RequestID: "req-1"})
+	params := map[string]string{"customer": "acme", "token": "s3cret", "unrelated": "x"}
+	if _, err := service.GetMetric(ctx, "orders_for", params, models.QueryOptions{}); err != nil {
+		t.Fatalf("GetMetric() error = %v", err)
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("audit record %q is not JSON: %v", buf.String(), err)
+	}
+	for key, want := range map[string]string{"metric": "orders_for", "remote_ip": "203.0.113.7", "request_id": "req-1"} {
+		if record[key] != want {
+			t.Errorf("%s = %v, want %q", key, record[key], want)
+		}
+	}
+	if _, ok := record["time"]; !ok {
+		t.Error("audit record has no time")
+	}
+	wantParams := map[string]interface{}{"customer": "acme", "token": models.RedactedValue}
+	if !reflect.DeepEqual(record["params"], wantParams) {
+		t.Errorf("params = %v, want %v", record["params"], wantParams)
+	}
+	if bytes.Contains(buf.Bytes(), []byte("s3cret")) {
+		t.Errorf("audit record %q contains a sensitive value", buf.String())
+	}
+
+	// Unknown metrics were never accessed, so leave no record.
+	buf.Reset()
+	service.GetMetric(ctx, "nope", nil, models.QueryOptions{})
+	if buf.Len() != 0 {
+		t.Errorf("audit record for unknown metric: %q", buf.String())
+	}
+}
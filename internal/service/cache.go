@@ -0,0 +1,88 @@
+// In-memory TTL cache for metric query results.
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+// sweepInterval bounds how often set scans for expired entries, so that
+// entries for parameter combinations that are never requested again
+// don't accumulate forever.
+const sweepInterval = time.Minute
+
+type cacheEntry struct {
+	result    models.MetricResult
+	expiresAt time.Time
+}
+
+// resultCache is a concurrency-safe map of query results with per-entry expiry.
+type resultCache struct {
+	mu        sync.Mutex
+	entries   map[string]cacheEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newResultCache() *resultCache {
+	return &resultCache{
+		entries: make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// get returns the cached result for key if present and not expired.
+func (c *resultCache) get(key string) (models.MetricResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return models.MetricResult{}, false
+	}
+
+	if !c.now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return models.MetricResult{}, false
+	}
+
+	return entry.result, true
+}
+
+// set stores result under key for the given ttl.
+func (c *resultCache) set(key string, result models.MetricResult, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.lastSweep) >= sweepInterval {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	c.entries[key] = cacheEntry{result: result, expiresAt: now.Add(ttl)}
+}
+
+// cacheKey identifies a metric execution by name, its prepared query and its
+// converted query arguments (plus any pagination arguments).
+// Using the converted arguments means requests that differ only in undeclared
+// query parameters share an entry. The query is included because list
+// params change it: ["a"],["b","c"] and ["a","b"],["c"] flatten to the same args.
+func cacheKey(name, query string, args []interface{}) string {
+	return fmt.Sprintf("%s|%s|%#v", name, query, args)
+}
+
+// clear removes every entry.
+func (c *resultCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]cacheEntry)
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+func TestResultCache_Expiry(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := newResultCache()
+	cache.now = func() time.Time { return now }
+
+	cache.set("key", models.MetricResult{Name: "m", Value: int64(42)}, 10*time.Second)
+
+	if r, ok := cache.get("key"); !ok || r.Value != int64(42) {
+		t.Fatalf("get() = %v, %v; want 42, true", r.Value, ok)
+	}
+
+	now = now.Add(9 * time.Second)
+	if _, ok := cache.get("key"); !ok {
+		t.Error("entry expired before its TTL")
+	}
+
+	now = now.Add(time.Second)
+	if _, ok := cache.get("key"); ok {
+		t.Error("entry still present at its TTL")
+	}
+}
+
+func TestResultCache_SweepRemovesExpired(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := newResultCache()
+	cache.now = func() time.Time { return now }
+
+	cache.set("stale", models.MetricResult{Value: int64(1)}, time.Second)
+
+	now = now.Add(2 * sweepInterval)
+	cache.set("fresh", models.MetricResult{Value: int64(2)}, time.Minute)
+
+	if _, ok := cache.entries["stale"]; ok {
+		t.Error("expired entry was not swept")
+	}
+	if _, ok := cache.entries["fresh"]; !ok {
+		t.Error("fresh entry missing after sweep")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	a := cacheKey("metric", "SELECT ?", []interface{}{int64(1), "x"})
+	b := cacheKey("metric", "SELECT ?", []interface{}{int64(1), "x"})
+	c := cacheKey("metric", "SELECT ?", []interface{}{int64(2), "x"})
+	d := cacheKey("other", "SELECT ?", []interface{}{int64(1), "x"})
+	e := cacheKey("metric", "SELECT ?, ?", []interface{}{int64(1), "x"})
+
+	if a != b {
+		t.Errorf("identical inputs produced different keys: %q vs %q", a, b)
+	}
+	if a == c {
+		t.Error("different args produced the same key")
+	}
+	if a == d {
+		t.Error("different metric names produced the same key")
+	}
+	if a == e {
+		t.Error("different queries produced the same key")
+	}
+}
@@ -0,0 +1,63 @@
+// Expands a request's range shorthand into a metric's date params.
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+var errInvalidRange = errors.New(`must be "today", "this_month" or a number of days such as "7d"`)
+
+// parseRange returns the first and last day, inclusive, of a range relative
+// to now: "today", "this_month" from the first of the month to today, or
+// "Nd" for the N days ending today. Days are in now's location, so the
+// server's time zone decides when today starts.
+func parseRange(spec string, now time.Time) (from, to time.Time, err error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch spec {
+	case "today":
+		return today, today, nil
+	case "this_month":
+		return today.AddDate(0, 0, 1-today.Day()), today, nil
+	}
+	if n, ok := strings.CutSuffix(spec, "d"); ok {
+		if days, err := strconv.Atoi(n); err == nil && days >= 1 && days <= maxGapFillDays {
+			return today.AddDate(0, 0, 1-days), today, nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid range %q: %w", spec, errInvalidRange)
+}
+
+// withRange returns params with the metric's range params set from spec.
+// A param the request gives itself is kept, so a client can still pin one
+// end of the range. The spec is checked even for metrics without a range
+// setting, which otherwise ignore it as single-value metrics ignore limit.
+func (ms *MetricService) withRange(metric models.Metric, params map[string]string, spec string) (map[string]string, error) {
+	if spec == "" {
+		return params, nil
+	}
+	from, to, err := parseRange(spec, ms.now())
+	if err != nil {
+		return nil, classify(ErrParamInvalid, err)
+	}
+	if metric.Range == nil {
+		return params, nil
+	}
+
+	expanded := make(map[string]string, len(params)+2)
+	for name, value := range params {
+		expanded[name] = value
+	}
+	for name, day := range map[string]time.Time{metric.Range.From: from, metric.Range.To: to} {
+		def, _ := metric.GetParamByName(name)
+		if _, ok, _ := def.Lookup(params); !ok {
+			expanded[name] = day.Format(time.DateOnly)
+		}
+	}
+	return expanded, nil
+}
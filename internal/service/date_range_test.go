@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+func TestParseRange(t *testing.T) {
+	now := time.Date(2025, 3, 18, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		spec     string
+		wantFrom string
+		wantTo   string
+		wantErr  bool
+	}{
+		{spec: "7d", wantFrom: "2025-03-12", wantTo: "2025-03-18"},
+		{spec: "30d", wantFrom: "2025-02-17", wantTo: "2025-03-18"},
+		{spec: "1d", wantFrom: "2025-03-18", wantTo: "2025-03-18"},
+		{spec: "today", wantFrom: "2025-03-18", wantTo: "2025-03-18"},
+		{spec: "this_month", wantFrom: "2025-03-01", wantTo: "2025-03-18"},
+		{spec: "0d", wantErr: true},
+		{spec: "-7d", wantErr: true},
+		{spec: "7", wantErr: true},
+		{spec: "7D", wantErr: true},
+		{spec: "99999d", wantErr: true},
+		{spec: "last_week", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			from, to, err := parseRange(tt.spec, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseRange(%q) = %v, %v, want an error", tt.spec, from, to)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRange(%q) error = %v", tt.spec, err)
+			}
+			if got := from.Format(time.DateOnly); got != tt.wantFrom {
+				t.Errorf("from = %s, want %s", got, tt.wantFrom)
+			}
+			if got := to.Format(time.DateOnly); got != tt.wantTo {
+				t.Errorf("to = %s, want %s", got, tt.wantTo)
+			}
+		})
+	}
+
+	t.Run("days of now's location", func(t *testing.T) {
+		late := time.Date(2025, 3, 31, 23, 30, 0, 0, time.FixedZone("UTC-5", -5*60*60))
+		from, _, err := parseRange("this_month", late)
+		if err != nil {
+			t.Fatalf("parseRange() error = %v", err)
+		}
+		if got := from.Format(time.DateOnly); got != "2025-03-01" {
+			t.Errorf("from = %s, want 2025-03-01", got)
+		}
+	})
+}
+
+func TestMetricService_GetMetric_Range(t *testing.T) {
+	ranged := models.Metric{
+		Name:  "revenue",
+		Query: "SELECT SUM(amount) FROM orders WHERE day BETWEEN :start_date AND :end_date",
+		Params: []models.ParamDefinition{
+			{Name: "start_date", Type: models.ParamTypeDate, Required: true},
+			{Name: "end_date", Type: models.ParamTypeDate, Required: true, Aliases: []string{"until"}},
+		},
+		Range: &models.DateRange{From: "start_date", To: "end_date"},
+	}
+	unranged := models.Metric{Name: "total_users", Query: "SELECT COUNT(*) FROM users"}
+	computed := models.Metric{Name: "revenue_again", Formula: "revenue"}
+
+	tests := []struct {
+		name     string
+		metric   string
+		params   map[string]string
+		spec     string
+		wantArgs []interface{}
+		wantErr  error
+	}{
+		{name: "last 7 days", metric: "revenue", spec: "7d", wantArgs: []interface{}{"2025-03-12", "2025-03-18"}},
+		{name: "this month", metric: "revenue", spec: "this_month", wantArgs: []interface{}{"2025-03-01", "2025-03-18"}},
+		{
+			name:     "request param wins",
+			metric:   "revenue",
+			params:   map[string]string{"end_date": "2025-03-15"},
+			spec:     "7d",
+			wantArgs: []interface{}{"2025-03-12", "2025-03-15"},
+		},
+		{
+			name:     "request alias wins",
+			metric:   "revenue",
+			params:   map[string]string{"until": "2025-03-15"},
+			spec:     "today",
+			wantArgs: []interface{}{"2025-03-18", "2025-03-15"},
+		},
+		{name: "formula passes range on", metric: "revenue_again", spec: "today", wantArgs: []interface{}{"2025-03-18", "2025-03-18"}},
+		{name: "metric without range ignores it", metric: "total_users", spec: "7d", wantArgs: nil},
+		{name: "no range", metric: "revenue", wantErr: ErrParamMissing},
+		{name: "invalid range", metric: "total_users", spec: "fortnight", wantErr: ErrParamInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &recordingRepository{mockRepository: mockRepository{singleValueResult: int64(1)}}
+			service := NewMetricService(repo, []models.Metric{ranged, unranged, computed}, nil, Options{})
+			service.now = func() time.Time { return time.Date(2025, 3, 18, 9, 0, 0, 0, time.UTC) }
+
+			_, err := service.GetMetric(context.Background(), tt.metric, tt.params, models.QueryOptions{Range: tt.spec})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetMetric() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetMetric() error = %v", err)
+			}
+			if len(repo.args) != 1 || !reflect.DeepEqual(repo.args[0], tt.wantArgs) {
+				t.Errorf("args = %v, want one query with %v", repo.args, tt.wantArgs)
+			}
+		})
+	}
+}
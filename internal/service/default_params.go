@@ -0,0 +1,39 @@
+// Fills metric params from the deployment-wide defaults in the config.
+package service
+
+import "github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+
+// withDefaults returns params with the configured default params added for
+// each param the metric declares that the request does not give, under its
+// name or an alias. A default thus stands in for the request, taking
+// precedence over the param's own default.
+func (ms *MetricService) withDefaults(metric models.Metric, params map[string]string) map[string]string {
+	ms.mu.RLock()
+	defaults := ms.defaultParams
+	ms.mu.RUnlock()
+	if len(defaults) == 0 {
+		return params
+	}
+
+	var merged map[string]string
+	for _, def := range metric.Params {
+		value, ok := defaults[def.Name]
+		if !ok {
+			continue
+		}
+		if _, given, _ := def.Lookup(params); given {
+			continue
+		}
+		if merged == nil {
+			merged = make(map[string]string, len(params)+1)
+			for name, v := range params {
+				merged[name] = v
+			}
+		}
+		merged[def.Name] = value
+	}
+	if merged == nil {
+		return params
+	}
+	return merged
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+func TestMetricService_GetMetric_DefaultParams(t *testing.T) {
+	orders := models.Metric{
+		Name:  "orders",
+		Query: "SELECT COUNT(*) FROM orders WHERE tenant_id = :tenant_id AND status = :status",
+		Params: []models.ParamDefinition{
+			{Name: "tenant_id", Type: models.ParamTypeInt, Required: true, Aliases: []string{"tenant"}},
+			{Name: "status", Type: models.ParamTypeString, Default: "paid"},
+		},
+	}
+	users := models.Metric{Name: "users", Query: "SELECT COUNT(*) FROM users"}
+	computed := models.Metric{Name: "orders_again", Formula: "orders"}
+
+	tests := []struct {
+		name     string
+		defaults map[string]string
+		metric   string
+		params   map[string]string
+		wantArgs []interface{}
+		wantErr  error
+	}{
+		{name: "default applied", defaults: map[string]string{"tenant_id": "7"}, metric: "orders", wantArgs: []interface{}{int64(7), "paid"}},
+		{name: "request overrides", defaults: map[string]string{"tenant_id": "7"}, metric: "orders", params: map[string]string{"tenant_id": "9"}, wantArgs: []interface{}{int64(9), "paid"}},
+		{name: "request alias overrides", defaults: map[string]string{"tenant_id": "7"}, metric: "orders", params: map[string]string{"tenant": "9"}, wantArgs: []interface{}{int64(9), "paid"}},
+		{name: "over the param's own default", defaults: map[string]string{"tenant_id": "7", "status": "refunded"}, metric: "orders", wantArgs: []interface{}{int64(7), "refunded"}},
+		{name: "formula dependency", defaults: map[string]string{"tenant_id": "7"}, metric: "orders_again", wantArgs: []interface{}{int64(7), "paid"}},
+		{name: "undeclared param ignored", defaults: map[string]string{"tenant_id": "7"}, metric: "users", wantArgs: nil},
+		{name: "no defaults", metric: "orders", wantErr: ErrParamMissing},
+		{name: "invalid default", defaults: map[string]string{"tenant_id": "acme"}, metric: "orders", wantErr: ErrParamInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &recordingRepository{mockRepository: mockRepository{singleValueResult: int64(1)}}
+			service := NewMetricService(repo, []models.Metric{orders, users, computed}, nil, Options{DefaultParams: tt.defaults})
+
+			_, err := service.GetMetric(context.Background(), tt.metric, tt.params, models.QueryOptions{})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("GetMetric() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetMetric() error = %v", err)
+			}
+			if len(repo.args) != 1 || !reflect.DeepEqual(repo.args[0], tt.wantArgs) {
+				t.Errorf("args = %v, want one query with %v", repo.args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestMetricService_Refresh_DefaultParams(t *testing.T) {
+	orders := models.Metric{
+		Name:            "orders",
+		Query:           "SELECT COUNT(*) FROM orders WHERE tenant_id = ?",
+		Params:          []models.ParamDefinition{{Name: "tenant_id", Type: models.ParamTypeInt, Default: "1"}},
+		CacheTTL:        time.Minute,
+		RefreshInterval: time.Second,
+	}
+	repo := &recordingRepository{mockRepository: mockRepository{singleValueResult: int64(1)}}
+	service := NewMetricService(repo, []models.Metric{orders}, nil, Options{DefaultParams: map[string]string{"tenant_id": "7"}})
+
+	if err := service.refresh(context.Background(), orders); err != nil {
+		t.Fatalf("refresh() error = %v", err)
+	}
+	if _, err := service.GetMetric(context.Background(), "orders", nil, models.QueryOptions{}); err != nil {
+		t.Fatalf("GetMetric() error = %v", err)
+	}
+	if len(repo.args) != 1 || !reflect.DeepEqual(repo.args[0], []interface{}{int64(7)}) {
+		t.Errorf("args = %v, want one refresh query with the default, then a cache hit", repo.args)
+	}
+}
+
+func TestMetricService_Reload_DefaultParams(t *testing.T) {
+	orders := models.Metric{
+		Name:   "orders",
+		Query:  "SELECT COUNT(*) FROM orders WHERE tenant_id = ?",
+		Params: []models.ParamDefinition{{Name: "tenant_id", Type: models.ParamTypeInt, Required: true}},
+	}
+	repo := &recordingRepository{mockRepository: mockRepository{singleValueResult: int64(1)}}
+	service := NewMetricService(repo, []models.Metric{orders}, nil, Options{DefaultParams: map[string]string{"tenant_id": "7"}})
+
+	service.ReloadMetrics([]models.Metric{orders})
+	if _, err := service.GetMetric(context.Background(), "orders", nil, models.QueryOptions{}); err != nil {
+		t.Fatalf("GetMetric() after ReloadMetrics error = %v", err)
+	}
+
+	service.Reload([]models.Metric{orders}, map[string]string{"tenant_id": "9"})
+	if _, err := service.GetMetric(context.Background(), "orders", nil, models.QueryOptions{}); err != nil {
+		t.Fatalf("GetMetric() after Reload error = %v", err)
+	}
+
+	service.Reload([]models.Metric{orders}, nil)
+	if _, err := service.GetMetric(context.Background(), "orders", nil, models.QueryOptions{}); !errors.Is(err, ErrParamMissing) {
+		t.Errorf("GetMetric() without defaults error = %v, want ErrParamMissing", err)
+	}
+
+	want := [][]interface{}{{int64(7)}, {int64(9)}}
+	if !reflect.DeepEqual(repo.args, want) {
+		t.Errorf("args = %v, want %v", repo.args, want)
+	}
+}
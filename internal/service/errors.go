@@ -0,0 +1,67 @@
+// Sentinel errors that let callers classify service failures.
+package service
+
+import (
+	"errors"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+var (
+	// ErrMetricNotFound is returned when a requested metric is not configured.
+	ErrMetricNotFound = errors.New("metric not found")
+	// ErrMetricDisabled is returned when a requested metric is configured
+	// but set to enabled = false.
+	ErrMetricDisabled = errors.New("metric disabled")
+	// ErrForbidden is returned when the request's API key lacks a scope
+	// the metric requires.
+	ErrForbidden = errors.New("forbidden")
+	// ErrParamMissing is returned when a parameter the query needs is absent.
+	ErrParamMissing = errors.New("parameter missing")
+	// ErrParamInvalid is returned when a request value fails validation,
+	// whether a metric parameter or a request option such as limit.
+	ErrParamInvalid = errors.New("parameter invalid")
+	// ErrResultTooLarge is returned when a result exceeds Options.MaxRows.
+	ErrResultTooLarge = errors.New("result too large")
+	// ErrQueryFailed is returned when the database rejects or fails a
+	// metric's query, e.g. for a missing column, rather than it returning
+	// no rows or the request ending first.
+	ErrQueryFailed = errors.New("query failed")
+)
+
+// classifiedError tags an error with a sentinel for errors.Is while keeping
+// the original message, which already describes the problem to clients.
+type classifiedError struct {
+	err  error
+	kind error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() []error {
+	return []error{e.err, e.kind}
+}
+
+func classify(kind, err error) error {
+	return &classifiedError{err: err, kind: kind}
+}
+
+// MissingParamError is the ErrParamMissing failure for one absent param. It
+// carries the metric's whole param spec so a client can see every param the
+// metric takes, not only the first one it left out.
+type MissingParamError struct {
+	Metric string
+	Param  string
+	Params []models.ParamDefinition
+	Err    error
+}
+
+func (e *MissingParamError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *MissingParamError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,104 @@
+// Fills days missing from multi-row results with zero-valued rows.
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+// maxGapFillDays bounds the filled range so a careless from/to pair cannot
+// build millions of rows before MaxRows is checked.
+const maxGapFillDays = 3660
+
+// fillGaps applies the metric's GapFill to rows, using the request's values
+// (or defaults) for the range params, which prepareParams has validated.
+// Rows are expected in ascending day order, as the query should sort them;
+// a filled row is inserted before the first row with a later day.
+func (ms *MetricService) fillGaps(metric models.Metric, params map[string]string, value interface{}) (interface{}, error) {
+	rows, ok := value.([]map[string]interface{})
+	if !ok {
+		return value, nil
+	}
+	fill := metric.FillGaps
+
+	from, err := rangeDay(metric, params, fill.From)
+	if err != nil {
+		return nil, err
+	}
+	to, err := rangeDay(metric, params, fill.To)
+	if err != nil {
+		return nil, err
+	}
+	if to.Sub(from) > maxGapFillDays*24*time.Hour {
+		return nil, classify(ErrParamInvalid, fmt.Errorf("metric %q: fill_gaps range cannot exceed %d days", metric.Name, maxGapFillDays))
+	}
+
+	var columns []string
+	if len(rows) > 0 {
+		for col := range rows[0] {
+			columns = append(columns, col)
+		}
+	}
+	blank := func(day time.Time) map[string]interface{} {
+		row := make(map[string]interface{}, len(columns)+len(fill.Values)+1)
+		for _, col := range columns {
+			row[col] = nil
+		}
+		for _, col := range fill.Values {
+			row[col] = int64(0)
+		}
+		row[fill.Column] = day.Format(time.DateOnly)
+		return row
+	}
+
+	filled := make([]map[string]interface{}, 0, len(rows))
+	next := from
+	for _, row := range rows {
+		if day, ok := rowDay(row[fill.Column]); ok {
+			for ; next.Before(day) && !next.After(to); next = next.AddDate(0, 0, 1) {
+				filled = append(filled, blank(next))
+			}
+			if !next.After(day) {
+				next = day.AddDate(0, 0, 1)
+			}
+		}
+		filled = append(filled, row)
+	}
+	for ; !next.After(to); next = next.AddDate(0, 0, 1) {
+		filled = append(filled, blank(next))
+	}
+	return filled, nil
+}
+
+// rangeDay returns the day given by the named date param, or its default.
+func rangeDay(metric models.Metric, params map[string]string, name string) (time.Time, error) {
+	def, _ := metric.GetParamByName(name)
+	raw, ok, _ := def.Lookup(params)
+	if !ok {
+		raw = def.Default
+	}
+	converted, err := convertParamValue(raw, models.ParamTypeDate)
+	if err != nil {
+		return time.Time{}, classify(ErrParamInvalid, fmt.Errorf("metric %q: parameter %q: %w", metric.Name, name, err))
+	}
+	day, _ := rowDay(converted)
+	return day, nil
+}
+
+// rowDay extracts the calendar day from a date column, which drivers return
+// as time.Time or as text beginning YYYY-MM-DD.
+func rowDay(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC), true
+	case string:
+		if len(v) < len(time.DateOnly) {
+			return time.Time{}, false
+		}
+		day, err := time.Parse(time.DateOnly, v[:len(time.DateOnly)])
+		return day, err == nil
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+func dailySignupsMetric() models.Metric {
+	return models.Metric{
+		Name:     "daily_signups",
+		Query:    "SELECT date(created) AS day, COUNT(*) AS signups, MAX(plan) AS plan FROM users WHERE created BETWEEN ? AND ? GROUP BY day ORDER BY day",
+		MultiRow: true,
+		Params: []models.ParamDefinition{
+			{Name: "from", Type: models.ParamTypeDate, Required: true},
+			{Name: "to", Type: models.ParamTypeDate, Default: "2025-01-05"},
+		},
+		FillGaps: &models.GapFill{Column: "day", Values: []string{"signups"}, From: "from", To: "to"},
+	}
+}
+
+func TestMetricService_GetMetric_FillGaps(t *testing.T) {
+	tests := []struct {
+		name   string
+		rows   []map[string]interface{}
+		params map[string]string
+		want   []string
+	}{
+		{
+			name: "fills before, between and after rows",
+			rows: []map[string]interface{}{
+				{"day": "2025-01-02", "signups": int64(4), "plan": "pro"},
+				{"day": "2025-01-04", "signups": int64(1), "plan": "free"},
+			},
+			params: map[string]string{"from": "2025-01-01"},
+			want:   []string{"2025-01-01", "2025-01-02", "2025-01-03", "2025-01-04", "2025-01-05"},
+		},
+		{
+			name:   "no rows",
+			rows:   []map[string]interface{}{},
+			params: map[string]string{"from": "2025-01-01", "to": "2025-01-03"},
+			want:   []string{"2025-01-01", "2025-01-02", "2025-01-03"},
+		},
+		{
+			name: "timestamps and rows outside the range",
+			rows: []map[string]interface{}{
+				{"day": time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC), "signups": int64(9), "plan": nil},
+				{"day": "2025-01-02 00:00:00", "signups": int64(4), "plan": nil},
+			},
+			params: map[string]string{"from": "2025-01-01", "to": "2025-01-02"},
+			want:   []string{"2024-12-31", "2025-01-01", "2025-01-02"},
+		},
+		{
+			name:   "empty range",
+			rows:   []map[string]interface{}{},
+			params: map[string]string{"from": "2025-01-03", "to": "2025-01-01"},
+			want:   []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewMetricService(&mockRepository{multiRowResult: tt.rows}, []models.Metric{dailySignupsMetric()}, nil, Options{})
+
+			results, err := service.GetMetric(context.Background(), "daily_signups", tt.params, models.QueryOptions{})
+			if err != nil {
+				t.Fatalf("GetMetric() error = %v", err)
+			}
+			rows := results[0].Value.([]map[string]interface{})
+
+			days := make([]string, len(rows))
+			for i, row := range rows {
+				day, _ := rowDay(row["day"])
+				days[i] = day.Format(time.DateOnly)
+			}
+			if !reflect.DeepEqual(days, tt.want) {
+				t.Errorf("days = %v, want %v", days, tt.want)
+			}
+		})
+	}
+
+	t.Run("filled rows", func(t *testing.T) {
+		rows := []map[string]interface{}{{"day": "2025-01-02", "signups": int64(4), "plan": "pro"}}
+		service := NewMetricService(&mockRepository{multiRowResult: rows}, []models.Metric{dailySignupsMetric()}, nil, Options{})
+
+		results, err := service.GetMetric(context.Background(), "daily_signups", map[string]string{"from": "2025-01-01", "to": "2025-01-02"}, models.QueryOptions{})
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		want := []map[string]interface{}{
+			{"day": "2025-01-01", "signups": int64(0), "plan": nil},
+			{"day": "2025-01-02", "signups": int64(4), "plan": "pro"},
+		}
+		if got := results[0].Value; !reflect.DeepEqual(got, want) {
+			t.Errorf("Value = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestMetricService_GetMetric_FillGapsRejected(t *testing.T) {
+	service := NewMetricService(&mockRepository{multiRowResult: []map[string]interface{}{}}, []models.Metric{dailySignupsMetric()}, nil, Options{MaxRows: 10})
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		opts    models.QueryOptions
+		wantErr error
+	}{
+		{name: "paginated", params: map[string]string{"from": "2025-01-01"}, opts: models.QueryOptions{Limit: 2}, wantErr: ErrParamInvalid},
+		{name: "range too long", params: map[string]string{"from": "1900-01-01"}, wantErr: ErrParamInvalid},
+		{name: "more days than MaxRows", params: map[string]string{"from": "2024-01-01"}, wantErr: ErrResultTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.GetMetric(context.Background(), "daily_signups", tt.params, tt.opts); !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetMetric() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	err := service.StreamMetric(context.Background(), "daily_signups", map[string]string{"from": "2025-01-01"}, models.QueryOptions{}, func(map[string]interface{}) error { return nil })
+	if !errors.Is(err, ErrParamInvalid) {
+		t.Errorf("StreamMetric() error = %v, want ErrParamInvalid", err)
+	}
+}
@@ -0,0 +1,34 @@
+// Prometheus counters and histograms for metric query execution.
+package service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricQueriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dashboard_metric_queries_total",
+			Help: "Number of database queries executed per metric.",
+		},
+		[]string{"metric"},
+	)
+
+	metricQueryFailuresTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dashboard_metric_query_failures_total",
+			Help: "Number of failed database queries per metric.",
+		},
+		[]string{"metric"},
+	)
+
+	metricQueryDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "dashboard_metric_query_duration_seconds",
+			Help:    "Duration of database queries per metric.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"metric"},
+	)
+)
@@ -3,104 +3,976 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/formula"
 	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
 	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/repository"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/sqlutil"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
+// Options tunes MetricService behaviour. The zero value applies no limits.
+type Options struct {
+	// MaxRows caps the rows a multi-row metric may return; 0 means unlimited.
+	MaxRows int
+
+	// MaxConcurrency caps how many metrics of one batch run at once, so a
+	// large batch cannot exhaust the connection pool; 0 means unlimited.
+	MaxConcurrency int
+
+	// Retries is how many more times a query failing with a transient error
+	// (see repository.IsTransient) is attempted. RetryDelay is the wait
+	// before the first retry, doubling for each one after.
+	Retries    int
+	RetryDelay time.Duration
+
+	// StrictParams rejects requests carrying params that none of the
+	// requested metrics declare, so a misspelt name fails instead of being
+	// silently ignored.
+	StrictParams bool
+
+	// MetricTimeout bounds each metric of a batch separately, so in a
+	// partial request one slow query fails alone while the rest are
+	// returned; 0 leaves only the request's own deadline.
+	MetricTimeout time.Duration
+
+	// AuditLogger, when set, receives a record of every metric requested;
+	// see audit.
+	AuditLogger *slog.Logger
+
+	// DataSources holds the repositories for metrics that set data_source,
+	// by name. Other metrics use the repository passed to NewMetricService.
+	DataSources map[string]repository.Repository
+
+	// DefaultParams are given to every metric declaring a param of the same
+	// name, unless the request gives its own value; see withDefaults. Reload
+	// replaces them.
+	DefaultParams map[string]string
+}
+
 // MetricService orchestrates metric queries between HTTP handlers and the repository.
 type MetricService struct {
-	repo    repository.Repository
-	metrics map[string]models.Metric
-	logger  *slog.Logger
+	repo   repository.Repository
+	logger *slog.Logger
+	cache  *resultCache
+	opts   Options
+	now    func() time.Time
+
+	// mu guards metrics and defaultParams, which reloads replace while
+	// requests run, and generation, which counts the replacements.
+	mu            sync.RWMutex
+	metrics       map[string]models.Metric
+	defaultParams map[string]string
+	generation    int
 }
 
 // NewMetricService creates a new MetricService with the given repository and metrics.
 // It builds a map for efficient O(1) metric lookup by name.
-func NewMetricService(repo repository.Repository, metricsList []models.Metric, logger *slog.Logger) *MetricService {
-	metricsMap := make(map[string]models.Metric)
-	for _, m := range metricsList {
-		metricsMap[m.Name] = m
+// A nil logger discards all log output.
+func NewMetricService(repo repository.Repository, metricsList []models.Metric, logger *slog.Logger, opts Options) *MetricService {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
 	}
 
 	return &MetricService{
-		repo:    repo,
-		metrics: metricsMap,
-		logger:  logger,
+		repo:          repo,
+		metrics:       metricsByName(metricsList),
+		defaultParams: opts.DefaultParams,
+		logger:        logger,
+		cache:         newResultCache(),
+		opts:          opts,
+		now:           time.Now,
+	}
+}
+
+// ReloadMetrics atomically replaces the set of served metrics, keeping the
+// default params. Requests already executing finish with the definitions
+// they started with. Cached results are dropped since their queries may
+// have changed.
+func (ms *MetricService) ReloadMetrics(metricsList []models.Metric) {
+	metrics := metricsByName(metricsList)
+
+	ms.mu.Lock()
+	ms.metrics = metrics
+	ms.generation++
+	ms.mu.Unlock()
+
+	ms.cache.clear()
+}
+
+// Reload is ReloadMetrics that also replaces the default params, so that
+// a reloaded configuration file takes effect as a whole.
+func (ms *MetricService) Reload(metricsList []models.Metric, defaultParams map[string]string) {
+	metrics := metricsByName(metricsList)
+
+	ms.mu.Lock()
+	ms.metrics = metrics
+	ms.defaultParams = defaultParams
+	ms.generation++
+	ms.mu.Unlock()
+
+	ms.cache.clear()
+}
+
+func metricsByName(metricsList []models.Metric) map[string]models.Metric {
+	metrics := make(map[string]models.Metric, len(metricsList))
+	for _, m := range metricsList {
+		metrics[m.Name] = m
 	}
+	return metrics
 }
 
-// GetMetricNames returns a slice of all available metric names.
+// repoFor returns the repository a metric queries. Data sources are only
+// connected at startup, so a reload can name one that is not available.
+func (ms *MetricService) repoFor(metric models.Metric) (repository.Repository, error) {
+	if metric.DataSource == "" {
+		return ms.repo, nil
+	}
+	repo, ok := ms.opts.DataSources[metric.DataSource]
+	if !ok {
+		return nil, fmt.Errorf("data source %q is not connected; restart the server to add data sources", metric.DataSource)
+	}
+	return repo, nil
+}
+
+// lookup returns the metric definition for name.
+func (ms *MetricService) lookup(name string) (models.Metric, bool) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	m, ok := ms.metrics[name]
+	return m, ok
+}
+
+// find returns the metric definition for name, failing with ErrMetricNotFound
+// or, for a metric set to enabled = false, ErrMetricDisabled.
+func (ms *MetricService) find(name string) (models.Metric, error) {
+	metric, ok := ms.lookup(name)
+	if !ok {
+		return models.Metric{}, classify(ErrMetricNotFound, fmt.Errorf("metric %q not found", name))
+	}
+	if !metric.IsEnabled() {
+		return models.Metric{}, classify(ErrMetricDisabled, fmt.Errorf("metric %q is disabled", name))
+	}
+	return metric, nil
+}
+
+// GetMetricNames returns a slice of all enabled metric names.
 func (ms *MetricService) GetMetricNames() []string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
 	names := make([]string, 0, len(ms.metrics))
-	for name := range ms.metrics {
-		names = append(names, name)
+	for name, m := range ms.metrics {
+		if m.IsEnabled() {
+			names = append(names, name)
+		}
 	}
 	return names
 }
 
+// IsSensitiveParam reports whether any metric marks the parameter name, or
+// a param it is an alias of, as sensitive. Request logs use it because they
+// see params before any metric has claimed them.
+func (ms *MetricService) IsSensitiveParam(name string) bool {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	for _, m := range ms.metrics {
+		for _, p := range m.Params {
+			if p.Sensitive && (p.Name == name || slices.Contains(p.Aliases, name)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ListMetrics returns the catalog of enabled metrics passing the options'
+// tag filter, sorted by name. Metrics ctx lacks the scopes to read are left
+// out, so a scoped key does not learn what they are.
+func (ms *MetricService) ListMetrics(ctx context.Context, opts models.ListOptions) []models.MetricInfo {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	infos := make([]models.MetricInfo, 0, len(ms.metrics))
+	for _, m := range ms.metrics {
+		if m.IsEnabled() && opts.Matches(m.Tags) && authorize(ctx, m) == nil {
+			infos = append(infos, m.Info())
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// GetMetricSchema describes a metric's params and, for multi-row metrics,
+// the columns it returns. Columns come from running the query wrapped in
+// LIMIT 0, with each param bound to its default or NULL, so no rows are read.
+func (ms *MetricService) GetMetricSchema(ctx context.Context, name string) (models.MetricSchema, error) {
+	metric, err := ms.find(name)
+	if err != nil {
+		return models.MetricSchema{}, err
+	}
+	if err := authorize(ctx, metric); err != nil {
+		return models.MetricSchema{}, err
+	}
+
+	schema := models.MetricSchema{MetricInfo: metric.Info()}
+	if !metric.MultiRow {
+		return schema, nil
+	}
+
+	columns, err := ms.probeColumns(ctx, metric)
+	if err != nil {
+		return models.MetricSchema{}, fmt.Errorf("metric %q schema: %w", metric.Name, err)
+	}
+	schema.Columns = columns
+
+	return schema, nil
+}
+
+// ValidateQueries runs every enabled query metric wrapped in LIMIT 0 against its
+// database, so typos and missing tables or columns surface before serving
+// rather than as errors on first request. It reports every failing metric.
+func (ms *MetricService) ValidateQueries(ctx context.Context) error {
+	names := ms.GetMetricNames()
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		metric, ok := ms.lookup(name)
+		if !ok || metric.IsComputed() {
+			continue
+		}
+		if _, err := ms.probeColumns(ctx, metric); err != nil {
+			errs = append(errs, fmt.Errorf("metric %q: %w", metric.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// probeColumns runs the metric's query wrapped in LIMIT 0, with params bound
+// as schemaArgs describes, returning its column names without reading rows.
+func (ms *MetricService) probeColumns(ctx context.Context, metric models.Metric) ([]string, error) {
+	repo, err := ms.repoFor(metric)
+	if err != nil {
+		return nil, err
+	}
+
+	query, args := schemaArgs(metric)
+	inner := strings.TrimRight(strings.TrimSpace(query), "; \t\n")
+	probe := fmt.Sprintf("SELECT * FROM (%s) AS probed LIMIT 0", inner)
+
+	return repo.QueryColumns(ctx, probe, args...)
+}
+
+// schemaArgs binds every param to its default, or nil when it has none, so
+// the query can run without a caller supplying values. Only the shape of
+// the result matters, not which rows would match.
+func schemaArgs(metric models.Metric) (string, []interface{}) {
+	query, names := sqlutil.ParseNamed(metric.Query)
+
+	args := make([]interface{}, len(metric.Params))
+	values := make(map[string]interface{}, len(metric.Params))
+	for i, paramDef := range metric.Params {
+		if paramDef.Default != "" {
+			if v, err := paramDef.Type.Convert(paramDef.Default); err == nil {
+				args[i] = v
+			}
+		}
+		values[paramDef.Name] = args[i]
+	}
+
+	if len(names) > 0 {
+		args = make([]interface{}, len(names))
+		for i, name := range names {
+			args[i] = values[name]
+		}
+	}
+
+	return query, args
+}
+
 // GetMetric executes a single metric query with optional parameters.
 // Returns a slice containing one MetricResult, or an error.
-func (ms *MetricService) GetMetric(ctx context.Context, name string, params map[string]string) ([]models.MetricResult, error) {
-	metric, exists := ms.metrics[name]
-	if !exists {
-		return nil, fmt.Errorf("metric %q not found", name)
+func (ms *MetricService) GetMetric(ctx context.Context, name string, params map[string]string, opts models.QueryOptions) (results []models.MetricResult, err error) {
+	ctx, span := startMetricSpan(ctx, "metric", name)
+	defer func() { endSpan(span, err) }()
+
+	return ms.getMetric(ctx, name, params, opts)
+}
+
+// getMetric is GetMetric within its span.
+func (ms *MetricService) getMetric(ctx context.Context, name string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+	metric, err := ms.find(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, metric); err != nil {
+		return nil, err
+	}
+	ms.audit(ctx, metric, params)
+
+	if err := opts.Validate(); err != nil {
+		return nil, classify(ErrParamInvalid, err)
+	}
+	params, err = ms.withRange(metric, params, opts.Range)
+	if err != nil {
+		return nil, err
+	}
+	params = ms.withDefaults(metric, params)
+
+	if metric.IsComputed() {
+		return ms.compute(ctx, metric, params, opts)
 	}
 
 	// Prepare and validate parameters
-	args, err := ms.prepareParams(metric, params)
+	query, args, err := ms.prepareParams(metric, params)
 	if err != nil {
 		return nil, err
 	}
+	metric.Query = query
 
-	var value interface{}
+	// A single_row metric ignores limit and offset, as single values do.
+	paginated := metric.MultiRow && !metric.SingleRow && opts.Paginated()
+	if paginated && metric.FillGaps != nil {
+		return nil, classify(ErrParamInvalid, fmt.Errorf("metric %q fills gaps in its rows and cannot be paginated", metric.Name))
+	}
+
+	var key string
+	if metric.CacheTTL > 0 {
+		keyArgs := args
+		if paginated {
+			keyArgs = append(keyArgs[:len(keyArgs):len(keyArgs)], opts.Limit, opts.Offset)
+		}
+		key = cacheKey(metric.Name, metric.Query, keyArgs)
+		if result, ok := ms.cache.get(key); ok {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("metric.cache_hit", true))
+			if opts.OmitNulls {
+				result.Value = withoutNulls(result.Value)
+			}
+			return []models.MetricResult{result}, nil
+		}
+	}
+
+	result, elapsed, err := ms.run(ctx, metric, params, args, paginated, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// A degraded result is not cached, so the next request tries the
+	// primary query again.
+	if metric.CacheTTL > 0 && !result.Degraded {
+		ms.cache.set(key, result, metric.CacheTTL)
+	}
+	if opts.OmitNulls {
+		result.Value = withoutNulls(result.Value)
+	}
+
+	// Set after caching so a later cache hit, which does no query, has none.
+	if opts.Debug {
+		d := durationMS(elapsed)
+		result.DurationMS = &d
+	}
+
+	return []models.MetricResult{result}, nil
+}
+
+// run executes a query metric whose params are already prepared, returning
+// its result and how long the query took. Caching is left to the caller.
+func (ms *MetricService) run(ctx context.Context, metric models.Metric, params map[string]string, args []interface{}, paginated bool, opts models.QueryOptions) (models.MetricResult, time.Duration, error) {
+	start := time.Now()
+	result := newResult(metric, start.UTC())
+	err := ms.query(ctx, &result, metric, args, paginated, opts)
+	if err != nil && metric.FallbackQuery != "" && !errors.Is(err, repository.ErrNoRows) && ctx.Err() == nil {
+		err = ms.queryFailure(ctx, metric, err)
+		ms.logger.Warn("metric query failed, using fallback_query", "metric", metric.Name, "error", err)
+		metric.Query = metric.FallbackQuery
+		if metric.Query, args, err = ms.prepareParams(metric, params); err != nil {
+			return models.MetricResult{}, 0, err
+		}
+		err = ms.query(ctx, &result, metric, args, paginated, opts)
+		result.Degraded = true
+	}
+	elapsed := time.Since(start)
+	ms.logger.Debug("metric query finished", "metric", metric.Name, "duration_ms", durationMS(elapsed), "failed", err != nil)
+	if err != nil {
+		return models.MetricResult{}, 0, ms.queryFailure(ctx, metric, err)
+	}
+	convertRows(metric, result.Value)
+	if metric.SingleRow {
+		result.Value = firstRow(result.Value)
+	}
+	if metric.FillGaps != nil {
+		if result.Value, err = ms.fillGaps(metric, params, result.Value); err != nil {
+			return models.MetricResult{}, 0, err
+		}
+	}
+	if err := ms.checkRows(metric, result.Value); err != nil {
+		return models.MetricResult{}, 0, err
+	}
+	if result.Value, err = normalizeValue(result.Value, metric.ValueType); err != nil {
+		return models.MetricResult{}, 0, fmt.Errorf("metric %q: %w", metric.Name, err)
+	}
+
+	return result, elapsed, nil
+}
+
+// query runs metric's query, or one page of it when paginated, setting
+// the value, columns and page of result. Rows beyond the metric's max_rows
+// are cut off, and unless paginated are never read from the database.
+func (ms *MetricService) query(ctx context.Context, result *models.MetricResult, metric models.Metric, args []interface{}, paginated bool, opts models.QueryOptions) (err error) {
+	switch {
+	case paginated:
+		result.Value, result.Columns, result.Page, err = ms.executePage(ctx, metric, args, opts)
+	case metric.SingleRow:
+		first := metric
+		first.Query = fmt.Sprintf("SELECT * FROM (%s) AS first_row LIMIT 1", subquery(metric.Query))
+		result.Value, result.Columns, err = ms.execute(ctx, first, args)
+	case metric.MaxRows > 0:
+		// One row more than the cap shows whether any were left out.
+		capped := metric
+		capped.Query = fmt.Sprintf("SELECT * FROM (%s) AS capped LIMIT ?", subquery(metric.Query))
+		result.Value, result.Columns, err = ms.execute(ctx, capped, append(args[:len(args):len(args)], metric.MaxRows+1))
+	default:
+		result.Value, result.Columns, err = ms.execute(ctx, metric, args)
+	}
+	if rows, ok := result.Value.([]map[string]interface{}); ok && metric.MaxRows > 0 && len(rows) > metric.MaxRows {
+		result.Value, result.Truncated = rows[:metric.MaxRows], true
+	}
+	return err
+}
+
+// firstRow returns the first of a multi-row value's rows, or nil when it has
+// none, so a single_row metric with no rows answers null like a NULL value.
+func firstRow(value interface{}) interface{} {
+	rows, ok := value.([]map[string]interface{})
+	if !ok || len(rows) == 0 {
+		return nil
+	}
+	return rows[0]
+}
+
+// subquery prepares a metric query for wrapping as a subquery, where a
+// trailing semicolon would be a syntax error.
+func subquery(query string) string {
+	return strings.TrimRight(strings.TrimSpace(query), "; \t\n")
+}
 
-	if metric.MultiRow {
-		// Execute multi-row query
-		rows, err := ms.repo.QueryMultiRow(ctx, metric.Query, args...)
+// newResult starts metric's result, carrying the configuration that
+// clients need alongside the value.
+func newResult(metric models.Metric, generatedAt time.Time) models.MetricResult {
+	return models.MetricResult{
+		Name:        metric.Name,
+		Unit:        metric.Unit,
+		Format:      metric.Format,
+		MaxAge:      metric.MaxAge,
+		GeneratedAt: generatedAt,
+	}
+}
+
+// queryFailure wraps a failed query's error with the metric name. Errors the
+// database raised are logged with the SQL that caused them, but never the
+// bound values, which may come from users, and classified as ErrQueryFailed.
+func (ms *MetricService) queryFailure(ctx context.Context, metric models.Metric, err error) error {
+	err = fmt.Errorf("metric %q failed: %w", metric.Name, err)
+
+	var queryErr *repository.QueryError
+	if !errors.As(err, &queryErr) || ctx.Err() != nil {
+		return err
+	}
+	ms.logger.Error("metric query failed", "metric", metric.Name, "op", queryErr.Op, "query", queryErr.Query, "error", queryErr.Err)
+	return classify(ErrQueryFailed, err)
+}
+
+// StreamMetric runs a multi-row metric, passing each row to fn as the
+// database returns it rather than collecting the result. Because rows may
+// already be on their way to the client when something fails, streaming
+// skips the result cache, retries and the MaxRows limit. Of opts, only
+// OmitNulls and Range apply.
+func (ms *MetricService) StreamMetric(ctx context.Context, name string, params map[string]string, opts models.QueryOptions, fn func(row map[string]interface{}) error) (err error) {
+	ctx, span := startMetricSpan(ctx, "stream metric", name)
+	defer func() { endSpan(span, err) }()
+
+	metric, err := ms.find(name)
+	if err != nil {
+		return err
+	}
+	if err := authorize(ctx, metric); err != nil {
+		return err
+	}
+	ms.audit(ctx, metric, params)
+	if !metric.MultiRow {
+		return classify(ErrParamInvalid, fmt.Errorf("metric %q returns a single value; only multi-row metrics can be streamed", name))
+	}
+	if metric.FillGaps != nil {
+		return classify(ErrParamInvalid, fmt.Errorf("metric %q fills gaps in its rows and cannot be streamed", name))
+	}
+	if metric.SingleRow {
+		return classify(ErrParamInvalid, fmt.Errorf("metric %q returns a single row and cannot be streamed", name))
+	}
+	params, err = ms.withRange(metric, params, opts.Range)
+	if err != nil {
+		return err
+	}
+	params = ms.withDefaults(metric, params)
+
+	if ms.opts.StrictParams {
+		if err := ms.checkUnknownParams([]string{name}, params); err != nil {
+			return err
+		}
+	}
+
+	query, args, err := ms.prepareParams(metric, params)
+	if err != nil {
+		return err
+	}
+	metric.Query = query
+
+	repo, err := ms.repoFor(metric)
+	if err != nil {
+		return fmt.Errorf("metric %q failed: %w", metric.Name, err)
+	}
+
+	metric.OmitNulls = metric.OmitNulls || opts.OmitNulls
+	if len(metric.JSONColumns) > 0 || len(metric.BoolColumns) > 0 || metric.OmitNulls {
+		yield := fn
+		fn = func(row map[string]interface{}) error {
+			convertColumns(metric, row)
+			return yield(row)
+		}
+	}
+
+	metricQueriesTotal.WithLabelValues(metric.Name).Inc()
+	start := time.Now()
+	err = repo.QueryRowsStream(ctx, metric.Query, fn, args...)
+	metricQueryDuration.WithLabelValues(metric.Name).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metricQueryFailuresTotal.WithLabelValues(metric.Name).Inc()
+		return ms.queryFailure(ctx, metric, err)
+	}
+	return nil
+}
+
+// convertRows applies convertColumns to each row of a multi-row value.
+func convertRows(metric models.Metric, value interface{}) {
+	rows, ok := value.([]map[string]interface{})
+	if !ok || len(metric.JSONColumns) == 0 && len(metric.BoolColumns) == 0 && !metric.OmitNulls {
+		return
+	}
+	for _, row := range rows {
+		convertColumns(metric, row)
+	}
+}
+
+// convertColumns renders the metric's json_columns and bool_columns in row,
+// and drops its NULL columns when the metric sets omit_nulls.
+func convertColumns(metric models.Metric, row map[string]interface{}) {
+	embedJSON(row, metric.JSONColumns)
+	for _, col := range metric.BoolColumns {
+		if b, err := toBool(row[col]); err == nil {
+			row[col] = b
+		}
+	}
+	if metric.OmitNulls {
+		dropNulls(row)
+	}
+}
+
+// dropNulls deletes the columns of row that are NULL.
+func dropNulls(row map[string]interface{}) {
+	for col, v := range row {
+		if v == nil {
+			delete(row, col)
+		}
+	}
+}
+
+// withoutNulls returns a multi-row or single_row value with NULL columns
+// dropped. Rows are copied rather than changed in place, since the value may
+// be shared with the result cache; anything other than rows is returned
+// as-is.
+func withoutNulls(value interface{}) interface{} {
+	if row, ok := value.(map[string]interface{}); ok {
+		return withoutNulls([]map[string]interface{}{row}).([]map[string]interface{})[0]
+	}
+	rows, ok := value.([]map[string]interface{})
+	if !ok {
+		return value
+	}
+	out := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		out[i] = make(map[string]interface{}, len(row))
+		for col, v := range row {
+			if v != nil {
+				out[i][col] = v
+			}
+		}
+	}
+	return out
+}
+
+// embedJSON replaces text holding valid JSON in the given columns with a
+// json.RawMessage, so it is encoded as-is instead of as a quoted string.
+// Raw JSON, unlike a decoded value, keeps large integers exact. Anything
+// else, including invalid JSON, is left as the database returned it.
+func embedJSON(row map[string]interface{}, columns []string) {
+	for _, col := range columns {
+		if s, ok := row[col].(string); ok && json.Valid([]byte(s)) {
+			row[col] = json.RawMessage(s)
+		}
+	}
+}
+
+// durationMS converts d to fractional milliseconds for logs and responses.
+func durationMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// compute evaluates a formula metric from the values of the metrics it
+// references, which run concurrently with the request's params and range.
+// As in SQL, a NULL operand or a division by zero makes the result null
+// rather than failing the request. Dependency cycles are rejected when
+// config loads.
+func (ms *MetricService) compute(ctx context.Context, metric models.Metric, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+	expr, err := formula.Parse(metric.Formula)
+	if err != nil {
+		return nil, fmt.Errorf("metric %q: %w", metric.Name, err)
+	}
+
+	deps := expr.Vars()
+	values := make([]interface{}, len(deps))
+	generated := make([]time.Time, len(deps))
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	for i, dep := range deps {
+		eg.Go(func() error {
+			results, err := ms.GetMetric(egCtx, dep, params, models.QueryOptions{Range: opts.Range})
+			if err != nil {
+				return err
+			}
+			values[i], generated[i] = results[0].Value, results[0].GeneratedAt
+			return nil
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		return nil, fmt.Errorf("metric %q: %w", metric.Name, err)
+	}
+
+	// A formula is only as fresh as its oldest input, which may be cached.
+	result := newResult(metric, time.Now().UTC())
+	for _, t := range generated {
+		if t.Before(result.GeneratedAt) {
+			result.GeneratedAt = t
+		}
+	}
+
+	vars := make(map[string]float64, len(deps))
+	for i, dep := range deps {
+		if values[i] == nil {
+			return []models.MetricResult{result}, nil
+		}
+		v, err := toFloat64(values[i])
 		if err != nil {
-			return nil, fmt.Errorf("metric %q failed: %w", metric.Name, err)
+			return nil, fmt.Errorf("metric %q: dependency %q: %w", metric.Name, dep, err)
+		}
+		vars[dep] = v
+	}
+
+	value, err := expr.Eval(vars)
+	if errors.Is(err, formula.ErrDivisionByZero) {
+		return []models.MetricResult{result}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("metric %q: %w", metric.Name, err)
+	}
+	if result.Value, err = normalizeValue(value, metric.ValueType); err != nil {
+		return nil, fmt.Errorf("metric %q: %w", metric.Name, err)
+	}
+
+	return []models.MetricResult{result}, nil
+}
+
+// executePage runs a multi-row metric restricted to one page of rows, along
+// with a count of all rows so clients can render pagination controls.
+// The metric query is wrapped as a subquery, so it must not contain its own
+// LIMIT clause for the page to be meaningful.
+func (ms *MetricService) executePage(ctx context.Context, metric models.Metric, args []interface{}, opts models.QueryOptions) (interface{}, []string, *models.Page, error) {
+	inner := subquery(metric.Query)
+
+	countMetric := metric
+	countMetric.MultiRow = false
+	countMetric.Query = fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS counted", inner)
+
+	count, _, err := ms.execute(ctx, countMetric, args)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	total, err := toInt64(count)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("row count: %w", err)
+	}
+
+	pageMetric := metric
+	pageMetric.Query = fmt.Sprintf("SELECT * FROM (%s) AS paged LIMIT ? OFFSET ?", inner)
+	pageArgs := append(args[:len(args):len(args)], opts.Limit, opts.Offset)
+
+	rows, columns, err := ms.execute(ctx, pageMetric, pageArgs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return rows, columns, &models.Page{Limit: opts.Limit, Offset: opts.Offset, Total: total}, nil
+}
+
+// checkRows rejects multi-row results larger than the configured MaxRows,
+// which would otherwise be serialized into an arbitrarily large response.
+// A metric's own max_rows, which truncates instead, takes its place.
+func (ms *MetricService) checkRows(metric models.Metric, value interface{}) error {
+	rows, ok := value.([]map[string]interface{})
+	if !ok || ms.opts.MaxRows <= 0 || metric.MaxRows > 0 || len(rows) <= ms.opts.MaxRows {
+		return nil
+	}
+	return classify(ErrResultTooLarge, fmt.Errorf("metric %q returned %d rows, exceeding the limit of %d; use limit and offset to page through results", metric.Name, len(rows), ms.opts.MaxRows))
+}
+
+// toInt64 converts a scanned numeric database value to int64.
+func toInt64(v interface{}) (int64, error) {
+	switch n := v.(type) {
+	case int64:
+		return n, nil
+	case int:
+		return int64(n), nil
+	case float64:
+		return int64(n), nil
+	case []byte:
+		return strconv.ParseInt(string(n), 10, 64)
+	case string:
+		return strconv.ParseInt(n, 10, 64)
+	default:
+		return 0, fmt.Errorf("unexpected type %T for integer value", v)
+	}
+}
+
+// toFloat64 converts a scanned numeric database value to float64. A bool,
+// from a metric with value_type bool, counts as 1 or 0 in formulas.
+func toFloat64(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case bool:
+		if n {
+			return 1, nil
 		}
-		value = rows
-	} else {
-		// Execute single-value query
-		result, err := ms.repo.QuerySingleValue(ctx, metric.Query, args...)
+		return 0, nil
+	case int64:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case []byte:
+		return strconv.ParseFloat(string(n), 64)
+	case string:
+		return strconv.ParseFloat(n, 64)
+	default:
+		return 0, fmt.Errorf("unexpected type %T for numeric value", v)
+	}
+}
+
+// toBool converts a scanned flag to bool. Numbers are true unless zero, as
+// in SQL; text must be one strconv.ParseBool accepts, such as "1" or "true".
+func toBool(v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case int64:
+		return b != 0, nil
+	case int:
+		return b != 0, nil
+	case float64:
+		return b != 0, nil
+	case []byte:
+		return strconv.ParseBool(string(b))
+	case string:
+		return strconv.ParseBool(b)
+	default:
+		return false, fmt.Errorf("unexpected type %T for boolean value", v)
+	}
+}
+
+// normalizeValue converts a single value to the metric's declared value
+// type, so JSON output does not switch between 5 and 5.5-style encodings as
+// the driver's choice of type varies. Integers round to the nearest whole
+// number. NULL stays nil.
+func normalizeValue(v interface{}, vt models.ValueType) (interface{}, error) {
+	if v == nil || vt == "" {
+		return v, nil
+	}
+
+	if vt == models.ValueTypeBool {
+		b, err := toBool(v)
 		if err != nil {
-			return nil, fmt.Errorf("metric %q failed: %w", metric.Name, err)
+			return nil, fmt.Errorf("value_type %s: %w", vt, err)
+		}
+		return b, nil
+	}
+
+	if vt == models.ValueTypeInt {
+		if n, ok := v.(int64); ok {
+			return n, nil
 		}
-		value = result
 	}
 
-	return []models.MetricResult{
-		{
-			Name:  metric.Name,
-			Value: value,
-		},
-	}, nil
+	f, err := toFloat64(v)
+	if err != nil {
+		return nil, fmt.Errorf("value_type %s: %w", vt, err)
+	}
+	if vt == models.ValueTypeInt {
+		return int64(math.Round(f)), nil
+	}
+	return f, nil
 }
 
-// GetMetrics executes multiple metrics concurrently using errgroup.
-// If any metric fails, returns error immediately (fail-fast).
-// Returns a slice of MetricResult, one per requested metric (if successful).
-func (ms *MetricService) GetMetrics(ctx context.Context, names []string, params map[string]string) ([]models.MetricResult, error) {
-	results := make([]models.MetricResult, len(names))
-	eg, egCtx := errgroup.WithContext(ctx)
+// execute runs the metric's query against the repository, retrying
+// transient failures and substituting DefaultOnEmpty for no rows, and
+// records execution count, failures and duration (including any retries)
+// for Prometheus. Multi-row metrics also return their column names in query
+// order.
+func (ms *MetricService) execute(ctx context.Context, metric models.Metric, args []interface{}) (interface{}, []string, error) {
+	repo, err := ms.repoFor(metric)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metricQueriesTotal.WithLabelValues(metric.Name).Inc()
+	start := time.Now()
+
+	var value interface{}
+	var columns []string
+	for attempt := 0; ; attempt++ {
+		if metric.MultiRow {
+			columns, value, err = repo.QueryMultiRowColumns(ctx, metric.Query, args...)
+		} else {
+			value, err = repo.QuerySingleValue(ctx, metric.Query, args...)
+		}
+		if err == nil || attempt >= ms.opts.Retries || !repository.IsTransient(err) {
+			break
+		}
 
+		delay := ms.opts.RetryDelay << attempt
+		ms.logger.Warn("retrying transient query failure", "metric", metric.Name, "attempt", attempt+1, "delay", delay, "error", err)
+		if !sleep(ctx, delay) {
+			break
+		}
+	}
+
+	metricQueryDuration.WithLabelValues(metric.Name).Observe(time.Since(start).Seconds())
+
+	// With a default configured, no rows is an expected answer rather
+	// than a failure.
+	if errors.Is(err, repository.ErrNoRows) && metric.DefaultOnEmpty != nil {
+		return metric.DefaultOnEmpty, nil, nil
+	}
+	if err != nil {
+		metricQueryFailuresTotal.WithLabelValues(metric.Name).Inc()
+		return nil, nil, err
+	}
+
+	return value, columns, nil
+}
+
+// sleep waits for d, returning false without waiting when ctx would end
+// first, since a retry after the deadline could only fail.
+func sleep(ctx context.Context, d time.Duration) bool {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return false
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// GetMetrics executes multiple metrics concurrently using errgroup, at most
+// Options.MaxConcurrency at a time.
+// By default, if any metric fails, returns error immediately (fail-fast).
+// With opts.Partial, failures are recorded on the corresponding MetricResult instead.
+// Returns a slice of MetricResult, one per requested metric, in request order.
+func (ms *MetricService) GetMetrics(ctx context.Context, names []string, params map[string]string, opts models.QueryOptions) ([]models.MetricResult, error) {
+	if ms.opts.StrictParams {
+		if err := ms.checkUnknownParams(names, params); err != nil {
+			return nil, err
+		}
+	}
+
+	requests := make([]models.MetricRequest, len(names))
 	for i, name := range names {
-		// Capture loop variables for goroutine
-		i, name := i, name
+		requests[i] = models.MetricRequest{Name: name, Params: params}
+	}
+	return ms.runBatch(ctx, requests, opts)
+}
 
+// GetMetricBatch is GetMetrics for batches where each metric has its own
+// params. A name may appear more than once, e.g. to compare date ranges.
+func (ms *MetricService) GetMetricBatch(ctx context.Context, requests []models.MetricRequest, opts models.QueryOptions) ([]models.MetricResult, error) {
+	if ms.opts.StrictParams {
+		for _, req := range requests {
+			if err := ms.checkUnknownParams([]string{req.Name}, req.Params); err != nil {
+				return nil, fmt.Errorf("metric %q: %w", req.Name, err)
+			}
+		}
+	}
+
+	return ms.runBatch(ctx, requests, opts)
+}
+
+// runBatch runs requests concurrently for GetMetrics and GetMetricBatch.
+func (ms *MetricService) runBatch(ctx context.Context, requests []models.MetricRequest, opts models.QueryOptions) ([]models.MetricResult, error) {
+	if opts.Partial {
+		return ms.runBatchPartial(ctx, requests, opts), nil
+	}
+	if err := ms.authorizeBatch(ctx, requests); err != nil {
+		return nil, err
+	}
+
+	results := make([]models.MetricResult, len(requests))
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	if ms.opts.MaxConcurrency > 0 {
+		eg.SetLimit(ms.opts.MaxConcurrency)
+	}
+
+	for i, req := range requests {
 		eg.Go(func() error {
-			metricResults, err := ms.GetMetric(egCtx, name, params)
+			metricCtx, cancel := ms.metricContext(egCtx)
+			defer cancel()
+
+			metricResults, err := ms.GetMetric(metricCtx, req.Name, req.Params, opts)
 			if err != nil {
 				return err
 			}
+
 			if len(metricResults) > 0 {
 				results[i] = metricResults[0]
 			}
+
 			return nil
 		})
 	}
@@ -112,36 +984,191 @@ func (ms *MetricService) GetMetrics(ctx context.Context, names []string, params
 	return results, nil
 }
 
+// metricContext derives the context for one metric of a batch, applying
+// Options.MetricTimeout.
+func (ms *MetricService) metricContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ms.opts.MetricTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, ms.opts.MetricTimeout)
+}
+
+// runBatchPartial runs every metric to completion, recording errors per result.
+// Metrics do not share a cancellable context, so one failure never aborts the others.
+func (ms *MetricService) runBatchPartial(ctx context.Context, requests []models.MetricRequest, opts models.QueryOptions) []models.MetricResult {
+	results := make([]models.MetricResult, len(requests))
+
+	var eg errgroup.Group
+	if ms.opts.MaxConcurrency > 0 {
+		eg.SetLimit(ms.opts.MaxConcurrency)
+	}
+
+	for i, req := range requests {
+		// Errors are recorded on the result and never returned, so the group
+		// only serves to wait and to apply the concurrency limit.
+		eg.Go(func() error {
+			metricCtx, cancel := ms.metricContext(ctx)
+			defer cancel()
+
+			metricResults, err := ms.GetMetric(metricCtx, req.Name, req.Params, opts)
+			if err != nil {
+				ms.logger.Warn("metric failed in partial request", "metric", req.Name, "error", err)
+				results[i] = models.MetricResult{Name: req.Name, Error: err.Error(), Err: err}
+				return nil
+			}
+
+			if len(metricResults) > 0 {
+				results[i] = metricResults[0]
+			}
+			return nil
+		})
+	}
+	eg.Wait()
+
+	return results
+}
+
+// checkUnknownParams rejects params not declared by any of the named
+// metrics. Params shared across a batch only need to be declared by one
+// metric, and a computed metric accepts the params of the metrics its
+// formula references. Unknown metric names are left for GetMetric to report.
+func (ms *MetricService) checkUnknownParams(names []string, params map[string]string) error {
+	declared := make(map[string]bool)
+	seen := make(map[string]bool)
+
+	var collect func(name string)
+	collect = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+
+		metric, ok := ms.lookup(name)
+		if !ok {
+			return
+		}
+		for _, paramDef := range metric.Params {
+			declared[paramDef.Name] = true
+			for _, alias := range paramDef.Aliases {
+				declared[alias] = true
+			}
+		}
+		for _, dep := range metric.Dependencies() {
+			collect(dep)
+		}
+	}
+	for _, name := range names {
+		collect(name)
+	}
+
+	var unknown []string
+	for name := range params {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknown)
+	return classify(ErrParamInvalid, fmt.Errorf("unknown parameters: %s", strings.Join(unknown, ", ")))
+}
+
 // prepareParams validates required parameters and converts string values to typed values.
-// Returns a slice of interface{} that can be passed directly to repository query methods.
-func (ms *MetricService) prepareParams(metric models.Metric, params map[string]string) ([]interface{}, error) {
+// It returns the query with any ":name" placeholders rewritten as "?", along with
+// the args in placeholder order, ready to pass to repository query methods.
+// A list param's placeholder is expanded to one "?" per element; an empty list
+// binds a single NULL, so "IN (?)" matches nothing rather than being invalid SQL.
+func (ms *MetricService) prepareParams(metric models.Metric, params map[string]string) (string, []interface{}, error) {
+	query, names := sqlutil.ParseNamed(metric.Query)
 	if len(metric.Params) == 0 {
-		return nil, nil
+		return query, nil, nil
 	}
 
-	args := make([]interface{}, len(metric.Params))
+	slots := make([][]interface{}, len(metric.Params))
+	values := make(map[string][]interface{}, len(metric.Params))
+	hasList := false
 
 	for i, paramDef := range metric.Params {
-		value, exists := params[paramDef.Name]
+		value, exists, err := paramDef.Lookup(params)
+		if err != nil {
+			return "", nil, classify(ErrParamInvalid, fmt.Errorf("metric %q: parameter %q: %w", metric.Name, paramDef.Name, err))
+		}
 
 		// Check if parameter is present
 		if !exists {
 			if paramDef.Required {
-				return nil, fmt.Errorf("metric %q: required parameter %q is missing", metric.Name, paramDef.Name)
+				return "", nil, missingParam(metric, paramDef, fmt.Errorf("metric %q: required parameter %q is missing", metric.Name, paramDef.Name))
+			}
+			if paramDef.Default == "" {
+				// Placeholders cannot be conditionally omitted, so an optional
+				// parameter needs a default to stand in when it is absent.
+				return "", nil, missingParam(metric, paramDef, fmt.Errorf("metric %q: optional parameter %q was not provided and has no default", metric.Name, paramDef.Name))
 			}
-			// Optional parameters must be provided for SQL positional parameters to work.
-			// SQL positional parameters cannot be conditionally omitted.
-			return nil, fmt.Errorf("metric %q: optional parameter %q was not provided (optional parameters are not supported with positional SQL parameters)", metric.Name, paramDef.Name)
+			value = paramDef.Default
 		}
 
-		// Convert string value to typed value
-		convertedValue, err := convertParamValue(value, paramDef.Type)
-		if err != nil {
-			return nil, fmt.Errorf("metric %q: parameter %q: %w", metric.Name, paramDef.Name, err)
+		elements := paramDef.Elements(value)
+		converted := make([]interface{}, 0, len(elements))
+		for _, element := range elements {
+			// Convert string value to typed value
+			convertedValue, err := convertParamValue(element, paramDef.Type)
+			if err != nil {
+				// Conversion errors quote the value, as do strconv's wrapped ones
+				if paramDef.Sensitive {
+					err = fmt.Errorf("invalid %s value %q", paramDef.Type, models.RedactedValue)
+				}
+				return "", nil, classify(ErrParamInvalid, fmt.Errorf("metric %q: parameter %q: %w", metric.Name, paramDef.Name, err))
+			}
+			if !paramDef.Allows(convertedValue) {
+				return "", nil, classify(ErrParamInvalid, fmt.Errorf("metric %q: parameter %q: invalid value %q: must be one of %s", metric.Name, paramDef.Name, paramDef.Redact(element), strings.Join(paramDef.AllowedValues, ", ")))
+			}
+			if err := paramDef.CheckRange(convertedValue); err != nil {
+				return "", nil, classify(ErrParamInvalid, fmt.Errorf("metric %q: parameter %q: %w", metric.Name, paramDef.Name, err))
+			}
+			if s, ok := convertedValue.(string); ok {
+				convertedValue = paramDef.WrapValue(s)
+			}
+			converted = append(converted, convertedValue)
 		}
+		if len(converted) == 0 {
+			converted = append(converted, nil)
+		}
+
+		slots[i] = converted
+		values[paramDef.Name] = converted
+		hasList = hasList || paramDef.List
+	}
 
-		args[i] = convertedValue
+	// Named placeholders bind in query order, independent of declaration order.
+	if len(names) > 0 {
+		slots = make([][]interface{}, len(names))
+		for i, name := range names {
+			slots[i] = values[name]
+		}
 	}
 
-	return args, nil
+	if hasList {
+		query = sqlutil.ReplacePlaceholders(query, func(n int) string {
+			return strings.Repeat("?, ", len(slots[n-1])-1) + "?"
+		})
+	}
+
+	var args []interface{}
+	for _, slot := range slots {
+		args = append(args, slot...)
+	}
+
+	return query, args, nil
+}
+
+// missingParam classifies err as ErrParamMissing for param of metric.
+func missingParam(metric models.Metric, param models.ParamDefinition, err error) error {
+	return classify(ErrParamMissing, &MissingParamError{
+		Metric: metric.Name,
+		Param:  param.Name,
+		Params: metric.Params,
+		Err:    err,
+	})
 }
@@ -2,10 +2,20 @@ package service
 
 import (
 	"context"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/repository"
 )
 
 // mockRepository is a test double that implements repository.Repository
@@ -13,20 +23,48 @@ type mockRepository struct {
 	singleValueResult interface{}
 	singleValueErr    error
 	multiRowResult    []map[string]interface{}
+	multiRowColumns   []string
 	multiRowErr       error
-	queryCalls        int
+	queryCalls        atomic.Int64
 }
 
 func (m *mockRepository) QuerySingleValue(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
-	m.queryCalls++
+	m.queryCalls.Add(1)
 	return m.singleValueResult, m.singleValueErr
 }
 
 func (m *mockRepository) QueryMultiRow(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
-	m.queryCalls++
+	m.queryCalls.Add(1)
 	return m.multiRowResult, m.multiRowErr
 }
 
+func (m *mockRepository) QueryMultiRowColumns(ctx context.Context, query string, args ...interface{}) ([]string, []map[string]interface{}, error) {
+	rows, err := m.QueryMultiRow(ctx, query, args...)
+	return m.multiRowColumns, rows, err
+}
+
+func (m *mockRepository) QueryRowsStream(ctx context.Context, query string, fn func(row map[string]interface{}) error, args ...interface{}) error {
+	m.queryCalls.Add(1)
+	if m.multiRowErr != nil {
+		return m.multiRowErr
+	}
+	for _, row := range m.multiRowResult {
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) QueryColumns(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	m.queryCalls.Add(1)
+	return nil, m.multiRowErr
+}
+
+func (m *mockRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
 func (m *mockRepository) Close() error {
 	return nil
 }
@@ -46,7 +84,7 @@ func TestNewMetricService(t *testing.T) {
 	}
 
 	repo := &mockRepository{}
-	service := NewMetricService(repo, metrics, nil)
+	service := NewMetricService(repo, metrics, nil, Options{})
 
 	if service == nil {
 		t.Error("NewMetricService returned nil")
@@ -61,7 +99,7 @@ func TestMetricService_GetMetricNames(t *testing.T) {
 	}
 
 	repo := &mockRepository{}
-	service := NewMetricService(repo, metrics, nil)
+	service := NewMetricService(repo, metrics, nil, Options{})
 
 	names := service.GetMetricNames()
 
@@ -83,6 +121,216 @@ func TestMetricService_GetMetricNames(t *testing.T) {
 	}
 }
 
+func TestMetricService_ListMetrics(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "revenue", Query: "SELECT 1", Unit: "USD", Format: models.FormatCurrency, Category: "finance"},
+		{
+			Name:        "active_users",
+			Description: "Users active in the last day",
+			Query:       "SELECT 1",
+			MultiRow:    true,
+			Params:      []models.ParamDefinition{{Name: "since", Type: models.ParamTypeDate}},
+		},
+	}
+
+	service := NewMetricService(&mockRepository{}, metrics, nil, Options{})
+
+	want := []models.MetricInfo{
+		{
+			Name:        "active_users",
+			Description: "Users active in the last day",
+			MultiRow:    true,
+			Params:      []models.ParamDefinition{{Name: "since", Type: models.ParamTypeDate}},
+		},
+		{Name: "revenue", Unit: "USD", Format: models.FormatCurrency, Category: "finance"},
+	}
+
+	if got := service.ListMetrics(context.Background(), models.ListOptions{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("ListMetrics() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMetricService_ListMetrics_Tags(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "daily_sales", Query: "SELECT 1", Tags: []string{"sales", "daily"}},
+		{Name: "weekly_sales", Query: "SELECT 1", Tags: []string{"sales", "weekly"}},
+		{Name: "signups", Query: "SELECT 1", Tags: []string{"users", "daily"}},
+		{Name: "untagged", Query: "SELECT 1"},
+	}
+	service := NewMetricService(&mockRepository{}, metrics, nil, Options{})
+
+	tests := []struct {
+		name string
+		opts models.ListOptions
+		want []string
+	}{
+		{name: "no filter", opts: models.ListOptions{}, want: []string{"daily_sales", "signups", "untagged", "weekly_sales"}},
+		{name: "single tag", opts: models.ListOptions{Tags: []string{"sales"}}, want: []string{"daily_sales", "weekly_sales"}},
+		{name: "any of several", opts: models.ListOptions{Tags: []string{"weekly", "users"}}, want: []string{"signups", "weekly_sales"}},
+		{name: "all of several", opts: models.ListOptions{Tags: []string{"sales", "daily"}, Match: models.TagMatchAll}, want: []string{"daily_sales"}},
+		{name: "unknown tag", opts: models.ListOptions{Tags: []string{"finance"}}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, info := range service.ListMetrics(context.Background(), tt.opts) {
+				got = append(got, info.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListMetrics() names = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricService_ReloadMetrics(t *testing.T) {
+	repo := &mockRepository{singleValueResult: int64(1)}
+	service := NewMetricService(repo, []models.Metric{
+		{Name: "old", Query: "SELECT 1", CacheTTL: time.Minute},
+	}, nil, Options{})
+
+	if _, err := service.GetMetric(context.Background(), "old", nil, models.QueryOptions{}); err != nil {
+		t.Fatalf("GetMetric(old) error = %v", err)
+	}
+
+	service.ReloadMetrics([]models.Metric{
+		{Name: "old", Query: "SELECT 2", CacheTTL: time.Minute},
+		{Name: "added", Query: "SELECT 3"},
+	})
+
+	if names := service.GetMetricNames(); len(names) != 2 {
+		t.Errorf("GetMetricNames() after reload = %v, want 2 names", names)
+	}
+	if _, err := service.GetMetric(context.Background(), "added", nil, models.QueryOptions{}); err != nil {
+		t.Errorf("GetMetric(added) error = %v", err)
+	}
+
+	calls := repo.queryCalls.Load()
+	if _, err := service.GetMetric(context.Background(), "old", nil, models.QueryOptions{}); err != nil {
+		t.Fatalf("GetMetric(old) error = %v", err)
+	}
+	if repo.queryCalls.Load() != calls+1 {
+		t.Error("cached result from before reload was served")
+	}
+}
+
+func TestMetricService_DisabledMetric(t *testing.T) {
+	disabled := false
+	metrics := []models.Metric{
+		{Name: "revenue", Query: "SELECT 1"},
+		{Name: "expensive", Query: "SELECT name FROM big_table", MultiRow: true, Enabled: &disabled},
+	}
+	repo := &mockRepository{singleValueResult: int64(1), multiRowResult: []map[string]interface{}{}}
+	service := NewMetricService(repo, metrics, nil, Options{})
+
+	if names := service.GetMetricNames(); !reflect.DeepEqual(names, []string{"revenue"}) {
+		t.Errorf("GetMetricNames() = %v, want [revenue]", names)
+	}
+	if infos := service.ListMetrics(context.Background(), models.ListOptions{}); len(infos) != 1 || infos[0].Name != "revenue" {
+		t.Errorf("ListMetrics() = %+v, want only revenue", infos)
+	}
+
+	if _, err := service.GetMetric(context.Background(), "expensive", nil, models.QueryOptions{}); !errors.Is(err, ErrMetricDisabled) {
+		t.Errorf("GetMetric() error = %v, want ErrMetricDisabled", err)
+	}
+	if _, err := service.GetMetricSchema(context.Background(), "expensive"); !errors.Is(err, ErrMetricDisabled) {
+		t.Errorf("GetMetricSchema() error = %v, want ErrMetricDisabled", err)
+	}
+	err := service.StreamMetric(context.Background(), "expensive", nil, models.QueryOptions{}, func(map[string]interface{}) error { return nil })
+	if !errors.Is(err, ErrMetricDisabled) {
+		t.Errorf("StreamMetric() error = %v, want ErrMetricDisabled", err)
+	}
+	if repo.queryCalls.Load() != 0 {
+		t.Errorf("disabled metric ran %d queries, want 0", repo.queryCalls.Load())
+	}
+
+	results, err := service.GetMetrics(context.Background(), []string{"revenue", "expensive"}, nil, models.QueryOptions{Partial: true})
+	if err != nil {
+		t.Fatalf("GetMetrics() error = %v", err)
+	}
+	if results[0].Error != "" || !strings.Contains(results[1].Error, "disabled") {
+		t.Errorf("partial results = %+v, want revenue served and expensive disabled", results)
+	}
+
+	// A reload without enabled = false puts the metric back in service.
+	metrics[1].Enabled = nil
+	service.ReloadMetrics(metrics)
+	if _, err := service.GetMetric(context.Background(), "expensive", nil, models.QueryOptions{}); err != nil {
+		t.Errorf("GetMetric() after reload error = %v", err)
+	}
+}
+
+func TestMetricService_Scopes(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "revenue", Query: "SELECT 1", Scopes: []string{"sales"}},
+		{Name: "margin", Query: "SELECT 1", Scopes: []string{"sales", "finance"}},
+		{Name: "user_emails", Query: "SELECT 1", Scopes: []string{"pii"}},
+		{Name: "uptime", Query: "SELECT 1"},
+		{Name: "revenue_again", Formula: "revenue"},
+	}
+	service := NewMetricService(&mockRepository{singleValueResult: int64(1)}, metrics, nil, Options{})
+	sales := WithScopes(context.Background(), []string{"sales"})
+
+	for _, tt := range []struct {
+		name    string
+		ctx     context.Context
+		metric  string
+		wantErr error
+	}{
+		{name: "granted scope", ctx: sales, metric: "revenue"},
+		{name: "no scopes required", ctx: sales, metric: "uptime"},
+		{name: "one of two scopes", ctx: sales, metric: "margin", wantErr: ErrForbidden},
+		{name: "other scope", ctx: sales, metric: "user_emails", wantErr: ErrForbidden},
+		{name: "formula dependency", ctx: WithScopes(context.Background(), nil), metric: "revenue_again", wantErr: ErrForbidden},
+		{name: "unscoped caller", ctx: context.Background(), metric: "user_emails"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.GetMetric(tt.ctx, tt.metric, nil, models.QueryOptions{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetMetric() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("batch lists every forbidden metric", func(t *testing.T) {
+		_, err := service.GetMetrics(sales, []string{"revenue", "user_emails", "margin", "user_emails"}, nil, models.QueryOptions{})
+		if !errors.Is(err, ErrForbidden) {
+			t.Fatalf("GetMetrics() error = %v, want ErrForbidden", err)
+		}
+		if want := "API key lacks the scopes to read metrics: user_emails, margin"; err.Error() != want {
+			t.Errorf("GetMetrics() error = %q, want %q", err, want)
+		}
+	})
+
+	t.Run("partial batch", func(t *testing.T) {
+		results, err := service.GetMetrics(sales, []string{"revenue", "user_emails"}, nil, models.QueryOptions{Partial: true})
+		if err != nil {
+			t.Fatalf("GetMetrics() error = %v", err)
+		}
+		if results[0].Error != "" || !strings.Contains(results[1].Error, `requires scope "pii"`) {
+			t.Errorf("results = %+v, want revenue served and user_emails forbidden", results)
+		}
+	})
+
+	t.Run("catalog", func(t *testing.T) {
+		var got []string
+		for _, info := range service.ListMetrics(sales, models.ListOptions{}) {
+			got = append(got, info.Name)
+		}
+		if want := []string{"revenue", "revenue_again", "uptime"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("ListMetrics() names = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		err := service.StreamMetric(sales, "user_emails", nil, models.QueryOptions{}, func(map[string]interface{}) error { return nil })
+		if !errors.Is(err, ErrForbidden) {
+			t.Errorf("StreamMetric() error = %v, want ErrForbidden", err)
+		}
+	})
+}
+
 func TestMetricService_GetMetric_SingleValue(t *testing.T) {
 	metrics := []models.Metric{
 		{
@@ -95,9 +343,9 @@ func TestMetricService_GetMetric_SingleValue(t *testing.T) {
 	repo := &mockRepository{
 		singleValueResult: int64(1523),
 	}
-	service := NewMetricService(repo, metrics, nil)
+	service := NewMetricService(repo, metrics, nil, Options{})
 
-	results, err := service.GetMetric(context.Background(), "active_users", nil)
+	results, err := service.GetMetric(context.Background(), "active_users", nil, models.QueryOptions{})
 
 	if err != nil {
 		t.Errorf("GetMetric() error = %v, want nil", err)
@@ -116,6 +364,83 @@ func TestMetricService_GetMetric_SingleValue(t *testing.T) {
 	}
 }
 
+func TestMetricService_GetMetric_NullValue(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "revenue", Query: "SELECT SUM(amount) FROM orders WHERE 1 = 0", CacheTTL: time.Minute},
+	}
+
+	repo := &mockRepository{singleValueResult: nil}
+	service := NewMetricService(repo, metrics, nil, Options{})
+
+	for i := 0; i < 2; i++ {
+		results, err := service.GetMetric(context.Background(), "revenue", nil, models.QueryOptions{})
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v, want nil", err)
+		}
+		if results[0].Value != nil {
+			t.Errorf("GetMetric() Value = %v, want nil", results[0].Value)
+		}
+	}
+
+	// A NULL result is a valid value, so it is cached like any other
+	if repo.queryCalls.Load() != 1 {
+		t.Errorf("queryCalls = %d, want 1", repo.queryCalls.Load())
+	}
+}
+
+func TestMetricService_GetMetric_NoRows(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "latest_order", Query: "SELECT amount FROM orders ORDER BY id DESC LIMIT 1"},
+	}
+
+	repo := &mockRepository{singleValueErr: repository.ErrNoRows}
+	service := NewMetricService(repo, metrics, nil, Options{})
+
+	_, err := service.GetMetric(context.Background(), "latest_order", nil, models.QueryOptions{})
+	if !errors.Is(err, repository.ErrNoRows) {
+		t.Errorf("GetMetric() error = %v, want %v", err, repository.ErrNoRows)
+	}
+}
+
+func TestMetricService_GetMetric_DefaultOnEmpty(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "latest_order", Query: "SELECT amount FROM orders ORDER BY id DESC LIMIT 1", DefaultOnEmpty: int64(0)},
+		{Name: "latest_rating", Query: "SELECT rating FROM reviews ORDER BY id DESC LIMIT 1", DefaultOnEmpty: "0", ValueType: models.ValueTypeFloat},
+		{Name: "latest_status", Query: "SELECT status FROM orders ORDER BY id DESC LIMIT 1", DefaultOnEmpty: "none"},
+	}
+
+	tests := []struct {
+		name string
+		want interface{}
+	}{
+		{name: "latest_order", want: int64(0)},
+		{name: "latest_rating", want: 0.0},
+		{name: "latest_status", want: "none"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{singleValueErr: repository.ErrNoRows}
+			service := NewMetricService(repo, metrics, nil, Options{})
+
+			results, err := service.GetMetric(context.Background(), tt.name, nil, models.QueryOptions{})
+			if err != nil {
+				t.Fatalf("GetMetric() error = %v, want nil", err)
+			}
+			if results[0].Value != tt.want {
+				t.Errorf("GetMetric() Value = %#v, want %#v", results[0].Value, tt.want)
+			}
+		})
+	}
+
+	// Other failures are still errors.
+	repo := &mockRepository{singleValueErr: errors.New("connection refused")}
+	service := NewMetricService(repo, metrics, nil, Options{})
+	if _, err := service.GetMetric(context.Background(), "latest_order", nil, models.QueryOptions{}); err == nil {
+		t.Error("GetMetric() error = nil, want the query failure")
+	}
+}
+
 func TestMetricService_GetMetric_MultiRow(t *testing.T) {
 	metrics := []models.Metric{
 		{
@@ -133,9 +458,9 @@ func TestMetricService_GetMetric_MultiRow(t *testing.T) {
 	repo := &mockRepository{
 		multiRowResult: multiRowData,
 	}
-	service := NewMetricService(repo, metrics, nil)
+	service := NewMetricService(repo, metrics, nil, Options{})
 
-	results, err := service.GetMetric(context.Background(), "signups_by_day", nil)
+	results, err := service.GetMetric(context.Background(), "signups_by_day", nil, models.QueryOptions{})
 
 	if err != nil {
 		t.Errorf("GetMetric() error = %v, want nil", err)
@@ -174,13 +499,13 @@ func TestMetricService_GetMetric_WithParameters(t *testing.T) {
 	repo := &mockRepository{
 		singleValueResult: int64(150),
 	}
-	service := NewMetricService(repo, metrics, nil)
+	service := NewMetricService(repo, metrics, nil, Options{})
 
 	params := map[string]string{
 		"start_date": "2025-01-01",
 	}
 
-	results, err := service.GetMetric(context.Background(), "signups_by_date", params)
+	results, err := service.GetMetric(context.Background(), "signups_by_date", params, models.QueryOptions{})
 
 	if err != nil {
 		t.Errorf("GetMetric() error = %v, want nil", err)
@@ -208,10 +533,10 @@ func TestMetricService_GetMetric_MissingRequiredParam(t *testing.T) {
 	}
 
 	repo := &mockRepository{}
-	service := NewMetricService(repo, metrics, nil)
+	service := NewMetricService(repo, metrics, nil, Options{})
 
 	// Call with empty params (missing required start_date)
-	results, err := service.GetMetric(context.Background(), "signups_by_date", nil)
+	results, err := service.GetMetric(context.Background(), "signups_by_date", nil, models.QueryOptions{})
 
 	if err == nil {
 		t.Error("GetMetric() error = nil, want error for missing required param")
@@ -235,13 +560,13 @@ func TestMetricService_GetMetric_InvalidParamType(t *testing.T) {
 	}
 
 	repo := &mockRepository{}
-	service := NewMetricService(repo, metrics, nil)
+	service := NewMetricService(repo, metrics, nil, Options{})
 
 	params := map[string]string{
 		"limit": "not_a_number",
 	}
 
-	results, err := service.GetMetric(context.Background(), "users_with_limit", params)
+	results, err := service.GetMetric(context.Background(), "users_with_limit", params, models.QueryOptions{})
 
 	if err == nil {
 		t.Error("GetMetric() error = nil, want error for invalid int param")
@@ -265,12 +590,12 @@ func TestMetricService_GetMetric_OptionalIntParamNotProvided(t *testing.T) {
 	}
 
 	repo := &mockRepository{}
-	service := NewMetricService(repo, metrics, nil)
+	service := NewMetricService(repo, metrics, nil, Options{})
 
 	// Call without providing the optional limit parameter
-	results, err := service.GetMetric(context.Background(), "users_paginated", nil)
+	results, err := service.GetMetric(context.Background(), "users_paginated", nil, models.QueryOptions{})
 
-	// Should error because optional parameters don't work with positional SQL parameters
+	// Should error because there is no default to stand in for the missing value
 	if err == nil {
 		t.Error("GetMetric() error = nil, want error for optional param not provided")
 	}
@@ -280,15 +605,143 @@ func TestMetricService_GetMetric_OptionalIntParamNotProvided(t *testing.T) {
 	}
 }
 
+func TestMetricService_GetMetric_OptionalParamDefault(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:     "users_paginated",
+			Query:    "SELECT * FROM users WHERE id > ? LIMIT ?",
+			MultiRow: true,
+			Params: []models.ParamDefinition{
+				{Name: "min_id", Type: models.ParamTypeInt, Required: true},
+				{Name: "max_rows", Type: models.ParamTypeInt, Default: "100"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		params   map[string]string
+		wantArgs []interface{}
+	}{
+		{
+			name:     "missing uses default",
+			params:   map[string]string{"min_id": "5"},
+			wantArgs: []interface{}{int64(5), int64(100)},
+		},
+		{
+			name:     "present overrides default",
+			params:   map[string]string{"min_id": "5", "max_rows": "10"},
+			wantArgs: []interface{}{int64(5), int64(10)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &recordingRepository{}
+			service := NewMetricService(repo, metrics, nil, Options{})
+
+			if _, err := service.GetMetric(context.Background(), "users_paginated", tt.params, models.QueryOptions{}); err != nil {
+				t.Fatalf("GetMetric() error = %v", err)
+			}
+			if !reflect.DeepEqual(repo.args[0], tt.wantArgs) {
+				t.Errorf("args = %v, want %v", repo.args[0], tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestMetricService_GetMetric_AllowedValues(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:  "signups_by_period",
+			Query: "SELECT COUNT(*) FROM signups WHERE period = ? AND days = ?",
+			Params: []models.ParamDefinition{
+				{Name: "period", Type: models.ParamTypeString, Required: true, AllowedValues: []string{"day", "week", "month"}},
+				{Name: "days", Type: models.ParamTypeInt, Required: true, AllowedValues: []string{"7", "30"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		wantErr bool
+	}{
+		{name: "allowed values", params: map[string]string{"period": "week", "days": "07"}},
+		{name: "string not allowed", params: map[string]string{"period": "year", "days": "7"}, wantErr: true},
+		{name: "int not allowed", params: map[string]string{"period": "day", "days": "14"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{singleValueResult: int64(1)}
+			service := NewMetricService(repo, metrics, nil, Options{})
+
+			_, err := service.GetMetric(context.Background(), "signups_by_period", tt.params, models.QueryOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetMetric() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && repo.queryCalls.Load() != 0 {
+				t.Error("query ran despite a disallowed value")
+			}
+		})
+	}
+}
+
+func TestMetricService_GetMetric_ParamRange(t *testing.T) {
+	minRows, maxRows := 1.0, 1000.0
+	metrics := []models.Metric{
+		{
+			Name:     "recent_users",
+			Query:    "SELECT * FROM users LIMIT ?",
+			MultiRow: true,
+			Params: []models.ParamDefinition{
+				{Name: "max_rows", Type: models.ParamTypeInt, Required: true, Min: &minRows, Max: &maxRows},
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{name: "within range", value: "500"},
+		{name: "below min", value: "0", wantErr: `metric "recent_users": parameter "max_rows": invalid value 0: must be at least 1`},
+		{name: "above max", value: "10000000", wantErr: `metric "recent_users": parameter "max_rows": invalid value 10000000: must be at most 1000`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{}
+			service := NewMetricService(repo, metrics, nil, Options{})
+
+			_, err := service.GetMetric(context.Background(), "recent_users", map[string]string{"max_rows": tt.value}, models.QueryOptions{})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("GetMetric() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("GetMetric() error = %v, want %q", err, tt.wantErr)
+			}
+			if repo.queryCalls.Load() != 0 {
+				t.Error("query ran despite an out-of-range value")
+			}
+		})
+	}
+}
+
 func TestMetricService_GetMetric_MetricNotFound(t *testing.T) {
 	metrics := []models.Metric{
 		{Name: "active_users", Query: "SELECT 1", MultiRow: false},
 	}
 
 	repo := &mockRepository{}
-	service := NewMetricService(repo, metrics, nil)
+	service := NewMetricService(repo, metrics, nil, Options{})
 
-	results, err := service.GetMetric(context.Background(), "nonexistent", nil)
+	results, err := service.GetMetric(context.Background(), "nonexistent", nil, models.QueryOptions{})
 
 	if err == nil {
 		t.Error("GetMetric() error = nil, want error for nonexistent metric")
@@ -321,9 +774,9 @@ func TestMetricService_GetMetrics_Concurrent(t *testing.T) {
 	repo := &mockRepository{
 		singleValueResult: int64(100),
 	}
-	service := NewMetricService(repo, metrics, nil)
+	service := NewMetricService(repo, metrics, nil, Options{})
 
-	results, err := service.GetMetrics(context.Background(), []string{"active_users", "signups", "revenue"}, nil)
+	results, err := service.GetMetrics(context.Background(), []string{"active_users", "signups", "revenue"}, nil, models.QueryOptions{})
 
 	if err != nil {
 		t.Errorf("GetMetrics() error = %v, want nil", err)
@@ -366,9 +819,9 @@ func TestMetricService_GetMetrics_ErrorHandling(t *testing.T) {
 		successCount: 1,
 	}
 
-	service := NewMetricService(failingRepo, metrics, nil)
+	service := NewMetricService(failingRepo, metrics, nil, Options{})
 
-	_, err := service.GetMetrics(context.Background(), []string{"active_users", "signups"}, nil)
+	_, err := service.GetMetrics(context.Background(), []string{"active_users", "signups"}, nil, models.QueryOptions{})
 
 	// Should return error (fail-fast)
 	if err == nil {
@@ -396,6 +849,1945 @@ func (t *testRepositoryWithFailure) QueryMultiRow(ctx context.Context, query str
 	return nil, nil
 }
 
+func (t *testRepositoryWithFailure) QueryMultiRowColumns(ctx context.Context, query string, args ...interface{}) ([]string, []map[string]interface{}, error) {
+	return nil, nil, nil
+}
+
+func (t *testRepositoryWithFailure) QueryRowsStream(ctx context.Context, query string, fn func(row map[string]interface{}) error, args ...interface{}) error {
+	return nil
+}
+
+func (t *testRepositoryWithFailure) QueryColumns(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	return nil, nil
+}
+
+func (t *testRepositoryWithFailure) Ping(ctx context.Context) error {
+	return nil
+}
+
 func (t *testRepositoryWithFailure) Close() error {
 	return nil
 }
+
+func TestMetricService_GetMetrics_Partial(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "active_users", Query: "SELECT COUNT(*) FROM users", MultiRow: false},
+		{Name: "broken", Query: "SELECT COUNT(*) FROM missing_table", MultiRow: false},
+		{Name: "revenue", Query: "SELECT SUM(amount) FROM transactions", MultiRow: false},
+	}
+
+	repo := &queryFailingRepository{
+		failQueries: map[string]bool{"SELECT COUNT(*) FROM missing_table": true},
+	}
+	service := NewMetricService(repo, metrics, nil, Options{})
+
+	names := []string{"active_users", "broken", "revenue"}
+	results, err := service.GetMetrics(context.Background(), names, nil, models.QueryOptions{Partial: true})
+
+	if err != nil {
+		t.Fatalf("GetMetrics() error = %v, want nil in partial mode", err)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("GetMetrics() returned %d results, want 3", len(results))
+	}
+
+	for i, name := range names {
+		if results[i].Name != name {
+			t.Errorf("results[%d].Name = %s, want %s", i, results[i].Name, name)
+		}
+	}
+
+	if results[0].Error != "" || results[0].Value != int64(100) {
+		t.Errorf("results[0] = %+v, want value 100 and no error", results[0])
+	}
+
+	if results[1].Error == "" {
+		t.Error("results[1].Error is empty, want failure recorded")
+	}
+	if results[1].Value != nil {
+		t.Errorf("results[1].Value = %v, want nil", results[1].Value)
+	}
+
+	if results[2].Error != "" || results[2].Value != int64(100) {
+		t.Errorf("results[2] = %+v, want value 100 and no error", results[2])
+	}
+}
+
+// queryFailingRepository fails any query listed in failQueries
+type queryFailingRepository struct {
+	failQueries map[string]bool
+}
+
+func (q *queryFailingRepository) QuerySingleValue(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+	if q.failQueries[query] {
+		return nil, errQueryFailed
+	}
+	return int64(100), nil
+}
+
+func (q *queryFailingRepository) QueryMultiRow(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	if q.failQueries[query] {
+		return nil, errQueryFailed
+	}
+	return []map[string]interface{}{}, nil
+}
+
+func (q *queryFailingRepository) QueryMultiRowColumns(ctx context.Context, query string, args ...interface{}) ([]string, []map[string]interface{}, error) {
+	rows, err := q.QueryMultiRow(ctx, query, args...)
+	return nil, rows, err
+}
+
+func (q *queryFailingRepository) QueryRowsStream(ctx context.Context, query string, fn func(row map[string]interface{}) error, args ...interface{}) error {
+	if q.failQueries[query] {
+		return errQueryFailed
+	}
+	return nil
+}
+
+func (q *queryFailingRepository) QueryColumns(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	return nil, nil
+}
+
+func (q *queryFailingRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (q *queryFailingRepository) Close() error {
+	return nil
+}
+
+func TestMetricService_GetMetrics_PartialUnknownKeepsOrder(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "active_users", Query: "SELECT COUNT(*) FROM users"},
+		{Name: "revenue", Query: "SELECT SUM(amount) FROM transactions"},
+	}
+	service := NewMetricService(&mockRepository{singleValueResult: int64(5)}, metrics, nil, Options{})
+
+	names := []string{"active_users", "no_such_metric", "revenue"}
+	results, err := service.GetMetrics(context.Background(), names, nil, models.QueryOptions{Partial: true})
+	if err != nil {
+		t.Fatalf("GetMetrics() error = %v, want nil in partial mode", err)
+	}
+
+	if len(results) != len(names) {
+		t.Fatalf("GetMetrics() returned %d results, want %d", len(results), len(names))
+	}
+	for i, name := range names {
+		if results[i].Name != name {
+			t.Errorf("results[%d].Name = %s, want %s", i, results[i].Name, name)
+		}
+	}
+
+	if results[0].Value != int64(5) || results[2].Value != int64(5) {
+		t.Errorf("known metrics = %v, %v, want 5, 5", results[0].Value, results[2].Value)
+	}
+	if results[1].Value != nil || !strings.Contains(results[1].Error, "not found") {
+		t.Errorf("results[1] = %+v, want nil value and a not found error", results[1])
+	}
+
+	// Without partial, an unknown name still fails the whole batch.
+	if _, err := service.GetMetrics(context.Background(), names, nil, models.QueryOptions{}); !errors.Is(err, ErrMetricNotFound) {
+		t.Errorf("GetMetrics() error = %v, want ErrMetricNotFound", err)
+	}
+}
+
+func TestMetricService_GetMetrics_DataSources(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "users", Query: "SELECT COUNT(*) FROM users"},
+		{Name: "events", Query: "SELECT COUNT(*) FROM events", DataSource: "analytics"},
+		{Name: "orphaned", Query: "SELECT 1", DataSource: "warehouse"},
+	}
+	primary := &mockRepository{singleValueResult: int64(1)}
+	analytics := &mockRepository{singleValueResult: int64(2)}
+	service := NewMetricService(primary, metrics, nil, Options{
+		DataSources: map[string]repository.Repository{"analytics": analytics},
+	})
+
+	results, err := service.GetMetrics(context.Background(), []string{"users", "events"}, nil, models.QueryOptions{})
+	if err != nil {
+		t.Fatalf("GetMetrics() error = %v", err)
+	}
+	if results[0].Value != int64(1) || results[1].Value != int64(2) {
+		t.Errorf("values = %v, %v, want 1 from primary and 2 from analytics", results[0].Value, results[1].Value)
+	}
+	if primary.queryCalls.Load() != 1 || analytics.queryCalls.Load() != 1 {
+		t.Errorf("query calls = %d primary, %d analytics, want 1 each", primary.queryCalls.Load(), analytics.queryCalls.Load())
+	}
+
+	// A metric reloaded with a data source that was not connected at startup
+	_, err = service.GetMetric(context.Background(), "orphaned", nil, models.QueryOptions{})
+	if err == nil || !strings.Contains(err.Error(), `data source "warehouse" is not connected`) {
+		t.Errorf("GetMetric() error = %v, want data source not connected", err)
+	}
+}
+
+func TestMetricService_GetMetric_SensitiveParamErrors(t *testing.T) {
+	minID := 100.0
+	metrics := []models.Metric{
+		{
+			Name:  "account_balance",
+			Query: "SELECT balance FROM accounts WHERE id = ? AND tier = ?",
+			Params: []models.ParamDefinition{
+				{Name: "account_id", Type: models.ParamTypeInt, Required: true, Sensitive: true, Min: &minID},
+				{Name: "tier", Type: models.ParamTypeString, Required: true, Sensitive: true, AllowedValues: []string{"gold", "silver"}},
+			},
+		},
+	}
+	service := NewMetricService(&mockRepository{}, metrics, nil, Options{})
+
+	tests := []struct {
+		name    string
+		params  map[string]string
+		secret  string
+		wantErr string
+	}{
+		{
+			name:    "not an int",
+			params:  map[string]string{"account_id": "4111x", "tier": "gold"},
+			secret:  "4111x",
+			wantErr: `metric "account_balance": parameter "account_id": invalid int value "***"`,
+		},
+		{
+			name:    "out of range",
+			params:  map[string]string{"account_id": "42", "tier": "gold"},
+			secret:  "42",
+			wantErr: `metric "account_balance": parameter "account_id": invalid value ***: must be at least 100`,
+		},
+		{
+			name:    "not allowed",
+			params:  map[string]string{"account_id": "4111", "tier": "platinum"},
+			secret:  "platinum",
+			wantErr: `metric "account_balance": parameter "tier": invalid value "***": must be one of gold, silver`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.GetMetric(context.Background(), "account_balance", tt.params, models.QueryOptions{})
+			if !errors.Is(err, ErrParamInvalid) {
+				t.Fatalf("GetMetric() error = %v, want ErrParamInvalid", err)
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("GetMetric() error = %q, want %q", err, tt.wantErr)
+			}
+			if strings.Contains(err.Error(), tt.secret) {
+				t.Errorf("error %q contains the sensitive value", err)
+			}
+		})
+	}
+}
+
+func TestMetricService_GetMetrics_StrictParams(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:   "signups",
+			Query:  "SELECT COUNT(*) FROM users WHERE created > ?",
+			Params: []models.ParamDefinition{{Name: "start_date", Type: models.ParamTypeDate, Default: "2025-01-01"}},
+		},
+		{
+			Name:   "orders",
+			Query:  "SELECT COUNT(*) FROM orders WHERE region = ?",
+			Params: []models.ParamDefinition{{Name: "region", Type: models.ParamTypeString, Default: "eu"}},
+		},
+		{Name: "signups_doubled", Formula: "signups * 2"},
+	}
+
+	tests := []struct {
+		name    string
+		strict  bool
+		names   []string
+		params  map[string]string
+		wantErr string
+	}{
+		{name: "lenient ignores typo", names: []string{"signups"}, params: map[string]string{"start_dat": "2025-02-01"}},
+		{name: "declared param", strict: true, names: []string{"signups"}, params: map[string]string{"start_date": "2025-02-01"}},
+		{name: "typo rejected", strict: true, names: []string{"signups"}, params: map[string]string{"start_dat": "2025-02-01"}, wantErr: "unknown parameters: start_dat"},
+		{name: "all unknown listed", strict: true, names: []string{"signups"}, params: map[string]string{"zone": "x", "start_dat": "y"}, wantErr: "unknown parameters: start_dat, zone"},
+		{name: "declared by another metric in batch", strict: true, names: []string{"signups", "orders"}, params: map[string]string{"start_date": "2025-02-01", "region": "us"}},
+		{name: "undeclared by any metric in batch", strict: true, names: []string{"orders"}, params: map[string]string{"start_date": "2025-02-01"}, wantErr: "unknown parameters: start_date"},
+		{name: "computed metric accepts dependency params", strict: true, names: []string{"signups_doubled"}, params: map[string]string{"start_date": "2025-02-01"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewMetricService(&mockRepository{singleValueResult: int64(5)}, metrics, nil, Options{StrictParams: tt.strict})
+
+			_, err := service.GetMetrics(context.Background(), tt.names, tt.params, models.QueryOptions{})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("GetMetrics() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrParamInvalid) || err.Error() != tt.wantErr {
+				t.Errorf("GetMetrics() error = %v, want %q classified as ErrParamInvalid", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// argsRepository answers single-value queries with their bound args, so
+// tests can see which params each metric ran with.
+type argsRepository struct {
+	mockRepository
+}
+
+func (a *argsRepository) QuerySingleValue(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+	return fmt.Sprint(args...), nil
+}
+
+func TestMetricService_GetMetricBatch(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:   "signups",
+			Query:  "SELECT COUNT(*) FROM users WHERE created > ?",
+			Params: []models.ParamDefinition{{Name: "start_date", Type: models.ParamTypeDate, Required: true}},
+		},
+		{
+			Name:   "top_orders",
+			Query:  "SELECT COUNT(*) FROM orders LIMIT ?",
+			Params: []models.ParamDefinition{{Name: "count", Type: models.ParamTypeInt, Default: "5"}},
+		},
+	}
+	service := NewMetricService(&argsRepository{}, metrics, nil, Options{StrictParams: true})
+
+	t.Run("each metric runs with its own params", func(t *testing.T) {
+		results, err := service.GetMetricBatch(context.Background(), []models.MetricRequest{
+			{Name: "signups", Params: map[string]string{"start_date": "2025-01-01"}},
+			{Name: "top_orders", Params: map[string]string{"count": "10"}},
+			{Name: "signups", Params: map[string]string{"start_date": "2025-06-01"}},
+			{Name: "top_orders", Params: map[string]string{}},
+		}, models.QueryOptions{})
+		if err != nil {
+			t.Fatalf("GetMetricBatch() error = %v", err)
+		}
+
+		want := []interface{}{"2025-01-01", "10", "2025-06-01", "5"}
+		if len(results) != len(want) {
+			t.Fatalf("got %d results, want %d", len(results), len(want))
+		}
+		for i, result := range results {
+			if result.Value != want[i] {
+				t.Errorf("results[%d] = %s %v, want %v", i, result.Name, result.Value, want[i])
+			}
+		}
+	})
+
+	t.Run("params are checked per metric", func(t *testing.T) {
+		_, err := service.GetMetricBatch(context.Background(), []models.MetricRequest{
+			{Name: "signups", Params: map[string]string{"start_date": "2025-01-01"}},
+			{Name: "top_orders", Params: map[string]string{"start_date": "2025-01-01"}},
+		}, models.QueryOptions{})
+		if !errors.Is(err, ErrParamInvalid) || !strings.Contains(err.Error(), `metric "top_orders": unknown parameters: start_date`) {
+			t.Errorf("GetMetricBatch() error = %v, want top_orders to reject start_date", err)
+		}
+	})
+
+	t.Run("partial records failures per entry", func(t *testing.T) {
+		results, err := service.GetMetricBatch(context.Background(), []models.MetricRequest{
+			{Name: "signups", Params: map[string]string{}},
+			{Name: "signups", Params: map[string]string{"start_date": "2025-01-01"}},
+		}, models.QueryOptions{Partial: true})
+		if err != nil {
+			t.Fatalf("GetMetricBatch() error = %v", err)
+		}
+		if results[0].Error == "" {
+			t.Error("entry without start_date succeeded, want a missing param error")
+		}
+		if results[1].Error != "" || results[1].Value != "2025-01-01" {
+			t.Errorf("results[1] = %+v, want value 2025-01-01", results[1])
+		}
+	})
+}
+
+// blockingRepository answers every query immediately except slowQuery,
+// which waits until its context ends.
+type blockingRepository struct {
+	mockRepository
+	slowQuery string
+}
+
+func (b *blockingRepository) QuerySingleValue(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+	if query == b.slowQuery {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return int64(7), nil
+}
+
+func TestMetricService_GetMetrics_MetricTimeout(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "fast_a", Query: "SELECT 1"},
+		{Name: "slow", Query: "SELECT pg_sleep(60)"},
+		{Name: "fast_b", Query: "SELECT 2"},
+	}
+	repo := &blockingRepository{slowQuery: "SELECT pg_sleep(60)"}
+	service := NewMetricService(repo, metrics, nil, Options{MetricTimeout: 50 * time.Millisecond})
+	names := []string{"fast_a", "slow", "fast_b"}
+
+	start := time.Now()
+	results, err := service.GetMetrics(context.Background(), names, nil, models.QueryOptions{Partial: true})
+	if err != nil {
+		t.Fatalf("GetMetrics() error = %v, want nil in partial mode", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("GetMetrics() took %v, want the slow metric cut off by its timeout", elapsed)
+	}
+
+	if results[0].Value != int64(7) || results[2].Value != int64(7) {
+		t.Errorf("fast metrics = %+v, %+v, want value 7 from each", results[0], results[2])
+	}
+	if results[1].Value != nil || !strings.Contains(results[1].Error, context.DeadlineExceeded.Error()) {
+		t.Errorf("slow metric = %+v, want a deadline exceeded error", results[1])
+	}
+
+	// Without partial, the timed-out metric fails the batch as a timeout.
+	if _, err := service.GetMetrics(context.Background(), names, nil, models.QueryOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetMetrics() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestMetricService_GetMetric_QueryFailedLogged(t *testing.T) {
+	query := "SELECT COUNT(*) FROM users WHERE emial = ?"
+	metrics := []models.Metric{
+		{
+			Name:   "user_by_email",
+			Query:  query,
+			Params: []models.ParamDefinition{{Name: "email", Type: models.ParamTypeString, Required: true}},
+		},
+	}
+	repo := &mockRepository{singleValueErr: &repository.QueryError{Op: "query failed", Query: query, Err: errors.New("no such column: emial")}}
+
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	service := NewMetricService(repo, metrics, logger, Options{})
+
+	_, err := service.GetMetric(context.Background(), "user_by_email", map[string]string{"email": "secret@example.com"}, models.QueryOptions{})
+	if !errors.Is(err, ErrQueryFailed) {
+		t.Fatalf("GetMetric() error = %v, want ErrQueryFailed", err)
+	}
+
+	out := logs.String()
+	for _, want := range []string{"metric=user_by_email", "no such column: emial", "emial = ?"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("log %q does not contain %q", out, want)
+		}
+	}
+	if strings.Contains(out, "secret@example.com") {
+		t.Errorf("log %q contains a bound parameter value", out)
+	}
+
+	// A missing row is not a query failure.
+	repo.singleValueErr = repository.ErrNoRows
+	if _, err := service.GetMetric(context.Background(), "user_by_email", map[string]string{"email": "x"}, models.QueryOptions{}); errors.Is(err, ErrQueryFailed) {
+		t.Errorf("GetMetric() error = %v, want no rows not classified as ErrQueryFailed", err)
+	}
+}
+
+func TestMetricService_GetMetric_JSONColumns(t *testing.T) {
+	metrics := []models.Metric{{
+		Name:        "events",
+		Query:       "SELECT id, payload, note FROM events",
+		MultiRow:    true,
+		JSONColumns: []string{"payload"},
+	}}
+	newRows := func() []map[string]interface{} {
+		return []map[string]interface{}{
+			{"id": int64(1), "payload": `{"user": {"id": 9007199254740993}, "tags": ["a"]}`, "note": `{"x": 1}`},
+			{"id": int64(2), "payload": `{not json`, "note": nil},
+			{"id": int64(3), "payload": nil, "note": nil},
+		}
+	}
+	want := `[{"id":1,"note":"{\"x\": 1}","payload":{"user":{"id":9007199254740993},"tags":["a"]}},` +
+		`{"id":2,"note":null,"payload":"{not json"},` +
+		`{"id":3,"note":null,"payload":null}]`
+
+	service := NewMetricService(&mockRepository{multiRowResult: newRows()}, metrics, nil, Options{})
+	results, err := service.GetMetric(context.Background(), "events", nil, models.QueryOptions{})
+	if err != nil {
+		t.Fatalf("GetMetric() error = %v", err)
+	}
+	got, err := json.Marshal(results[0].Value)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("JSON = %s, want %s", got, want)
+	}
+
+	// Streamed rows are embedded the same way.
+	service = NewMetricService(&mockRepository{multiRowResult: newRows()}, metrics, nil, Options{})
+	var streamed []map[string]interface{}
+	err = service.StreamMetric(context.Background(), "events", nil, models.QueryOptions{}, func(row map[string]interface{}) error {
+		streamed = append(streamed, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamMetric() error = %v", err)
+	}
+	if got, _ := json.Marshal(streamed); string(got) != want {
+		t.Errorf("streamed JSON = %s, want %s", got, want)
+	}
+}
+
+func TestMetricService_GetMetric_BoolColumns(t *testing.T) {
+	metrics := []models.Metric{{
+		Name:        "users",
+		Query:       "SELECT id, is_active, is_admin FROM users",
+		MultiRow:    true,
+		BoolColumns: []string{"is_active"},
+	}}
+	newRows := func() []map[string]interface{} {
+		return []map[string]interface{}{
+			{"id": int64(1), "is_active": int64(1), "is_admin": int64(1)},
+			{"id": int64(2), "is_active": int64(0), "is_admin": int64(0)},
+			{"id": int64(3), "is_active": nil, "is_admin": nil},
+		}
+	}
+	want := `[{"id":1,"is_active":true,"is_admin":1},` +
+		`{"id":2,"is_active":false,"is_admin":0},` +
+		`{"id":3,"is_active":null,"is_admin":null}]`
+
+	service := NewMetricService(&mockRepository{multiRowResult: newRows()}, metrics, nil, Options{})
+	results, err := service.GetMetric(context.Background(), "users", nil, models.QueryOptions{})
+	if err != nil {
+		t.Fatalf("GetMetric() error = %v", err)
+	}
+	if got, _ := json.Marshal(results[0].Value); string(got) != want {
+		t.Errorf("JSON = %s, want %s", got, want)
+	}
+
+	// Streamed rows are converted the same way.
+	service = NewMetricService(&mockRepository{multiRowResult: newRows()}, metrics, nil, Options{})
+	var streamed []map[string]interface{}
+	err = service.StreamMetric(context.Background(), "users", nil, models.QueryOptions{}, func(row map[string]interface{}) error {
+		streamed = append(streamed, row)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamMetric() error = %v", err)
+	}
+	if got, _ := json.Marshal(streamed); string(got) != want {
+		t.Errorf("streamed JSON = %s, want %s", got, want)
+	}
+}
+
+func TestMetricService_GetMetric_OmitNulls(t *testing.T) {
+	// Rows as the repository test fixture returns them, where Bob's
+	// optional column is NULL.
+	newRows := func() []map[string]interface{} {
+		return []map[string]interface{}{
+			{"name": "Alice", "optional": "value1"},
+			{"name": "Bob", "optional": nil},
+			{"name": "Charlie", "optional": "value3"},
+		}
+	}
+	withNulls := `[{"name":"Alice","optional":"value1"},{"name":"Bob","optional":null},{"name":"Charlie","optional":"value3"}]`
+	omitted := `[{"name":"Alice","optional":"value1"},{"name":"Bob"},{"name":"Charlie","optional":"value3"}]`
+
+	get := func(t *testing.T, service *MetricService, name string, opts models.QueryOptions) string {
+		t.Helper()
+		results, err := service.GetMetric(context.Background(), name, nil, opts)
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		got, _ := json.Marshal(results[0].Value)
+		return string(got)
+	}
+
+	t.Run("metric setting", func(t *testing.T) {
+		metrics := []models.Metric{{Name: "test_data", Query: "SELECT name, optional FROM test_data", MultiRow: true, OmitNulls: true}}
+		service := NewMetricService(&mockRepository{multiRowResult: newRows()}, metrics, nil, Options{})
+
+		if got := get(t, service, "test_data", models.QueryOptions{}); got != omitted {
+			t.Errorf("JSON = %s, want %s", got, omitted)
+		}
+	})
+
+	t.Run("query option leaves cached rows intact", func(t *testing.T) {
+		metrics := []models.Metric{{Name: "test_data", Query: "SELECT name, optional FROM test_data", MultiRow: true, CacheTTL: time.Minute}}
+		service := NewMetricService(&mockRepository{multiRowResult: newRows()}, metrics, nil, Options{})
+
+		for _, tt := range []struct {
+			omitNulls bool
+			want      string
+		}{
+			{omitNulls: true, want: omitted},
+			{omitNulls: false, want: withNulls},
+			{omitNulls: true, want: omitted},
+		} {
+			if got := get(t, service, "test_data", models.QueryOptions{OmitNulls: tt.omitNulls}); got != tt.want {
+				t.Errorf("OmitNulls %v: JSON = %s, want %s", tt.omitNulls, got, tt.want)
+			}
+		}
+	})
+
+	t.Run("streamed", func(t *testing.T) {
+		metrics := []models.Metric{{Name: "test_data", Query: "SELECT name, optional FROM test_data", MultiRow: true}}
+		service := NewMetricService(&mockRepository{multiRowResult: newRows()}, metrics, nil, Options{})
+
+		var streamed []map[string]interface{}
+		err := service.StreamMetric(context.Background(), "test_data", nil, models.QueryOptions{OmitNulls: true}, func(row map[string]interface{}) error {
+			streamed = append(streamed, row)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("StreamMetric() error = %v", err)
+		}
+		if got, _ := json.Marshal(streamed); string(got) != omitted {
+			t.Errorf("streamed JSON = %s, want %s", got, omitted)
+		}
+	})
+}
+
+// failingQueryRepository fails any query reading failTable with err and
+// answers the rest from the embedded mockRepository.
+type failingQueryRepository struct {
+	*mockRepository
+	failTable string
+	err       error
+	queries   []string
+	args      [][]interface{}
+}
+
+func (r *failingQueryRepository) QuerySingleValue(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+	r.queries = append(r.queries, query)
+	r.args = append(r.args, args)
+	if r.failTable != "" && strings.Contains(query, r.failTable) {
+		return nil, r.err
+	}
+	return r.mockRepository.QuerySingleValue(ctx, query, args...)
+}
+
+func TestMetricService_GetMetric_FallbackQuery(t *testing.T) {
+	metric := models.Metric{
+		Name:          "revenue",
+		Query:         "SELECT total FROM mv_revenue WHERE region = :region",
+		FallbackQuery: "SELECT SUM(amount) FROM orders WHERE region = :region",
+		Params:        []models.ParamDefinition{{Name: "region", Type: models.ParamTypeString, Required: true}},
+		CacheTTL:      time.Minute,
+	}
+	params := map[string]string{"region": "eu"}
+	viewErr := &repository.QueryError{Op: "query", Query: metric.Query, Err: errors.New("no such table: mv_revenue")}
+
+	t.Run("primary fails", func(t *testing.T) {
+		repo := &failingQueryRepository{mockRepository: &mockRepository{singleValueResult: int64(42)}, failTable: "mv_revenue", err: viewErr}
+		service := NewMetricService(repo, []models.Metric{metric}, nil, Options{})
+
+		results, err := service.GetMetric(context.Background(), "revenue", params, models.QueryOptions{})
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		if results[0].Value != int64(42) || !results[0].Degraded {
+			t.Errorf("result = %+v, want degraded value 42", results[0])
+		}
+		wantQueries := []string{"SELECT total FROM mv_revenue WHERE region = ?", "SELECT SUM(amount) FROM orders WHERE region = ?"}
+		if !reflect.DeepEqual(repo.queries, wantQueries) {
+			t.Errorf("queries = %q, want %q", repo.queries, wantQueries)
+		}
+		if !reflect.DeepEqual(repo.args[1], []interface{}{"eu"}) {
+			t.Errorf("fallback args = %v, want [eu]", repo.args[1])
+		}
+
+		// A degraded result is not cached, so the primary is tried again.
+		if _, err := service.GetMetric(context.Background(), "revenue", params, models.QueryOptions{}); err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		if len(repo.queries) != 4 {
+			t.Errorf("queries after second request = %d, want 4", len(repo.queries))
+		}
+	})
+
+	t.Run("primary succeeds", func(t *testing.T) {
+		repo := &failingQueryRepository{mockRepository: &mockRepository{singleValueResult: int64(40)}}
+		service := NewMetricService(repo, []models.Metric{metric}, nil, Options{})
+
+		results, err := service.GetMetric(context.Background(), "revenue", params, models.QueryOptions{})
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		if results[0].Degraded || len(repo.queries) != 1 {
+			t.Errorf("result = %+v after %d queries, want one query and no degradation", results[0], len(repo.queries))
+		}
+	})
+
+	t.Run("no rows is not a failure", func(t *testing.T) {
+		repo := &failingQueryRepository{mockRepository: &mockRepository{}, failTable: "mv_revenue", err: repository.ErrNoRows}
+		service := NewMetricService(repo, []models.Metric{metric}, nil, Options{})
+
+		if _, err := service.GetMetric(context.Background(), "revenue", params, models.QueryOptions{}); !errors.Is(err, repository.ErrNoRows) {
+			t.Errorf("GetMetric() error = %v, want ErrNoRows", err)
+		}
+		if len(repo.queries) != 1 {
+			t.Errorf("queries = %q, want only the primary", repo.queries)
+		}
+	})
+
+	t.Run("fallback fails too", func(t *testing.T) {
+		fallbackErr := &repository.QueryError{Op: "query", Query: metric.FallbackQuery, Err: errors.New("database is locked")}
+		repo := &failingQueryRepository{mockRepository: &mockRepository{singleValueErr: fallbackErr}, failTable: "mv_revenue", err: viewErr}
+		service := NewMetricService(repo, []models.Metric{metric}, nil, Options{})
+
+		_, err := service.GetMetric(context.Background(), "revenue", params, models.QueryOptions{})
+		if !errors.Is(err, ErrQueryFailed) || !strings.Contains(err.Error(), "database is locked") {
+			t.Errorf("GetMetric() error = %v, want the fallback's query failure", err)
+		}
+	})
+}
+
+func TestMetricService_StreamMetric(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:     "users_since",
+			Query:    "SELECT id FROM users WHERE created > ?",
+			MultiRow: true,
+			Params:   []models.ParamDefinition{{Name: "since", Type: models.ParamTypeDate, Required: true}},
+		},
+		{Name: "user_count", Query: "SELECT COUNT(*) FROM users"},
+	}
+	rows := []map[string]interface{}{{"id": int64(1)}, {"id": int64(2)}}
+	service := NewMetricService(&mockRepository{multiRowResult: rows}, metrics, nil, Options{MaxRows: 1})
+
+	var got []map[string]interface{}
+	collect := func(row map[string]interface{}) error {
+		got = append(got, row)
+		return nil
+	}
+
+	// MaxRows does not apply, since rows are never held together.
+	if err := service.StreamMetric(context.Background(), "users_since", map[string]string{"since": "2025-01-01"}, models.QueryOptions{}, collect); err != nil {
+		t.Fatalf("StreamMetric() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, rows) {
+		t.Errorf("streamed rows = %v, want %v", got, rows)
+	}
+
+	tests := []struct {
+		name    string
+		metric  string
+		params  map[string]string
+		wantErr error
+	}{
+		{name: "unknown metric", metric: "nope", wantErr: ErrMetricNotFound},
+		{name: "single-value metric", metric: "user_count", wantErr: ErrParamInvalid},
+		{name: "missing param", metric: "users_since", wantErr: ErrParamMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := service.StreamMetric(context.Background(), tt.metric, tt.params, models.QueryOptions{}, collect); !errors.Is(err, tt.wantErr) {
+				t.Errorf("StreamMetric() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMetricService_GetMetric_Cache(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:     "cached",
+			Query:    "SELECT COUNT(*) FROM users WHERE id > ?",
+			CacheTTL: time.Minute,
+			Params: []models.ParamDefinition{
+				{Name: "min_id", Type: models.ParamTypeInt, Required: true},
+			},
+		},
+		{
+			Name:  "uncached",
+			Query: "SELECT COUNT(*) FROM users",
+		},
+	}
+
+	t.Run("second call within TTL is served from cache", func(t *testing.T) {
+		repo := &mockRepository{singleValueResult: int64(7)}
+		service := NewMetricService(repo, metrics, nil, Options{})
+		params := map[string]string{"min_id": "10"}
+
+		for i := 0; i < 2; i++ {
+			results, err := service.GetMetric(context.Background(), "cached", params, models.QueryOptions{})
+			if err != nil {
+				t.Fatalf("GetMetric() error = %v", err)
+			}
+			if results[0].Value != int64(7) {
+				t.Errorf("GetMetric() Value = %v, want 7", results[0].Value)
+			}
+		}
+
+		if repo.queryCalls.Load() != 1 {
+			t.Errorf("repository called %d times, want 1", repo.queryCalls.Load())
+		}
+	})
+
+	t.Run("different params are cached separately", func(t *testing.T) {
+		repo := &mockRepository{singleValueResult: int64(7)}
+		service := NewMetricService(repo, metrics, nil, Options{})
+
+		service.GetMetric(context.Background(), "cached", map[string]string{"min_id": "10"}, models.QueryOptions{})
+		service.GetMetric(context.Background(), "cached", map[string]string{"min_id": "20"}, models.QueryOptions{})
+
+		if repo.queryCalls.Load() != 2 {
+			t.Errorf("repository called %d times, want 2", repo.queryCalls.Load())
+		}
+	})
+
+	t.Run("expired entry is refreshed", func(t *testing.T) {
+		repo := &mockRepository{singleValueResult: int64(7)}
+		service := NewMetricService(repo, metrics, nil, Options{})
+		now := time.Now()
+		service.cache.now = func() time.Time { return now }
+		params := map[string]string{"min_id": "10"}
+
+		service.GetMetric(context.Background(), "cached", params, models.QueryOptions{})
+		now = now.Add(2 * time.Minute)
+		service.GetMetric(context.Background(), "cached", params, models.QueryOptions{})
+
+		if repo.queryCalls.Load() != 2 {
+			t.Errorf("repository called %d times, want 2", repo.queryCalls.Load())
+		}
+	})
+
+	t.Run("zero TTL is not cached", func(t *testing.T) {
+		repo := &mockRepository{singleValueResult: int64(7)}
+		service := NewMetricService(repo, metrics, nil, Options{})
+
+		service.GetMetric(context.Background(), "uncached", nil, models.QueryOptions{})
+		service.GetMetric(context.Background(), "uncached", nil, models.QueryOptions{})
+
+		if repo.queryCalls.Load() != 2 {
+			t.Errorf("repository called %d times, want 2", repo.queryCalls.Load())
+		}
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		repo := &mockRepository{singleValueErr: errQueryFailed}
+		service := NewMetricService(repo, metrics, nil, Options{})
+		params := map[string]string{"min_id": "10"}
+
+		service.GetMetric(context.Background(), "cached", params, models.QueryOptions{})
+		service.GetMetric(context.Background(), "cached", params, models.QueryOptions{})
+
+		if repo.queryCalls.Load() != 2 {
+			t.Errorf("repository called %d times, want 2", repo.queryCalls.Load())
+		}
+	})
+}
+
+func TestMetricService_GetMetric_GeneratedAt(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "live", Query: "SELECT COUNT(*) FROM sessions"},
+		{Name: "cached", Query: "SELECT COUNT(*) FROM users", CacheTTL: time.Minute},
+		{Name: "ratio", Formula: "live / cached"},
+	}
+
+	get := func(t *testing.T, service *MetricService, name string) models.MetricResult {
+		t.Helper()
+		results, err := service.GetMetric(context.Background(), name, nil, models.QueryOptions{})
+		if err != nil {
+			t.Fatalf("GetMetric(%s) error = %v", name, err)
+		}
+		return results[0]
+	}
+
+	t.Run("set at query time", func(t *testing.T) {
+		service := NewMetricService(&mockRepository{singleValueResult: int64(3)}, metrics, nil, Options{})
+
+		before := time.Now()
+		got := get(t, service, "live").GeneratedAt
+		if got.Before(before) || got.After(time.Now()) {
+			t.Errorf("GeneratedAt = %v, want the time of the query", got)
+		}
+		if got.Location() != time.UTC {
+			t.Errorf("GeneratedAt = %v, want UTC", got)
+		}
+	})
+
+	t.Run("cached result keeps its query time", func(t *testing.T) {
+		service := NewMetricService(&mockRepository{singleValueResult: int64(3)}, metrics, nil, Options{})
+
+		first := get(t, service, "cached").GeneratedAt
+		time.Sleep(time.Millisecond)
+		if second := get(t, service, "cached").GeneratedAt; !second.Equal(first) {
+			t.Errorf("cached GeneratedAt = %v, want %v from the first query", second, first)
+		}
+		if fresh := get(t, service, "live").GeneratedAt; !fresh.After(first) {
+			t.Errorf("uncached GeneratedAt = %v, want later than %v", fresh, first)
+		}
+	})
+
+	t.Run("formula takes its oldest input", func(t *testing.T) {
+		service := NewMetricService(&mockRepository{singleValueResult: int64(3)}, metrics, nil, Options{})
+
+		cachedAt := get(t, service, "cached").GeneratedAt
+		time.Sleep(time.Millisecond)
+		if got := get(t, service, "ratio").GeneratedAt; !got.Equal(cachedAt) {
+			t.Errorf("GeneratedAt = %v, want %v from the cached input", got, cachedAt)
+		}
+	})
+}
+
+func TestMetricService_GetMetrics_Format(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "revenue", Query: "SELECT SUM(amount) FROM orders", Unit: "USD", Format: models.FormatCurrency, CacheTTL: time.Minute},
+		{Name: "conversion", Query: "SELECT 0.25", Format: models.FormatPercent},
+		{Name: "visits", Query: "SELECT COUNT(*) FROM visits"},
+		{Name: "revenue_per_visit", Formula: "revenue / visits", Unit: "USD", Format: models.FormatCurrency},
+	}
+	repo := &mockRepository{singleValueResult: int64(4)}
+	service := NewMetricService(repo, metrics, nil, Options{})
+
+	// Run twice so the cached revenue result is checked as well.
+	for pass := range 2 {
+		calls := repo.queryCalls.Load()
+		results, err := service.GetMetrics(context.Background(), []string{"revenue", "conversion", "visits", "revenue_per_visit"}, nil, models.QueryOptions{})
+		if err != nil {
+			t.Fatalf("GetMetrics() error = %v", err)
+		}
+
+		want := []struct {
+			unit   string
+			format models.Format
+		}{
+			{"USD", models.FormatCurrency},
+			{"", models.FormatPercent},
+			{"", ""},
+			{"USD", models.FormatCurrency},
+		}
+		for i, result := range results {
+			if result.Unit != want[i].unit || result.Format != want[i].format {
+				t.Errorf("%s unit, format = %q, %q, want %q, %q", result.Name, result.Unit, result.Format, want[i].unit, want[i].format)
+			}
+		}
+		// conversion, visits and the formula's visits; revenue is cached
+		if got := repo.queryCalls.Load() - calls; pass == 1 && got != 3 {
+			t.Errorf("second pass ran %d queries, want 3 with revenue from cache", got)
+		}
+	}
+}
+
+func TestMetricService_GetMetric_Debug(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "user_count", Query: "SELECT COUNT(*) FROM users"},
+		{Name: "cached_count", Query: "SELECT COUNT(*) FROM orders", CacheTTL: time.Minute},
+	}
+
+	t.Run("duration reported when requested", func(t *testing.T) {
+		service := NewMetricService(&mockRepository{singleValueResult: int64(3)}, metrics, nil, Options{})
+
+		results, err := service.GetMetrics(context.Background(), []string{"user_count"}, nil, models.QueryOptions{Debug: true})
+		if err != nil {
+			t.Fatalf("GetMetrics() error = %v", err)
+		}
+		if results[0].DurationMS == nil {
+			t.Fatal("DurationMS = nil, want a duration")
+		}
+		if *results[0].DurationMS < 0 {
+			t.Errorf("DurationMS = %v, want non-negative", *results[0].DurationMS)
+		}
+
+		body, err := json.Marshal(results[0])
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		if !strings.Contains(string(body), `"duration_ms":`) {
+			t.Errorf("JSON %s lacks duration_ms", body)
+		}
+	})
+
+	t.Run("duration omitted by default", func(t *testing.T) {
+		service := NewMetricService(&mockRepository{singleValueResult: int64(3)}, metrics, nil, Options{})
+
+		results, err := service.GetMetrics(context.Background(), []string{"user_count"}, nil, models.QueryOptions{})
+		if err != nil {
+			t.Fatalf("GetMetrics() error = %v", err)
+		}
+		if results[0].DurationMS != nil {
+			t.Errorf("DurationMS = %v, want nil", *results[0].DurationMS)
+		}
+	})
+
+	t.Run("cache hit has no duration", func(t *testing.T) {
+		repo := &mockRepository{singleValueResult: int64(3)}
+		service := NewMetricService(repo, metrics, nil, Options{})
+		opts := models.QueryOptions{Debug: true}
+
+		first, err := service.GetMetric(context.Background(), "cached_count", nil, opts)
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		if first[0].DurationMS == nil {
+			t.Error("first call DurationMS = nil, want a duration")
+		}
+
+		second, err := service.GetMetric(context.Background(), "cached_count", nil, opts)
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		if second[0].DurationMS != nil {
+			t.Errorf("cached call DurationMS = %v, want nil", *second[0].DurationMS)
+		}
+	})
+}
+
+// flakyRepository fails its first failures queries with err.
+type flakyRepository struct {
+	mockRepository
+	failures int
+	err      error
+	calls    int
+}
+
+func (r *flakyRepository) QuerySingleValue(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+	r.calls++
+	if r.calls <= r.failures {
+		return nil, r.err
+	}
+	return r.mockRepository.QuerySingleValue(ctx, query, args...)
+}
+
+func TestMetricService_GetMetric_Retry(t *testing.T) {
+	metrics := []models.Metric{{Name: "user_count", Query: "SELECT COUNT(*) FROM users"}}
+	transient := fmt.Errorf("query failed: %w", driver.ErrBadConn)
+
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		retries   int
+		wantCalls int
+		wantErr   bool
+	}{
+		{name: "succeeds after transient failures", failures: 2, err: transient, retries: 3, wantCalls: 3},
+		{name: "gives up after retries", failures: 5, err: transient, retries: 2, wantCalls: 3, wantErr: true},
+		{name: "retries disabled", failures: 1, err: transient, retries: 0, wantCalls: 1, wantErr: true},
+		{name: "query errors not retried", failures: 1, err: errors.New("no such table: users"), retries: 3, wantCalls: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &flakyRepository{mockRepository: mockRepository{singleValueResult: int64(9)}, failures: tt.failures, err: tt.err}
+			service := NewMetricService(repo, metrics, nil, Options{Retries: tt.retries, RetryDelay: time.Millisecond})
+
+			results, err := service.GetMetric(context.Background(), "user_count", nil, models.QueryOptions{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetMetric() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && results[0].Value != int64(9) {
+				t.Errorf("Value = %v, want 9", results[0].Value)
+			}
+			if repo.calls != tt.wantCalls {
+				t.Errorf("queries = %d, want %d", repo.calls, tt.wantCalls)
+			}
+		})
+	}
+
+	t.Run("stops when the deadline would pass", func(t *testing.T) {
+		repo := &flakyRepository{failures: 5, err: transient}
+		service := NewMetricService(repo, metrics, nil, Options{Retries: 3, RetryDelay: time.Hour})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		start := time.Now()
+		if _, err := service.GetMetric(ctx, "user_count", nil, models.QueryOptions{}); !errors.Is(err, driver.ErrBadConn) {
+			t.Errorf("GetMetric() error = %v, want the query's error", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("GetMetric() took %v, want an immediate failure", elapsed)
+		}
+		if repo.calls != 1 {
+			t.Errorf("queries = %d, want 1", repo.calls)
+		}
+	})
+}
+
+func TestMetricService_QueryInstrumentation(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "instrumented_ok", Query: "SELECT 1"},
+		{Name: "instrumented_fail", Query: "SELECT broken"},
+	}
+
+	repo := &queryFailingRepository{failQueries: map[string]bool{"SELECT broken": true}}
+	service := NewMetricService(repo, metrics, nil, Options{})
+
+	service.GetMetric(context.Background(), "instrumented_ok", nil, models.QueryOptions{})
+	service.GetMetric(context.Background(), "instrumented_fail", nil, models.QueryOptions{})
+
+	if got := testutil.ToFloat64(metricQueriesTotal.WithLabelValues("instrumented_ok")); got != 1 {
+		t.Errorf("queries for instrumented_ok = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metricQueryFailuresTotal.WithLabelValues("instrumented_ok")); got != 0 {
+		t.Errorf("failures for instrumented_ok = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(metricQueriesTotal.WithLabelValues("instrumented_fail")); got != 1 {
+		t.Errorf("queries for instrumented_fail = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(metricQueryFailuresTotal.WithLabelValues("instrumented_fail")); got != 1 {
+		t.Errorf("failures for instrumented_fail = %v, want 1", got)
+	}
+}
+
+// recordingRepository captures each query and its arguments.
+type recordingRepository struct {
+	mockRepository
+	queries []string
+	args    [][]interface{}
+}
+
+func (r *recordingRepository) QuerySingleValue(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+	r.queries = append(r.queries, query)
+	r.args = append(r.args, args)
+	return r.mockRepository.QuerySingleValue(ctx, query, args...)
+}
+
+func (r *recordingRepository) QueryMultiRowColumns(ctx context.Context, query string, args ...interface{}) ([]string, []map[string]interface{}, error) {
+	r.queries = append(r.queries, query)
+	r.args = append(r.args, args)
+	return r.mockRepository.QueryMultiRowColumns(ctx, query, args...)
+}
+
+func TestMetricService_GetMetric_Columns(t *testing.T) {
+	metrics := []models.Metric{{Name: "users", Query: "SELECT name, id, email FROM users", MultiRow: true}}
+	columns := []string{"name", "id", "email"}
+	repo := &mockRepository{
+		singleValueResult: int64(1),
+		multiRowResult:    []map[string]interface{}{{"name": "Alice", "id": int64(1), "email": nil}},
+		multiRowColumns:   columns,
+	}
+	service := NewMetricService(repo, metrics, nil, Options{})
+
+	for _, opts := range []models.QueryOptions{{}, {Limit: 10}} {
+		results, err := service.GetMetric(context.Background(), "users", nil, opts)
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		if !reflect.DeepEqual(results[0].Columns, columns) {
+			t.Errorf("opts %+v: Columns = %v, want %v", opts, results[0].Columns, columns)
+		}
+	}
+}
+
+func TestMetricService_GetMetric_Pagination(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:     "signups",
+			Query:    "SELECT day, count FROM signups WHERE count > ?;",
+			MultiRow: true,
+			CacheTTL: time.Minute,
+			Params: []models.ParamDefinition{
+				{Name: "min", Type: models.ParamTypeInt, Required: true},
+			},
+		},
+		{Name: "total", Query: "SELECT COUNT(*) FROM users"},
+	}
+	params := map[string]string{"min": "5"}
+
+	t.Run("wraps query with limit and offset and reports total", func(t *testing.T) {
+		repo := &recordingRepository{mockRepository: mockRepository{
+			singleValueResult: int64(42),
+			multiRowResult:    []map[string]interface{}{{"day": "2025-01-01", "count": int64(9)}},
+		}}
+		service := NewMetricService(repo, metrics, nil, Options{})
+
+		results, err := service.GetMetric(context.Background(), "signups", params, models.QueryOptions{Limit: 10, Offset: 20})
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+
+		wantPage := models.Page{Limit: 10, Offset: 20, Total: 42}
+		if results[0].Page == nil || *results[0].Page != wantPage {
+			t.Errorf("GetMetric() Page = %+v, want %+v", results[0].Page, wantPage)
+		}
+
+		wantQueries := []string{
+			"SELECT COUNT(*) FROM (SELECT day, count FROM signups WHERE count > ?) AS counted",
+			"SELECT * FROM (SELECT day, count FROM signups WHERE count > ?) AS paged LIMIT ? OFFSET ?",
+		}
+		if len(repo.queries) != len(wantQueries) {
+			t.Fatalf("ran %d queries, want %d", len(repo.queries), len(wantQueries))
+		}
+		for i, want := range wantQueries {
+			if repo.queries[i] != want {
+				t.Errorf("query %d = %q, want %q", i, repo.queries[i], want)
+			}
+		}
+		if got := repo.args[1]; len(got) != 3 || got[1] != 10 || got[2] != 20 {
+			t.Errorf("page args = %v, want [5 10 20]", got)
+		}
+	})
+
+	t.Run("pages are cached separately", func(t *testing.T) {
+		repo := &recordingRepository{mockRepository: mockRepository{singleValueResult: int64(42)}}
+		service := NewMetricService(repo, metrics, nil, Options{})
+
+		service.GetMetric(context.Background(), "signups", params, models.QueryOptions{Limit: 10})
+		service.GetMetric(context.Background(), "signups", params, models.QueryOptions{Limit: 10, Offset: 10})
+		service.GetMetric(context.Background(), "signups", params, models.QueryOptions{Limit: 10})
+
+		if len(repo.queries) != 4 {
+			t.Errorf("ran %d queries, want 4", len(repo.queries))
+		}
+	})
+
+	t.Run("single-value metrics ignore pagination", func(t *testing.T) {
+		repo := &recordingRepository{mockRepository: mockRepository{singleValueResult: int64(3)}}
+		service := NewMetricService(repo, metrics, nil, Options{})
+
+		results, err := service.GetMetric(context.Background(), "total", nil, models.QueryOptions{Limit: 10})
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		if results[0].Page != nil {
+			t.Errorf("GetMetric() Page = %+v, want nil", results[0].Page)
+		}
+		if repo.queries[0] != "SELECT COUNT(*) FROM users" {
+			t.Errorf("query = %q, want unchanged", repo.queries[0])
+		}
+	})
+}
+
+func TestMetricService_GetMetric_NamedParams(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:  "signups_between",
+			Query: "SELECT COUNT(*) FROM users WHERE created >= :start_date AND created < :end_date AND plan = :plan OR :plan = 'all'",
+			Params: []models.ParamDefinition{
+				{Name: "plan", Type: models.ParamTypeString, Required: true},
+				{Name: "end_date", Type: models.ParamTypeDate, Required: true},
+				{Name: "start_date", Type: models.ParamTypeDate, Required: true},
+			},
+		},
+	}
+
+	repo := &recordingRepository{mockRepository: mockRepository{singleValueResult: int64(12)}}
+	service := NewMetricService(repo, metrics, nil, Options{})
+
+	params := map[string]string{"start_date": "2025-01-01", "end_date": "2025-02-01", "plan": "pro"}
+	if _, err := service.GetMetric(context.Background(), "signups_between", params, models.QueryOptions{}); err != nil {
+		t.Fatalf("GetMetric() error = %v", err)
+	}
+
+	wantQuery := "SELECT COUNT(*) FROM users WHERE created >= ? AND created < ? AND plan = ? OR ? = 'all'"
+	if repo.queries[0] != wantQuery {
+		t.Errorf("query = %q, want %q", repo.queries[0], wantQuery)
+	}
+	wantArgs := []interface{}{"2025-01-01", "2025-02-01", "pro", "pro"}
+	if !reflect.DeepEqual(repo.args[0], wantArgs) {
+		t.Errorf("args = %v, want %v", repo.args[0], wantArgs)
+	}
+}
+
+func TestMetricService_GetMetric_ParamAliases(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:  "signups_between",
+			Query: "SELECT COUNT(*) FROM users WHERE created >= :start_date AND created < :end_date",
+			Params: []models.ParamDefinition{
+				{Name: "start_date", Type: models.ParamTypeDate, Required: true, Aliases: []string{"from"}},
+				{Name: "end_date", Type: models.ParamTypeDate, Default: "2025-12-31", Aliases: []string{"to", "until"}},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		params   map[string]string
+		wantArgs []interface{}
+		wantErr  string
+	}{
+		{name: "canonical names", params: map[string]string{"start_date": "2025-01-01", "end_date": "2025-02-01"}, wantArgs: []interface{}{"2025-01-01", "2025-02-01"}},
+		{name: "aliases", params: map[string]string{"from": "2025-01-01", "to": "2025-02-01"}, wantArgs: []interface{}{"2025-01-01", "2025-02-01"}},
+		{name: "second alias", params: map[string]string{"start_date": "2025-01-01", "until": "2025-03-01"}, wantArgs: []interface{}{"2025-01-01", "2025-03-01"}},
+		{name: "alias with default", params: map[string]string{"from": "2025-01-01"}, wantArgs: []interface{}{"2025-01-01", "2025-12-31"}},
+		{name: "same value twice", params: map[string]string{"start_date": "2025-01-01", "from": "2025-01-01"}, wantArgs: []interface{}{"2025-01-01", "2025-12-31"}},
+		{name: "conflicting values", params: map[string]string{"start_date": "2025-01-01", "from": "2025-06-01"}, wantErr: `parameter "start_date": parameter given under more than one of its names with different values: "start_date" and "from"`},
+		{name: "conflicting aliases", params: map[string]string{"from": "2025-01-01", "to": "2025-02-01", "until": "2025-03-01"}, wantErr: `"to" and "until"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &recordingRepository{mockRepository: mockRepository{singleValueResult: int64(12)}}
+			service := NewMetricService(repo, metrics, nil, Options{StrictParams: true})
+
+			_, err := service.GetMetrics(context.Background(), []string{"signups_between"}, tt.params, models.QueryOptions{})
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrParamInvalid) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("GetMetrics() error = %v, want ErrParamInvalid containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetMetrics() error = %v", err)
+			}
+			if !reflect.DeepEqual(repo.args[0], tt.wantArgs) {
+				t.Errorf("args = %v, want %v", repo.args[0], tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestMetricService_GetMetric_ListParams(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:  "orders_by_status",
+			Query: "SELECT COUNT(*) FROM orders WHERE status IN (?) AND total > ?",
+			Params: []models.ParamDefinition{
+				{Name: "status", Type: models.ParamTypeString, List: true, Required: true, AllowedValues: []string{"pending", "shipped", "delivered"}},
+				{Name: "min_total", Type: models.ParamTypeInt, Default: "0"},
+			},
+		},
+		{
+			Name:  "orders_named",
+			Query: "SELECT COUNT(*) FROM orders WHERE id IN (:ids) OR parent_id IN (:ids)",
+			Params: []models.ParamDefinition{
+				{Name: "ids", Type: models.ParamTypeInt, List: true, Required: true},
+			},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		metric    string
+		params    map[string]string
+		wantQuery string
+		wantArgs  []interface{}
+		wantErr   error
+	}{
+		{
+			name:      "positional list expanded",
+			metric:    "orders_by_status",
+			params:    map[string]string{"status": "pending, shipped", "min_total": "10"},
+			wantQuery: "SELECT COUNT(*) FROM orders WHERE status IN (?, ?) AND total > ?",
+			wantArgs:  []interface{}{"pending", "shipped", int64(10)},
+		},
+		{
+			name:      "single element",
+			metric:    "orders_by_status",
+			params:    map[string]string{"status": "delivered"},
+			wantQuery: "SELECT COUNT(*) FROM orders WHERE status IN (?) AND total > ?",
+			wantArgs:  []interface{}{"delivered", int64(0)},
+		},
+		{
+			name:      "empty list binds NULL",
+			metric:    "orders_by_status",
+			params:    map[string]string{"status": ""},
+			wantQuery: "SELECT COUNT(*) FROM orders WHERE status IN (?) AND total > ?",
+			wantArgs:  []interface{}{nil, int64(0)},
+		},
+		{
+			name:      "named list used twice",
+			metric:    "orders_named",
+			params:    map[string]string{"ids": "1,2,3"},
+			wantQuery: "SELECT COUNT(*) FROM orders WHERE id IN (?, ?, ?) OR parent_id IN (?, ?, ?)",
+			wantArgs:  []interface{}{int64(1), int64(2), int64(3), int64(1), int64(2), int64(3)},
+		},
+		{
+			name:    "element not allowed",
+			metric:  "orders_by_status",
+			params:  map[string]string{"status": "pending,lost"},
+			wantErr: ErrParamInvalid,
+		},
+		{
+			name:    "element of wrong type",
+			metric:  "orders_named",
+			params:  map[string]string{"ids": "1,x"},
+			wantErr: ErrParamInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &recordingRepository{mockRepository: mockRepository{singleValueResult: int64(5)}}
+			service := NewMetricService(repo, metrics, nil, Options{})
+
+			_, err := service.GetMetric(context.Background(), tt.metric, tt.params, models.QueryOptions{})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetMetric() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetMetric() error = %v", err)
+			}
+
+			if repo.queries[0] != tt.wantQuery {
+				t.Errorf("query = %q, want %q", repo.queries[0], tt.wantQuery)
+			}
+			if !reflect.DeepEqual(repo.args[0], tt.wantArgs) {
+				t.Errorf("args = %v, want %v", repo.args[0], tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestMetricService_GetMetric_WrapParams(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:  "users_matching",
+			Query: `SELECT COUNT(*) FROM users WHERE name LIKE ? ESCAPE '\' AND email LIKE ? ESCAPE '\'`,
+			Params: []models.ParamDefinition{
+				{Name: "name", Type: models.ParamTypeString, Required: true, Wrap: models.WrapContains},
+				{Name: "domain", Type: models.ParamTypeString, Default: "example.com", Wrap: models.WrapSuffix},
+			},
+		},
+	}
+
+	repo := &recordingRepository{mockRepository: mockRepository{singleValueResult: int64(1)}}
+	service := NewMetricService(repo, metrics, nil, Options{})
+
+	params := map[string]string{"name": "100%_real"}
+	if _, err := service.GetMetric(context.Background(), "users_matching", params, models.QueryOptions{}); err != nil {
+		t.Fatalf("GetMetric() error = %v", err)
+	}
+
+	wantArgs := []interface{}{`%100\%\_real%`, "%example.com"}
+	if !reflect.DeepEqual(repo.args[0], wantArgs) {
+		t.Errorf("args = %q, want %q", repo.args[0], wantArgs)
+	}
+	if repo.queries[0] != metrics[0].Query {
+		t.Errorf("query = %q, want it unchanged", repo.queries[0])
+	}
+}
+
+func TestMetricService_GetMetric_ErrorKinds(t *testing.T) {
+	minRows := 1.0
+	metrics := []models.Metric{
+		{
+			Name:  "signups",
+			Query: "SELECT COUNT(*) FROM users WHERE created > ? LIMIT ?",
+			Params: []models.ParamDefinition{
+				{Name: "since", Type: models.ParamTypeDate, Required: true},
+				{Name: "max_rows", Type: models.ParamTypeInt, Default: "10", Min: &minRows},
+			},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		metric string
+		params map[string]string
+		opts   models.QueryOptions
+		want   error
+	}{
+		{name: "unknown metric", metric: "nope", want: ErrMetricNotFound},
+		{name: "missing required param", metric: "signups", want: ErrParamMissing},
+		{name: "unparseable param", metric: "signups", params: map[string]string{"since": "yesterday"}, want: ErrParamInvalid},
+		{name: "out of range param", metric: "signups", params: map[string]string{"since": "2025-01-01", "max_rows": "0"}, want: ErrParamInvalid},
+		{name: "invalid options", metric: "signups", params: map[string]string{"since": "2025-01-01"}, opts: models.QueryOptions{Limit: -1}, want: ErrParamInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewMetricService(&mockRepository{}, metrics, nil, Options{})
+
+			_, err := service.GetMetric(context.Background(), tt.metric, tt.params, tt.opts)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("GetMetric() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("missing param carries the param spec", func(t *testing.T) {
+		service := NewMetricService(&mockRepository{}, metrics, nil, Options{})
+
+		_, err := service.GetMetric(context.Background(), "signups", nil, models.QueryOptions{})
+		var missing *MissingParamError
+		if !errors.As(err, &missing) {
+			t.Fatalf("GetMetric() error = %v, want a MissingParamError", err)
+		}
+		if missing.Metric != "signups" || missing.Param != "since" {
+			t.Errorf("MissingParamError names %s.%s, want signups.since", missing.Metric, missing.Param)
+		}
+		if !reflect.DeepEqual(missing.Params, metrics[0].Params) {
+			t.Errorf("MissingParamError.Params = %+v, want the metric's params", missing.Params)
+		}
+	})
+
+	t.Run("query failures are unclassified", func(t *testing.T) {
+		repo := &mockRepository{singleValueErr: errors.New("invalid input syntax")}
+		service := NewMetricService(repo, metrics, nil, Options{})
+
+		_, err := service.GetMetric(context.Background(), "signups", map[string]string{"since": "2025-01-01"}, models.QueryOptions{})
+		for _, kind := range []error{ErrMetricNotFound, ErrParamMissing, ErrParamInvalid} {
+			if errors.Is(err, kind) {
+				t.Errorf("GetMetric() error %v classified as %v", err, kind)
+			}
+		}
+	})
+}
+
+func TestMetricService_GetMetric_MaxRows(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "all_users", Query: "SELECT * FROM users", MultiRow: true, CacheTTL: time.Minute},
+		{Name: "user_count", Query: "SELECT COUNT(*) FROM users"},
+	}
+	rows := []map[string]interface{}{{"id": int64(1)}, {"id": int64(2)}, {"id": int64(3)}}
+
+	tests := []struct {
+		name    string
+		metric  string
+		maxRows int
+		wantErr bool
+	}{
+		{name: "unlimited", metric: "all_users", maxRows: 0},
+		{name: "at limit", metric: "all_users", maxRows: 3},
+		{name: "over limit", metric: "all_users", maxRows: 2, wantErr: true},
+		{name: "single value ignores limit", metric: "user_count", maxRows: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockRepository{multiRowResult: rows, singleValueResult: int64(3)}
+			service := NewMetricService(repo, metrics, nil, Options{MaxRows: tt.maxRows})
+
+			_, err := service.GetMetric(context.Background(), tt.metric, nil, models.QueryOptions{})
+			if tt.wantErr != errors.Is(err, ErrResultTooLarge) {
+				t.Fatalf("GetMetric() error = %v, want ErrResultTooLarge: %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, ok := service.cache.entries[cacheKey(tt.metric, "SELECT * FROM users", nil)]; ok {
+					t.Error("oversized result was cached")
+				}
+			}
+		})
+	}
+}
+
+func TestMetricService_GetMetric_MetricMaxRows(t *testing.T) {
+	// The mock ignores LIMIT, so it always returns the repository test
+	// fixture's three rows, as a query of more rows than the cap would.
+	rows := []map[string]interface{}{
+		{"id": int64(1), "name": "Alice"},
+		{"id": int64(2), "name": "Bob"},
+		{"id": int64(3), "name": "Charlie"},
+	}
+
+	tests := []struct {
+		name          string
+		maxRows       int
+		serverMaxRows int
+		opts          models.QueryOptions
+		wantRows      int
+		wantTruncated bool
+		wantQuery     string
+	}{
+		{name: "truncated", maxRows: 2, wantRows: 2, wantTruncated: true, wantQuery: "SELECT * FROM (SELECT id, name FROM test_data ORDER BY id) AS capped LIMIT ?"},
+		{name: "at the cap", maxRows: 3, wantRows: 3, wantQuery: "SELECT * FROM (SELECT id, name FROM test_data ORDER BY id) AS capped LIMIT ?"},
+		{name: "in place of the server limit", maxRows: 3, serverMaxRows: 2, wantRows: 3, wantQuery: "SELECT * FROM (SELECT id, name FROM test_data ORDER BY id) AS capped LIMIT ?"},
+		{name: "no cap", wantRows: 3, wantQuery: "SELECT id, name FROM test_data ORDER BY id;"},
+		{name: "page over the cap", maxRows: 2, opts: models.QueryOptions{Limit: 10}, wantRows: 2, wantTruncated: true, wantQuery: "SELECT * FROM (SELECT id, name FROM test_data ORDER BY id) AS paged LIMIT ? OFFSET ?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := []models.Metric{{Name: "test_data", Query: "SELECT id, name FROM test_data ORDER BY id;", MultiRow: true, MaxRows: tt.maxRows}}
+			repo := &recordingRepository{mockRepository: mockRepository{singleValueResult: int64(3), multiRowResult: rows}}
+			service := NewMetricService(repo, metrics, nil, Options{MaxRows: tt.serverMaxRows})
+
+			results, err := service.GetMetric(context.Background(), "test_data", nil, tt.opts)
+			if err != nil {
+				t.Fatalf("GetMetric() error = %v", err)
+			}
+			got := results[0].Value.([]map[string]interface{})
+			if len(got) != tt.wantRows || results[0].Truncated != tt.wantTruncated {
+				t.Errorf("got %d rows, truncated %v; want %d, %v", len(got), results[0].Truncated, tt.wantRows, tt.wantTruncated)
+			}
+			if last := repo.queries[len(repo.queries)-1]; last != tt.wantQuery {
+				t.Errorf("query = %q, want %q", last, tt.wantQuery)
+			}
+			if tt.maxRows > 0 && tt.opts.Limit == 0 {
+				if args := repo.args[len(repo.args)-1]; !reflect.DeepEqual(args, []interface{}{tt.maxRows + 1}) {
+					t.Errorf("args = %v, want [%d]", args, tt.maxRows+1)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricService_GetMetric_SingleRow(t *testing.T) {
+	latest := models.Metric{
+		Name:        "latest_order",
+		Query:       "SELECT id, total, items, note FROM orders ORDER BY created_at DESC;",
+		MultiRow:    true,
+		SingleRow:   true,
+		JSONColumns: []string{"items"},
+		CacheTTL:    time.Minute,
+	}
+	// The mock ignores LIMIT, so it returns every row, as a query of more
+	// than one row would without it.
+	rows := []map[string]interface{}{
+		{"id": int64(2), "total": 9.5, "items": `["tea"]`, "note": nil},
+		{"id": int64(1), "total": 3.0, "items": `[]`, "note": "gift"},
+	}
+
+	t.Run("first row", func(t *testing.T) {
+		repo := &recordingRepository{mockRepository: mockRepository{multiRowResult: rows, multiRowColumns: []string{"id", "total", "items", "note"}}}
+		service := NewMetricService(repo, []models.Metric{latest}, nil, Options{MaxRows: 1})
+
+		results, err := service.GetMetric(context.Background(), "latest_order", nil, models.QueryOptions{Limit: 10, OmitNulls: true})
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		want := map[string]interface{}{"id": int64(2), "total": 9.5, "items": json.RawMessage(`["tea"]`)}
+		if !reflect.DeepEqual(results[0].Value, want) {
+			t.Errorf("value = %#v, want %#v", results[0].Value, want)
+		}
+		if results[0].Page != nil {
+			t.Errorf("page = %+v, want none since single_row ignores limit", results[0].Page)
+		}
+		if want := "SELECT * FROM (SELECT id, total, items, note FROM orders ORDER BY created_at DESC) AS first_row LIMIT 1"; repo.queries[0] != want {
+			t.Errorf("query = %q, want %q", repo.queries[0], want)
+		}
+
+		// The cached row keeps its NULL columns for requests without omit_nulls.
+		results, err = service.GetMetric(context.Background(), "latest_order", nil, models.QueryOptions{})
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		if row := results[0].Value.(map[string]interface{}); len(repo.queries) != 1 || row["note"] != nil || len(row) != 4 {
+			t.Errorf("cached value = %#v after %d queries, want all four columns from one query", row, len(repo.queries))
+		}
+	})
+
+	t.Run("no rows", func(t *testing.T) {
+		service := NewMetricService(&mockRepository{}, []models.Metric{latest}, nil, Options{})
+
+		results, err := service.GetMetric(context.Background(), "latest_order", nil, models.QueryOptions{})
+		if err != nil {
+			t.Fatalf("GetMetric() error = %v", err)
+		}
+		if results[0].Value != nil {
+			t.Errorf("value = %#v, want nil", results[0].Value)
+		}
+	})
+
+	t.Run("not streamed", func(t *testing.T) {
+		service := NewMetricService(&mockRepository{multiRowResult: rows}, []models.Metric{latest}, nil, Options{})
+
+		err := service.StreamMetric(context.Background(), "latest_order", nil, models.QueryOptions{}, func(map[string]interface{}) error { return nil })
+		if !errors.Is(err, ErrParamInvalid) {
+			t.Errorf("StreamMetric() error = %v, want ErrParamInvalid", err)
+		}
+	})
+}
+
+// valueRepository returns a fixed single value per query.
+type valueRepository struct {
+	mockRepository
+	values map[string]interface{}
+}
+
+func (v *valueRepository) QuerySingleValue(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+	value, ok := v.values[query]
+	if !ok {
+		return nil, errQueryFailed
+	}
+	return value, nil
+}
+
+func TestMetricService_GetMetric_Computed(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "signups", Query: "SELECT COUNT(*) FROM signups"},
+		{Name: "visitors", Query: "SELECT COUNT(*) FROM visits"},
+		{Name: "refunds", Query: "SELECT COUNT(*) FROM refunds"},
+		{Name: "broken", Query: "SELECT COUNT(*) FROM missing_table"},
+		{
+			Name:   "signups_since",
+			Query:  "SELECT COUNT(*) FROM signups WHERE created_at >= ?",
+			Params: []models.ParamDefinition{{Name: "since", Type: models.ParamTypeString, Required: true}},
+		},
+		{Name: "conversion_rate", Formula: "signups / visitors * 100"},
+		{Name: "net_signups", Formula: "(signups - refunds) / 2"},
+		{Name: "refund_rate", Formula: "refunds / visitors"},
+		{Name: "visitors_per_refund", Formula: "visitors / refunds"},
+		{Name: "nested", Formula: "conversion_rate + 1"},
+		{Name: "null_operand", Formula: "signups + revenue"},
+		{Name: "revenue", Query: "SELECT SUM(amount) FROM orders"},
+		{Name: "failing", Formula: "signups + broken"},
+		{Name: "recent_rate", Formula: "signups_since / visitors"},
+	}
+
+	repo := &valueRepository{values: map[string]interface{}{
+		"SELECT COUNT(*) FROM signups":                       int64(25),
+		"SELECT COUNT(*) FROM visits":                        int64(200),
+		"SELECT COUNT(*) FROM refunds":                       []byte("0"),
+		"SELECT SUM(amount) FROM orders":                     nil,
+		"SELECT COUNT(*) FROM signups WHERE created_at >= ?": 50.0,
+	}}
+	service := NewMetricService(repo, metrics, nil, Options{})
+
+	tests := []struct {
+		name      string
+		metric    string
+		params    map[string]string
+		wantValue interface{}
+		wantErr   error
+	}{
+		{name: "ratio", metric: "conversion_rate", wantValue: 12.5},
+		{name: "parentheses", metric: "net_signups", wantValue: 12.5},
+		{name: "byte-encoded operand", metric: "refund_rate", wantValue: 0.0},
+		{name: "division by zero is null", metric: "visitors_per_refund", wantValue: nil},
+		{name: "formula over formula", metric: "nested", wantValue: 13.5},
+		{name: "null operand is null", metric: "null_operand", wantValue: nil},
+		{name: "dependency failure", metric: "failing", wantErr: errQueryFailed},
+		{name: "params pass to dependencies", metric: "recent_rate", params: map[string]string{"since": "2024-01-01"}, wantValue: 0.25},
+		{name: "missing dependency param", metric: "recent_rate", wantErr: ErrParamMissing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := service.GetMetric(context.Background(), tt.metric, tt.params, models.QueryOptions{})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("GetMetric() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetMetric() error = %v", err)
+			}
+			if results[0].Name != tt.metric {
+				t.Errorf("Name = %q, want %q", results[0].Name, tt.metric)
+			}
+			if results[0].Value != tt.wantValue {
+				t.Errorf("Value = %v, want %v", results[0].Value, tt.wantValue)
+			}
+		})
+	}
+}
+
+// concurrencyRepository records the peak number of queries in flight.
+type concurrencyRepository struct {
+	mockRepository
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (c *concurrencyRepository) QuerySingleValue(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return int64(1), nil
+}
+
+func TestMetricService_GetMetrics_MaxConcurrency(t *testing.T) {
+	var metrics []models.Metric
+	var names []string
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		metrics = append(metrics, models.Metric{Name: name, Query: "SELECT 1"})
+		names = append(names, name)
+	}
+
+	for _, partial := range []bool{false, true} {
+		repo := &concurrencyRepository{}
+		service := NewMetricService(repo, metrics, nil, Options{MaxConcurrency: 2})
+
+		results, err := service.GetMetrics(context.Background(), names, nil, models.QueryOptions{Partial: partial})
+		if err != nil {
+			t.Fatalf("GetMetrics(partial=%v) error = %v", partial, err)
+		}
+		if len(results) != len(names) {
+			t.Errorf("GetMetrics(partial=%v) returned %d results, want %d", partial, len(results), len(names))
+		}
+		if peak := repo.peak.Load(); peak > 2 {
+			t.Errorf("GetMetrics(partial=%v) ran %d queries at once, want at most 2", partial, peak)
+		}
+	}
+}
+
+func TestMetricService_GetMetricSchema(t *testing.T) {
+	metrics := []models.Metric{
+		{
+			Name:     "signups_by_day",
+			Query:    "SELECT date, count FROM signups WHERE date >= :since AND plan = :plan",
+			MultiRow: true,
+			Params: []models.ParamDefinition{
+				{Name: "plan", Type: models.ParamTypeString, Default: "pro"},
+				{Name: "since", Type: models.ParamTypeDate, Required: true},
+			},
+		},
+		{Name: "active_users", Query: "SELECT COUNT(*) FROM users", Unit: "users"},
+	}
+
+	t.Run("multi-row metric", func(t *testing.T) {
+		repo := &columnsRepository{columns: []string{"date", "count"}}
+		service := NewMetricService(repo, metrics, nil, Options{})
+
+		schema, err := service.GetMetricSchema(context.Background(), "signups_by_day")
+		if err != nil {
+			t.Fatalf("GetMetricSchema() error = %v", err)
+		}
+
+		if !reflect.DeepEqual(schema.Columns, []string{"date", "count"}) {
+			t.Errorf("Columns = %v, want [date count]", schema.Columns)
+		}
+		if len(schema.Params) != 2 || !schema.MultiRow {
+			t.Errorf("MetricInfo = %+v, want both params and multi_row", schema.MetricInfo)
+		}
+
+		wantQuery := "SELECT * FROM (SELECT date, count FROM signups WHERE date >= ? AND plan = ?) AS probed LIMIT 0"
+		if repo.query != wantQuery {
+			t.Errorf("query = %q, want %q", repo.query, wantQuery)
+		}
+		// Named order: since has no default so binds nil; plan binds its default
+		if !reflect.DeepEqual(repo.args, []interface{}{nil, "pro"}) {
+			t.Errorf("args = %#v, want [nil pro]", repo.args)
+		}
+	})
+
+	t.Run("single-value metric skips the database", func(t *testing.T) {
+		repo := &columnsRepository{}
+		service := NewMetricService(repo, metrics, nil, Options{})
+
+		schema, err := service.GetMetricSchema(context.Background(), "active_users")
+		if err != nil {
+			t.Fatalf("GetMetricSchema() error = %v", err)
+		}
+		if schema.Columns != nil || schema.Unit != "users" {
+			t.Errorf("schema = %+v, want unit and no columns", schema)
+		}
+		if repo.query != "" {
+			t.Errorf("unexpected query %q", repo.query)
+		}
+	})
+
+	t.Run("unknown metric", func(t *testing.T) {
+		service := NewMetricService(&columnsRepository{}, metrics, nil, Options{})
+
+		_, err := service.GetMetricSchema(context.Background(), "missing")
+		if !errors.Is(err, ErrMetricNotFound) {
+			t.Errorf("GetMetricSchema() error = %v, want %v", err, ErrMetricNotFound)
+		}
+	})
+}
+
+// columnsRepository returns fixed columns and records the probe query.
+type columnsRepository struct {
+	mockRepository
+	columns []string
+	query   string
+	args    []interface{}
+}
+
+func (c *columnsRepository) QueryColumns(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	c.query = query
+	c.args = args
+	return c.columns, nil
+}
+
+// probeRepository fails QueryColumns for any probe mentioning a missing
+// table, recording the probes it receives.
+type probeRepository struct {
+	mockRepository
+	missing string
+	probes  []string
+}
+
+func (p *probeRepository) QueryColumns(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	p.probes = append(p.probes, query)
+	if strings.Contains(query, p.missing) {
+		return nil, fmt.Errorf("no such table: %s", p.missing)
+	}
+	return []string{"value"}, nil
+}
+
+func TestMetricService_ValidateQueries(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "users", Query: "SELECT COUNT(*) FROM users"},
+		{Name: "orders", Query: "SELECT COUNT(*) FROM ordrs WHERE id > ?", Params: []models.ParamDefinition{{Name: "min", Type: models.ParamTypeInt, Required: true}}},
+		{Name: "refunds", Query: "SELECT * FROM ordrs", MultiRow: true},
+		{Name: "orders_per_user", Formula: "orders / users"},
+	}
+	repo := &probeRepository{missing: "ordrs"}
+	service := NewMetricService(repo, metrics, nil, Options{})
+
+	err := service.ValidateQueries(context.Background())
+	if err == nil {
+		t.Fatal("ValidateQueries() error = nil, want failures for orders and refunds")
+	}
+	want := "metric \"orders\": no such table: ordrs\nmetric \"refunds\": no such table: ordrs"
+	if err.Error() != want {
+		t.Errorf("ValidateQueries() error = %q, want %q", err, want)
+	}
+
+	// The computed metric has no query of its own to probe.
+	if len(repo.probes) != 3 {
+		t.Errorf("probed %d queries, want 3", len(repo.probes))
+	}
+	for _, probe := range repo.probes {
+		if !strings.HasSuffix(probe, "LIMIT 0") {
+			t.Errorf("probe %q does not read zero rows", probe)
+		}
+	}
+
+	repo.missing = "no_table_matches_this"
+	if err := service.ValidateQueries(context.Background()); err != nil {
+		t.Errorf("ValidateQueries() error = %v, want nil", err)
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     interface{}
+		valueType models.ValueType
+		want      interface{}
+		wantErr   bool
+	}{
+		{name: "no type keeps int", value: int64(5), want: int64(5)},
+		{name: "no type keeps float", value: 5.5, want: 5.5},
+		{name: "int from int", value: int64(5), valueType: models.ValueTypeInt, want: int64(5)},
+		{name: "int from whole float", value: 5.0, valueType: models.ValueTypeInt, want: int64(5)},
+		{name: "int rounds float", value: 4.6, valueType: models.ValueTypeInt, want: int64(5)},
+		{name: "int from decimal bytes", value: []byte("12.00"), valueType: models.ValueTypeInt, want: int64(12)},
+		{name: "float from int", value: int64(5), valueType: models.ValueTypeFloat, want: 5.0},
+		{name: "float from string", value: "2.25", valueType: models.ValueTypeFloat, want: 2.25},
+		{name: "null stays null", value: nil, valueType: models.ValueTypeFloat, want: nil},
+		{name: "non-numeric string", value: "n/a", valueType: models.ValueTypeInt, wantErr: true},
+		{name: "bool from one", value: int64(1), valueType: models.ValueTypeBool, want: true},
+		{name: "bool from zero", value: int64(0), valueType: models.ValueTypeBool, want: false},
+		{name: "bool from text", value: []byte("t"), valueType: models.ValueTypeBool, want: true},
+		{name: "bool keeps bool", value: false, valueType: models.ValueTypeBool, want: false},
+		{name: "bool stays null", value: nil, valueType: models.ValueTypeBool, want: nil},
+		{name: "bool from other text", value: "yes", valueType: models.ValueTypeBool, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeValue(tt.value, tt.valueType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeValue(%#v, %q) = %#v, want %#v", tt.value, tt.valueType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricService_GetMetric_ValueType(t *testing.T) {
+	metrics := []models.Metric{
+		{Name: "avg_rating", Query: "SELECT AVG(rating) FROM reviews", ValueType: models.ValueTypeFloat},
+		{Name: "rounded_rating", Query: "SELECT AVG(rating) FROM reviews", ValueType: models.ValueTypeInt},
+	}
+
+	// The driver returned an integer this time, e.g. because every rating was whole
+	repo := &mockRepository{singleValueResult: int64(4)}
+	service := NewMetricService(repo, metrics, nil, Options{})
+
+	results, err := service.GetMetrics(context.Background(), []string{"avg_rating", "rounded_rating"}, nil, models.QueryOptions{})
+	if err != nil {
+		t.Fatalf("GetMetrics() error = %v", err)
+	}
+	if results[0].Value != 4.0 {
+		t.Errorf("avg_rating = %#v, want float64 4", results[0].Value)
+	}
+	if results[1].Value != int64(4) {
+		t.Errorf("rounded_rating = %#v, want int64 4", results[1].Value)
+	}
+}
@@ -145,6 +145,108 @@ func TestConvertParamValue(t *testing.T) {
 			want:      nil,
 			wantErr:   true,
 		},
+
+		// Date conversions
+		{
+			name:      "plain date",
+			value:     "2025-01-15",
+			paramType: models.ParamTypeDate,
+			want:      "2025-01-15",
+			wantErr:   false,
+		},
+		{
+			name:      "RFC3339 UTC",
+			value:     "2025-01-15T10:30:00Z",
+			paramType: models.ParamTypeDate,
+			want:      "2025-01-15 10:30:00",
+			wantErr:   false,
+		},
+		{
+			name:      "RFC3339 with offset normalized to UTC",
+			value:     "2025-01-15T23:30:00-02:00",
+			paramType: models.ParamTypeDate,
+			want:      "2025-01-16 01:30:00",
+			wantErr:   false,
+		},
+		{
+			name:      "invalid date - out of range",
+			value:     "2025-13-40",
+			paramType: models.ParamTypeDate,
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid date - wrong format",
+			value:     "15/01/2025",
+			paramType: models.ParamTypeDate,
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid date - empty",
+			value:     "",
+			paramType: models.ParamTypeDate,
+			want:      nil,
+			wantErr:   true,
+		},
+
+		// Timestamp conversions
+		{
+			name:      "epoch timestamp",
+			value:     "1736904600",
+			paramType: models.ParamTypeTimestamp,
+			want:      "2025-01-15 01:30:00",
+			wantErr:   false,
+		},
+		{
+			name:      "timestamp zero",
+			value:     "0",
+			paramType: models.ParamTypeTimestamp,
+			want:      "1970-01-01 00:00:00",
+			wantErr:   false,
+		},
+		{
+			name:      "timestamp at upper bound",
+			value:     "253402300799",
+			paramType: models.ParamTypeTimestamp,
+			want:      "9999-12-31 23:59:59",
+			wantErr:   false,
+		},
+		{
+			name:      "invalid timestamp - negative",
+			value:     "-1",
+			paramType: models.ParamTypeTimestamp,
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid timestamp - past year 9999",
+			value:     "253402300800",
+			paramType: models.ParamTypeTimestamp,
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid timestamp - fractional",
+			value:     "1736904600.5",
+			paramType: models.ParamTypeTimestamp,
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid timestamp - calendar date",
+			value:     "2025-01-15",
+			paramType: models.ParamTypeTimestamp,
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "invalid timestamp - empty",
+			value:     "",
+			paramType: models.ParamTypeTimestamp,
+			want:      nil,
+			wantErr:   true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,116 @@
+// Background refresh of metrics that set refresh_interval into the result cache.
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+// refreshTick is how often RunRefresh checks for metrics due a refresh, and
+// so the finest refresh_interval it honours.
+const refreshTick = time.Second
+
+// refreshSchedule records when each metric is next due a refresh, for the
+// metric set of one generation.
+type refreshSchedule struct {
+	generation int
+	next       map[string]time.Time
+}
+
+// RunRefresh reruns every metric with a refresh_interval on its schedule,
+// with default params, including the config's default params, and caches
+// the result under the key a request without params would use. All are
+// refreshed once at the start. It blocks until ctx is cancelled, so
+// callers wanting a clean shutdown should wait for it to return.
+func (ms *MetricService) RunRefresh(ctx context.Context) {
+	schedule := &refreshSchedule{generation: -1}
+	ms.refreshDue(ctx, schedule, time.Now())
+
+	ticker := time.NewTicker(refreshTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ms.refreshDue(ctx, schedule, now)
+		}
+	}
+}
+
+// refreshDue refreshes, one at a time, each metric whose next refresh in
+// schedule is not after now. A reload clears the cache, so it also makes
+// every metric due again.
+func (ms *MetricService) refreshDue(ctx context.Context, schedule *refreshSchedule, now time.Time) {
+	metrics, generation := ms.refreshable()
+	if generation != schedule.generation {
+		schedule.generation = generation
+		schedule.next = make(map[string]time.Time, len(metrics))
+	}
+
+	for _, metric := range metrics {
+		if ctx.Err() != nil {
+			return
+		}
+		if next, ok := schedule.next[metric.Name]; ok && now.Before(next) {
+			continue
+		}
+		schedule.next[metric.Name] = now.Add(metric.RefreshInterval)
+
+		if err := ms.refresh(ctx, metric); err != nil && ctx.Err() == nil {
+			ms.logger.Warn("metric refresh failed", "metric", metric.Name, "error", err)
+		}
+	}
+}
+
+// refreshable returns the enabled metrics that set refresh_interval, sorted
+// by name, along with the generation of the metric set they came from.
+func (ms *MetricService) refreshable() ([]models.Metric, int) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	var metrics []models.Metric
+	for _, metric := range ms.metrics {
+		if metric.RefreshInterval > 0 && metric.IsEnabled() {
+			metrics = append(metrics, metric)
+		}
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics, ms.generation
+}
+
+// refresh runs metric with its default params, and the config's where it
+// declares them, and caches the result. It is not audited, since no caller
+// asked for it.
+func (ms *MetricService) refresh(ctx context.Context, metric models.Metric) (err error) {
+	ctx, span := startMetricSpan(ctx, "refresh metric", metric.Name)
+	defer func() { endSpan(span, err) }()
+
+	if ms.opts.MetricTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ms.opts.MetricTimeout)
+		defer cancel()
+	}
+
+	params := ms.withDefaults(metric, nil)
+	query, args, err := ms.prepareParams(metric, params)
+	if err != nil {
+		return err
+	}
+	metric.Query = query
+
+	result, _, err := ms.run(ctx, metric, params, args, false, models.QueryOptions{})
+	if err != nil {
+		return err
+	}
+	if result.Degraded {
+		return fmt.Errorf("metric %q: query failed and only fallback_query succeeded", metric.Name)
+	}
+	ms.cache.set(cacheKey(metric.Name, metric.Query, args), result, metric.CacheTTL)
+	return nil
+}
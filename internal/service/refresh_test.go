@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+// signalingRepository reports each single-value query on queried.
+type signalingRepository struct {
+	*mockRepository
+	queried chan struct{}
+}
+
+func (r *signalingRepository) QuerySingleValue(ctx context.Context, query string, args ...interface{}) (interface{}, error) {
+	value, err := r.mockRepository.QuerySingleValue(ctx, query, args...)
+	select {
+	case r.queried <- struct{}{}:
+	default:
+	}
+	return value, err
+}
+
+func refreshMetrics() []models.Metric {
+	return []models.Metric{
+		{
+			Name:            "revenue",
+			Query:           "SELECT SUM(amount) FROM orders WHERE region = ?",
+			Params:          []models.ParamDefinition{{Name: "region", Type: models.ParamTypeString, Default: "eu"}},
+			CacheTTL:        5 * time.Minute,
+			RefreshInterval: time.Minute,
+		},
+		{Name: "orders", Query: "SELECT COUNT(*) FROM orders", CacheTTL: 5 * time.Minute},
+	}
+}
+
+func TestMetricService_RunRefresh(t *testing.T) {
+	repo := &signalingRepository{
+		mockRepository: &mockRepository{singleValueResult: int64(42)},
+		queried:        make(chan struct{}, 1),
+	}
+	service := NewMetricService(repo, refreshMetrics(), nil, Options{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		service.RunRefresh(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-repo.queried:
+	case <-time.After(time.Second):
+		t.Fatal("RunRefresh did not refresh the metric at startup")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunRefresh did not return after cancellation")
+	}
+
+	// Only the metric with a refresh_interval was run.
+	if repo.queryCalls.Load() != 1 {
+		t.Fatalf("queryCalls = %d, want 1", repo.queryCalls.Load())
+	}
+
+	// Requests without params, or with the defaults, find the result cached.
+	for _, params := range []map[string]string{nil, {"region": "eu"}} {
+		results, err := service.GetMetric(context.Background(), "revenue", params, models.QueryOptions{})
+		if err != nil {
+			t.Fatalf("GetMetric(%v) error = %v", params, err)
+		}
+		if results[0].Value != int64(42) {
+			t.Errorf("GetMetric(%v) Value = %v, want 42", params, results[0].Value)
+		}
+	}
+	if repo.queryCalls.Load() != 1 {
+		t.Errorf("queryCalls = %d after requests, want 1 (served from cache)", repo.queryCalls.Load())
+	}
+
+	// Other params still query on demand.
+	if _, err := service.GetMetric(context.Background(), "revenue", map[string]string{"region": "us"}, models.QueryOptions{}); err != nil {
+		t.Fatalf("GetMetric() error = %v", err)
+	}
+	if repo.queryCalls.Load() != 2 {
+		t.Errorf("queryCalls = %d, want 2", repo.queryCalls.Load())
+	}
+}
+
+func TestMetricService_RefreshDue(t *testing.T) {
+	repo := &mockRepository{singleValueResult: int64(42)}
+	service := NewMetricService(repo, refreshMetrics(), nil, Options{})
+	ctx := context.Background()
+	schedule := &refreshSchedule{generation: -1}
+	start := time.Now()
+
+	steps := []struct {
+		name      string
+		at        time.Duration
+		reload    bool
+		wantCalls int64
+	}{
+		{name: "first run", at: 0, wantCalls: 1},
+		{name: "within interval", at: 30 * time.Second, wantCalls: 1},
+		{name: "interval elapsed", at: time.Minute, wantCalls: 2},
+		{name: "after reload", at: 70 * time.Second, reload: true, wantCalls: 3},
+		{name: "within interval of reload", at: 100 * time.Second, wantCalls: 3},
+	}
+	for _, step := range steps {
+		if step.reload {
+			service.ReloadMetrics(refreshMetrics())
+		}
+		service.refreshDue(ctx, schedule, start.Add(step.at))
+		if repo.queryCalls.Load() != step.wantCalls {
+			t.Errorf("%s: queryCalls = %d, want %d", step.name, repo.queryCalls.Load(), step.wantCalls)
+		}
+	}
+}
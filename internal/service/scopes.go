@@ -0,0 +1,53 @@
+// Limits scoped API keys to the metrics whose scopes they were granted.
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/roryirvine/vibe-personal-dashboard-backend/internal/models"
+)
+
+type scopesKey struct{}
+
+// WithScopes returns a context limited to metrics whose scopes are all among
+// granted. A context without it, as for unscoped API keys or with
+// authentication off, may read every metric.
+func WithScopes(ctx context.Context, granted []string) context.Context {
+	return context.WithValue(ctx, scopesKey{}, granted)
+}
+
+// authorize fails with ErrForbidden when ctx is limited to scopes that do
+// not cover every scope metric requires.
+func authorize(ctx context.Context, metric models.Metric) error {
+	granted, ok := ctx.Value(scopesKey{}).([]string)
+	if !ok {
+		return nil
+	}
+	for _, scope := range metric.Scopes {
+		if !slices.Contains(granted, scope) {
+			return classify(ErrForbidden, fmt.Errorf("metric %q requires scope %q", metric.Name, scope))
+		}
+	}
+	return nil
+}
+
+// authorizeBatch checks every metric of a batch before any runs, so a batch
+// naming forbidden metrics fails with all of them listed rather than with
+// whichever one the errgroup happens to report. Unknown names are left for
+// GetMetric to report.
+func (ms *MetricService) authorizeBatch(ctx context.Context, requests []models.MetricRequest) error {
+	var forbidden []string
+	for _, req := range requests {
+		metric, ok := ms.lookup(req.Name)
+		if ok && authorize(ctx, metric) != nil && !slices.Contains(forbidden, req.Name) {
+			forbidden = append(forbidden, req.Name)
+		}
+	}
+	if len(forbidden) == 0 {
+		return nil
+	}
+	return classify(ErrForbidden, fmt.Errorf("API key lacks the scopes to read metrics: %s", strings.Join(forbidden, ", ")))
+}
@@ -0,0 +1,30 @@
+// OpenTelemetry spans around metric execution.
+package service
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer uses the global provider, which records nothing until one with an
+// exporter is installed.
+var tracer = otel.Tracer("github.com/roryirvine/vibe-personal-dashboard-backend/internal/service")
+
+// startMetricSpan starts the span for one metric execution. Params are left
+// out, since their values may be sensitive.
+func startMetricSpan(ctx context.Context, op, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, op+" "+name, trace.WithAttributes(attribute.String("metric.name", name)))
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,151 @@
+// Scans SQL for "?" and ":name" placeholders and leading keywords, skipping literals and comments.
+package sqlutil
+
+import "strings"
+
+// ReplacePlaceholders calls replace for each "?" placeholder in query, with
+// n counting from 1, and substitutes its result. Question marks inside
+// string literals, quoted identifiers and comments are left untouched.
+func ReplacePlaceholders(query string, replace func(n int) string) string {
+	return rewrite(query, replace, nil)
+}
+
+// CountPlaceholders returns the number of "?" placeholders in query, using
+// the same rules as ReplacePlaceholders.
+func CountPlaceholders(query string) int {
+	count := 0
+	rewrite(query, func(n int) string {
+		count = n
+		return "?"
+	}, nil)
+	return count
+}
+
+// ParseNamed rewrites each ":name" placeholder in query as "?" and returns
+// the names in order of appearance, repeating any name used more than once.
+// PostgreSQL "::type" casts are not placeholders.
+func ParseNamed(query string) (string, []string) {
+	var names []string
+	rewritten := rewrite(query, nil, func(name string) string {
+		names = append(names, name)
+		return "?"
+	})
+	return rewritten, names
+}
+
+// rewrite copies query, substituting positional placeholders through
+// positional and named placeholders through named. A nil function leaves
+// that kind of placeholder as written.
+func rewrite(query string, positional func(n int) string, named func(name string) string) string {
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := skipQuoted(query, i, c)
+			b.WriteString(query[i:end])
+			i = end - 1
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			b.WriteString(query[i : i+end])
+			i += end - 1
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+			b.WriteString(query[i : i+end])
+			i += end - 1
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			b.WriteString("::")
+			i++
+		case c == ':' && i+1 < len(query) && isIdentStart(query[i+1]):
+			end := i + 2
+			for end < len(query) && isIdentChar(query[end]) {
+				end++
+			}
+			if named != nil {
+				b.WriteString(named(query[i+1 : end]))
+			} else {
+				b.WriteString(query[i:end])
+			}
+			i = end - 1
+		case c == '?':
+			n++
+			if positional != nil {
+				b.WriteString(positional(n))
+			} else {
+				b.WriteByte(c)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String()
+}
+
+// skipQuoted returns the index just past the quoted section starting at
+// start. A doubled quote character is treated as an escaped quote.
+func skipQuoted(query string, start int, quote byte) int {
+	for i := start + 1; i < len(query); i++ {
+		if query[i] != quote {
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(query)
+}
+
+// FirstKeyword returns the first word of query in upper case, skipping
+// leading whitespace, comments and opening parentheses. It returns "" when
+// the query contains no word.
+func FirstKeyword(query string) string {
+	i := 0
+	for i < len(query) {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '(':
+			i++
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return ""
+			}
+			i += end + 1
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return ""
+			}
+			i += end + 4
+		default:
+			start := i
+			for i < len(query) && isIdentChar(query[i]) {
+				i++
+			}
+			return strings.ToUpper(query[start:i])
+		}
+	}
+	return ""
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,111 @@
+package sqlutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCountPlaceholders(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{name: "none", query: "SELECT COUNT(*) FROM users", want: 0},
+		{name: "one", query: "SELECT name FROM users WHERE id = ?", want: 1},
+		{name: "several", query: "SELECT * FROM t WHERE a = ? AND b > ? LIMIT ?", want: 3},
+		{name: "in string literal", query: "SELECT '?' FROM t WHERE id = ?", want: 1},
+		{name: "escaped quote in literal", query: "SELECT 'it''s ?' FROM t WHERE id = ?", want: 1},
+		{name: "in quoted identifier", query: `SELECT "what?" FROM t`, want: 0},
+		{name: "in backtick identifier", query: "SELECT `what?` FROM t WHERE id = ?", want: 1},
+		{name: "in comments", query: "SELECT id -- why?\nFROM t /* really? */ WHERE id = ?", want: 1},
+		{name: "unterminated literal", query: "SELECT 'oops ? FROM t", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CountPlaceholders(tt.query); got != tt.want {
+				t.Errorf("CountPlaceholders(%q) = %d, want %d", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNamed(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantQuery string
+		wantNames []string
+	}{
+		{
+			name:      "no named placeholders",
+			query:     "SELECT * FROM t WHERE id = ?",
+			wantQuery: "SELECT * FROM t WHERE id = ?",
+		},
+		{
+			name:      "in order of appearance",
+			query:     "SELECT * FROM t WHERE created >= :end_date - 7 AND created < :start_date",
+			wantQuery: "SELECT * FROM t WHERE created >= ? - 7 AND created < ?",
+			wantNames: []string{"end_date", "start_date"},
+		},
+		{
+			name:      "repeated name",
+			query:     "SELECT :day, COUNT(*) FROM t WHERE date(created) = :day",
+			wantQuery: "SELECT ?, COUNT(*) FROM t WHERE date(created) = ?",
+			wantNames: []string{"day", "day"},
+		},
+		{
+			name:      "postgres cast is not a placeholder",
+			query:     "SELECT created::date FROM t WHERE id = :id",
+			wantQuery: "SELECT created::date FROM t WHERE id = ?",
+			wantNames: []string{"id"},
+		},
+		{
+			name:      "literals and comments are untouched",
+			query:     "SELECT '12:30', \":col\" -- :note\nFROM t /* :other */ WHERE id = :id",
+			wantQuery: "SELECT '12:30', \":col\" -- :note\nFROM t /* :other */ WHERE id = ?",
+			wantNames: []string{"id"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotQuery, gotNames := ParseNamed(tt.query)
+			if gotQuery != tt.wantQuery {
+				t.Errorf("ParseNamed() query = %q, want %q", gotQuery, tt.wantQuery)
+			}
+			if !reflect.DeepEqual(gotNames, tt.wantNames) {
+				t.Errorf("ParseNamed() names = %q, want %q", gotNames, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestFirstKeyword(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "select", query: "SELECT 1", want: "SELECT"},
+		{name: "lower case", query: "select 1", want: "SELECT"},
+		{name: "leading whitespace", query: "\n\t  with x AS (SELECT 1) SELECT * FROM x", want: "WITH"},
+		{name: "line comment", query: "-- daily count\nSELECT 1", want: "SELECT"},
+		{name: "recursive CTE after comments", query: "/* org chart */\n-- walks down from the root\n  WITH RECURSIVE tree(id) AS (SELECT 1 UNION ALL SELECT id + 1 FROM tree) SELECT * FROM tree", want: "WITH"},
+		{name: "block comment", query: "/* DELETE */ SELECT 1", want: "SELECT"},
+		{name: "parenthesized", query: "(SELECT 1) UNION (SELECT 2)", want: "SELECT"},
+		{name: "delete", query: "DELETE FROM users", want: "DELETE"},
+		{name: "only comment", query: "-- nothing here", want: ""},
+		{name: "unterminated block comment", query: "/* SELECT 1", want: ""},
+		{name: "empty", query: "   ", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FirstKeyword(tt.query); got != tt.want {
+				t.Errorf("FirstKeyword(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
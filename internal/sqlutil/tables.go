@@ -0,0 +1,99 @@
+// Finds schema qualifiers on the tables a query reads, skipping literals and comments.
+package sqlutil
+
+import "strings"
+
+// token is a word, quoted identifier or single punctuation character of a
+// query. String literals and comments produce no tokens.
+type token struct {
+	text  string
+	ident bool
+}
+
+// SchemaQualifiers returns the schemas named in "schema.table" references
+// directly after FROM or JOIN, and after commas in a FROM list, in order of
+// first appearance. It is a scan rather than a parse, so references it
+// cannot recognise are left out rather than guessed at.
+func SchemaQualifiers(query string) []string {
+	tokens := tokenize(query)
+	at := func(i int) token {
+		if i < len(tokens) {
+			return tokens[i]
+		}
+		return token{}
+	}
+
+	var schemas []string
+	seen := make(map[string]bool)
+	for i, tok := range tokens {
+		if !tok.ident || !strings.EqualFold(tok.text, "FROM") && !strings.EqualFold(tok.text, "JOIN") {
+			continue
+		}
+
+		j := i + 1
+		for at(j).ident {
+			if at(j+1).text == "." && at(j+2).ident {
+				if schema := at(j).text; !seen[strings.ToLower(schema)] {
+					seen[strings.ToLower(schema)] = true
+					schemas = append(schemas, schema)
+				}
+				j += 2
+			}
+			j++
+
+			// An optional alias, with or without AS, may sit between a
+			// table and the comma that lists the next one.
+			if at(j).ident && strings.EqualFold(at(j).text, "AS") {
+				j++
+			}
+			if at(j).ident {
+				j++
+			}
+			if at(j).text != "," {
+				break
+			}
+			j++
+		}
+	}
+	return schemas
+}
+
+// tokenize splits query into tokens, unquoting quoted identifiers.
+func tokenize(query string) []token {
+	var tokens []token
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			i = skipQuoted(query, i, c) - 1
+		case c == '"' || c == '`':
+			end := skipQuoted(query, i, c)
+			text := strings.Trim(query[i:end], string(c))
+			tokens = append(tokens, token{text: text, ident: true})
+			i = end - 1
+		case c == '-' && i+1 < len(query) && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return tokens
+			}
+			i += end
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 3
+		case isIdentChar(c):
+			end := i + 1
+			for end < len(query) && isIdentChar(query[end]) {
+				end++
+			}
+			tokens = append(tokens, token{text: query[i:end], ident: isIdentStart(c)})
+			i = end - 1
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		default:
+			tokens = append(tokens, token{text: string(c)})
+		}
+	}
+	return tokens
+}
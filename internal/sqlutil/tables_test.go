@@ -0,0 +1,33 @@
+package sqlutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaQualifiers(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "unqualified", query: "SELECT COUNT(*) FROM events", want: nil},
+		{name: "from", query: "SELECT COUNT(*) FROM analytics.events", want: []string{"analytics"}},
+		{name: "join", query: "SELECT u.name FROM users u JOIN logs.visits v ON v.user_id = u.id", want: []string{"logs"}},
+		{name: "from list", query: "SELECT * FROM a.x AS ax, b.y by_alias, z WHERE ax.id = by_alias.id", want: []string{"a", "b"}},
+		{name: "repeated", query: "SELECT * FROM a.x JOIN A.y ON x.id = y.id", want: []string{"a"}},
+		{name: "quoted", query: `SELECT * FROM "analytcs"."events"`, want: []string{"analytcs"}},
+		{name: "column qualifiers ignored", query: "SELECT e.id FROM events e WHERE e.day > ?", want: nil},
+		{name: "subquery", query: "SELECT * FROM (SELECT id FROM logs.visits) v", want: []string{"logs"}},
+		{name: "in string literal", query: "SELECT 'FROM fake.table' FROM events", want: nil},
+		{name: "in comments", query: "SELECT 1 -- FROM fake.table\nFROM events /* JOIN other.t */", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SchemaQualifiers(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SchemaQualifiers(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+// Build information set at link time with -ldflags "-X ...".
+package version
+
+// These are overridden at build time, for example:
+//
+//	go build -ldflags "-X github.com/roryirvine/vibe-personal-dashboard-backend/internal/version.Version=v1.2.0"
+//
+// They stay "dev" in builds that do not set them, such as go run.
+var (
+	Version = "dev"
+	Commit  = "dev"
+	Built   = "dev"
+)
+
+// Info is the build information reported by GET /version.
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Built   string `json:"built"`
+}
+
+// Get returns the build information of the running binary.
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, Built: Built}
+}